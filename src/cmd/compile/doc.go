@@ -71,6 +71,15 @@ Flags:
 	-installsuffix suffix
 		Look for packages in $GOROOT/pkg/$GOOS_$GOARCH_suffix
 		instead of $GOROOT/pkg/$GOOS_$GOARCH.
+	-json version,dir
+		Write optimization decisions as JSON to the directory dir,
+		which must be absolute or a file:// URL. Version 0 writes
+		LSP diagnostics per source file, for editors. Version 1 writes
+		one report per package, covering heap escapes with their
+		reasons, inlining decisions with costs, remaining bounds and
+		nil checks, and devirtualized calls; use it with
+		go build -gcflags=all=-json=1,dir to report on a whole build.
+		The format is described in cmd/compile/internal/logopt.
 	-l
 		Disable inlining.
 	-lang version
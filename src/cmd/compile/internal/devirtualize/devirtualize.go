@@ -12,8 +12,11 @@
 package devirtualize
 
 import (
+	"fmt"
+
 	"cmd/compile/internal/base"
 	"cmd/compile/internal/ir"
+	"cmd/compile/internal/logopt"
 	"cmd/compile/internal/typecheck"
 	"cmd/compile/internal/types"
 )
@@ -120,6 +123,10 @@ func staticCall(call *ir.CallExpr) {
 		if base.Flag.LowerM != 0 {
 			base.WarnfAt(call.Pos(), "devirtualizing %v to %v", sel, typ)
 		}
+		if logopt.Enabled() {
+			logopt.LogOpt(call.Pos(), "devirtualizedCall", "devirtualize", ir.FuncName(ir.CurFunc), fmt.Sprintf("%v.%v", typ, sel.Sel),
+				logopt.Arg{Name: "pgo", Value: false})
+		}
 		call.SetOp(ir.OCALLMETH)
 		call.X = x
 	case ir.ODOTINTER:
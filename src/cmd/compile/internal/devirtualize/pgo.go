@@ -10,8 +10,11 @@ import (
 	"cmd/compile/internal/ir"
 	"cmd/compile/internal/logopt"
 	"cmd/compile/internal/pgo"
+	"cmd/compile/internal/reflectdata"
 	"cmd/compile/internal/typecheck"
 	"cmd/compile/internal/types"
+	"cmd/internal/obj"
+	"cmd/internal/src"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -78,6 +81,27 @@ type CallStat struct {
 //		}
 //	}
 //
+// Calls of function values are similarly devirtualized to the hottest
+// concrete function:
+//
+//	type AddFunc func(a, b int) int
+//
+//	func Add(a, b int) int { return a + b }
+//
+//	func foo(f AddFunc) int {
+//		return f(1, 2)
+//	}
+//
+// to:
+//
+//	func foo(f AddFunc) int {
+//		if internal/abi.FuncPCABIInternal(f) == internal/abi.FuncPCABIInternal(Add) {
+//			return Add(1, 2)
+//		} else {
+//			return f(1, 2)
+//		}
+//	}
+//
 // The primary benefit of this transformation is enabling inlining of the
 // direct call.
 func ProfileGuided(fn *ir.Func, p *pgo.Profile) {
@@ -125,7 +149,13 @@ func ProfileGuided(fn *ir.Func, p *pgo.Profile) {
 			}
 		}
 
-		if call.Op() != ir.OCALLINTER {
+		switch call.Op() {
+		case ir.OCALLINTER:
+		case ir.OCALLFUNC:
+			if base.Debug.PGODevirtualize < 2 || pgo.DirectCallee(call.X) != nil {
+				return n
+			}
+		default:
 			return n
 		}
 
@@ -140,19 +170,21 @@ func ProfileGuided(fn *ir.Func, p *pgo.Profile) {
 			return n
 		}
 
-		// Bail if we do not have a hot callee.
-		callee, weight := findHotConcreteCallee(p, fn, call)
-		if callee == nil {
-			return n
+		var newNode ir.Node
+		var callee *ir.Func
+		var weight int64
+		if call.Op() == ir.OCALLINTER {
+			newNode, callee, weight = maybeDevirtualizeInterfaceCall(p, fn, call)
+		} else {
+			newNode, callee, weight = maybeDevirtualizeFunctionCall(p, fn, call)
 		}
-		// Bail if we do not have a Type node for the hot callee.
-		ctyp := methodRecvType(callee)
-		if ctyp == nil {
+		if newNode == nil {
 			return n
 		}
-		// Bail if we know for sure it won't inline.
-		if !shouldPGODevirt(callee) {
-			return n
+
+		if logopt.Enabled() {
+			logopt.LogOpt(call.Pos(), "devirtualizedCall", "pgo-devirtualize", ir.FuncName(fn), ir.PkgFuncName(callee),
+				logopt.Arg{Name: "pgo", Value: true}, logopt.Arg{Name: "weight", Value: weight})
 		}
 
 		if stat != nil {
@@ -160,12 +192,51 @@ func ProfileGuided(fn *ir.Func, p *pgo.Profile) {
 			stat.DevirtualizedWeight = weight
 		}
 
-		return rewriteCondCall(call, fn, callee, ctyp)
+		return newNode
 	}
 
 	ir.EditChildren(fn, edit)
 }
 
+// maybeDevirtualizeInterfaceCall returns a node to replace the interface call
+// with, or nil if the call should not be devirtualized. If devirtualized, it
+// also returns the callee and its edge weight.
+func maybeDevirtualizeInterfaceCall(p *pgo.Profile, fn *ir.Func, call *ir.CallExpr) (ir.Node, *ir.Func, int64) {
+	// Bail if we do not have a hot callee.
+	callee, weight := findHotConcreteInterfaceCallee(p, fn, call)
+	if callee == nil {
+		return nil, nil, 0
+	}
+	// Bail if we do not have a Type node for the hot callee.
+	ctyp := methodRecvType(callee)
+	if ctyp == nil {
+		return nil, nil, 0
+	}
+	// Bail if we know for sure it won't inline.
+	if !shouldPGODevirt(callee) {
+		return nil, nil, 0
+	}
+
+	return rewriteInterfaceCall(call, fn, callee, ctyp), callee, weight
+}
+
+// maybeDevirtualizeFunctionCall returns a node to replace the indirect
+// function call with, or nil if the call should not be devirtualized. If
+// devirtualized, it also returns the callee and its edge weight.
+func maybeDevirtualizeFunctionCall(p *pgo.Profile, fn *ir.Func, call *ir.CallExpr) (ir.Node, *ir.Func, int64) {
+	// Bail if we do not have a hot callee.
+	callee, weight := findHotConcreteFunctionCallee(p, fn, call)
+	if callee == nil {
+		return nil, nil, 0
+	}
+	// Bail if we know for sure it won't inline.
+	if !shouldPGODevirt(callee) {
+		return nil, nil, 0
+	}
+
+	return rewriteFunctionCall(call, fn, callee), callee, weight
+}
+
 // shouldPGODevirt checks if we should perform PGO devirtualization to the
 // target function.
 //
@@ -262,11 +333,11 @@ func constructCallStat(p *pgo.Profile, fn *ir.Func, name string, call *ir.CallEx
 	return &stat
 }
 
-// rewriteCondCall devirtualizes the given call using a direct method call to
-// concretetyp.
-func rewriteCondCall(call *ir.CallExpr, curfn, callee *ir.Func, concretetyp *types.Type) ir.Node {
+// rewriteInterfaceCall devirtualizes the given interface call using a direct
+// method call to concretetyp.
+func rewriteInterfaceCall(call *ir.CallExpr, curfn, callee *ir.Func, concretetyp *types.Type) ir.Node {
 	if base.Flag.LowerM != 0 {
-		fmt.Printf("%v: PGO devirtualizing %v to %v\n", ir.Line(call), call.X, callee)
+		fmt.Printf("%v: PGO devirtualizing interface call %v to %v\n", ir.Line(call), call.X, callee)
 	}
 
 	// We generate an OINCALL of:
@@ -297,46 +368,15 @@ func rewriteCondCall(call *ir.CallExpr, curfn, callee *ir.Func, concretetyp *typ
 	// making it less like to inline. We may want to compensate for this
 	// somehow.
 
-	var retvars []ir.Node
-
-	sig := call.X.Type()
-
-	for _, ret := range sig.Results().FieldSlice() {
-		retvars = append(retvars, typecheck.Temp(ret.Type))
-	}
-
 	sel := call.X.(*ir.SelectorExpr)
 	method := sel.Sel
 	pos := call.Pos()
 	init := ir.TakeInit(call)
 
-	// Evaluate receiver and argument expressions. The receiver is used
-	// twice but we don't want to cause side effects twice. The arguments
-	// are used in two different calls and we can't trivially copy them.
-	//
-	// recv must be first in the assignment list as its side effects must
-	// be ordered before argument side effects.
-	var lhs, rhs []ir.Node
-	recv := typecheck.Temp(sel.X.Type())
-	lhs = append(lhs, recv)
-	rhs = append(rhs, sel.X)
-
-	// Move arguments to assignments prior to the if statement. We cannot
-	// simply copy the args' IR, as some IR constructs cannot be copied,
-	// such as labels (possible in InlinedCall nodes).
-	args := call.Args.Take()
-	for _, arg := range args {
-		argvar := typecheck.Temp(arg.Type())
-
-		lhs = append(lhs, argvar)
-		rhs = append(rhs, arg)
-	}
-
-	asList := ir.NewAssignListStmt(pos, ir.OAS2, lhs, rhs)
-	init.Append(typecheck.Stmt(asList))
+	recv, args := copyInputs(pos, sel.X, call.Args.Take(), &init)
 
 	// Copy slice so edits in one location don't affect another.
-	argvars := append([]ir.Node(nil), lhs[1:]...)
+	argvars := append([]ir.Node(nil), args...)
 	call.Args = argvars
 
 	tmpnode := typecheck.Temp(concretetyp)
@@ -352,38 +392,151 @@ func rewriteCondCall(call *ir.CallExpr, curfn, callee *ir.Func, concretetyp *typ
 	argvars = append([]ir.Node(nil), argvars...)
 	concreteCall := typecheck.Call(pos, concreteCallee, argvars, call.IsDDD)
 
+	res := condCall(pos, tmpok, concreteCall, call, init)
+
+	if base.Debug.PGODebug >= 3 {
+		fmt.Printf("PGO devirtualizing interface call to %+v. After: %+v\n", concretetyp, res)
+	}
+
+	return res
+}
+
+// rewriteFunctionCall devirtualizes the given indirect function call using a
+// direct call to callee.
+func rewriteFunctionCall(call *ir.CallExpr, curfn, callee *ir.Func) ir.Node {
+	if base.Flag.LowerM != 0 {
+		fmt.Printf("%v: PGO devirtualizing function call %v to %v\n", ir.Line(call), call.X, callee)
+	}
+
+	// We generate an OINCALL of:
+	//
+	// var fn FuncType
+	//
+	// var arg1 A1
+	// var argN AN
+	//
+	// var ret1 R1
+	// var retN RN
+	//
+	// fn, arg1, argN = fn expr, arg1 expr, argN expr
+	//
+	// fnPC := internal/abi.FuncPCABIInternal(fn)
+	// concretePC := internal/abi.FuncPCABIInternal(concrete)
+	//
+	// if fnPC == concretePC {
+	//   ret1, retN = concrete(arg1, ... argN)
+	// } else {
+	//   ret1, retN = fn(arg1, ... argN)
+	// }
+	//
+	// OINCALL retvars: ret1, ... retN
+	//
+	// callee is never a closure, so the direct call does not need the
+	// closure context of fn.
+
+	pos := call.Pos()
+	init := ir.TakeInit(call)
+
+	fn, args := copyInputs(pos, call.X, call.Args.Take(), &init)
+
+	call.X = fn
+	// Copy slice so edits in one location don't affect another.
+	argvars := append([]ir.Node(nil), args...)
+	call.Args = argvars
+
+	// The conversion of fn to an interface is only used to extract its
+	// data word, but walk still needs its type word.
+	conv := ir.NewConvExpr(pos, ir.OCONV, types.Types[types.TINTER], fn)
+	conv.TypeWord = reflectdata.TypePtrAt(pos, fn.Type())
+	fnIface := typecheck.Expr(conv)
+	calleeIface := typecheck.Expr(ir.NewConvExpr(pos, ir.OCONV, types.Types[types.TINTER], callee.Nname))
+
+	fnPC := ir.FuncPC(pos, fnIface, obj.ABIInternal)
+	concretePC := ir.FuncPC(pos, calleeIface, obj.ABIInternal)
+
+	pcEq := typecheck.Expr(ir.NewBinaryExpr(pos, ir.OEQ, fnPC, concretePC))
+
+	// Copy slice so edits in one location don't affect another.
+	argvars = append([]ir.Node(nil), argvars...)
+	concreteCall := typecheck.Call(pos, callee.Nname, argvars, call.IsDDD)
+
+	res := condCall(pos, pcEq, concreteCall, call, init)
+
+	if base.Debug.PGODebug >= 3 {
+		fmt.Printf("PGO devirtualizing function call to %+v. After: %+v\n", ir.FuncName(callee), res)
+	}
+
+	return res
+}
+
+// copyInputs evaluates fn and args into temporaries, appending the
+// assignments to init, and returns the temporaries.
+//
+// The function (or receiver) is used twice but we don't want to cause side
+// effects twice. The arguments are used in two different calls and we can't
+// trivially copy them; some IR constructs cannot be copied, such as labels
+// (possible in InlinedCall nodes).
+func copyInputs(pos src.XPos, fn ir.Node, args []ir.Node, init *ir.Nodes) (ir.Node, []ir.Node) {
+	// fn must be first in the assignment list as its side effects must be
+	// ordered before argument side effects.
+	var lhs, rhs []ir.Node
+	fnvar := typecheck.Temp(fn.Type())
+	lhs = append(lhs, fnvar)
+	rhs = append(rhs, fn)
+
+	for _, arg := range args {
+		argvar := typecheck.Temp(arg.Type())
+
+		lhs = append(lhs, argvar)
+		rhs = append(rhs, arg)
+	}
+
+	asList := ir.NewAssignListStmt(pos, ir.OAS2, lhs, rhs)
+	init.Append(typecheck.Stmt(asList))
+
+	return fnvar, lhs[1:]
+}
+
+// condCall returns an ir.InlinedCallExpr that performs a call to thenCall if
+// cond is true and elseCall if cond is false. The return variables of the
+// InlinedCallExpr evaluate to the return values from the call.
+func condCall(pos src.XPos, cond, thenCall ir.Node, elseCall *ir.CallExpr, init ir.Nodes) *ir.InlinedCallExpr {
+	var retvars []ir.Node
+
+	sig := elseCall.X.Type()
+
+	for _, ret := range sig.Results().FieldSlice() {
+		retvars = append(retvars, typecheck.Temp(ret.Type))
+	}
+
 	var thenBlock, elseBlock ir.Nodes
 	if len(retvars) == 0 {
-		thenBlock.Append(concreteCall)
-		elseBlock.Append(call)
+		thenBlock.Append(thenCall)
+		elseBlock.Append(elseCall)
 	} else {
 		// Copy slice so edits in one location don't affect another.
 		thenRet := append([]ir.Node(nil), retvars...)
-		thenAsList := ir.NewAssignListStmt(pos, ir.OAS2, thenRet, []ir.Node{concreteCall})
+		thenAsList := ir.NewAssignListStmt(pos, ir.OAS2, thenRet, []ir.Node{thenCall})
 		thenBlock.Append(typecheck.Stmt(thenAsList))
 
 		elseRet := append([]ir.Node(nil), retvars...)
-		elseAsList := ir.NewAssignListStmt(pos, ir.OAS2, elseRet, []ir.Node{call})
+		elseAsList := ir.NewAssignListStmt(pos, ir.OAS2, elseRet, []ir.Node{elseCall})
 		elseBlock.Append(typecheck.Stmt(elseAsList))
 	}
 
-	cond := ir.NewIfStmt(pos, nil, nil, nil)
-	cond.SetInit(init)
-	cond.Cond = tmpok
-	cond.Body = thenBlock
-	cond.Else = elseBlock
-	cond.Likely = true
+	nif := ir.NewIfStmt(pos, nil, nil, nil)
+	nif.SetInit(init)
+	nif.Cond = cond
+	nif.Body = thenBlock
+	nif.Else = elseBlock
+	nif.Likely = true
 
-	body := []ir.Node{typecheck.Stmt(cond)}
+	body := []ir.Node{typecheck.Stmt(nif)}
 
 	res := ir.NewInlinedCallExpr(pos, body, retvars)
-	res.SetType(call.Type())
+	res.SetType(elseCall.Type())
 	res.SetTypecheck(1)
 
-	if base.Debug.PGODebug >= 3 {
-		fmt.Printf("PGO devirtualizing call to %+v. After: %+v\n", concretetyp, res)
-	}
-
 	return res
 }
 
@@ -412,15 +565,15 @@ func interfaceCallRecvTypeAndMethod(call *ir.CallExpr) (*types.Type, *types.Sym)
 	return sel.X.Type(), sel.Sel
 }
 
-// findHotConcreteCallee returns the *ir.Func of the hottest callee of an
-// indirect call, if available, and its edge weight.
-func findHotConcreteCallee(p *pgo.Profile, caller *ir.Func, call *ir.CallExpr) (*ir.Func, int64) {
+// findHotConcreteCallee returns the *ir.Func of the hottest callee of a call,
+// if available, and its edge weight. extraFn can perform additional
+// applicability checks on each candidate edge. If extraFn returns false,
+// candidate will not be considered a valid callee candidate.
+func findHotConcreteCallee(p *pgo.Profile, caller *ir.Func, call *ir.CallExpr, extraFn func(callerName string, callOffset int, candidate *pgo.IREdge) bool) (*ir.Func, int64) {
 	callerName := ir.LinkFuncName(caller)
 	callerNode := p.WeightedCG.IRNodes[callerName]
 	callOffset := pgo.NodeLineOffset(call, caller)
 
-	inter, method := interfaceCallRecvTypeAndMethod(call)
-
 	var hottest *pgo.IREdge
 
 	// Returns true if e is hotter than hottest.
@@ -471,7 +624,8 @@ func findHotConcreteCallee(p *pgo.Profile, caller *ir.Func, call *ir.CallExpr) (
 			// Destination isn't visible from this package
 			// compilation.
 			//
-			// We must assume it implements the interface.
+			// We must assume it implements the interface or has
+			// the function type.
 			//
 			// We still record this as the hottest callee so far
 			// because we only want to return the #1 hottest
@@ -484,14 +638,42 @@ func findHotConcreteCallee(p *pgo.Profile, caller *ir.Func, call *ir.CallExpr) (
 			continue
 		}
 
+		if extraFn != nil && !extraFn(callerName, callOffset, e) {
+			continue
+		}
+
+		if base.Debug.PGODebug >= 2 {
+			fmt.Printf("%v: edge %s:%d -> %s (weight %d): hottest so far\n", ir.Line(call), callerName, callOffset, e.Dst.Name(), e.Weight)
+		}
+		hottest = e
+	}
+
+	if hottest == nil {
+		if base.Debug.PGODebug >= 2 {
+			fmt.Printf("%v: call %s:%d: no hot callee\n", ir.Line(call), callerName, callOffset)
+		}
+		return nil, 0
+	}
+
+	if base.Debug.PGODebug >= 2 {
+		fmt.Printf("%v call %s:%d: hottest callee %s (weight %d)\n", ir.Line(call), callerName, callOffset, hottest.Dst.Name(), hottest.Weight)
+	}
+	return hottest.Dst.AST, hottest.Weight
+}
+
+// findHotConcreteInterfaceCallee returns the *ir.Func of the hottest callee of
+// an interface call, if available, and its edge weight.
+func findHotConcreteInterfaceCallee(p *pgo.Profile, caller *ir.Func, call *ir.CallExpr) (*ir.Func, int64) {
+	inter, method := interfaceCallRecvTypeAndMethod(call)
+
+	return findHotConcreteCallee(p, caller, call, func(callerName string, callOffset int, e *pgo.IREdge) bool {
 		ctyp := methodRecvType(e.Dst.AST)
 		if ctyp == nil {
 			// Not a method.
-			// TODO(prattmic): Support non-interface indirect calls.
 			if base.Debug.PGODebug >= 2 {
 				fmt.Printf("%v: edge %s:%d -> %s (weight %d): callee not a method\n", ir.Line(call), callerName, callOffset, e.Dst.Name(), e.Weight)
 			}
-			continue
+			return false
 		}
 
 		// If ctyp doesn't implement inter it is most likely from a
@@ -510,7 +692,7 @@ func findHotConcreteCallee(p *pgo.Profile, caller *ir.Func, call *ir.CallExpr) (
 				why := typecheck.ImplementsExplain(ctyp, inter)
 				fmt.Printf("%v: edge %s:%d -> %s (weight %d): %v doesn't implement %v (%s)\n", ir.Line(call), callerName, callOffset, e.Dst.Name(), e.Weight, ctyp, inter, why)
 			}
-			continue
+			return false
 		}
 
 		// If the method name is different it is most likely from a
@@ -519,24 +701,52 @@ func findHotConcreteCallee(p *pgo.Profile, caller *ir.Func, call *ir.CallExpr) (
 			if base.Debug.PGODebug >= 2 {
 				fmt.Printf("%v: edge %s:%d -> %s (weight %d): callee is a different method\n", ir.Line(call), callerName, callOffset, e.Dst.Name(), e.Weight)
 			}
-			continue
+			return false
 		}
 
-		if base.Debug.PGODebug >= 2 {
-			fmt.Printf("%v: edge %s:%d -> %s (weight %d): hottest so far\n", ir.Line(call), callerName, callOffset, e.Dst.Name(), e.Weight)
+		return true
+	})
+}
+
+// findHotConcreteFunctionCallee returns the *ir.Func of the hottest callee of
+// an indirect function call, if available, and its edge weight.
+func findHotConcreteFunctionCallee(p *pgo.Profile, caller *ir.Func, call *ir.CallExpr) (*ir.Func, int64) {
+	typ := call.X.Type().Underlying()
+
+	return findHotConcreteCallee(p, caller, call, func(callerName string, callOffset int, e *pgo.IREdge) bool {
+		if methodRecvType(e.Dst.AST) != nil {
+			// Not a function.
+			// TODO: Support method values.
+			if base.Debug.PGODebug >= 2 {
+				fmt.Printf("%v: edge %s:%d -> %s (weight %d): callee is a method\n", ir.Line(call), callerName, callOffset, e.Dst.Name(), e.Weight)
+			}
+			return false
 		}
-		hottest = e
-	}
 
-	if hottest == nil {
-		if base.Debug.PGODebug >= 2 {
-			fmt.Printf("%v: call %s:%d: no hot callee\n", ir.Line(call), callerName, callOffset)
+		if e.Dst.AST.OClosure != nil {
+			// A direct call cannot pass the closure context.
+			if base.Debug.PGODebug >= 2 {
+				fmt.Printf("%v: edge %s:%d -> %s (weight %d): callee is a closure\n", ir.Line(call), callerName, callOffset, e.Dst.Name(), e.Weight)
+			}
+			return false
 		}
-		return nil, 0
-	}
 
-	if base.Debug.PGODebug >= 2 {
-		fmt.Printf("%v call %s:%d: hottest callee %s (weight %d)\n", ir.Line(call), callerName, callOffset, hottest.Dst.Name(), hottest.Weight)
-	}
-	return hottest.Dst.AST, hottest.Weight
+		if e.Dst.AST.ABI != obj.ABIInternal {
+			if base.Debug.PGODebug >= 2 {
+				fmt.Printf("%v: edge %s:%d -> %s (weight %d): callee is %v\n", ir.Line(call), callerName, callOffset, e.Dst.Name(), e.Weight, e.Dst.AST.ABI)
+			}
+			return false
+		}
+
+		// If the function type doesn't match it is most likely from a
+		// different call on the same line
+		if !types.Identical(typ, e.Dst.AST.Type()) {
+			if base.Debug.PGODebug >= 2 {
+				fmt.Printf("%v: edge %s:%d -> %s (weight %d): %v doesn't match %v\n", ir.Line(call), callerName, callOffset, e.Dst.Name(), e.Weight, e.Dst.AST.Type(), typ)
+			}
+			return false
+		}
+
+		return true
+	})
 }
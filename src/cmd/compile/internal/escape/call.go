@@ -224,7 +224,7 @@ func (e *escape) callCommon(ks []hole, call ir.Node, init *ir.Nodes, wrapper *ir
 //	defer func() { f(x1, y1) }()
 func (e *escape) goDeferStmt(n *ir.GoDeferStmt) {
 	k := e.heapHole()
-	if n.Op() == ir.ODEFER && e.loopDepth == 1 {
+	if n.Op() == ir.ODEFER && e.loopDepth == 1 && n.DeferAt == nil {
 		// Top-level defer arguments don't escape to the heap,
 		// but they do need to last until they're invoked.
 		k = e.later(e.discardHole())
@@ -240,6 +240,12 @@ func (e *escape) goDeferStmt(n *ir.GoDeferStmt) {
 	init.Append(ir.TakeInit(call)...)
 	e.stmts(*init)
 
+	if n.DeferAt != nil {
+		// The deferrangefunc token is only used to find the
+		// enclosing function's defer list.
+		e.discard(n.DeferAt)
+	}
+
 	// If the function is already a zero argument/result function call,
 	// just escape analyze it normally.
 	//
@@ -308,13 +308,16 @@ func (b *batch) finish(fns []*ir.Func) {
 				if base.Flag.LowerM != 0 {
 					base.WarnfAt(n.Pos(), "moved to heap: %v", n)
 				}
+				if logopt.Enabled() {
+					logopt.LogOpt(n.Pos(), "heap", "escape", ir.FuncName(loc.curfn), fmt.Sprintf("moved to heap: %v", n), loc.explanation)
+				}
 			} else {
 				if base.Flag.LowerM != 0 && !goDeferWrapper {
 					base.WarnfAt(n.Pos(), "%v escapes to heap", n)
 				}
 				if logopt.Enabled() {
-					var e_curfn *ir.Func // TODO(mdempsky): Fix.
-					logopt.LogOpt(n.Pos(), "escape", "escape", ir.FuncName(e_curfn))
+					logopt.LogOpt(n.Pos(), "escape", "escape", ir.FuncName(loc.curfn))
+					logopt.LogOpt(n.Pos(), "heap", "escape", ir.FuncName(loc.curfn), fmt.Sprintf("%v escapes to heap", n), loc.explanation)
 				}
 			}
 			n.SetEsc(ir.EscHeap)
@@ -82,6 +82,10 @@ type location struct {
 	captured   bool // has a closure captured this variable?
 	reassigned bool // has this variable been reassigned?
 	addrtaken  bool // has this variable's address been taken?
+
+	// explanation records why the represented variable escapes,
+	// if it does and optimization logging is enabled.
+	explanation []*logopt.LoggedOpt
 }
 
 // An edge represents an assignment edge between two Go variables.
@@ -190,8 +194,8 @@ func (b *batch) flow(k hole, src *location) {
 			}
 			explanation := b.explainFlow(pos, dst, src, k.derefs, k.notes, []*logopt.LoggedOpt{})
 			if logopt.Enabled() {
-				var e_curfn *ir.Func // TODO(mdempsky): Fix.
-				logopt.LogOpt(src.n.Pos(), "escapes", "escape", ir.FuncName(e_curfn), fmt.Sprintf("%v escapes to heap", src.n), explanation)
+				logopt.LogOpt(src.n.Pos(), "escapes", "escape", ir.FuncName(src.curfn), fmt.Sprintf("%v escapes to heap", src.n), explanation)
+				src.explanation = explanation
 			}
 
 		}
@@ -99,8 +99,7 @@ func (b *batch) walkOne(root *location, walkgen uint32, enqueue func(*location))
 					}
 					explanation := b.explainPath(root, l)
 					if logopt.Enabled() {
-						var e_curfn *ir.Func // TODO(mdempsky): Fix.
-						logopt.LogOpt(l.n.Pos(), "leak", "escape", ir.FuncName(e_curfn),
+						logopt.LogOpt(l.n.Pos(), "leak", "escape", ir.FuncName(l.curfn),
 							fmt.Sprintf("parameter %v leaks to %s with derefs=%d", l.n, b.explainLoc(root), derefs), explanation)
 					}
 				}
@@ -117,8 +116,8 @@ func (b *batch) walkOne(root *location, walkgen uint32, enqueue func(*location))
 					}
 					explanation := b.explainPath(root, l)
 					if logopt.Enabled() {
-						var e_curfn *ir.Func // TODO(mdempsky): Fix.
-						logopt.LogOpt(l.n.Pos(), "escape", "escape", ir.FuncName(e_curfn), fmt.Sprintf("%v escapes to heap", l.n), explanation)
+						logopt.LogOpt(l.n.Pos(), "escape", "escape", ir.FuncName(l.curfn), fmt.Sprintf("%v escapes to heap", l.n), explanation)
+						l.explanation = explanation
 					}
 				}
 				l.escapes = true
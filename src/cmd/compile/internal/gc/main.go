@@ -341,7 +341,7 @@ func Main(archInit func(*ssagen.ArchInfo)) {
 	}
 	base.Timer.AddEvent(fcount, "funcs")
 
-	compileFunctions()
+	compileFunctions(profile)
 
 	if base.Flag.CompilingRuntime {
 		// Write barriers are now known. Check the call graph.
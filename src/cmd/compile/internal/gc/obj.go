@@ -137,7 +137,7 @@ func dumpdata() {
 			}
 		}
 		numDecls = len(typecheck.Target.Decls)
-		compileFunctions()
+		compileFunctions(nil)
 		reflectdata.WriteRuntimeTypes()
 		if numDecls == len(typecheck.Target.Decls) {
 			break
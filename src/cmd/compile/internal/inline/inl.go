@@ -18,6 +18,12 @@
 //
 // At some point this may get another default and become switch-offable with -N.
 //
+// With GOEXPERIMENT=newinliner, functions somewhat over the budget are
+// still marked inlinable, and each call site is given a score by
+// package inlheur: the callee's cost, adjusted by properties of the
+// callee and of the call site. A call is inlined if its score is
+// within the budget.
+//
 // The -d typcheckinl flag enables early typechecking of all imported bodies,
 // which is useful to flush out bugs.
 //
@@ -29,10 +35,12 @@ package inline
 import (
 	"fmt"
 	"go/constant"
+	"internal/buildcfg"
 	"sort"
 	"strconv"
 
 	"cmd/compile/internal/base"
+	"cmd/compile/internal/inline/inlheur"
 	"cmd/compile/internal/ir"
 	"cmd/compile/internal/logopt"
 	"cmd/compile/internal/pgo"
@@ -160,12 +168,18 @@ func InlinePackage(p *pgo.Profile) {
 		p = nil
 	}
 
+	if inlheur.Enabled() {
+		inlheur.SetupScoreAdjustments()
+	}
+
 	InlineDecls(p, typecheck.Target.Decls, true)
 
 	// Perform a garbage collection of hidden closures functions that
 	// are no longer reachable from top-level functions following
 	// inlining. See #59404 and #59638 for more context.
 	garbageCollectUnreferencedHiddenClosures()
+
+	inlheur.DumpFuncProps()
 }
 
 // InlineDecls applies inlining to the given batch of declarations.
@@ -196,6 +210,14 @@ func InlineDecls(p *pgo.Profile, decls []ir.Node, doInline bool) {
 		// example).
 
 		// First compute inlinability for all functions in the SCC ...
+		if inlheur.Enabled() {
+			// ... after computing the properties used to score
+			// calls to them, which are recorded with the inline
+			// bodies ...
+			for _, n := range list {
+				inlheur.AnalyzeFunc(n)
+			}
+		}
 		for _, n := range list {
 			doCanInline(n, recursive, numfns)
 		}
@@ -315,6 +337,13 @@ func CanInline(fn *ir.Func, profile *pgo.Profile) {
 		}
 	}
 
+	// The new inliner decides call by call, using a score that can
+	// be well below the callee's cost, so let functions somewhat
+	// above the regular budget be inlinable.
+	if buildcfg.Experiment.NewInliner {
+		budget += inlheur.BudgetExpansion(inlineMaxBudget)
+	}
+
 	// At this point in the game the function we're looking at may
 	// have "stale" autos, vars that still appear in the Dcl list, but
 	// which no longer have any uses in the function body (due to
@@ -343,6 +372,9 @@ func CanInline(fn *ir.Func, profile *pgo.Profile) {
 
 		CanDelayResults: canDelayResults(fn),
 	}
+	if inlheur.Enabled() {
+		n.Func.Inl.Properties = inlheur.SerializedProps(fn)
+	}
 
 	if base.Flag.LowerM > 1 {
 		fmt.Printf("%v: can inline %v with cost %d as: %v { %v }\n", ir.Line(fn), n, budget-visitor.budget, fn.Type(), ir.Nodes(n.Func.Inl.Body))
@@ -350,7 +382,8 @@ func CanInline(fn *ir.Func, profile *pgo.Profile) {
 		fmt.Printf("%v: can inline %v\n", ir.Line(fn), n)
 	}
 	if logopt.Enabled() {
-		logopt.LogOpt(fn.Pos(), "canInlineFunction", "inline", ir.FuncName(fn), fmt.Sprintf("cost: %d", budget-visitor.budget))
+		logopt.LogOpt(fn.Pos(), "canInlineFunction", "inline", ir.FuncName(fn), fmt.Sprintf("cost: %d", budget-visitor.budget),
+			logopt.Arg{Name: "cost", Value: budget - visitor.budget})
 	}
 }
 
@@ -506,6 +539,13 @@ func (v *hairyVisitor) doNode(n ir.Node) bool {
 		var cheap bool
 		if n.X.Op() == ir.ONAME {
 			name := n.X.(*ir.Name)
+			// Defers in range-over-func loop bodies run when the
+			// function that called runtime.deferrangefunc returns,
+			// so that function must keep its own frame.
+			if name.Class == ir.PFUNC && name.Sym().Pkg == ir.Pkgs.Runtime && name.Sym().Name == "deferrangefunc" {
+				v.reason = "call to deferrangefunc"
+				return true
+			}
 			if name.Class == ir.PFUNC && types.IsRuntimePkg(name.Sym().Pkg) {
 				fn := name.Sym().Name
 				if fn == "getcallerpc" || fn == "getcallersp" {
@@ -590,8 +630,13 @@ func (v *hairyVisitor) doNode(n ir.Node) bool {
 		}
 
 		if fn := inlCallee(n.X, v.profile); fn != nil && typecheck.HaveInlineBody(fn) {
-			v.budget -= fn.Inl.Cost
-			break
+			// With the new inliner, callees over the regular
+			// budget are inlined only at call sites that score
+			// well, so charge them like any other call.
+			if !buildcfg.Experiment.NewInliner || fn.Inl.Cost <= inlineMaxBudget {
+				v.budget -= fn.Inl.Cost
+				break
+			}
 		}
 
 		// Call cost for non-leaf inlining.
@@ -829,6 +874,9 @@ func inlcopy(n ir.Node) ir.Node {
 func InlineCalls(fn *ir.Func, profile *pgo.Profile) {
 	savefn := ir.CurFunc
 	ir.CurFunc = fn
+	if inlheur.Enabled() {
+		inlheur.ScoreCalls(fn)
+	}
 	bigCaller := isBigFunc(fn)
 	if bigCaller && base.Flag.LowerM > 1 {
 		fmt.Printf("%v: function %v considered 'big'; reducing max cost of inlinees\n", ir.Line(fn), fn)
@@ -983,9 +1031,11 @@ var InlineCall = func(call *ir.CallExpr, fn *ir.Func, inlIndex int) *ir.InlinedC
 // inlineCostOK returns true if call n from caller to callee is cheap enough to
 // inline. bigCaller indicates that caller is a big function.
 //
-// If inlineCostOK returns false, it also returns the max cost that the callee
+// inlineCostOK also returns the metric compared against the max cost: the
+// callee's cost, or the call site's score under the new inliner. If
+// inlineCostOK returns false, it also returns the max cost that the callee
 // exceeded.
-func inlineCostOK(n *ir.CallExpr, caller, callee *ir.Func, bigCaller bool) (bool, int32) {
+func inlineCostOK(n *ir.CallExpr, caller, callee *ir.Func, bigCaller bool) (bool, int32, int32) {
 	maxCost := int32(inlineMaxBudget)
 	if bigCaller {
 		// We use this to restrict inlining into very big functions.
@@ -993,9 +1043,16 @@ func inlineCostOK(n *ir.CallExpr, caller, callee *ir.Func, bigCaller bool) (bool
 		maxCost = inlineBigFunctionMaxCost
 	}
 
-	if callee.Inl.Cost <= maxCost {
+	metric := callee.Inl.Cost
+	if buildcfg.Experiment.NewInliner {
+		if score, ok := inlheur.GetCallSiteScore(n); ok {
+			metric = int32(score)
+		}
+	}
+
+	if metric <= maxCost {
 		// Simple case. Function is already cheap enough.
-		return true, 0
+		return true, 0, metric
 	}
 
 	// We'll also allow inlining of hot functions below inlineHotMaxBudget,
@@ -1005,7 +1062,7 @@ func inlineCostOK(n *ir.CallExpr, caller, callee *ir.Func, bigCaller bool) (bool
 	csi := pgo.CallSiteInfo{LineOffset: lineOffset, Caller: caller}
 	if _, ok := candHotEdgeMap[csi]; !ok {
 		// Cold
-		return false, maxCost
+		return false, maxCost, metric
 	}
 
 	// Hot
@@ -1014,18 +1071,18 @@ func inlineCostOK(n *ir.CallExpr, caller, callee *ir.Func, bigCaller bool) (bool
 		if base.Debug.PGODebug > 0 {
 			fmt.Printf("hot-big check disallows inlining for call %s (cost %d) at %v in big function %s\n", ir.PkgFuncName(callee), callee.Inl.Cost, ir.Line(n), ir.PkgFuncName(caller))
 		}
-		return false, maxCost
+		return false, maxCost, metric
 	}
 
 	if callee.Inl.Cost > inlineHotMaxBudget {
-		return false, inlineHotMaxBudget
+		return false, inlineHotMaxBudget, metric
 	}
 
 	if base.Debug.PGODebug > 0 {
 		fmt.Printf("hot-budget check allows inlining for call %s (cost %d) at %v in function %s\n", ir.PkgFuncName(callee), callee.Inl.Cost, ir.Line(n), ir.PkgFuncName(caller))
 	}
 
-	return true, 0
+	return true, 0, metric
 }
 
 // If n is a OCALLFUNC node, and fn is an ONAME node for a
@@ -1045,10 +1102,18 @@ func mkinlcall(n *ir.CallExpr, fn *ir.Func, bigCaller bool, inlCalls *[]*ir.Inli
 		return n
 	}
 
-	if ok, maxCost := inlineCostOK(n, ir.CurFunc, fn, bigCaller); !ok {
+	ok, maxCost, metric := inlineCostOK(n, ir.CurFunc, fn, bigCaller)
+	if !ok {
 		if logopt.Enabled() {
-			logopt.LogOpt(n.Pos(), "cannotInlineCall", "inline", ir.FuncName(ir.CurFunc),
-				fmt.Sprintf("cost %d of %s exceeds max caller cost %d", fn.Inl.Cost, ir.PkgFuncName(fn), maxCost))
+			if metric != fn.Inl.Cost {
+				logopt.LogOpt(n.Pos(), "cannotInlineCall", "inline", ir.FuncName(ir.CurFunc),
+					fmt.Sprintf("score %d (cost %d) of %s exceeds max caller cost %d", metric, fn.Inl.Cost, ir.PkgFuncName(fn), maxCost),
+					logopt.Arg{Name: "cost", Value: fn.Inl.Cost}, logopt.Arg{Name: "score", Value: metric}, logopt.Arg{Name: "maxCost", Value: maxCost})
+			} else {
+				logopt.LogOpt(n.Pos(), "cannotInlineCall", "inline", ir.FuncName(ir.CurFunc),
+					fmt.Sprintf("cost %d of %s exceeds max caller cost %d", fn.Inl.Cost, ir.PkgFuncName(fn), maxCost),
+					logopt.Arg{Name: "cost", Value: fn.Inl.Cost}, logopt.Arg{Name: "maxCost", Value: maxCost})
+			}
 		}
 		return n
 	}
@@ -1056,7 +1121,7 @@ func mkinlcall(n *ir.CallExpr, fn *ir.Func, bigCaller bool, inlCalls *[]*ir.Inli
 	if fn == ir.CurFunc {
 		// Can't recursively inline a function into itself.
 		if logopt.Enabled() {
-			logopt.LogOpt(n.Pos(), "cannotInlineCall", "inline", fmt.Sprintf("recursive call to %s", ir.FuncName(ir.CurFunc)))
+			logopt.LogOpt(n.Pos(), "cannotInlineCall", "inline", ir.FuncName(ir.CurFunc), fmt.Sprintf("recursive call to %s", ir.FuncName(ir.CurFunc)))
 		}
 		return n
 	}
@@ -1149,6 +1214,13 @@ func mkinlcall(n *ir.CallExpr, fn *ir.Func, bigCaller bool, inlCalls *[]*ir.Inli
 	if base.Flag.LowerM != 0 {
 		fmt.Printf("%v: inlining call to %v\n", ir.Line(n), fn)
 	}
+	if logopt.Enabled() {
+		args := []interface{}{ir.PkgFuncName(fn), logopt.Arg{Name: "cost", Value: fn.Inl.Cost}}
+		if metric != fn.Inl.Cost {
+			args = append(args, logopt.Arg{Name: "score", Value: metric})
+		}
+		logopt.LogOpt(n.Pos(), "inlineCall", "inline", ir.FuncName(ir.CurFunc), args...)
+	}
 	if base.Flag.LowerM > 2 {
 		fmt.Printf("%v: Before inlining: %+v\n", ir.Line(n), n)
 	}
@@ -0,0 +1,294 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package inlheur implements the heuristics used by the inliner when
+// GOEXPERIMENT=newinliner is enabled.
+//
+// Rather than comparing the cost of a callee against a fixed budget,
+// the new inliner scores each call site. The score starts out as the
+// callee's inline cost and is then adjusted using properties of the
+// callee (see FuncProps) together with properties of the call site:
+// whether it is in a loop or on a path that leads to a panic, whether
+// constant arguments feed branches in the callee, and so on. A call
+// is inlined if its score is within the regular inlining budget, so a
+// large callee can be inlined at call sites where most of its body is
+// expected to fold away.
+//
+// Function properties are computed by AnalyzeFunc before inlining
+// begins, and call sites are scored by ScoreCalls as the inliner
+// visits each caller.
+package inlheur
+
+import (
+	"fmt"
+	"internal/buildcfg"
+	"os"
+	"sort"
+	"strings"
+
+	"cmd/compile/internal/base"
+	"cmd/compile/internal/ir"
+	"cmd/compile/internal/types"
+)
+
+// Enabled reports whether the inlining heuristics should be computed,
+// either because the new inliner is in use or because one of the
+// debugging flags that dump them was given.
+func Enabled() bool {
+	return buildcfg.Experiment.NewInliner || base.Debug.DumpInlFuncProps != "" || base.Debug.DumpInlCallSiteScores != 0
+}
+
+// fpmap holds the properties of functions analyzed or imported so far.
+var fpmap = map[*ir.Func]*FuncProps{}
+
+// analyzed records the functions passed to AnalyzeFunc, in order, for
+// -d=dumpinlfuncprops.
+var analyzed []*ir.Func
+
+// AnalyzeFunc computes the properties of fn and records them for use
+// when scoring calls to fn. Functions must be analyzed bottom-up, so
+// that the properties of local callees are already known.
+func AnalyzeFunc(fn *ir.Func) *FuncProps {
+	fp := &FuncProps{}
+	if funcNeverReturns(fn) {
+		fp.Flags |= FuncPropNeverReturns
+	}
+	fp.ParamFlags = analyzeParams(fn)
+	fp.ResultFlags = analyzeResults(fn)
+	fpmap[fn] = fp
+	if base.Debug.DumpInlFuncProps != "" {
+		analyzed = append(analyzed, fn)
+	}
+	return fp
+}
+
+// SerializedProps returns the serialized properties of fn, to be
+// stored in fn.Inl.Properties, or "" if fn was not analyzed.
+func SerializedProps(fn *ir.Func) string {
+	return fpmap[fn].SerializeToString()
+}
+
+// propsOf returns the properties of fn, if known. Properties of
+// functions from other packages are decoded from their inline bodies.
+func propsOf(fn *ir.Func) *FuncProps {
+	if fp, ok := fpmap[fn]; ok {
+		return fp
+	}
+	if fn.Inl == nil || fn.Inl.Properties == "" {
+		return nil
+	}
+	fp, err := DeserializeFromString(fn.Inl.Properties)
+	if err != nil {
+		base.Fatalf("bad properties for %v: %v", fn, err)
+	}
+	fpmap[fn] = fp
+	return fp
+}
+
+// DumpFuncProps writes the properties of every function analyzed in
+// this compilation to the file named by -d=dumpinlfuncprops, one
+// function per line.
+func DumpFuncProps() {
+	path := base.Debug.DumpInlFuncProps
+	if path == "" {
+		return
+	}
+	sort.SliceStable(analyzed, func(i, j int) bool {
+		return analyzed[i].Pos().Before(analyzed[j].Pos())
+	})
+	var sb strings.Builder
+	for _, fn := range analyzed {
+		fmt.Fprintf(&sb, "%v %v %v\n", ir.Line(fn), ir.FuncName(fn), fpmap[fn])
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		base.Fatalf("opening function props dump file %q: %v", path, err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(sb.String()); err != nil {
+		base.Fatalf("writing function props dump file %q: %v", path, err)
+	}
+}
+
+// paramNames returns the receiver and parameter names of fn, in the
+// order used by FuncProps.ParamFlags. Unnamed and blank parameters
+// have nil entries.
+func paramNames(fn *ir.Func) []*ir.Name {
+	var names []*ir.Name
+	for _, fs := range &types.RecvsParams {
+		for _, f := range fs(fn.Type()).FieldSlice() {
+			name, _ := f.Nname.(*ir.Name)
+			if name != nil && name.Sym().IsBlank() {
+				name = nil
+			}
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// staticCallee returns the function called by call, if it is known
+// statically. It follows the same rules as the inliner.
+func staticCallee(call *ir.CallExpr) *ir.Func {
+	switch fn := ir.StaticValue(call.X); fn.Op() {
+	case ir.OMETHEXPR:
+		fn := fn.(*ir.SelectorExpr)
+		n := ir.MethodExprName(fn)
+		if n == nil || !types.Identical(n.Type().Recv().Type, fn.X.Type()) {
+			return nil
+		}
+		return n.Func
+	case ir.ONAME:
+		fn := fn.(*ir.Name)
+		if fn.Class == ir.PFUNC {
+			return fn.Func
+		}
+	case ir.OCLOSURE:
+		return fn.(*ir.ClosureExpr).Func
+	}
+	return nil
+}
+
+// isExitCall reports whether call is a call to a function that is
+// known not to return.
+func isExitCall(call *ir.CallExpr) bool {
+	if call.Op() != ir.OCALLFUNC {
+		return false
+	}
+	if name, ok := call.X.(*ir.Name); ok && name.Class == ir.PFUNC {
+		s := name.Sym()
+		switch {
+		case s.Pkg.Path == "os" && s.Name == "Exit":
+			return true
+		case (types.IsRuntimePkg(s.Pkg) || s.Pkg == ir.Pkgs.Runtime) && (s.Name == "throw" || s.Name == "fatal"):
+			return true
+		}
+	}
+	if callee := staticCallee(call); callee != nil {
+		if fp := propsOf(callee); fp != nil && fp.Flags&FuncPropNeverReturns != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// funcNeverReturns reports whether every path through fn's body ends
+// without returning.
+func funcNeverReturns(fn *ir.Func) bool {
+	if len(fn.Body) == 0 {
+		return false
+	}
+	// Keep the analysis simple in the presence of gotos and labels.
+	if ir.Any(fn, func(n ir.Node) bool { return n.Op() == ir.OGOTO || n.Op() == ir.OLABEL }) {
+		return false
+	}
+	return neverReturns(fn.Body)
+}
+
+// neverReturns reports whether executing the statement list list
+// never completes normally: every path through it panics, exits, or
+// loops forever. Statements following one that never returns are
+// unreachable and ignored.
+func neverReturns(list ir.Nodes) bool {
+	for _, n := range list {
+		if stmtNeverReturns(n) {
+			return true
+		}
+		if hasBranch(ir.Nodes{n}, ir.ORETURN) {
+			return false
+		}
+	}
+	return false
+}
+
+func stmtNeverReturns(n ir.Node) bool {
+	switch n.Op() {
+	case ir.OPANIC:
+		return true
+	case ir.OCALLFUNC:
+		return isExitCall(n.(*ir.CallExpr))
+	case ir.OBLOCK:
+		return neverReturns(n.(*ir.BlockStmt).List)
+	case ir.OIF:
+		n := n.(*ir.IfStmt)
+		return neverReturns(n.Body) && neverReturns(n.Else)
+	case ir.OSWITCH:
+		n := n.(*ir.SwitchStmt)
+		hasDefault := false
+		for _, cas := range n.Cases {
+			if len(cas.List) == 0 {
+				hasDefault = true
+			}
+			if hasBranch(cas.Body, ir.OBREAK, ir.OGOTO) || !neverReturns(cas.Body) {
+				return false
+			}
+		}
+		return hasDefault
+	case ir.OFOR:
+		n := n.(*ir.ForStmt)
+		return n.Cond == nil && !hasBranch(n.Body, ir.OBREAK, ir.OGOTO, ir.ORETURN)
+	case ir.OSELECT:
+		return len(n.(*ir.SelectStmt).Cases) == 0
+	}
+	return false
+}
+
+// hasBranch reports whether list contains any of the given branch
+// statements, outside of closures.
+func hasBranch(list ir.Nodes, ops ...ir.Op) bool {
+	return ir.AnyList(list, func(n ir.Node) bool {
+		for _, op := range ops {
+			if n.Op() == op {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// foldableCond reports whether expr is built only from constants and
+// operators that the compiler evaluates at compile time when all of
+// its operands are constant, given that every remaining leaf is
+// accepted by leaf.
+func foldableCond(expr ir.Node, leaf func(ir.Node) bool) bool {
+	var visit func(n ir.Node) bool
+	visit = func(n ir.Node) bool {
+		switch n.Op() {
+		case ir.OLITERAL, ir.ONIL:
+			return true
+		case ir.ONAME:
+			if n.(*ir.Name).Class == ir.PFUNC {
+				return false
+			}
+			return leaf(n)
+		case ir.OCALLFUNC, ir.OCALLINTER:
+			return leaf(n)
+		case ir.OEQ, ir.ONE, ir.OLT, ir.OLE, ir.OGT, ir.OGE,
+			ir.OADD, ir.OSUB, ir.OMUL, ir.ODIV, ir.OMOD,
+			ir.OAND, ir.OOR, ir.OXOR, ir.OANDNOT, ir.OLSH, ir.ORSH:
+			n := n.(*ir.BinaryExpr)
+			return visit(n.X) && visit(n.Y)
+		case ir.OANDAND, ir.OOROR:
+			n := n.(*ir.LogicalExpr)
+			return visit(n.X) && visit(n.Y)
+		case ir.ONOT, ir.ONEG, ir.OPLUS, ir.OBITNOT:
+			return visit(n.(*ir.UnaryExpr).X)
+		case ir.OLEN:
+			n := n.(*ir.UnaryExpr)
+			return n.X.Type().IsString() && visit(n.X)
+		case ir.OCONV, ir.OCONVNOP:
+			n := n.(*ir.ConvExpr)
+			return !n.Type().IsInterface() && visit(n.X)
+		}
+		return false
+	}
+	return len(expr.Init()) == 0 && visit(expr)
+}
+
+// isConstArg reports whether the argument n has a value known at
+// compile time.
+func isConstArg(n ir.Node) bool {
+	n = ir.StaticValue(n)
+	return n.Op() == ir.OLITERAL || n.Op() == ir.ONIL
+}
@@ -0,0 +1,172 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package inlheur
+
+import (
+	"cmd/compile/internal/ir"
+)
+
+// paramsAnalyzer computes ParamPropBits for the parameters of a
+// function by looking for the uses that would simplify if the
+// corresponding argument were known at the call site.
+type paramsAnalyzer struct {
+	index map[*ir.Name]int // parameter name -> index in flags
+	flags []ParamPropBits
+}
+
+// analyzeParams returns the ParamPropBits for each parameter of fn,
+// receiver first.
+func analyzeParams(fn *ir.Func) []ParamPropBits {
+	names := paramNames(fn)
+	pa := &paramsAnalyzer{
+		index: make(map[*ir.Name]int),
+		flags: make([]ParamPropBits, len(names)),
+	}
+	for i, name := range names {
+		// A parameter that is assigned to (or whose address is
+		// taken) no longer carries the argument's value.
+		if name != nil && !ir.Reassigned(name) {
+			pa.index[name] = i
+		}
+	}
+	if len(pa.index) != 0 {
+		pa.visitList(fn.Body, false)
+	}
+	return pa.flags
+}
+
+// param returns the index of the parameter n refers to, or -1.
+func (pa *paramsAnalyzer) param(n ir.Node) int {
+	for n.Op() == ir.OCONVNOP {
+		n = n.(*ir.ConvExpr).X
+	}
+	if name, ok := n.(*ir.Name); ok {
+		if i, ok := pa.index[name.Canonical()]; ok {
+			return i
+		}
+	}
+	return -1
+}
+
+// mark records a use of parameter i; feeds is used for uses reached
+// unconditionally and mayFeed for nested ones.
+func (pa *paramsAnalyzer) mark(i int, nested bool, feeds, mayFeed ParamPropBits) {
+	if i < 0 {
+		return
+	}
+	if nested {
+		pa.flags[i] |= mayFeed
+	} else {
+		pa.flags[i] |= feeds
+	}
+}
+
+// cond examines a branch condition or switch tag.
+func (pa *paramsAnalyzer) cond(n ir.Node, nested bool) {
+	if n == nil {
+		return
+	}
+	p := -1
+	ok := foldableCond(n, func(leaf ir.Node) bool {
+		i := pa.param(leaf)
+		if i < 0 || (p >= 0 && p != i) {
+			return false
+		}
+		p = i
+		return true
+	})
+	if ok {
+		pa.mark(p, nested, ParamFeedsIfOrSwitch, ParamMayFeedIfOrSwitch)
+	}
+}
+
+func (pa *paramsAnalyzer) visitList(list ir.Nodes, nested bool) {
+	for _, n := range list {
+		pa.visit(n, nested)
+	}
+}
+
+func (pa *paramsAnalyzer) visit(n ir.Node, nested bool) {
+	if n == nil {
+		return
+	}
+	switch n.Op() {
+	case ir.OCLOSURE:
+		// Closures are analyzed on their own.
+		return
+
+	case ir.OIF:
+		n := n.(*ir.IfStmt)
+		pa.visitList(n.Init(), nested)
+		pa.cond(n.Cond, nested)
+		pa.visit(n.Cond, nested)
+		pa.visitList(n.Body, true)
+		pa.visitList(n.Else, true)
+		return
+
+	case ir.OSWITCH:
+		n := n.(*ir.SwitchStmt)
+		pa.visitList(n.Init(), nested)
+		if n.Tag != nil && n.Tag.Op() != ir.OTYPESW {
+			pa.cond(n.Tag, nested)
+		}
+		pa.visit(n.Tag, nested)
+		for _, cas := range n.Cases {
+			for _, x := range cas.List {
+				if n.Tag == nil {
+					pa.cond(x, nested)
+				}
+				pa.visit(x, true)
+			}
+			pa.visitList(cas.Body, true)
+		}
+		return
+
+	case ir.OFOR:
+		n := n.(*ir.ForStmt)
+		pa.visitList(n.Init(), nested)
+		pa.visit(n.Cond, nested)
+		pa.visit(n.Post, true)
+		pa.visitList(n.Body, true)
+		return
+
+	case ir.ORANGE:
+		n := n.(*ir.RangeStmt)
+		pa.visitList(n.Init(), nested)
+		pa.visit(n.X, nested)
+		pa.visitList(n.Body, true)
+		return
+
+	case ir.OSELECT:
+		n := n.(*ir.SelectStmt)
+		pa.visitList(n.Init(), nested)
+		for _, cas := range n.Cases {
+			pa.visit(cas.Comm, nested)
+			pa.visitList(cas.Body, true)
+		}
+		return
+
+	case ir.OANDAND, ir.OOROR:
+		n := n.(*ir.LogicalExpr)
+		pa.visit(n.X, nested)
+		pa.visit(n.Y, true)
+		return
+
+	case ir.OCALLINTER:
+		n := n.(*ir.CallExpr)
+		if sel, ok := n.X.(*ir.SelectorExpr); ok && sel.Op() == ir.ODOTINTER {
+			pa.mark(pa.param(sel.X), nested, ParamFeedsInterfaceMethodCall, ParamMayFeedInterfaceMethodCall)
+		}
+
+	case ir.OCALLFUNC:
+		n := n.(*ir.CallExpr)
+		pa.mark(pa.param(n.X), nested, ParamFeedsIndirectCall, ParamMayFeedIndirectCall)
+	}
+
+	ir.DoChildren(n, func(x ir.Node) bool {
+		pa.visit(x, nested)
+		return false
+	})
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package inlheur
+
+import (
+	"go/constant"
+	"go/token"
+
+	"cmd/compile/internal/ir"
+	"cmd/compile/internal/types"
+)
+
+// analyzeResults returns the ResultPropBits for each result of fn,
+// based on the values returned by its return statements.
+func analyzeResults(fn *ir.Func) []ResultPropBits {
+	nresults := fn.Type().NumResults()
+	if nresults == 0 {
+		return nil
+	}
+	flags := make([]ResultPropBits, nresults)
+
+	var returns []*ir.ReturnStmt
+	ir.VisitList(fn.Body, func(n ir.Node) {
+		if n, ok := n.(*ir.ReturnStmt); ok {
+			returns = append(returns, n)
+		}
+	})
+	if len(returns) == 0 {
+		return flags
+	}
+	for _, ret := range returns {
+		// Bare returns of named results, and "return f()" for a
+		// multi-valued f, return values we don't track.
+		if len(ret.Results) != nresults {
+			return flags
+		}
+	}
+
+	for i := range flags {
+		vals := make([]ir.Node, len(returns))
+		for j, ret := range returns {
+			vals[j] = ir.StaticValue(ret.Results[i])
+		}
+		flags[i] = resultProps(vals)
+	}
+	return flags
+}
+
+// resultProps computes the properties shared by every value in vals.
+func resultProps(vals []ir.Node) ResultPropBits {
+	first := vals[0]
+	switch first.Op() {
+	case ir.OLITERAL, ir.ONIL:
+		for _, v := range vals[1:] {
+			if !sameConstant(first, v) {
+				return ResultNoInfo
+			}
+		}
+		return ResultAlwaysSameConstant
+
+	case ir.ONAME:
+		name := first.(*ir.Name)
+		if name.Class != ir.PFUNC {
+			return ResultNoInfo
+		}
+		for _, v := range vals[1:] {
+			if v != first {
+				return ResultNoInfo
+			}
+		}
+		if name.Func != nil && name.Func.Inl != nil {
+			return ResultAlwaysSameFunc | ResultAlwaysSameInlinableFunc
+		}
+		return ResultAlwaysSameFunc
+
+	case ir.OCONVIFACE:
+		typ := first.(*ir.ConvExpr).X.Type()
+		if typ.IsInterface() {
+			return ResultNoInfo
+		}
+		for _, v := range vals[1:] {
+			if v.Op() != ir.OCONVIFACE || !types.Identical(v.(*ir.ConvExpr).X.Type(), typ) {
+				return ResultNoInfo
+			}
+		}
+		return ResultIsConcreteTypeConvertedToInterface
+	}
+	return ResultNoInfo
+}
+
+// sameConstant reports whether a and b are the same constant value.
+func sameConstant(a, b ir.Node) bool {
+	if a.Op() != b.Op() {
+		return false
+	}
+	if a.Op() == ir.ONIL {
+		return true
+	}
+	va, vb := a.Val(), b.Val()
+	if va.Kind() != vb.Kind() || va.Kind() == constant.Unknown {
+		return false
+	}
+	return constant.Compare(va, token.EQL, vb)
+}
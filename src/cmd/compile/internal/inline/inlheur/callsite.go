@@ -0,0 +1,296 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package inlheur
+
+import (
+	"strings"
+
+	"cmd/compile/internal/ir"
+)
+
+// callSite records the information about a call to an inlinable
+// function that goes into its score.
+type callSite struct {
+	callee *ir.Func
+	call   *ir.CallExpr
+	flags  CSPropBits
+
+	// resultAdj holds the adjustments earned by the way the caller
+	// uses the call's results.
+	resultAdj scoreAdjustTyp
+
+	folded int            // estimated cost of callee code folded away
+	score  int            // final score
+	mask   scoreAdjustTyp // adjustments applied to reach score
+}
+
+// CSPropBits describes the context of a call site.
+type CSPropBits uint32
+
+const (
+	// CallSiteInLoop is set for calls in the body of a loop.
+	CallSiteInLoop CSPropBits = 1 << iota
+
+	// CallSiteOnPanicPath is set for calls from which every path
+	// ends in a panic or a call to a function that never returns.
+	CallSiteOnPanicPath
+
+	// CallSiteInInitFunc is set for calls in package initialization
+	// functions.
+	CallSiteInInitFunc
+)
+
+var csPropNames = []string{
+	"CallSiteInLoop",
+	"CallSiteOnPanicPath",
+	"CallSiteInInitFunc",
+}
+
+func (b CSPropBits) String() string { return bitsString(uint32(b), csPropNames) }
+
+// resultRef identifies result idx of a call.
+type resultRef struct {
+	call *ir.CallExpr
+	idx  int
+}
+
+// callSiteAnalyzer collects the call sites of a function.
+type callSiteAnalyzer struct {
+	fn    *ir.Func
+	sites []*callSite
+
+	// multi maps the temporaries assigned by "a, b := f()" to the
+	// call results they hold.
+	multi map[*ir.Name]resultRef
+
+	// resultAdj holds the result-use adjustments for each call.
+	resultAdj map[*ir.CallExpr]scoreAdjustTyp
+}
+
+// collectCallSites returns the calls to inlinable functions in fn's
+// body, not counting calls in closures, which are scored on their own.
+func collectCallSites(fn *ir.Func) []*callSite {
+	csa := &callSiteAnalyzer{
+		fn:        fn,
+		multi:     make(map[*ir.Name]resultRef),
+		resultAdj: make(map[*ir.CallExpr]scoreAdjustTyp),
+	}
+	csa.examineResultUses()
+
+	var flags CSPropBits
+	if isInitFunc(fn) {
+		flags |= CallSiteInInitFunc
+	}
+	csa.visitList(fn.Body, flags)
+	return csa.sites
+}
+
+// isInitFunc reports whether fn is (or is a closure within) a package
+// initialization function.
+func isInitFunc(fn *ir.Func) bool {
+	name := fn.Sym().Name
+	return name == "init" || strings.HasPrefix(name, "init.")
+}
+
+// examineResultUses looks for uses of call results that would become
+// simpler if the call were inlined, and records the corresponding
+// adjustment for the call.
+func (csa *callSiteAnalyzer) examineResultUses() {
+	ir.VisitList(csa.fn.Body, func(n ir.Node) {
+		if n, ok := n.(*ir.AssignListStmt); ok && n.Op() == ir.OAS2FUNC {
+			if call, ok := n.Rhs[0].(*ir.CallExpr); ok && call.Op() == ir.OCALLFUNC {
+				for i, lhs := range n.Lhs {
+					if name, ok := lhs.(*ir.Name); ok && name.Defn == n {
+						csa.multi[name] = resultRef{call, i}
+					}
+				}
+			}
+		}
+	})
+
+	ir.VisitList(csa.fn.Body, func(n ir.Node) {
+		switch n.Op() {
+		case ir.OIF:
+			csa.condUse(n.(*ir.IfStmt).Cond)
+		case ir.OSWITCH:
+			n := n.(*ir.SwitchStmt)
+			if n.Tag == nil {
+				for _, cas := range n.Cases {
+					for _, x := range cas.List {
+						csa.condUse(x)
+					}
+				}
+			} else if n.Tag.Op() != ir.OTYPESW {
+				csa.condUse(n.Tag)
+			}
+		case ir.OCALLINTER:
+			n := n.(*ir.CallExpr)
+			if sel, ok := n.X.(*ir.SelectorExpr); ok && sel.Op() == ir.ODOTINTER {
+				if ref, fp := csa.result(sel.X); fp != nil && fp.ResultFlags[ref.idx]&ResultIsConcreteTypeConvertedToInterface != 0 {
+					csa.resultAdj[ref.call] |= returnFeedsConcreteToInterfaceCallAdj
+				}
+			}
+		case ir.OCALLFUNC:
+			n := n.(*ir.CallExpr)
+			if ref, fp := csa.result(n.X); fp != nil {
+				rf := fp.ResultFlags[ref.idx]
+				switch {
+				case rf&ResultAlwaysSameInlinableFunc != 0:
+					csa.resultAdj[ref.call] |= returnFeedsInlinableFuncToIndirectCallAdj
+				case rf&ResultAlwaysSameFunc != 0:
+					csa.resultAdj[ref.call] |= returnFeedsFuncToIndirectCallAdj
+				}
+			}
+		}
+	})
+}
+
+// condUse examines a branch condition or switch tag for call results
+// that are always the same constant.
+func (csa *callSiteAnalyzer) condUse(cond ir.Node) {
+	var refs []resultRef
+	ok := foldableCond(cond, func(leaf ir.Node) bool {
+		ref, fp := csa.result(leaf)
+		if fp == nil || fp.ResultFlags[ref.idx]&ResultAlwaysSameConstant == 0 {
+			return false
+		}
+		refs = append(refs, ref)
+		return true
+	})
+	if ok {
+		for _, ref := range refs {
+			csa.resultAdj[ref.call] |= returnFeedsConstToIfAdj
+		}
+	}
+}
+
+// result reports which call result n holds, if any, along with the
+// properties of the called function.
+func (csa *callSiteAnalyzer) result(n ir.Node) (resultRef, *FuncProps) {
+	var ref resultRef
+	switch n := ir.StaticValue(n).(type) {
+	case *ir.CallExpr:
+		if n.Op() != ir.OCALLFUNC {
+			return ref, nil
+		}
+		ref = resultRef{n, 0}
+	case *ir.Name:
+		r, ok := csa.multi[n]
+		if !ok || ir.Reassigned(n) {
+			return ref, nil
+		}
+		ref = r
+	default:
+		return ref, nil
+	}
+	callee := staticCallee(ref.call)
+	if callee == nil || callee.Inl == nil {
+		return ref, nil
+	}
+	fp := propsOf(callee)
+	if fp == nil || ref.idx >= len(fp.ResultFlags) {
+		return ref, nil
+	}
+	return ref, fp
+}
+
+// visitList visits the statements in list. flags describes the
+// context of the list; in particular, CallSiteOnPanicPath is set if
+// control reaching the end of the list leads to a panic.
+func (csa *callSiteAnalyzer) visitList(list ir.Nodes, flags CSPropBits) {
+	// Work backwards to find the statements from which every path
+	// ends in a panic: those that never return themselves, and those
+	// followed by such a statement with no way to branch around it.
+	onPanicPath := make([]bool, len(list))
+	panics := flags&CallSiteOnPanicPath != 0
+	for i := len(list) - 1; i >= 0; i-- {
+		n := list[i]
+		panics = stmtNeverReturns(n) ||
+			(panics && !hasBranch(ir.Nodes{n}, ir.ORETURN, ir.OBREAK, ir.OCONTINUE, ir.OGOTO, ir.OLABEL))
+		onPanicPath[i] = panics
+	}
+	for i, n := range list {
+		f := flags &^ CallSiteOnPanicPath
+		if onPanicPath[i] {
+			f |= CallSiteOnPanicPath
+		}
+		csa.visit(n, f)
+	}
+}
+
+func (csa *callSiteAnalyzer) visit(n ir.Node, flags CSPropBits) {
+	if n == nil {
+		return
+	}
+	switch n.Op() {
+	case ir.OCLOSURE:
+		return
+
+	case ir.OBLOCK:
+		csa.visitList(n.(*ir.BlockStmt).List, flags)
+		return
+
+	case ir.OIF:
+		n := n.(*ir.IfStmt)
+		csa.visitList(n.Init(), flags)
+		csa.visit(n.Cond, flags)
+		csa.visitList(n.Body, flags)
+		csa.visitList(n.Else, flags)
+		return
+
+	case ir.OFOR:
+		n := n.(*ir.ForStmt)
+		csa.visitList(n.Init(), flags)
+		csa.visit(n.Cond, flags|CallSiteInLoop)
+		csa.visit(n.Post, flags|CallSiteInLoop)
+		csa.visitList(n.Body, flags|CallSiteInLoop)
+		return
+
+	case ir.ORANGE:
+		n := n.(*ir.RangeStmt)
+		csa.visitList(n.Init(), flags)
+		csa.visit(n.X, flags)
+		csa.visitList(n.Body, flags|CallSiteInLoop)
+		return
+
+	case ir.OSWITCH:
+		n := n.(*ir.SwitchStmt)
+		csa.visitList(n.Init(), flags)
+		csa.visit(n.Tag, flags)
+		for _, cas := range n.Cases {
+			for _, x := range cas.List {
+				csa.visit(x, flags)
+			}
+			csa.visitList(cas.Body, flags)
+		}
+		return
+
+	case ir.OSELECT:
+		n := n.(*ir.SelectStmt)
+		csa.visitList(n.Init(), flags)
+		for _, cas := range n.Cases {
+			csa.visit(cas.Comm, flags)
+			csa.visitList(cas.Body, flags)
+		}
+		return
+	}
+
+	ir.DoChildren(n, func(x ir.Node) bool {
+		csa.visit(x, flags)
+		return false
+	})
+
+	if n.Op() == ir.OCALLFUNC {
+		call := n.(*ir.CallExpr)
+		if callee := staticCallee(call); callee != nil && callee.Inl != nil {
+			csa.sites = append(csa.sites, &callSite{
+				callee:    callee,
+				call:      call,
+				flags:     flags,
+				resultAdj: csa.resultAdj[call],
+			})
+		}
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package inlheur
+
+import (
+	"go/constant"
+	"go/token"
+
+	"cmd/compile/internal/ir"
+	"cmd/compile/internal/types"
+)
+
+// foldedCost estimates how much of callee's inline cost disappears
+// when call is inlined: the constant arguments of call are substituted
+// into the "if" conditions and "switch" tags of the callee body, and
+// the branches that become unreachable are counted.
+//
+// The estimate is made only when the callee's inline body is at hand,
+// that is, for callees in the package being compiled. It counts IR
+// nodes, and so undercounts code containing calls, which the inliner
+// charges extra for.
+func foldedCost(callee *ir.Func, call *ir.CallExpr, fp *FuncProps) int {
+	if callee.Inl == nil || len(callee.Inl.Body) == 0 {
+		return 0
+	}
+	f := &folder{consts: make(map[*ir.Name]constant.Value)}
+	for i, name := range paramNames(callee) {
+		if name == nil || fp.ParamFlags[i]&(ParamFeedsIfOrSwitch|ParamMayFeedIfOrSwitch) == 0 {
+			continue
+		}
+		if arg := ir.StaticValue(call.Args[i]); arg.Op() == ir.OLITERAL {
+			f.consts[name] = arg.Val()
+		}
+	}
+	if len(f.consts) == 0 {
+		return 0
+	}
+	return f.foldList(callee.Inl.Body)
+}
+
+// folder evaluates conditions in a callee body given the values of
+// some of its parameters.
+type folder struct {
+	consts map[*ir.Name]constant.Value
+
+	// usedParam is set by eval when the value depends on one of
+	// the parameters. Conditions that are constant regardless of the
+	// arguments are already discounted by the inline cost.
+	usedParam bool
+}
+
+// foldList returns the cost of the code in list that is found to be
+// unreachable.
+func (f *folder) foldList(list ir.Nodes) int {
+	saved := 0
+	for i, n := range list {
+		live, dead, ok := f.foldStmt(n)
+		if !ok {
+			continue
+		}
+		saved += dead + f.foldList(live)
+		// If the branch taken always leaves the function, what
+		// follows the statement is unreachable too.
+		if endsInReturn(live) {
+			saved += nodeCost(list[i+1:])
+			break
+		}
+	}
+	return saved
+}
+
+// foldStmt reports, for an "if" or "switch" statement whose outcome is
+// known, the statements that remain live and the cost of those that
+// can be removed.
+func (f *folder) foldStmt(n ir.Node) (live ir.Nodes, dead int, ok bool) {
+	f.usedParam = false
+	switch n.Op() {
+	case ir.OIF:
+		n := n.(*ir.IfStmt)
+		if len(n.Init()) != 0 {
+			return nil, 0, false
+		}
+		v, ok := f.eval(n.Cond)
+		if !ok || !f.usedParam || v.Kind() != constant.Bool {
+			return nil, 0, false
+		}
+		dead = 1 + nodeCost(ir.Nodes{n.Cond})
+		if constant.BoolVal(v) {
+			return n.Body, dead + nodeCost(n.Else), true
+		}
+		return n.Else, dead + nodeCost(n.Body), true
+
+	case ir.OSWITCH:
+		n := n.(*ir.SwitchStmt)
+		if len(n.Init()) != 0 || n.Tag == nil || n.Tag.Op() == ir.OTYPESW {
+			return nil, 0, false
+		}
+		tag, ok := f.eval(n.Tag)
+		if !ok || !f.usedParam {
+			return nil, 0, false
+		}
+		var match, def *ir.CaseClause
+		for _, cas := range n.Cases {
+			if len(cas.Body) != 0 && cas.Body[len(cas.Body)-1].Op() == ir.OFALL {
+				return nil, 0, false
+			}
+			if len(cas.List) == 0 {
+				def = cas
+				continue
+			}
+			for _, x := range cas.List {
+				if x.Op() != ir.OLITERAL {
+					return nil, 0, false
+				}
+				if match == nil && sameKind(tag, x.Val()) && constant.Compare(tag, token.EQL, x.Val()) {
+					match = cas
+				}
+			}
+		}
+		if match == nil {
+			match = def
+		}
+		dead = 1 + nodeCost(ir.Nodes{n.Tag})
+		for _, cas := range n.Cases {
+			if cas != match {
+				dead += nodeCost(cas.List) + nodeCost(cas.Body)
+			}
+		}
+		if match == nil {
+			return nil, dead, true
+		}
+		return match.Body, dead, true
+	}
+	return nil, 0, false
+}
+
+// eval evaluates the condition or switch tag n, if its value follows
+// from the known parameter values.
+func (f *folder) eval(n ir.Node) (constant.Value, bool) {
+	switch n.Op() {
+	case ir.OLITERAL:
+		return n.Val(), true
+
+	case ir.ONAME:
+		v, ok := f.consts[n.(*ir.Name).Canonical()]
+		f.usedParam = f.usedParam || ok
+		return v, ok
+
+	case ir.OCONV, ir.OCONVNOP:
+		n := n.(*ir.ConvExpr)
+		v, ok := f.eval(n.X)
+		if !ok || !sameKind(v, zeroOf(n.Type())) {
+			return nil, false
+		}
+		return v, true
+
+	case ir.ONOT:
+		v, ok := f.eval(n.(*ir.UnaryExpr).X)
+		if !ok || v.Kind() != constant.Bool {
+			return nil, false
+		}
+		return constant.MakeBool(!constant.BoolVal(v)), true
+
+	case ir.OLEN:
+		v, ok := f.eval(n.(*ir.UnaryExpr).X)
+		if !ok || v.Kind() != constant.String {
+			return nil, false
+		}
+		return constant.MakeInt64(int64(len(constant.StringVal(v)))), true
+
+	case ir.OANDAND, ir.OOROR:
+		n := n.(*ir.LogicalExpr)
+		x, ok := f.eval(n.X)
+		if !ok || x.Kind() != constant.Bool {
+			return nil, false
+		}
+		if constant.BoolVal(x) == (n.Op() == ir.OOROR) {
+			return x, true
+		}
+		y, ok := f.eval(n.Y)
+		if !ok || y.Kind() != constant.Bool {
+			return nil, false
+		}
+		return y, true
+
+	case ir.OEQ, ir.ONE, ir.OLT, ir.OLE, ir.OGT, ir.OGE:
+		n := n.(*ir.BinaryExpr)
+		x, okx := f.eval(n.X)
+		y, oky := f.eval(n.Y)
+		if !okx || !oky || !sameKind(x, y) {
+			return nil, false
+		}
+		return constant.MakeBool(constant.Compare(x, cmpTokens[n.Op()], y)), true
+
+	case ir.OADD, ir.OSUB, ir.OMUL, ir.OAND, ir.OOR, ir.OXOR, ir.OANDNOT:
+		// Arithmetic is exact here, whereas it wraps at run time;
+		// that only makes the estimate less precise.
+		n := n.(*ir.BinaryExpr)
+		x, okx := f.eval(n.X)
+		y, oky := f.eval(n.Y)
+		if !okx || !oky || x.Kind() != constant.Int || y.Kind() != constant.Int {
+			return nil, false
+		}
+		return constant.BinaryOp(x, arithTokens[n.Op()], y), true
+	}
+	return nil, false
+}
+
+var cmpTokens = map[ir.Op]token.Token{
+	ir.OEQ: token.EQL,
+	ir.ONE: token.NEQ,
+	ir.OLT: token.LSS,
+	ir.OLE: token.LEQ,
+	ir.OGT: token.GTR,
+	ir.OGE: token.GEQ,
+}
+
+var arithTokens = map[ir.Op]token.Token{
+	ir.OADD:    token.ADD,
+	ir.OSUB:    token.SUB,
+	ir.OMUL:    token.MUL,
+	ir.OAND:    token.AND,
+	ir.OOR:     token.OR,
+	ir.OXOR:    token.XOR,
+	ir.OANDNOT: token.AND_NOT,
+}
+
+// sameKind reports whether x and y can be compared.
+func sameKind(x, y constant.Value) bool {
+	if x == nil || y == nil {
+		return false
+	}
+	kx, ky := x.Kind(), y.Kind()
+	if kx == ky {
+		return kx != constant.Unknown
+	}
+	numeric := func(k constant.Kind) bool {
+		return k == constant.Int || k == constant.Float
+	}
+	return numeric(kx) && numeric(ky)
+}
+
+// zeroOf returns a value of the constant kind for values of type t,
+// or nil if t has no such kind.
+func zeroOf(t *types.Type) constant.Value {
+	switch {
+	case t.IsInteger():
+		return constant.MakeInt64(0)
+	case t.IsBoolean():
+		return constant.MakeBool(false)
+	case t.IsString():
+		return constant.MakeString("")
+	}
+	return nil
+}
+
+// endsInReturn reports whether list always leaves the function.
+func endsInReturn(list ir.Nodes) bool {
+	if len(list) == 0 {
+		return false
+	}
+	switch list[len(list)-1].Op() {
+	case ir.ORETURN, ir.OPANIC:
+		return true
+	}
+	return false
+}
+
+// nodeCost approximates the inline cost of list by its number of
+// nodes.
+func nodeCost(list ir.Nodes) int {
+	n := 0
+	ir.VisitList(list, func(ir.Node) { n++ })
+	return n
+}
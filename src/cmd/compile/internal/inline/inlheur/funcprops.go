@@ -0,0 +1,260 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package inlheur
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// FuncProps describes a set of function or method properties that may
+// be useful for inlining heuristics. Properties are computed for each
+// function in the package being compiled, and are exported along with
+// the inline body of inlinable functions so that callers in other
+// packages can use them too.
+type FuncProps struct {
+	Flags FuncPropBits // function-level properties
+
+	// ParamFlags holds one entry per parameter, with the receiver
+	// (if any) in the first slot.
+	ParamFlags []ParamPropBits
+
+	// ResultFlags holds one entry per result.
+	ResultFlags []ResultPropBits
+}
+
+// FuncPropBits describes properties of a function as a whole.
+type FuncPropBits uint32
+
+const (
+	// FuncPropNeverReturns is set if every path through the function
+	// ends in a panic, an infinite loop, or a call to a function
+	// that never returns (os.Exit, runtime.throw, and so on).
+	FuncPropNeverReturns FuncPropBits = 1 << iota
+)
+
+// ParamPropBits describes how a parameter is used by the function body.
+// The "Feeds" variants are set when the use is reached unconditionally
+// on entry to the function; the "MayFeed" variants are set when the use
+// is nested inside conditional control flow.
+type ParamPropBits uint32
+
+// ParamNoInfo is the zero value of ParamPropBits.
+const ParamNoInfo ParamPropBits = 0
+
+const (
+	// ParamFeedsInterfaceMethodCall is set if the parameter is
+	// an interface value that is used unmodified as the receiver of
+	// an interface method call.
+	ParamFeedsInterfaceMethodCall ParamPropBits = 1 << iota
+
+	// ParamMayFeedInterfaceMethodCall is the nested form of
+	// ParamFeedsInterfaceMethodCall.
+	ParamMayFeedInterfaceMethodCall
+
+	// ParamFeedsIndirectCall is set if the parameter is a function
+	// value that is called unmodified.
+	ParamFeedsIndirectCall
+
+	// ParamMayFeedIndirectCall is the nested form of
+	// ParamFeedsIndirectCall.
+	ParamMayFeedIndirectCall
+
+	// ParamFeedsIfOrSwitch is set if the parameter is the only
+	// non-constant operand of an "if" condition or "switch" tag, so
+	// that the branch folds away when the argument is a constant.
+	ParamFeedsIfOrSwitch
+
+	// ParamMayFeedIfOrSwitch is the nested form of
+	// ParamFeedsIfOrSwitch.
+	ParamMayFeedIfOrSwitch
+)
+
+// ResultPropBits describes the values a function returns for one of its
+// results.
+type ResultPropBits uint32
+
+// ResultNoInfo is the zero value of ResultPropBits.
+const ResultNoInfo ResultPropBits = 0
+
+const (
+	// ResultIsConcreteTypeConvertedToInterface is set if every
+	// return statement converts a value of the same concrete type to
+	// the (interface) result type.
+	ResultIsConcreteTypeConvertedToInterface ResultPropBits = 1 << iota
+
+	// ResultAlwaysSameConstant is set if every return statement
+	// returns the same constant (or nil).
+	ResultAlwaysSameConstant
+
+	// ResultAlwaysSameFunc is set if every return statement returns
+	// the same top-level function.
+	ResultAlwaysSameFunc
+
+	// ResultAlwaysSameInlinableFunc is set in addition to
+	// ResultAlwaysSameFunc when that function is inlinable.
+	ResultAlwaysSameInlinableFunc
+)
+
+var funcPropNames = []string{
+	"FuncPropNeverReturns",
+}
+
+var paramPropNames = []string{
+	"ParamFeedsInterfaceMethodCall",
+	"ParamMayFeedInterfaceMethodCall",
+	"ParamFeedsIndirectCall",
+	"ParamMayFeedIndirectCall",
+	"ParamFeedsIfOrSwitch",
+	"ParamMayFeedIfOrSwitch",
+}
+
+var resultPropNames = []string{
+	"ResultIsConcreteTypeConvertedToInterface",
+	"ResultAlwaysSameConstant",
+	"ResultAlwaysSameFunc",
+	"ResultAlwaysSameInlinableFunc",
+}
+
+func (b FuncPropBits) String() string   { return bitsString(uint32(b), funcPropNames) }
+func (b ParamPropBits) String() string  { return bitsString(uint32(b), paramPropNames) }
+func (b ResultPropBits) String() string { return bitsString(uint32(b), resultPropNames) }
+
+// bitsString formats the set bits of v as a "|"-separated list of the
+// corresponding entries in names.
+func bitsString(v uint32, names []string) string {
+	if v == 0 {
+		return "0"
+	}
+	var sb strings.Builder
+	for i, name := range names {
+		if v&(1<<i) == 0 {
+			continue
+		}
+		if sb.Len() != 0 {
+			sb.WriteByte('|')
+		}
+		sb.WriteString(name)
+		v &^= 1 << i
+	}
+	if v != 0 {
+		if sb.Len() != 0 {
+			sb.WriteByte('|')
+		}
+		fmt.Fprintf(&sb, "%#x", v)
+	}
+	return sb.String()
+}
+
+func (fp *FuncProps) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Flags: %v, ParamFlags: [", fp.Flags)
+	for i, f := range fp.ParamFlags {
+		if i != 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(f.String())
+	}
+	sb.WriteString("], ResultFlags: [")
+	for i, f := range fp.ResultFlags {
+		if i != 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(f.String())
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
+
+// SerializeToString encodes fp in a compact form suitable for
+// storing in ir.Inline.Properties. A nil or empty fp encodes as the
+// empty string.
+func (fp *FuncProps) SerializeToString() string {
+	if fp == nil || fp.isEmpty() {
+		return ""
+	}
+	var buf []byte
+	buf = binary.AppendUvarint(buf, uint64(fp.Flags))
+	buf = binary.AppendUvarint(buf, uint64(len(fp.ParamFlags)))
+	for _, f := range fp.ParamFlags {
+		buf = binary.AppendUvarint(buf, uint64(f))
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(fp.ResultFlags)))
+	for _, f := range fp.ResultFlags {
+		buf = binary.AppendUvarint(buf, uint64(f))
+	}
+	return string(buf)
+}
+
+// DeserializeFromString decodes a string produced by
+// SerializeToString. It returns nil for the empty string.
+func DeserializeFromString(s string) (*FuncProps, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b := []byte(s)
+	next := func() (uint64, error) {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return 0, fmt.Errorf("malformed function properties %q", s)
+		}
+		b = b[n:]
+		return v, nil
+	}
+	fp := new(FuncProps)
+	v, err := next()
+	if err != nil {
+		return nil, err
+	}
+	fp.Flags = FuncPropBits(v)
+	if v, err = next(); err != nil {
+		return nil, err
+	}
+	if v > uint64(len(b)) {
+		return nil, fmt.Errorf("malformed function properties %q", s)
+	}
+	fp.ParamFlags = make([]ParamPropBits, v)
+	for i := range fp.ParamFlags {
+		if v, err = next(); err != nil {
+			return nil, err
+		}
+		fp.ParamFlags[i] = ParamPropBits(v)
+	}
+	if v, err = next(); err != nil {
+		return nil, err
+	}
+	if v > uint64(len(b)) {
+		return nil, fmt.Errorf("malformed function properties %q", s)
+	}
+	fp.ResultFlags = make([]ResultPropBits, v)
+	for i := range fp.ResultFlags {
+		if v, err = next(); err != nil {
+			return nil, err
+		}
+		fp.ResultFlags[i] = ResultPropBits(v)
+	}
+	if len(b) != 0 {
+		return nil, fmt.Errorf("malformed function properties %q", s)
+	}
+	return fp, nil
+}
+
+func (fp *FuncProps) isEmpty() bool {
+	if fp.Flags != 0 {
+		return false
+	}
+	for _, f := range fp.ParamFlags {
+		if f != 0 {
+			return false
+		}
+	}
+	for _, f := range fp.ResultFlags {
+		if f != 0 {
+			return false
+		}
+	}
+	return true
+}
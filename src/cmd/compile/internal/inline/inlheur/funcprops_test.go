@@ -0,0 +1,127 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package inlheur
+
+import (
+	"bufio"
+	"internal/testenv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSerDeser(t *testing.T) {
+	cases := []*FuncProps{
+		{Flags: FuncPropNeverReturns},
+		{ParamFlags: []ParamPropBits{0, ParamFeedsIfOrSwitch | ParamMayFeedInterfaceMethodCall}},
+		{ResultFlags: []ResultPropBits{ResultAlwaysSameFunc | ResultAlwaysSameInlinableFunc, 0}},
+		{
+			Flags:       FuncPropNeverReturns,
+			ParamFlags:  []ParamPropBits{ParamFeedsIndirectCall, ParamMayFeedIfOrSwitch, 0},
+			ResultFlags: []ResultPropBits{ResultAlwaysSameConstant},
+		},
+	}
+	for _, want := range cases {
+		got, err := DeserializeFromString(want.SerializeToString())
+		if err != nil {
+			t.Fatalf("deserializing %v: %v", want, err)
+		}
+		if got.String() != want.String() {
+			t.Errorf("round trip of %v produced %v", want, got)
+		}
+	}
+
+	// Properties with no information encode as the empty string.
+	empty := &FuncProps{ParamFlags: []ParamPropBits{0}, ResultFlags: []ResultPropBits{0}}
+	if s := empty.SerializeToString(); s != "" {
+		t.Errorf("empty properties encoded as %q, want \"\"", s)
+	}
+	if fp, err := DeserializeFromString(""); fp != nil || err != nil {
+		t.Errorf("DeserializeFromString(\"\") = %v, %v, want nil, nil", fp, err)
+	}
+	if _, err := DeserializeFromString("\x00\x05\x01"); err == nil {
+		t.Errorf("DeserializeFromString accepted truncated input")
+	}
+}
+
+// TestFuncProperties compiles each file in testdata/props and checks
+// the function properties dumped by the compiler against the
+// "// funcprops:" comments in the file.
+func TestFuncProperties(t *testing.T) {
+	testenv.MustHaveGoBuild(t)
+
+	files, err := filepath.Glob(filepath.Join("testdata", "props", "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for _, file := range files {
+		file := file
+		t.Run(strings.TrimSuffix(filepath.Base(file), ".go"), func(t *testing.T) {
+			want, err := expectedProps(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			base := strings.TrimSuffix(filepath.Base(file), ".go")
+			dump := filepath.Join(dir, base+".props")
+			cmd := testenv.Command(t, testenv.GoToolPath(t), "build",
+				"-gcflags=-d=dumpinlfuncprops="+dump,
+				"-o", filepath.Join(dir, base+".a"), file)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("build failed: %v\n%s", err, out)
+			}
+			got, err := dumpedProps(dump)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, w := range want {
+				g, ok := got[name]
+				if !ok {
+					t.Errorf("%s: no properties dumped", name)
+					continue
+				}
+				if g != w {
+					t.Errorf("%s:\ngot  %s\nwant %s", name, g, w)
+				}
+			}
+		})
+	}
+}
+
+// expectedProps reads the "// funcprops: name props" comments of file.
+func expectedProps(file string) (map[string]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		if rest, ok := strings.CutPrefix(line, "// funcprops: "); ok {
+			name, props, _ := strings.Cut(rest, " ")
+			m[name] = props
+		}
+	}
+	return m, nil
+}
+
+// dumpedProps reads a file written by -d=dumpinlfuncprops, whose
+// lines have the form "pos name props".
+func dumpedProps(file string) (map[string]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m := make(map[string]string)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.SplitN(s.Text(), " ", 3)
+		if len(fields) == 3 {
+			m[fields[1]] = fields[2]
+		}
+	}
+	return m, s.Err()
+}
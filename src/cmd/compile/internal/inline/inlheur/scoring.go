@@ -0,0 +1,300 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package inlheur
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cmd/compile/internal/base"
+	"cmd/compile/internal/ir"
+)
+
+// scoreAdjustTyp identifies an adjustment applied to the score of a
+// call site. Positive adjustments make inlining less likely, negative
+// ones more likely.
+type scoreAdjustTyp uint32
+
+const (
+	// Adjustments based on the context of the call site.
+	panicPathAdj scoreAdjustTyp = 1 << iota
+	initFuncAdj
+	inLoopAdj
+
+	// Adjustments based on arguments passed to the callee.
+	passConstToIfAdj
+	passConstToNestedIfAdj
+	passConcreteToItfCallAdj
+	passConcreteToNestedItfCallAdj
+	passFuncToIndirectCallAdj
+	passFuncToNestedIndirectCallAdj
+	passInlinableFuncToIndirectCallAdj
+	passInlinableFuncToNestedIndirectCallAdj
+
+	// Adjustments based on how the caller uses the results.
+	returnFeedsConstToIfAdj
+	returnFeedsConcreteToInterfaceCallAdj
+	returnFeedsFuncToIndirectCallAdj
+	returnFeedsInlinableFuncToIndirectCallAdj
+
+	sentinelScoreAdj // sentinel, not a real adjustment
+)
+
+var scoreAdjNames = []string{
+	"panicPathAdj",
+	"initFuncAdj",
+	"inLoopAdj",
+	"passConstToIfAdj",
+	"passConstToNestedIfAdj",
+	"passConcreteToItfCallAdj",
+	"passConcreteToNestedItfCallAdj",
+	"passFuncToIndirectCallAdj",
+	"passFuncToNestedIndirectCallAdj",
+	"passInlinableFuncToIndirectCallAdj",
+	"passInlinableFuncToNestedIndirectCallAdj",
+	"returnFeedsConstToIfAdj",
+	"returnFeedsConcreteToInterfaceCallAdj",
+	"returnFeedsFuncToIndirectCallAdj",
+	"returnFeedsInlinableFuncToIndirectCallAdj",
+}
+
+func (a scoreAdjustTyp) String() string { return bitsString(uint32(a), scoreAdjNames) }
+
+// adjValues holds the amount added to the score for each adjustment.
+// The values can be changed with -d=inlscoreadj.
+var adjValues = map[scoreAdjustTyp]int{
+	panicPathAdj:                              40,
+	initFuncAdj:                               20,
+	inLoopAdj:                                 -5,
+	passConstToIfAdj:                          -20,
+	passConstToNestedIfAdj:                    -15,
+	passConcreteToItfCallAdj:                  -30,
+	passConcreteToNestedItfCallAdj:            -25,
+	passFuncToIndirectCallAdj:                 -25,
+	passFuncToNestedIndirectCallAdj:           -20,
+	passInlinableFuncToIndirectCallAdj:        -45,
+	passInlinableFuncToNestedIndirectCallAdj:  -40,
+	returnFeedsConstToIfAdj:                   -15,
+	returnFeedsConcreteToInterfaceCallAdj:     -25,
+	returnFeedsFuncToIndirectCallAdj:          -25,
+	returnFeedsInlinableFuncToIndirectCallAdj: -40,
+}
+
+// adjGroups lists adjustments that describe the same opportunity with
+// different strength. At most one adjustment from each group, the
+// most favorable, is applied to a call site.
+var adjGroups = []scoreAdjustTyp{
+	passConstToIfAdj | passConstToNestedIfAdj,
+	passConcreteToItfCallAdj | passConcreteToNestedItfCallAdj,
+	passFuncToIndirectCallAdj | passFuncToNestedIndirectCallAdj |
+		passInlinableFuncToIndirectCallAdj | passInlinableFuncToNestedIndirectCallAdj,
+	returnFeedsFuncToIndirectCallAdj | returnFeedsInlinableFuncToIndirectCallAdj,
+}
+
+// SetupScoreAdjustments applies any -d=inlscoreadj overrides of the
+// adjustment values. The flag value is a "/"-separated list of
+// name:value pairs, as in
+//
+//	-d=inlscoreadj=panicPathAdj:10/passConstToIfAdj:-40
+func SetupScoreAdjustments() {
+	if base.Debug.InlScoreAdj == "" {
+		return
+	}
+	for _, item := range strings.Split(base.Debug.InlScoreAdj, "/") {
+		name, val, ok := strings.Cut(item, ":")
+		if !ok {
+			base.Fatalf("malformed -d=inlscoreadj item %q, want name:value", item)
+		}
+		adj := lookupAdj(name)
+		if adj == 0 {
+			base.Fatalf("unknown score adjustment %q in -d=inlscoreadj", name)
+		}
+		v, err := strconv.Atoi(val)
+		if err != nil {
+			base.Fatalf("bad value %q for score adjustment %s in -d=inlscoreadj", val, name)
+		}
+		adjValues[adj] = v
+	}
+}
+
+func lookupAdj(name string) scoreAdjustTyp {
+	for i, n := range scoreAdjNames {
+		if n == name {
+			return 1 << i
+		}
+	}
+	return 0
+}
+
+// BudgetExpansion returns the amount by which the inlining budget is
+// increased when deciding whether a function is inlinable at all.
+// Functions whose cost exceeds maxBudget are then inlined only at call
+// sites whose adjustments bring the score back within maxBudget.
+func BudgetExpansion(maxBudget int32) int32 {
+	if base.Debug.InlBudgetSlack != 0 {
+		return int32(base.Debug.InlBudgetSlack)
+	}
+	return maxBudget
+}
+
+// callSiteTab holds the scored call sites of the function currently
+// being processed by the inliner.
+var callSiteTab map[*ir.CallExpr]*callSite
+
+// ScoreCalls computes scores for the calls to inlinable functions in
+// fn. It must be called before the inliner visits fn's body.
+func ScoreCalls(fn *ir.Func) {
+	sites := collectCallSites(fn)
+	callSiteTab = make(map[*ir.CallExpr]*callSite, len(sites))
+	for _, cs := range sites {
+		cs.computeScore()
+		callSiteTab[cs.call] = cs
+	}
+	if base.Debug.DumpInlCallSiteScores != 0 {
+		dumpCallSiteScores(fn, sites)
+	}
+}
+
+// GetCallSiteScore returns the score computed by ScoreCalls for call.
+// It reports false for calls that were not scored, such as those that
+// appear in the bodies of already inlined functions.
+func GetCallSiteScore(call *ir.CallExpr) (int, bool) {
+	cs, ok := callSiteTab[call]
+	if !ok {
+		return 0, false
+	}
+	return cs.score, true
+}
+
+// computeScore computes the score of cs: the cost of the callee, less
+// the cost of any code that constant arguments make unreachable, plus
+// the applicable adjustments.
+func (cs *callSite) computeScore() {
+	var adj scoreAdjustTyp
+	if cs.flags&CallSiteOnPanicPath != 0 {
+		adj |= panicPathAdj
+	}
+	if cs.flags&CallSiteInInitFunc != 0 {
+		adj |= initFuncAdj
+	}
+	if cs.flags&CallSiteInLoop != 0 {
+		adj |= inLoopAdj
+	}
+	adj |= cs.resultAdj
+	if fp := propsOf(cs.callee); fp != nil && len(fp.ParamFlags) == len(cs.call.Args) {
+		for i, arg := range cs.call.Args {
+			adj |= argAdjustments(fp.ParamFlags[i], arg)
+		}
+		if adj&(passConstToIfAdj|passConstToNestedIfAdj) != 0 {
+			cs.folded = foldedCost(cs.callee, cs.call, fp)
+		}
+	}
+
+	// Keep only the most favorable adjustment of each group.
+	for _, g := range adjGroups {
+		best := scoreAdjustTyp(0)
+		for a := scoreAdjustTyp(1); a < sentinelScoreAdj; a <<= 1 {
+			if adj&g&a != 0 && (best == 0 || adjValues[a] < adjValues[best]) {
+				best = a
+			}
+		}
+		adj = adj&^g | best
+	}
+
+	score := int(cs.callee.Inl.Cost) - cs.folded
+	for a := scoreAdjustTyp(1); a < sentinelScoreAdj; a <<= 1 {
+		if adj&a != 0 {
+			score += adjValues[a]
+		}
+	}
+	cs.score = score
+	cs.mask = adj
+}
+
+// argAdjustments returns the adjustments earned by passing arg for a
+// parameter with the properties pf.
+func argAdjustments(pf ParamPropBits, arg ir.Node) scoreAdjustTyp {
+	var adj scoreAdjustTyp
+	if pf&(ParamFeedsIfOrSwitch|ParamMayFeedIfOrSwitch) != 0 && isConstArg(arg) {
+		if pf&ParamFeedsIfOrSwitch != 0 {
+			adj |= passConstToIfAdj
+		} else {
+			adj |= passConstToNestedIfAdj
+		}
+	}
+	if pf&(ParamFeedsInterfaceMethodCall|ParamMayFeedInterfaceMethodCall) != 0 && isConcreteConvIface(arg) {
+		if pf&ParamFeedsInterfaceMethodCall != 0 {
+			adj |= passConcreteToItfCallAdj
+		} else {
+			adj |= passConcreteToNestedItfCallAdj
+		}
+	}
+	if pf&(ParamFeedsIndirectCall|ParamMayFeedIndirectCall) != 0 {
+		if fn, inlinable := funcArg(arg); fn {
+			must := pf&ParamFeedsIndirectCall != 0
+			switch {
+			case inlinable && must:
+				adj |= passInlinableFuncToIndirectCallAdj
+			case inlinable:
+				adj |= passInlinableFuncToNestedIndirectCallAdj
+			case must:
+				adj |= passFuncToIndirectCallAdj
+			default:
+				adj |= passFuncToNestedIndirectCallAdj
+			}
+		}
+	}
+	return adj
+}
+
+// isConcreteConvIface reports whether arg is the conversion of a
+// concrete value to an interface type.
+func isConcreteConvIface(arg ir.Node) bool {
+	arg = ir.StaticValue(arg)
+	if arg.Op() != ir.OCONVIFACE {
+		return false
+	}
+	return !arg.(*ir.ConvExpr).X.Type().IsInterface()
+}
+
+// funcArg reports whether arg is a statically known function, and if
+// so whether that function is inlinable.
+func funcArg(arg ir.Node) (isFunc, inlinable bool) {
+	var fn *ir.Func
+	switch arg := ir.StaticValue(arg); arg.Op() {
+	case ir.ONAME:
+		arg := arg.(*ir.Name)
+		if arg.Class != ir.PFUNC {
+			return false, false
+		}
+		fn = arg.Func
+	case ir.OCLOSURE:
+		fn = arg.(*ir.ClosureExpr).Func
+	case ir.OMETHEXPR:
+		n := ir.MethodExprName(arg)
+		if n == nil {
+			return false, false
+		}
+		fn = n.Func
+	default:
+		return false, false
+	}
+	return true, fn != nil && fn.Inl != nil
+}
+
+// dumpCallSiteScores prints the scored call sites of fn, for
+// -d=dumpinlcallsitescores.
+func dumpCallSiteScores(fn *ir.Func, sites []*callSite) {
+	sort.SliceStable(sites, func(i, j int) bool {
+		return sites[i].call.Pos().Before(sites[j].call.Pos())
+	})
+	for _, cs := range sites {
+		fmt.Printf("%v: call to %v in %v: score %d cost %d folded %d flags %v adj %v\n",
+			ir.Line(cs.call), ir.PkgFuncName(cs.callee), ir.FuncName(fn),
+			cs.score, cs.callee.Inl.Cost, cs.folded, cs.flags, cs.mask)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Test cases for the function properties computed by the inlining
+// heuristics. Each "funcprops:" comment gives the expected dump line,
+// without its position, for the function that follows it.
+
+package neverreturns
+
+import "os"
+
+// funcprops: panics Flags: FuncPropNeverReturns, ParamFlags: [0], ResultFlags: []
+func panics(msg string) {
+	panic(msg)
+}
+
+// funcprops: exits Flags: FuncPropNeverReturns, ParamFlags: [0], ResultFlags: []
+func exits(code int) {
+	println("exiting")
+	os.Exit(code)
+}
+
+// funcprops: callsPanics Flags: FuncPropNeverReturns, ParamFlags: [], ResultFlags: []
+func callsPanics() {
+	panics("boom")
+}
+
+// funcprops: bothArms Flags: FuncPropNeverReturns, ParamFlags: [ParamFeedsIfOrSwitch], ResultFlags: [ResultAlwaysSameConstant]
+func bothArms(x int) int {
+	if x < 0 {
+		panic("negative")
+	} else {
+		exits(1)
+	}
+	return 0
+}
+
+// funcprops: switchAll Flags: FuncPropNeverReturns, ParamFlags: [ParamFeedsIfOrSwitch], ResultFlags: []
+func switchAll(x int) {
+	switch x {
+	case 1:
+		panic("one")
+	default:
+		panics("other")
+	}
+}
+
+// funcprops: forever Flags: FuncPropNeverReturns, ParamFlags: [], ResultFlags: []
+func forever() {
+	for {
+		println("spin")
+	}
+}
+
+// funcprops: earlyReturn Flags: 0, ParamFlags: [ParamFeedsIfOrSwitch], ResultFlags: [0]
+func earlyReturn(x int) int {
+	if x > 0 {
+		return x
+	}
+	panics("bad")
+	return 0
+}
+
+// funcprops: loopWithBreak Flags: 0, ParamFlags: [ParamMayFeedIfOrSwitch], ResultFlags: []
+func loopWithBreak(x int) {
+	for {
+		if x > 0 {
+			break
+		}
+		println(x)
+	}
+}
+
+// funcprops: oneArm Flags: 0, ParamFlags: [ParamFeedsIfOrSwitch], ResultFlags: []
+func oneArm(x int) {
+	if x < 0 {
+		panic("negative")
+	}
+}
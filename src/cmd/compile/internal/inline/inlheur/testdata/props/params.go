@@ -0,0 +1,102 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Test cases for the parameter properties computed by the inlining
+// heuristics. Each "funcprops:" comment gives the expected dump line,
+// without its position, for the function that follows it.
+
+package params
+
+import "fmt"
+
+// funcprops: feedsIf Flags: 0, ParamFlags: [ParamFeedsIfOrSwitch 0], ResultFlags: [0]
+func feedsIf(x int, s []int) int {
+	if x < 0 {
+		return len(s)
+	}
+	return x
+}
+
+// funcprops: feedsNestedIf Flags: 0, ParamFlags: [0 ParamMayFeedIfOrSwitch], ResultFlags: [0]
+func feedsNestedIf(s []int, y int) int {
+	for i := range s {
+		if y == 2 {
+			s[i]++
+		}
+	}
+	return len(s)
+}
+
+// funcprops: feedsSwitch Flags: 0, ParamFlags: [ParamFeedsIfOrSwitch], ResultFlags: [0]
+func feedsSwitch(mode string) int {
+	switch mode {
+	case "a":
+		return 1
+	case "b":
+		return 2
+	}
+	return 0
+}
+
+// funcprops: feedsTaglessSwitch Flags: 0, ParamFlags: [ParamFeedsIfOrSwitch], ResultFlags: [0]
+func feedsTaglessSwitch(n int) int {
+	switch {
+	case n > 10 && n < 20:
+		return 1
+	}
+	return 0
+}
+
+// funcprops: twoParamsInCond Flags: 0, ParamFlags: [0 0], ResultFlags: [0]
+func twoParamsInCond(x, y int) int {
+	if x < y {
+		return x
+	}
+	return y
+}
+
+// funcprops: reassigned Flags: 0, ParamFlags: [0], ResultFlags: [0]
+func reassigned(x int) int {
+	x++
+	if x < 0 {
+		return 1
+	}
+	return 2
+}
+
+// funcprops: feedsItf Flags: 0, ParamFlags: [ParamFeedsInterfaceMethodCall], ResultFlags: []
+func feedsItf(s fmt.Stringer) {
+	println(s.String())
+}
+
+// funcprops: feedsNestedItf Flags: 0, ParamFlags: [ParamMayFeedInterfaceMethodCall ParamFeedsIfOrSwitch], ResultFlags: []
+func feedsNestedItf(s fmt.Stringer, b bool) {
+	if b {
+		println(s.String())
+	}
+}
+
+// funcprops: feedsIndirect Flags: 0, ParamFlags: [ParamFeedsIndirectCall], ResultFlags: [0]
+func feedsIndirect(f func(int) int) int {
+	return f(2)
+}
+
+// funcprops: feedsNestedIndirect Flags: 0, ParamFlags: [ParamMayFeedIndirectCall 0], ResultFlags: [0]
+func feedsNestedIndirect(f func(int) int, s []int) int {
+	n := 0
+	for _, v := range s {
+		n += f(v)
+	}
+	return n
+}
+
+type T struct{ x int }
+
+// funcprops: T.feedsIfRecv Flags: 0, ParamFlags: [0 ParamFeedsIfOrSwitch], ResultFlags: [0]
+func (t T) feedsIfRecv(flag bool) int {
+	if !flag {
+		return 0
+	}
+	return t.x
+}
@@ -0,0 +1,75 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Test cases for the result properties computed by the inlining
+// heuristics. Each "funcprops:" comment gives the expected dump line,
+// without its position, for the function that follows it.
+
+package returns
+
+import "fmt"
+
+// funcprops: sameConst Flags: 0, ParamFlags: [ParamFeedsIfOrSwitch], ResultFlags: [ResultAlwaysSameConstant]
+func sameConst(x int) int {
+	if x < 0 {
+		println(x)
+		return 42
+	}
+	return 42
+}
+
+// funcprops: namedConst Flags: 0, ParamFlags: [], ResultFlags: [ResultAlwaysSameConstant]
+func namedConst() bool {
+	const ok = true
+	return ok
+}
+
+// funcprops: diffConst Flags: 0, ParamFlags: [ParamFeedsIfOrSwitch], ResultFlags: [0]
+func diffConst(x int) int {
+	if x < 0 {
+		return 1
+	}
+	return 2
+}
+
+// funcprops: multi Flags: 0, ParamFlags: [0], ResultFlags: [0 ResultAlwaysSameConstant]
+func multi(x int) (int, error) {
+	return x, nil
+}
+
+// funcprops: bareReturn Flags: 0, ParamFlags: [], ResultFlags: [0]
+func bareReturn() (x int) {
+	x = 3
+	return
+}
+
+type T int
+
+// funcprops: T.String Flags: 0, ParamFlags: [0], ResultFlags: [ResultAlwaysSameConstant]
+func (T) String() string { return "T" }
+
+// funcprops: toItf Flags: 0, ParamFlags: [ParamFeedsIfOrSwitch], ResultFlags: [ResultIsConcreteTypeConvertedToInterface]
+func toItf(x int) fmt.Stringer {
+	if x < 0 {
+		return T(0)
+	}
+	return T(x)
+}
+
+// funcprops: small Flags: 0, ParamFlags: [0], ResultFlags: [0]
+func small(x int) int { return x + 1 }
+
+//go:noinline
+// funcprops: notInlinable Flags: 0, ParamFlags: [0], ResultFlags: [0]
+func notInlinable(x int) int { return x + 2 }
+
+// funcprops: sameInlinableFunc Flags: 0, ParamFlags: [], ResultFlags: [ResultAlwaysSameFunc|ResultAlwaysSameInlinableFunc]
+func sameInlinableFunc() func(int) int {
+	return small
+}
+
+// funcprops: sameFunc Flags: 0, ParamFlags: [], ResultFlags: [ResultAlwaysSameFunc]
+func sameFunc() func(int) int {
+	return notInlinable
+}
@@ -184,6 +184,11 @@ type Inline struct {
 	// initializing the result parameters until immediately before the
 	// "return" statement.
 	CanDelayResults bool
+
+	// Properties holds the serialized properties of the function
+	// computed by the inlining heuristics (see package inlheur), or
+	// the empty string if they were not computed.
+	Properties string
 }
 
 // A Mark represents a scope boundary.
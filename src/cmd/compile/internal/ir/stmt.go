@@ -240,9 +240,15 @@ func NewForStmt(pos src.XPos, init Node, cond, post Node, body []Node, distinctV
 // The two opcodes use a single syntax because the implementations
 // are very similar: both are concerned with saving Call and running it
 // in a different context (a separate goroutine or a later time).
+//
+// DeferAt is non-nil for a defer statement in the body of a
+// range-over-func loop. It is the token returned by
+// runtime.deferrangefunc in the enclosing function, and the deferred
+// call is queued on that function's frame via runtime.deferprocat.
 type GoDeferStmt struct {
 	miniStmt
-	Call Node
+	Call    Node
+	DeferAt Expr
 }
 
 func NewGoDeferStmt(pos src.XPos, op Op, call Node) *GoDeferStmt {
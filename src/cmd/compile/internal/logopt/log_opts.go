@@ -99,6 +99,50 @@ import (
 //  go tool compile -json=0,file://logopt x.go       # no -p option to set the package
 //  head -1 logopt/%00/x.json
 //  {"version":0,"package":"\u0000","goos":"darwin","goarch":"amd64","gc_version":"devel +86487adf6a Thu Nov 7 19:34:56 2019 -0500","file":"x.go"}
+//
+// Version 1 (-json=1,<destination>) is a report for tools that aggregate
+// optimization decisions across a build, for example to flag new heap
+// allocations in code review. Instead of one LSP file per source file, it
+// writes one url.PathEscape(pkg)+".json"-named file per package directly in
+// <destination>, even if the package logged nothing. With the go command,
+//
+//  go build -gcflags=all=-json=1,/tmp/report ./...
+//
+// writes one report per compiled package. The go command does not use the
+// build cache for packages compiled with -json, as the cache does not hold
+// the reports, so every package matched by the flag is compiled again.
+//
+// The report holds one JSON value per line. The first is a VersionHeader
+// without a file. Each following line is a ReportRecord; records are sorted
+// by outermost source position. For example (wrapped for legibility):
+//
+// {"kind":"inlineCall","pass":"inline","function":"foo",
+//  "pos":{"file":"/tmp/x/file.go","line":8,"col":7},
+//  "message":"x.bar","args":{"cost":4}}
+//
+// The kinds currently reported are:
+//
+//  heap                  a value is heap allocated, or a variable is moved to
+//                        the heap; there is exactly one heap record for each
+//                        allocation; the explanation, if any, is the data flow
+//                        that makes it escape, as in the escape record
+//  escape, escapes       a value escapes to the heap; the explanation, if any,
+//                        is the data flow that makes it escape
+//  leak                  a parameter leaks to the heap or to a result
+//  canInlineFunction     a function can be inlined; args: cost
+//  cannotInlineFunction  a function cannot be inlined; message: reason
+//  inlineCall            a call was inlined; message: callee; args: cost
+//  cannotInlineCall      a call was not inlined; message: reason;
+//                        args: cost and maxCost if the callee is too big
+//  devirtualizedCall     an interface or function value call was devirtualized;
+//                        message: callee; args: pgo and, for pgo, weight
+//  isInBounds            a bounds check remains
+//  isSliceInBounds       a slice bounds check remains
+//  nilcheck              a nil check remains
+//  copy                  a large copy; message: size
+//
+// New kinds may be added; consumers should ignore kinds they do not know.
+// heap, inlineCall and devirtualizedCall are only reported by version 1.
 
 type VersionHeader struct {
 	Version   int    `json:"version"`
@@ -232,11 +276,56 @@ type LoggedOpt struct {
 	target       []interface{} // Optional target(s) or parameter(s) of "what" -- what was inlined, why it was not, size of copy, etc. 1st is most important/relevant.
 }
 
+// ReportPos is a source position in a version 1 report.
+type ReportPos struct {
+	File string `json:"file"`
+	Line uint   `json:"line"`
+	Col  uint   `json:"col"`
+}
+
+// ReportRecord is a single (non-)optimization in a version 1 report.
+type ReportRecord struct {
+	Kind     string      `json:"kind"`               // e.g., "escape", "inlineCall", "isInBounds"
+	Pass     string      `json:"pass"`               // compiler pass that logged the record
+	Function string      `json:"function,omitempty"` // function in which the record occurred
+	Pos      ReportPos   `json:"pos"`                // outermost position
+	End      *ReportPos  `json:"end,omitempty"`      // outermost end position, for records that cover a range
+	Inlined  []ReportPos `json:"inlined,omitempty"`  // if the record is in inlined code, the inlined positions from (second) outermost to innermost
+
+	Message     string                 `json:"message,omitempty"`
+	Args        map[string]interface{} `json:"args,omitempty"`        // structured details, see Arg
+	Explanation []ReportExplanation    `json:"explanation,omitempty"` // e.g., the data flow that makes a value escape
+}
+
+// ReportExplanation is one step of the explanation of a ReportRecord.
+type ReportExplanation struct {
+	Pos     ReportPos   `json:"pos"`
+	Inlined []ReportPos `json:"inlined,omitempty"`
+	Message string      `json:"message"`
+}
+
+// An Arg is a named detail of a logged (non-)optimization, such as the cost
+// of an inlined function. Args are passed to LogOpt after the message and
+// appear in the "args" object of version 1 records; version 0 ignores them.
+type Arg struct {
+	Name  string
+	Value interface{}
+}
+
+// reportOnly are the kinds that version 0 does not log, so that LSP clients
+// keep seeing the same diagnostics.
+var reportOnly = map[string]bool{
+	"heap":              true,
+	"inlineCall":        true,
+	"devirtualizedCall": true,
+}
+
 type logFormat uint8
 
 const (
 	None  logFormat = iota
 	Json0           // version 0 for LSP 3.14, 3.15; future versions of LSP may change the format and the compiler may need to support both as clients are updated.
+	Json1           // version 1, one report per package
 )
 
 var Format = None
@@ -245,11 +334,15 @@ var dest string
 // LogJsonOption parses and validates the version,directory value attached to the -json compiler flag.
 func LogJsonOption(flagValue string) {
 	version, directory := parseLogFlag("json", flagValue)
-	if version != 0 {
-		log.Fatal("-json version must be 0")
+	switch version {
+	case 0:
+		Format = Json0
+	case 1:
+		Format = Json1
+	default:
+		log.Fatal("-json version must be 0 or 1")
 	}
 	dest = checkLogPath(directory)
-	Format = Json0
 }
 
 // parseLogFlag checks the flag passed to -json
@@ -362,7 +455,7 @@ func Enabled() bool {
 	switch Format {
 	case None:
 		return false
-	case Json0:
+	case Json0, Json1:
 		return true
 	}
 	panic("Unexpected optimizer-logging level")
@@ -455,6 +548,9 @@ func FlushLoggedOpts(ctxt *obj.Link, slashPkgPath string) {
 		// For LSP, make a subdirectory for the package, and for each file foo.go, create foo.json in that subdirectory.
 		currentFile := ""
 		for _, x := range loggedOpts {
+			if reportOnly[x.what] {
+				continue
+			}
 			posTmp, p0 := parsePos(ctxt, x.pos, posTmp)
 			lastTmp, l0 := parsePos(ctxt, x.lastPos, lastTmp) // These match posTmp/p0 except for most-inline, and that often also matches.
 			p0f := uprootedPath(p0.Filename())
@@ -506,7 +602,82 @@ func FlushLoggedOpts(ctxt *obj.Link, slashPkgPath string) {
 		if w != nil {
 			w.Close()
 		}
+
+	case Json1:
+		var posTmp, lastTmp []src.Pos
+
+		if slashPkgPath == "" {
+			slashPkgPath = "\000"
+		}
+		p := filepath.Join(dest, url.PathEscape(slashPkgPath)+".json")
+		w, err := os.Create(p)
+		if err != nil {
+			log.Fatalf("Could not create file %s for logging optimizer actions, %v", p, err)
+		}
+		encoder := json.NewEncoder(w)
+		encoder.Encode(VersionHeader{Version: 1, Package: slashPkgPath, Goos: buildcfg.GOOS, Goarch: buildcfg.GOARCH, GcVersion: buildcfg.Version})
+
+		for _, x := range loggedOpts {
+			posTmp, p0 := parsePos(ctxt, x.pos, posTmp)
+
+			r := ReportRecord{
+				Kind:     x.what,
+				Pass:     x.compilerPass,
+				Function: x.functionName,
+				Pos:      newReportPos(p0),
+				Inlined:  newReportInlined(posTmp),
+			}
+			if x.lastPos != x.pos {
+				var l0 src.Pos
+				lastTmp, l0 = parsePos(ctxt, x.lastPos, lastTmp)
+				end := newReportPos(l0)
+				r.End = &end
+			}
+			for i, t := range x.target {
+				switch t := t.(type) {
+				case Arg:
+					if r.Args == nil {
+						r.Args = make(map[string]interface{})
+					}
+					r.Args[t.Name] = t.Value
+				case []*LoggedOpt:
+					for _, z := range t {
+						var zp src.Pos
+						posTmp, zp = parsePos(ctxt, z.pos, posTmp)
+						msg := z.what
+						if len(z.target) > 0 {
+							msg = msg + ": " + fmt.Sprint(z.target[0])
+						}
+						r.Explanation = append(r.Explanation, ReportExplanation{Pos: newReportPos(zp), Inlined: newReportInlined(posTmp), Message: msg})
+					}
+				default:
+					if i == 0 {
+						r.Message = fmt.Sprint(t)
+					}
+				}
+			}
+
+			encoder.Encode(&r)
+		}
+		if err := w.Close(); err != nil {
+			log.Fatalf("Could not write file %s for logging optimizer actions, %v", p, err)
+		}
+	}
+}
+
+// newReportPos returns the ReportPos for the compiler source location p.
+func newReportPos(p src.Pos) ReportPos {
+	return ReportPos{File: uprootedPath(p.Filename()), Line: p.Line(), Col: p.Col()}
+}
+
+// newReportInlined returns the inlined positions of the expanded position
+// posTmp, from (second) outermost to innermost.
+func newReportInlined(posTmp []src.Pos) []ReportPos {
+	var inlined []ReportPos
+	for _, p := range posTmp[1:] {
+		inlined = append(inlined, newReportPos(p))
 	}
+	return inlined
 }
 
 // newRange returns a single-position Range for the compiler source location p.
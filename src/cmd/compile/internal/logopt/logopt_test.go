@@ -5,6 +5,8 @@
 package logopt
 
 import (
+	"bytes"
+	"encoding/json"
 	"internal/testenv"
 	"os"
 	"path/filepath"
@@ -217,6 +219,124 @@ func s15a8(x *[15]int64) [15]int64 {
 	})
 }
 
+const reportCode = `package x
+
+type I interface{ M() int }
+
+type T struct{ x int }
+
+func (t T) M() int { return t.x }
+
+var sink *int
+
+func f(s []int, i int) int {
+	p := new(int)
+	sink = p
+	x := 0
+	sink = &x
+	var v I = T{1}
+	return s[i] + v.M()
+}
+
+func g() int {
+	return T{2}.M()
+}
+`
+
+// TestReport tests the version 1 per-package report.
+func TestReport(t *testing.T) {
+	t.Parallel()
+
+	testenv.MustHaveGoBuild(t)
+
+	if runtime.GOARCH != "amd64" {
+		// Keep the expected bounds checks simple.
+		t.Skip("skipping on non-amd64")
+	}
+
+	dir := fixSlash(t.TempDir())
+	src := filepath.Join(dir, "report.go")
+	if err := os.WriteFile(src, []byte(reportCode), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outfile := filepath.Join(dir, "report.o")
+
+	if _, err := testLogOptDir(t, dir, "-json=1,file://log/report", src, outfile); err != nil {
+		t.Fatal("-json=1,file://log/report should have succeeded")
+	}
+	logged, err := os.ReadFile(filepath.Join(dir, "log", "report", "x.json"))
+	if err != nil {
+		t.Fatal("-json=1,file://log/report missing expected report")
+	}
+	t.Logf("%s", logged)
+
+	dec := json.NewDecoder(bytes.NewReader(logged))
+	var header VersionHeader
+	if err := dec.Decode(&header); err != nil {
+		t.Fatalf("error decoding header: %v", err)
+	}
+	if header.Version != 1 || header.Package != "x" || header.File != "" {
+		t.Errorf("got header %+v, want version 1 for package x without file", header)
+	}
+	var records []ReportRecord
+	for dec.More() {
+		var r ReportRecord
+		if err := dec.Decode(&r); err != nil {
+			t.Fatalf("error decoding record: %v", err)
+		}
+		records = append(records, r)
+	}
+
+	find := func(kind string, line uint, message string) *ReportRecord {
+		for i, r := range records {
+			if r.Kind == kind && r.Pos.Line == line && r.Message == message {
+				return &records[i]
+			}
+		}
+		t.Errorf("missing %s record at line %d with message %q", kind, line, message)
+		return nil
+	}
+	count := func(kind string) int {
+		n := 0
+		for _, r := range records {
+			if r.Kind == kind {
+				n++
+			}
+		}
+		return n
+	}
+
+	if r := find("canInlineFunction", 7, "cost: 3"); r != nil {
+		if r.Function != "T.M" || r.Args["cost"] != 3.0 {
+			t.Errorf("got %+v, want function T.M with cost 3", r)
+		}
+	}
+	if r := find("heap", 12, "new(int) escapes to heap"); r != nil {
+		if r.Function != "f" || r.Pos.File != src || r.Pos.Col != 10 {
+			t.Errorf("got %+v, want function f at %s:12:10", r, src)
+		}
+		if len(r.Explanation) == 0 {
+			t.Errorf("heap record for new(int) has no explanation")
+		}
+	}
+	if r := find("heap", 14, "moved to heap: x"); r != nil && len(r.Explanation) == 0 {
+		t.Errorf("heap record for x has no explanation")
+	}
+	if n := count("heap"); n != 2 {
+		t.Errorf("got %d heap records, want 2", n)
+	}
+	if r := find("escape", 12, "new(int) escapes to heap"); r != nil && len(r.Explanation) == 0 {
+		t.Errorf("escape of new(int) has no explanation")
+	}
+	if r := find("devirtualizedCall", 17, "T.M"); r != nil && r.Args["pgo"] != false {
+		t.Errorf("got %+v, want static devirtualization", r)
+	}
+	if r := find("inlineCall", 21, "x.T.M"); r != nil && r.Args["cost"] != 3.0 {
+		t.Errorf("got %+v, want cost 3", r)
+	}
+	find("isInBounds", 17, "")
+}
+
 func testLogOpt(t *testing.T, flag, src, outfile string) (string, error) {
 	run := []string{testenv.GoToolPath(t), "tool", "compile", "-p=p", flag, "-o", outfile, src}
 	t.Log(run)
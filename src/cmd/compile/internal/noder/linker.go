@@ -298,6 +298,9 @@ func (l *linker) relocFuncExt(w *pkgbits.Encoder, name *ir.Name) {
 	if inl := name.Func.Inl; w.Bool(inl != nil) {
 		w.Len(int(inl.Cost))
 		w.Bool(inl.CanDelayResults)
+		if buildcfg.Experiment.NewInliner {
+			w.String(inl.Properties)
+		}
 	}
 
 	w.Sync(pkgbits.SyncEOF)
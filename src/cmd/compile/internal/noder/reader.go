@@ -1117,6 +1117,9 @@ func (r *reader) funcExt(name *ir.Name, method *types.Sym) {
 				Cost:            int32(r.Len()),
 				CanDelayResults: r.Bool(),
 			}
+			if buildcfg.Experiment.NewInliner {
+				fn.Inl.Properties = r.String()
+			}
 		}
 	} else {
 		r.addBody(name.Func, method)
@@ -1771,7 +1774,14 @@ func (r *reader) stmt1(tag codeStmt, out *ir.Nodes) ir.Node {
 		pos := r.pos()
 		op := r.op()
 		call := r.expr()
-		return ir.NewGoDeferStmt(pos, op, call)
+		stmt := ir.NewGoDeferStmt(pos, op, call)
+		if op == ir.ODEFER {
+			x := r.optExpr()
+			if x != nil {
+				stmt.DeferAt = x.(ir.Expr)
+			}
+		}
+		return stmt
 
 	case stmtExpr:
 		return r.expr()
@@ -2467,6 +2477,10 @@ func (r *reader) expr() (res ir.Node) {
 		x.SetType(typ)
 		return x
 
+	case exprRuntimeBuiltin:
+		name := r.String()
+		return typecheck.Expr(typecheck.LookupRuntime(name))
+
 	case exprConvert:
 		implicit := r.Bool()
 		typ := r.typ()
@@ -1261,6 +1261,9 @@ func (w *writer) stmt1(stmt syntax.Stmt) {
 		w.pos(stmt)
 		w.op(callOps[stmt.Tok])
 		w.expr(stmt.Call)
+		if stmt.Tok == syntax.Defer {
+			w.optExpr(stmt.DeferAt)
+		}
 
 	case *syntax.DeclStmt:
 		for _, decl := range stmt.DeclList {
@@ -1673,6 +1676,15 @@ func (w *writer) expr(expr syntax.Expr) {
 			return
 		}
 
+		if tv.IsRuntimeHelper() {
+			if pkg := obj.Pkg(); pkg != nil && pkg.Name() == "runtime" {
+				objName := obj.Name()
+				w.Code(exprRuntimeBuiltin)
+				w.String(objName)
+				return
+			}
+		}
+
 		// With shape types (and particular pointer shaping), we may have
 		// an expression of type "go.shape.*uint8", but need to reshape it
 		// to another shape-identical type to allow use in field
@@ -136,6 +136,12 @@ type Profile struct {
 	// WeightedCG represents the IRGraph built from profile, which we will
 	// update as part of inlining.
 	WeightedCG *IRGraph
+
+	// LineWeights maps the linker symbol name of each function in the
+	// profile to the cumulative weight of each of its source lines,
+	// keyed by line offset from the function start line. It is used
+	// for profile-guided basic block layout.
+	LineWeights map[string]map[int]int64
 }
 
 // New generates a profile-graph from the profile.
@@ -175,7 +181,8 @@ func New(profileFile string) (*Profile, error) {
 	})
 
 	p := &Profile{
-		NodeMap: make(map[NodeMapKey]*Weights),
+		NodeMap:     make(map[NodeMapKey]*Weights),
+		LineWeights: make(map[string]map[int]int64),
 		WeightedCG: &IRGraph{
 			IRNodes: make(map[string]*IRNode),
 		},
@@ -228,6 +235,15 @@ func (p *Profile) processprofileGraph(g *graph.Graph) error {
 			CallSiteOffset: n.Info.Lineno - n.Info.StartLine,
 		}
 
+		if n.Info.StartLine != 0 {
+			lines := p.LineWeights[canonicalName]
+			if lines == nil {
+				lines = make(map[int]int64)
+				p.LineWeights[canonicalName] = lines
+			}
+			lines[nodeinfo.CallSiteOffset] += n.CumValue()
+		}
+
 		for _, e := range n.Out {
 			p.TotalEdgeWeight += e.WeightValue()
 			nodeinfo.CalleeName = e.Dest.Info.Name
@@ -310,6 +326,13 @@ func NodeLineOffset(n ir.Node, fn *ir.Func) int {
 	return line - startLine
 }
 
+// FuncLineWeights returns the cumulative profile weight of each source
+// line of fn, keyed by line offset as computed by NodeLineOffset, or nil
+// if the profile has no samples in fn.
+func (p *Profile) FuncLineWeights(fn *ir.Func) map[int]int64 {
+	return p.LineWeights[ir.LinkFuncName(fn)]
+}
+
 // addIREdge adds an edge between caller and new node that points to `callee`
 // based on the profile-graph and NodeMap.
 func (p *Profile) addIREdge(callerNode *IRNode, callerName string, call ir.Node, callee *ir.Func) {
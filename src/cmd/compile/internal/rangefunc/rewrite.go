@@ -0,0 +1,731 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package rangefunc rewrites range-over-func to code that doesn't use range-over-funcs.
+Rewriting the construct in the front end, before noder, means the functions generated during
+the rewrite are available in a noder-generated representation for inlining by the back end.
+
+# Theory of Operation
+
+The basic idea is to rewrite
+
+	for x := range f {
+		...
+	}
+
+into
+
+	f(func(x T) bool {
+		...
+		return true
+	})
+
+But it's not usually that easy.
+
+# Range variables
+
+For a range not using :=, the assigned variables cannot be function
+parameters in the generated body function. Instead, we allocate fake
+parameters and start the body with an assignment. For example:
+
+	for expr1, expr2 = range f {
+		...
+	}
+
+becomes
+
+	f(func(#p1 T1, #p2 T2) bool {
+		expr1, expr2 = #p1, #p2
+		...
+	})
+
+The := form is handled the same way, with a := assignment, so that the
+iteration variables keep their own declarations. (All the generated
+variables have a # at the start to signal that they are internal
+variables when looking at the generated code in a debugger. Because
+variables have all been resolved to the specific objects they
+represent, there is no danger of colliding with a Go variable.)
+
+# Break and continue
+
+A "continue" of the loop being rewritten turns into "return true", to
+tell f to proceed with the next value, and a "break" turns into
+"return false", to tell f to stop.
+
+Each loop also gets a variable #exitK that is set once the loop must
+not run its body again: when the body breaks out of the loop, and when
+f returns. The body function begins by checking it:
+
+	{
+		var #exit1 bool
+		f(func(x T) bool {
+			if #exit1 {
+				runtime.panicrangeexit()
+			}
+			...
+			{ #exit1 = true; return false } // break
+			...
+			return true
+		})
+		#exit1 = true
+	}
+
+so that an iterator that keeps calling yield after being told to stop,
+or after it has returned, panics instead of silently running the loop
+body again.
+
+# Return and other branches
+
+If the body contains a return, or a break, continue, or goto whose
+target is outside the body, then we need to stop the iteration and
+trigger that control flow once f returns. The outermost rewritten loop
+declares an integer #next that says what to do when f returns. Each
+such statement sets #next and then stops f. A check after the call of
+f completes the branch:
+
+	{
+		var #next int
+		var #exit1 bool
+		f(func(x T) bool {
+			...
+			{ #next = 1; #exit1 = true; return false } // break L
+			...
+		})
+		#exit1 = true
+		if #next == 1 {
+			#next = 0
+			break L
+		}
+	}
+
+A plain "return" uses #next = -1, and its check is a plain return. A
+return with results first stores the results in variables #r1, #r2, ...
+declared next to #next, uses #next = -2, and its check is
+
+	if #next == -2 {
+		return #r1, #r2
+	}
+
+# Nested loops
+
+When range-over-func loops nest, a branch may need to leave several
+body functions at once. Each rewritten loop whose body is left this way
+propagates the stop to the enclosing body function after its call:
+
+	if #next != 0 {
+		#exit1 = true
+		return false
+	}
+
+until the loop after which the branch is completed is reached.
+"continue L" and "break L" naming an enclosing range-over-func loop are
+completed by "return true" and "{#exitK = true; return false}" in that
+loop's body function.
+
+# Defers
+
+A defer statement in a loop body must run when the enclosing function
+returns, not when the body function returns. The outermost loop calls
+runtime.deferrangefunc to obtain a token for the enclosing function's
+defer chain:
+
+	var #defers = runtime.deferrangefunc()
+
+and each defer in a body is marked with that token (syntax.CallStmt's
+DeferAt field), which makes the compiler queue the deferred call
+through runtime.deferprocat instead of runtime.deferproc.
+*/
+package rangefunc
+
+import (
+	"cmd/compile/internal/syntax"
+	"cmd/compile/internal/types2"
+	"fmt"
+	"go/constant"
+)
+
+// A rewriter implements rewriting the range-over-funcs in a given function.
+type rewriter struct {
+	pkg  *types2.Package
+	info *types2.Info
+	sig  *types2.Signature // signature of the function being rewritten
+
+	// depth records, for each statement that can be the target of a
+	// branch, the number of range-over-func loops enclosing it.
+	depth map[syntax.Stmt]int
+
+	// forStack lists the range-over-func loops enclosing the
+	// statement being rewritten, outermost first.
+	forStack []*forLoop
+
+	// Variables shared by the loops nested in the outermost
+	// range-over-func loop being rewritten; nil until first needed.
+	next    *types2.Var
+	retVars []*types2.Var
+	defers  *types2.Var
+
+	codes map[branch]int // #next code for each branch leaving a loop body
+	nexit int            // number of #exit variables allocated
+}
+
+// A forLoop describes a range-over-func loop being rewritten.
+type forLoop struct {
+	nfor   *syntax.ForStmt
+	result types2.Type // result type of the body function
+	exit   *types2.Var // #exitK
+
+	checks    []check // branches completed after the loop, in order of first use
+	propagate bool    // whether branches leave the enclosing loop body too
+}
+
+// A check completes a branch after the call of a loop's iterator
+// returns: if #next == code, stmt runs.
+type check struct {
+	code int
+	stmt syntax.Stmt
+}
+
+// A branch identifies the destination of a branch statement.
+type branch struct {
+	target     syntax.Stmt
+	isContinue bool
+}
+
+// Rewrite rewrites all the range-over-funcs in the files.
+// The type information in info must have been stored in the syntax
+// (types2.Config.StoreTypesInSyntax); info.Defs and info.Uses are
+// updated to describe the generated code.
+func Rewrite(pkg *types2.Package, info *types2.Info, files []*syntax.File) {
+	for _, file := range files {
+		syntax.Inspect(file, func(n syntax.Node) bool {
+			switch n := n.(type) {
+			case *syntax.FuncDecl:
+				if n.Body != nil {
+					if obj, ok := info.Defs[n.Name].(*types2.Func); ok {
+						rewriteFunc(pkg, info, obj.Type().(*types2.Signature), n.Body)
+					}
+				}
+			case *syntax.FuncLit:
+				if sig, ok := n.GetTypeInfo().Type.(*types2.Signature); ok {
+					rewriteFunc(pkg, info, sig, n.Body)
+				}
+			}
+			return true
+		})
+	}
+}
+
+// rewriteFunc rewrites the range-over-func loops in body, the body
+// of a function with signature sig. Function literals within body
+// are left alone; Rewrite visits them separately.
+func rewriteFunc(pkg *types2.Package, info *types2.Info, sig *types2.Signature, body *syntax.BlockStmt) {
+	r := &rewriter{
+		pkg:   pkg,
+		info:  info,
+		sig:   sig,
+		depth: make(map[syntax.Stmt]int),
+	}
+	if !r.scanList(body.List, 0) {
+		return
+	}
+	r.stmtList(body.List)
+}
+
+// scanList records the depth of the branch targets in list, which is
+// nested in depth range-over-func loops, and reports whether list
+// contains any range-over-func loops.
+func (r *rewriter) scanList(list []syntax.Stmt, depth int) bool {
+	found := false
+	for _, s := range list {
+		if r.scan(s, depth) {
+			found = true
+		}
+	}
+	return found
+}
+
+// scan is like scanList for a single statement.
+func (r *rewriter) scan(s syntax.Stmt, depth int) bool {
+	switch s := s.(type) {
+	case *syntax.BlockStmt:
+		return r.scanList(s.List, depth)
+	case *syntax.LabeledStmt:
+		r.depth[s] = depth
+		return r.scan(s.Stmt, depth)
+	case *syntax.IfStmt:
+		found := r.scanList(s.Then.List, depth)
+		if s.Else != nil && r.scan(s.Else, depth) {
+			found = true
+		}
+		return found
+	case *syntax.ForStmt:
+		r.depth[s] = depth
+		if r.isRangeFunc(s) {
+			r.scanList(s.Body.List, depth+1)
+			return true
+		}
+		return r.scanList(s.Body.List, depth)
+	case *syntax.SwitchStmt:
+		r.depth[s] = depth
+		found := false
+		for _, c := range s.Body {
+			if r.scanList(c.Body, depth) {
+				found = true
+			}
+		}
+		return found
+	case *syntax.SelectStmt:
+		r.depth[s] = depth
+		found := false
+		for _, c := range s.Body {
+			if r.scanList(c.Body, depth) {
+				found = true
+			}
+		}
+		return found
+	}
+	return false
+}
+
+// isRangeFunc reports whether s is a range-over-func loop.
+func (r *rewriter) isRangeFunc(s *syntax.ForStmt) bool {
+	rclause, ok := s.Init.(*syntax.RangeClause)
+	if !ok {
+		return false
+	}
+	_, ok = types2.CoreType(rclause.X.GetTypeInfo().Type).(*types2.Signature)
+	return ok
+}
+
+// stmtList rewrites the statements in list in place.
+func (r *rewriter) stmtList(list []syntax.Stmt) {
+	for i, s := range list {
+		list[i] = r.stmt(s)
+	}
+}
+
+// stmt returns the rewritten form of s.
+func (r *rewriter) stmt(s syntax.Stmt) syntax.Stmt {
+	switch s := s.(type) {
+	case *syntax.BlockStmt:
+		r.stmtList(s.List)
+	case *syntax.LabeledStmt:
+		s.Stmt = r.stmt(s.Stmt)
+	case *syntax.IfStmt:
+		r.stmtList(s.Then.List)
+		if s.Else != nil {
+			s.Else = r.stmt(s.Else)
+		}
+	case *syntax.ForStmt:
+		if r.isRangeFunc(s) {
+			return r.rangeFunc(s)
+		}
+		r.stmtList(s.Body.List)
+	case *syntax.SwitchStmt:
+		for _, c := range s.Body {
+			r.stmtList(c.Body)
+		}
+	case *syntax.SelectStmt:
+		for _, c := range s.Body {
+			r.stmtList(c.Body)
+		}
+	case *syntax.BranchStmt:
+		if len(r.forStack) > 0 {
+			return r.branchStmt(s)
+		}
+	case *syntax.ReturnStmt:
+		if len(r.forStack) > 0 {
+			return r.returnStmt(s)
+		}
+	case *syntax.CallStmt:
+		if s.Tok == syntax.Defer && len(r.forStack) > 0 {
+			if r.defers == nil {
+				r.defers = r.newVar(s.Pos(), "#defers", anyType)
+			}
+			s.DeferAt = r.useVar(s.Pos(), r.defers)
+		}
+	}
+	return s
+}
+
+// rangeFunc returns the rewritten form of the range-over-func loop nfor.
+func (r *rewriter) rangeFunc(nfor *syntax.ForStmt) syntax.Stmt {
+	pos := nfor.Pos()
+	end := nfor.Body.Rbrace
+	rclause := nfor.Init.(*syntax.RangeClause)
+	ftyp := types2.CoreType(rclause.X.GetTypeInfo().Type).(*types2.Signature)
+	ytyp := types2.CoreType(ftyp.Params().At(0).Type()).(*types2.Signature)
+
+	r.nexit++
+	loop := &forLoop{
+		nfor:   nfor,
+		result: ytyp.Results().At(0).Type(),
+		exit:   r.newVar(pos, fmt.Sprintf("#exit%d", r.nexit), types2.Typ[types2.Bool]),
+	}
+
+	// Rewrite the loop body, noting the branches that leave it.
+	depth := len(r.forStack)
+	r.forStack = append(r.forStack, loop)
+	r.stmtList(nfor.Body.List)
+	r.forStack = r.forStack[:depth]
+
+	// Build the body function.
+	var params []*types2.Var
+	for i := 0; i < ytyp.Params().Len(); i++ {
+		params = append(params, types2.NewParam(pos, r.pkg, fmt.Sprintf("#p%d", i+1), ytyp.Params().At(i).Type()))
+	}
+	results := types2.NewTuple(types2.NewParam(pos, r.pkg, "", loop.result))
+	sig := types2.NewSignatureType(nil, nil, nil, types2.NewTuple(params...), results, false)
+
+	body := []syntax.Stmt{r.ifStmt(pos, r.useVar(pos, loop.exit), r.callStmt(pos, r.runtimeSym(pos, "panicrangeexit")))}
+	if rclause.Lhs != nil {
+		lhs := unpackListExpr(rclause.Lhs)
+		rhs := make([]syntax.Expr, len(lhs))
+		for i := range lhs {
+			rhs[i] = r.useVar(pos, params[i])
+		}
+		as := r.assign(pos, packListExpr(pos, lhs), packListExpr(pos, rhs))
+		if rclause.Def {
+			as.Op = syntax.Def
+		}
+		body = append(body, as)
+	}
+	body = append(body, nfor.Body.List...)
+	body = append(body, r.returnBool(end, loop, true))
+
+	lit := &syntax.FuncLit{
+		Type: &syntax.FuncType{},
+		Body: &syntax.BlockStmt{List: body, Rbrace: end},
+	}
+	lit.SetPos(pos)
+	lit.Type.SetPos(pos)
+	lit.Body.SetPos(nfor.Body.Pos())
+	setValueType(lit, sig)
+
+	call := &syntax.CallExpr{Fun: rclause.X, ArgList: []syntax.Expr{lit}}
+	call.SetPos(pos)
+	setVoidType(call)
+
+	// Assemble the replacement block.
+	block := &syntax.BlockStmt{Rbrace: end}
+	block.SetPos(pos)
+	next := r.next
+	if depth == 0 {
+		if next != nil {
+			block.List = append(block.List, r.varDecl(pos, next, nil))
+		}
+		for _, v := range r.retVars {
+			block.List = append(block.List, r.varDecl(pos, v, nil))
+		}
+		if r.defers != nil {
+			call := &syntax.CallExpr{Fun: r.runtimeSym(pos, "deferrangefunc")}
+			call.SetPos(pos)
+			setValueType(call, anyType)
+			block.List = append(block.List, r.varDecl(pos, r.defers, call))
+		}
+		r.next, r.retVars, r.defers, r.codes = nil, nil, nil, nil
+	}
+	block.List = append(block.List,
+		r.varDecl(pos, loop.exit, nil),
+		r.exprStmt(pos, call),
+		r.assign(end, r.useVar(end, loop.exit), r.boolLit(end, types2.Typ[types2.Bool], true)),
+	)
+	for _, c := range loop.checks {
+		then := c.stmt
+		if c.code > 0 {
+			// Reset #next so that enclosing loops do not act on it too.
+			then = r.block(end, r.assign(end, r.useVar(end, next), r.intLit(end, 0)), c.stmt)
+		}
+		block.List = append(block.List, r.ifStmt(end, r.compareNext(end, next, syntax.Eql, c.code), then))
+	}
+	if loop.propagate {
+		outer := r.forStack[depth-1]
+		block.List = append(block.List, r.ifStmt(end, r.compareNext(end, next, syntax.Neq, 0), r.returnBool(end, outer, false)))
+	}
+	return block
+}
+
+// branchStmt returns the rewritten form of the branch statement s,
+// which appears in the body of the innermost loop on r.forStack.
+func (r *rewriter) branchStmt(s *syntax.BranchStmt) syntax.Stmt {
+	if s.Tok == syntax.Fallthrough {
+		return s
+	}
+	pos := s.Pos()
+	depth := len(r.forStack)
+	key := branch{target: s.Target, isContinue: s.Tok == syntax.Continue}
+
+	// Break or continue of a range-over-func loop.
+	for i, loop := range r.forStack {
+		if loop.nfor != s.Target {
+			continue
+		}
+		stmt := r.returnBool(pos, loop, key.isContinue)
+		if i == depth-1 {
+			return stmt
+		}
+		return r.exitTo(pos, i+1, r.code(key), stmt)
+	}
+
+	// Branches within the innermost loop body are unaffected.
+	t := r.depth[s.Target]
+	if t >= depth {
+		return s
+	}
+
+	b := &syntax.BranchStmt{Tok: s.Tok, Label: s.Label, Target: s.Target}
+	b.SetPos(pos)
+	return r.exitTo(pos, t, r.code(key), b)
+}
+
+// returnStmt returns the rewritten form of the return statement s,
+// which appears in the body of the innermost loop on r.forStack.
+func (r *rewriter) returnStmt(s *syntax.ReturnStmt) syntax.Stmt {
+	pos := s.Pos()
+	if s.Results == nil {
+		ret := &syntax.ReturnStmt{}
+		ret.SetPos(pos)
+		return r.exitTo(pos, 0, -1, ret)
+	}
+
+	if r.retVars == nil {
+		results := r.sig.Results()
+		for i := 0; i < results.Len(); i++ {
+			r.retVars = append(r.retVars, r.newVar(pos, fmt.Sprintf("#r%d", i+1), results.At(i).Type()))
+		}
+	}
+	lhs := make([]syntax.Expr, len(r.retVars))
+	rets := make([]syntax.Expr, len(r.retVars))
+	for i, v := range r.retVars {
+		lhs[i] = r.useVar(pos, v)
+		rets[i] = r.useVar(pos, v)
+	}
+	ret := &syntax.ReturnStmt{Results: packListExpr(pos, rets)}
+	ret.SetPos(pos)
+	return r.block(pos,
+		r.assign(pos, packListExpr(pos, lhs), s.Results),
+		r.exitTo(pos, 0, -2, ret),
+	)
+}
+
+// exitTo returns the statements that stop the loops r.forStack[level:]
+// so that action runs after the call of r.forStack[level]'s iterator
+// returns.
+func (r *rewriter) exitTo(pos syntax.Pos, level, code int, action syntax.Stmt) syntax.Stmt {
+	next := r.nextVar(pos)
+	loop := r.forStack[level]
+	if !loop.hasCheck(code) {
+		loop.checks = append(loop.checks, check{code, action})
+	}
+	for _, l := range r.forStack[level+1:] {
+		l.propagate = true
+	}
+	inner := r.forStack[len(r.forStack)-1]
+	return r.block(pos,
+		r.assign(pos, r.useVar(pos, next), r.intLit(pos, code)),
+		r.returnBool(pos, inner, false),
+	)
+}
+
+// hasCheck reports whether loop already has a check for code.
+func (loop *forLoop) hasCheck(code int) bool {
+	for _, c := range loop.checks {
+		if c.code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// code returns the #next code for completing the branch to key.
+func (r *rewriter) code(key branch) int {
+	if c, ok := r.codes[key]; ok {
+		return c
+	}
+	if r.codes == nil {
+		r.codes = make(map[branch]int)
+	}
+	c := len(r.codes) + 1
+	r.codes[key] = c
+	return c
+}
+
+// nextVar returns the #next variable, allocating it if needed.
+func (r *rewriter) nextVar(pos syntax.Pos) *types2.Var {
+	if r.next == nil {
+		r.next = r.newVar(pos, "#next", types2.Typ[types2.Int])
+	}
+	return r.next
+}
+
+// returnBool returns a statement that returns val from loop's body
+// function. Returning false also marks loop as exited.
+func (r *rewriter) returnBool(pos syntax.Pos, loop *forLoop, val bool) syntax.Stmt {
+	ret := &syntax.ReturnStmt{Results: r.boolLit(pos, loop.result, val)}
+	ret.SetPos(pos)
+	if val {
+		return ret
+	}
+	return r.block(pos, r.assign(pos, r.useVar(pos, loop.exit), r.boolLit(pos, types2.Typ[types2.Bool], true)), ret)
+}
+
+// compareNext returns the expression "#next op code".
+func (r *rewriter) compareNext(pos syntax.Pos, next *types2.Var, op syntax.Operator, code int) syntax.Expr {
+	x := &syntax.Operation{Op: op, X: r.useVar(pos, next), Y: r.intLit(pos, code)}
+	x.SetPos(pos)
+	setValueType(x, types2.Typ[types2.UntypedBool])
+	return x
+}
+
+// newVar returns a new local variable with the given name and type.
+func (r *rewriter) newVar(pos syntax.Pos, name string, typ types2.Type) *types2.Var {
+	return types2.NewVar(pos, r.pkg, name, typ)
+}
+
+// useVar returns a reference to v.
+func (r *rewriter) useVar(pos syntax.Pos, v *types2.Var) *syntax.Name {
+	n := syntax.NewName(pos, v.Name())
+	tv := syntax.TypeAndValue{Type: v.Type()}
+	tv.SetIsValue()
+	tv.SetAddressable()
+	tv.SetAssignable()
+	n.SetTypeInfo(tv)
+	r.info.Uses[n] = v
+	return n
+}
+
+// varDecl returns the declaration "var v = value", or "var v" if
+// value is nil.
+func (r *rewriter) varDecl(pos syntax.Pos, v *types2.Var, value syntax.Expr) syntax.Stmt {
+	n := syntax.NewName(pos, v.Name())
+	r.info.Defs[n] = v
+	decl := &syntax.VarDecl{NameList: []*syntax.Name{n}, Values: value}
+	decl.SetPos(pos)
+	stmt := &syntax.DeclStmt{DeclList: []syntax.Decl{decl}}
+	stmt.SetPos(pos)
+	return stmt
+}
+
+// assign returns the assignment "lhs = rhs".
+func (r *rewriter) assign(pos syntax.Pos, lhs, rhs syntax.Expr) *syntax.AssignStmt {
+	as := &syntax.AssignStmt{Lhs: lhs, Rhs: rhs}
+	as.SetPos(pos)
+	return as
+}
+
+// block returns a block holding list.
+func (r *rewriter) block(pos syntax.Pos, list ...syntax.Stmt) *syntax.BlockStmt {
+	b := &syntax.BlockStmt{List: list, Rbrace: pos}
+	b.SetPos(pos)
+	return b
+}
+
+// ifStmt returns the statement "if cond { then }".
+func (r *rewriter) ifStmt(pos syntax.Pos, cond syntax.Expr, then syntax.Stmt) syntax.Stmt {
+	s := &syntax.IfStmt{Cond: cond, Then: r.block(pos, then)}
+	s.SetPos(pos)
+	return s
+}
+
+// exprStmt returns the expression statement x.
+func (r *rewriter) exprStmt(pos syntax.Pos, x syntax.Expr) syntax.Stmt {
+	s := &syntax.ExprStmt{X: x}
+	s.SetPos(pos)
+	return s
+}
+
+// callStmt returns the statement "fn()" for a function fn without
+// results.
+func (r *rewriter) callStmt(pos syntax.Pos, fn syntax.Expr) syntax.Stmt {
+	call := &syntax.CallExpr{Fun: fn}
+	call.SetPos(pos)
+	setVoidType(call)
+	return r.exprStmt(pos, call)
+}
+
+// boolLit returns the boolean constant val with type typ.
+func (r *rewriter) boolLit(pos syntax.Pos, typ types2.Type, val bool) syntax.Expr {
+	n := syntax.NewName(pos, fmt.Sprint(val))
+	tv := syntax.TypeAndValue{Type: typ, Value: constant.MakeBool(val)}
+	tv.SetIsValue()
+	n.SetTypeInfo(tv)
+	r.info.Uses[n] = types2.Universe.Lookup(n.Value)
+	return n
+}
+
+// intLit returns the int constant val.
+func (r *rewriter) intLit(pos syntax.Pos, val int) syntax.Expr {
+	lit := &syntax.BasicLit{Value: fmt.Sprint(val), Kind: syntax.IntLit}
+	lit.SetPos(pos)
+	tv := syntax.TypeAndValue{Type: types2.Typ[types2.Int], Value: constant.MakeInt64(int64(val))}
+	tv.SetIsValue()
+	lit.SetTypeInfo(tv)
+	return lit
+}
+
+// runtimePkg is a fake runtime package holding the declarations of the
+// runtime helpers called by rewritten code. The noder resolves
+// references to them to the real runtime functions.
+var runtimePkg = func() *types2.Package {
+	pkg := types2.NewPackage("runtime", "runtime")
+	noParams := types2.NewTuple()
+	anyResult := types2.NewTuple(types2.NewParam(nopos, pkg, "", anyType))
+	do := func(name string, results *types2.Tuple) {
+		sig := types2.NewSignatureType(nil, nil, nil, noParams, results, false)
+		pkg.Scope().Insert(types2.NewFunc(nopos, pkg, name, sig))
+	}
+	do("deferrangefunc", anyResult)
+	do("panicrangeexit", noParams)
+	return pkg
+}()
+
+// runtimeSym returns a reference to the runtime helper with the given name.
+func (r *rewriter) runtimeSym(pos syntax.Pos, name string) *syntax.Name {
+	obj := runtimePkg.Scope().Lookup(name)
+	n := syntax.NewName(pos, "runtime."+name)
+	tv := syntax.TypeAndValue{Type: obj.Type()}
+	tv.SetIsValue()
+	tv.SetIsRuntimeHelper()
+	n.SetTypeInfo(tv)
+	r.info.Uses[n] = obj
+	return n
+}
+
+var (
+	nopos   syntax.Pos
+	anyType = types2.Universe.Lookup("any").Type()
+)
+
+// setValueType records that x is a value of type typ.
+func setValueType(x syntax.Expr, typ types2.Type) {
+	tv := syntax.TypeAndValue{Type: typ}
+	tv.SetIsValue()
+	x.SetTypeInfo(tv)
+}
+
+// setVoidType records that x is a call without results.
+func setVoidType(x syntax.Expr) {
+	tv := syntax.TypeAndValue{Type: (*types2.Tuple)(nil)}
+	tv.SetIsVoid()
+	x.SetTypeInfo(tv)
+}
+
+// unpackListExpr returns the elements of expr, which may be a list.
+func unpackListExpr(expr syntax.Expr) []syntax.Expr {
+	if list, ok := expr.(*syntax.ListExpr); ok {
+		return list.ElemList
+	}
+	return []syntax.Expr{expr}
+}
+
+// packListExpr returns list as a single expression.
+func packListExpr(pos syntax.Pos, list []syntax.Expr) syntax.Expr {
+	if len(list) == 1 {
+		return list[0]
+	}
+	x := &syntax.ListExpr{ElemList: list}
+	x.SetPos(pos)
+	return x
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"internal/abi"
+	"internal/buildcfg"
 	"os"
 	"sort"
 	"strings"
@@ -221,8 +222,9 @@ func MapType(t *types.Type) *types.Type {
 	//    oldbuckets *bmap
 	//    nevacuate  uintptr
 	//    extra      unsafe.Pointer // *mapextra
+	//    clearseq   uintptr        // GOEXPERIMENT=swissmap only
 	// }
-	// must match runtime/map.go:hmap.
+	// must match runtime/map.go:hmap, or runtime/map_swiss.go:hmap.
 	fields := []*types.Field{
 		makefield("count", types.Types[types.TINT]),
 		makefield("flags", types.Types[types.TUINT8]),
@@ -234,14 +236,22 @@ func MapType(t *types.Type) *types.Type {
 		makefield("nevacuate", types.Types[types.TUINTPTR]),
 		makefield("extra", types.Types[types.TUNSAFEPTR]),
 	}
+	if buildcfg.Experiment.SwissMap {
+		fields = append(fields, makefield("clearseq", types.Types[types.TUINTPTR]))
+	}
 
 	hmap := types.NewStruct(fields)
 	hmap.SetNoalg(true)
 	types.CalcSize(hmap)
 
 	// The size of hmap should be 48 bytes on 64 bit
-	// and 28 bytes on 32 bit platforms.
-	if size := int64(8 + 5*types.PtrSize); hmap.Size() != size {
+	// and 28 bytes on 32 bit platforms, plus a word
+	// for the Swiss table implementation.
+	size := int64(8 + 5*types.PtrSize)
+	if buildcfg.Experiment.SwissMap {
+		size += int64(types.PtrSize)
+	}
+	if hmap.Size() != size {
 		base.Fatalf("hmap size not correct: got %d, want %d", hmap.Size(), size)
 	}
 
@@ -28,6 +28,11 @@ type Block struct {
 	// Fatal if not BranchUnknown and len(Succs) > 2.
 	Likely BranchPrediction
 
+	// Hotness records whether a CPU profile showed this block executing,
+	// for profile-guided block layout and register allocation.
+	// See Hotness for what layout does with cold blocks.
+	Hotness Hotness
+
 	// After flagalloc, records whether flags are live at the end of the block.
 	FlagsLiveAtEnd bool
 
@@ -150,6 +155,12 @@ func (b *Block) LongString() string {
 	case BranchLikely:
 		s += " (likely)"
 	}
+	switch b.Hotness {
+	case HotnessCold:
+		s += " (cold)"
+	case HotnessHot:
+		s += " (hot)"
+	}
 	return s
 }
 
@@ -419,3 +430,17 @@ const (
 	BranchUnknown  = BranchPrediction(0)
 	BranchLikely   = BranchPrediction(+1)
 )
+
+// Hotness classifies how often a block executes according to a profile.
+//
+// Layout only moves cold blocks to the end of their function, like exit
+// blocks, and regalloc prefers to spill values used only in them. Cold
+// blocks are not split out into a separate text section, so they still
+// take up space in the function's text, next to its hot code.
+type Hotness int8
+
+const (
+	HotnessUnknown = Hotness(0)  // no profile information
+	HotnessCold    = Hotness(-1) // not sampled, although its function was
+	HotnessHot     = Hotness(+1) // sampled
+)
@@ -39,9 +39,12 @@ func layoutOrder(f *Func) []*Block {
 	defer f.retSparseSet(exit)
 
 	// Populate idToBlock and find exit blocks.
+	// Blocks that a profile showed to be cold are treated like exit
+	// blocks, which moves them to the end of the function, out of the
+	// way of the hot code. They are not moved out of the function.
 	for _, b := range f.Blocks {
 		idToBlock[b.ID] = b
-		if b.Kind == BlockExit {
+		if b.Kind == BlockExit || b.Hotness == HotnessCold && b != f.Entry {
 			exit.add(b.ID)
 		}
 	}
@@ -2721,6 +2721,12 @@ func (s *regAllocState) computeLive() {
 						delta = unlikelyDistance
 					}
 				}
+				if b.Hotness == HotnessCold && p.Hotness != HotnessCold {
+					// Uses in code a profile showed to be cold are
+					// treated as far away, so that values needed only
+					// there are spilled in preference to others.
+					delta = unlikelyDistance
+				}
 
 				// Update any desired registers at the end of p.
 				s.desired[p.ID].merge(&desired)
@@ -0,0 +1,124 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssagen
+
+import (
+	"fmt"
+
+	"cmd/compile/internal/base"
+	"cmd/compile/internal/ir"
+	"cmd/compile/internal/pgo"
+	"cmd/compile/internal/ssa"
+	"cmd/internal/src"
+)
+
+const (
+	// pgoHotFuncPercent is the minimum weight, as a percentage of the
+	// total profile weight, of the hottest line of a function for its
+	// unsampled blocks to be marked cold.
+	pgoHotFuncPercent = 0.1
+
+	// pgoBranchRatio is how many times the weight of one successor of a
+	// branch must exceed the other's for the branch to be predicted.
+	pgoBranchRatio = 10
+
+	// pgoMaxForward is how many position-less plain blocks are followed
+	// when looking for the weight of a branch successor.
+	pgoMaxForward = 4
+)
+
+// pgoAnnotateBlocks uses the per-line sample weights in profile to
+// predict the unpredicted branches of f, the SSA form of fn, and to
+// mark its blocks hot or cold. Layout moves cold blocks out of the
+// hot path, and register allocation prefers to spill values that are
+// only needed in cold blocks.
+//
+// Profile weights are CPU time, not execution counts, so only large
+// differences between the successors of a branch are trusted.
+func pgoAnnotateBlocks(f *ssa.Func, fn *ir.Func, profile *pgo.Profile) {
+	lines := profile.FuncLineWeights(fn)
+	if lines == nil {
+		// No samples at all. The function may be cold, or the
+		// profile may be stale; leave it alone.
+		return
+	}
+
+	// See "A note on line numbers" in package pgo.
+	start := int(base.Ctxt.InnermostPos(fn.Pos()).RelLine())
+	var max int64
+	for _, w := range lines {
+		if w > max {
+			max = w
+		}
+	}
+	hot := pgo.WeightInPercentage(max, profile.TotalNodeWeight) >= pgoHotFuncPercent
+
+	// Compute the weight of each block from the positions in it. Code
+	// inlined into fn is attributed to the line of its call site.
+	weight := make([]int64, f.NumBlocks())
+	known := make([]bool, f.NumBlocks())
+	add := func(b *ssa.Block, pos src.XPos) {
+		if !pos.IsKnown() {
+			return
+		}
+		line := int(base.Ctxt.OutermostPos(pos).RelLine())
+		if w := lines[line-start]; w > weight[b.ID] {
+			weight[b.ID] = w
+		}
+		known[b.ID] = true
+	}
+	for _, b := range f.Blocks {
+		add(b, b.Pos)
+		for _, v := range b.Values {
+			add(b, v.Pos)
+		}
+	}
+
+	// blockWeight returns the weight of b, looking through blocks
+	// that carry no positions of their own.
+	blockWeight := func(b *ssa.Block) (int64, bool) {
+		for i := 0; i < pgoMaxForward && !known[b.ID]; i++ {
+			if len(b.Succs) != 1 {
+				return 0, false
+			}
+			b = b.Succs[0].Block()
+		}
+		return weight[b.ID], known[b.ID]
+	}
+
+	var nbranch, ncold int
+	for _, b := range f.Blocks {
+		if w, ok := blockWeight(b); ok {
+			switch {
+			case w > 0:
+				b.Hotness = ssa.HotnessHot
+			case hot && b != f.Entry:
+				b.Hotness = ssa.HotnessCold
+				ncold++
+			}
+		}
+
+		if b.Kind != ssa.BlockIf || b.Likely != ssa.BranchUnknown {
+			continue
+		}
+		w0, ok0 := blockWeight(b.Succs[0].Block())
+		w1, ok1 := blockWeight(b.Succs[1].Block())
+		if !ok0 || !ok1 {
+			continue
+		}
+		switch {
+		case w0 > pgoBranchRatio*w1:
+			b.Likely = ssa.BranchLikely
+			nbranch++
+		case w1 > pgoBranchRatio*w0:
+			b.Likely = ssa.BranchUnlikely
+			nbranch++
+		}
+	}
+
+	if base.Debug.PGODebug >= 2 {
+		fmt.Printf("%v: PGO block layout for %v: %d branches predicted, %d cold blocks\n", ir.Line(fn), ir.FuncName(fn), nbranch, ncold)
+	}
+}
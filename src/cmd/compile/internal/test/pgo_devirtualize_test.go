@@ -64,6 +64,24 @@ go 1.19
 			pos:    "./devirt.go:61:31",
 			callee: "Add.Add",
 		},
+		{
+			pos:    "./devirt.go:113:16",
+			callee: "mult.MultFn",
+		},
+		{
+			pos:    "./devirt.go:113:28",
+			callee: "AddFn",
+		},
+		{
+			pos:    "./devirt.go:133:21",
+			callee: "mult.MultFn",
+		},
+		{
+			pos:    "./devirt.go:133:37",
+			callee: "AddFn",
+		},
+		// ExerciseFuncClosure is not devirtualized; its hot callee is
+		// a closure.
 	}
 
 	got := make(map[devirtualization]struct{})
@@ -0,0 +1,75 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package test
+
+import (
+	"fmt"
+	"internal/testenv"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// TestPGOBlockLayout tests that the profile is used to annotate the
+// blocks of hot functions, and that the annotated code still runs.
+func TestPGOBlockLayout(t *testing.T) {
+	testenv.MustHaveGoRun(t)
+	t.Parallel()
+
+	const pkg = "example.com/pgo/inline"
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("error getting wd: %v", err)
+	}
+	srcDir := filepath.Join(wd, "testdata/pgo/inline")
+
+	// Copy the module to a scratch location so we can add a go.mod.
+	dir := t.TempDir()
+	for _, file := range []string{"inline_hot.go", "inline_hot_test.go", "inline_hot.pprof"} {
+		if err := copyFile(filepath.Join(dir, file), filepath.Join(srcDir, file)); err != nil {
+			t.Fatalf("error copying %s: %v", file, err)
+		}
+	}
+	goMod := fmt.Sprintf(`module %s
+go 1.19
+`, pkg)
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0644); err != nil {
+		t.Fatalf("error writing go.mod: %v", err)
+	}
+
+	// Build and run the benchmark once with the profile, checking the
+	// SSA after every pass.
+	pprof := filepath.Join(dir, "inline_hot.pprof")
+	gcflag := fmt.Sprintf("-gcflags=-pgoprofile=%s -d=pgodebug=2,ssa/check/on", pprof)
+	cmd := testenv.CleanCmdEnv(testenv.Command(t, testenv.GoToolPath(t), "test", gcflag, "-run=^$", "-bench=.", "-benchtime=1x", "."))
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	t.Logf("%s", out)
+	if err != nil {
+		t.Fatalf("error running go test: %v", err)
+	}
+
+	layout := regexp.MustCompile(`: PGO block layout for (.*): (\d+) branches predicted, (\d+) cold blocks`)
+	got := make(map[string]int)
+	for _, m := range layout.FindAllStringSubmatch(string(out), -1) {
+		branches, _ := strconv.Atoi(m[2])
+		cold, _ := strconv.Atoi(m[3])
+		got[m[1]] = branches + cold
+	}
+
+	// Both functions are hot and have code paths that the profile
+	// never reached.
+	for _, fn := range []string{"A", "(*BS).NS"} {
+		n, ok := got[fn]
+		if !ok {
+			t.Errorf("%s not annotated; got %v", fn, got)
+		} else if n == 0 {
+			t.Errorf("%s has no predicted branches or cold blocks", fn)
+		}
+	}
+}
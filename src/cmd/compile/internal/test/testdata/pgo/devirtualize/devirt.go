@@ -70,4 +70,94 @@ func init() {
 	m.Multiply(42, 0)
 	n := mult.NegMult{}
 	n.Multiply(42, 0)
+	mult.MultFn(42, 0)
+	mult.NegMultFn(42, 0)
+}
+
+type AddFunc func(a, b int) int
+
+func AddFn(a, b int) int {
+	for i := 0; i < 1000; i++ {
+		sink++
+	}
+	return a + b
+}
+
+func SubFn(a, b int) int {
+	for i := 0; i < 1000; i++ {
+		sink++
+	}
+	return a - b
+}
+
+// ExerciseFuncConcrete calls mostly a1 and m1.
+//
+//go:noinline
+func ExerciseFuncConcrete(iter int, a1, a2 AddFunc, m1, m2 mult.MultFunc) {
+	for i := 0; i < iter; i++ {
+		a := a1
+		m := m1
+		if i%10 == 0 {
+			a = a2
+			m = m2
+		}
+
+		// N.B. Profiles only distinguish calls on a per-line level,
+		// making the two calls ambiguous. However because the
+		// function types are mutually exclusive, devirtualization can
+		// still select the correct callee for each.
+		//
+		// If they were not mutually exclusive (for example, two
+		// AddFunc calls), then we could not definitively select the
+		// correct callee.
+		sink += int(m(42, int64(a(1, 2))))
+	}
+}
+
+// Handler holds callbacks in struct fields.
+type Handler struct {
+	Add  AddFunc
+	Mult mult.MultFunc
+}
+
+// ExerciseFuncField calls mostly h1's callbacks.
+//
+//go:noinline
+func ExerciseFuncField(iter int, h1, h2 *Handler) {
+	for i := 0; i < iter; i++ {
+		h := h1
+		if i%10 == 0 {
+			h = h2
+		}
+
+		sink += int(h.Mult(42, int64(h.Add(1, 2))))
+	}
+}
+
+// AddClosure returns a closure that captures its argument.
+//
+//go:noinline
+func AddClosure(c int) AddFunc {
+	return func(a, b int) int {
+		for i := 0; i < 1000; i++ {
+			sink++
+		}
+		return a + b + c
+	}
+}
+
+// ExerciseFuncClosure calls mostly a1, which is a closure. Closures
+// are not devirtualized, as the direct call would lose the closure
+// context.
+//
+//go:noinline
+func ExerciseFuncClosure(iter int, a1, a2 AddFunc) {
+	for i := 0; i < iter; i++ {
+		a := a1
+		if i%10 == 0 {
+			a = a2
+		}
+
+		sink += a(1, 2)
+	}
 }
@@ -27,3 +27,17 @@ func BenchmarkDevirt(b *testing.B) {
 
 	Exercise(b.N, a1, a2, m1, m2)
 }
+
+func BenchmarkDevirtFuncConcrete(b *testing.B) {
+	ExerciseFuncConcrete(b.N, AddFn, SubFn, mult.MultFn, mult.NegMultFn)
+}
+
+func BenchmarkDevirtFuncField(b *testing.B) {
+	h1 := &Handler{Add: AddFn, Mult: mult.MultFn}
+	h2 := &Handler{Add: SubFn, Mult: mult.NegMultFn}
+	ExerciseFuncField(b.N, h1, h2)
+}
+
+func BenchmarkDevirtFuncClosure(b *testing.B) {
+	ExerciseFuncClosure(b.N, AddClosure(1), AddClosure(2))
+}
@@ -30,3 +30,19 @@ func (NegMult) Multiply(a, b int) int {
 	}
 	return -1 * a * b
 }
+
+type MultFunc func(a, b int64) int64
+
+func MultFn(a, b int64) int64 {
+	for i := 0; i < 1000; i++ {
+		sink++
+	}
+	return a * b
+}
+
+func NegMultFn(a, b int64) int64 {
+	for i := 0; i < 1000; i++ {
+		sink++
+	}
+	return -1 * a * b
+}
@@ -22,11 +22,15 @@ func panicmakeslicelen()
 func panicmakeslicecap()
 func throwinit()
 func panicwrap()
+func panicrangeexit()
 
 func gopanic(interface{})
 func gorecover(*int32) interface{}
 func goschedguarded()
 
+// defer in range over func
+func deferrangefunc() interface{}
+
 // Note: these declarations are just for wasm port.
 // Other ports call assembly stubs instead.
 func goPanicIndex(x int, y int)
@@ -427,10 +427,18 @@ func (b *Builder) useCache(a *Action, actionHash cache.ActionID, target string,
 	}
 
 	// If user requested -a, we force a rebuild, so don't use the cache.
+	// Likewise if the compiler must write a -json optimization report,
+	// which the cache does not hold.
+	staleReason := ""
 	if cfg.BuildA {
+		staleReason = "build -a flag in use"
+	} else if a.Mode == "build" && a.Package != nil && gcWritesReport(a.Package.Internal.Gcflags) {
+		staleReason = "-gcflags=-json in use"
+	}
+	if staleReason != "" {
 		if p := a.Package; p != nil && !p.Stale {
 			p.Stale = true
-			p.StaleReason = "build -a flag in use"
+			p.StaleReason = staleReason
 		}
 		// Begin saving output for later writing to cache.
 		a.output = []byte{}
@@ -273,6 +273,22 @@ func gcBackendConcurrency(gcflags []string) int {
 	return c
 }
 
+// gcWritesReport reports whether gcflags ask the compiler to write an
+// optimization report with -json. The compiler writes the report to a
+// directory of the user's choosing, outside the build cache, so a
+// compilation satisfied from the cache would not write it.
+func gcWritesReport(gcflags []string) bool {
+	for _, f := range gcflags {
+		if !strings.HasPrefix(f, "-") {
+			continue
+		}
+		if name, _, _ := strings.Cut(strings.TrimLeft(f, "-"), "="); name == "json" {
+			return true
+		}
+	}
+	return false
+}
+
 // trimpath returns the -trimpath argument to use
 // when compiling the action.
 func (a *Action) trimpath() string {
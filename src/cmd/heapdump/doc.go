@@ -0,0 +1,54 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Heapdump analyzes heap dumps written by runtime/debug.WriteHeapDump,
+to find out what is using memory in a program and what keeps it alive.
+
+Usage:
+
+	go tool heapdump [-n rows] command args...
+
+The commands are:
+
+	types dump
+		Print the number and total size of the objects of each type,
+		largest first.
+	top dump
+		Print the objects with the largest retained size, where the
+		retained size of an object is the total size of the objects
+		that would be freed if that object were freed: the objects
+		it dominates in the reference graph of the heap.
+	retainers dump address
+		Print why the object containing address is alive: a shortest
+		path of references to it from a root, such as a global variable
+		or a local variable on a goroutine stack, and the objects that
+		dominate it, which appear on every such path.
+	diff old new
+		Print how the number and total size of the objects of each type
+		changed between two dumps of the same program, largest change
+		first. Types whose objects grow from one dump to the next are
+		likely leaks.
+
+The -n flag limits the number of rows printed by each command, 25 by
+default. Zero means no limit.
+
+Heap objects only have types in the dump if the program was started
+with GODEBUG=heapdumptypes=1. That setting slows down every allocation
+and uses up to two extra words of memory per heap object, so use it to
+debug a program, not in production. Other objects are grouped by their
+block size, such as "<unknown 48-byte block>". An object of type T that
+is at least twice the size of T is an array of T, and is shown as "[]T".
+
+For example, to see which types grow between two points in a program:
+
+	$ GODEBUG=heapdumptypes=1 ./myprog   # calls debug.WriteHeapDump twice
+	$ go tool heapdump diff before.dump after.dump
+	$ go tool heapdump top after.dump
+	$ go tool heapdump retainers after.dump 0xc000123450
+
+The format of heap dumps is documented in the source of package
+cmd/internal/heapdump.
+*/
+package main
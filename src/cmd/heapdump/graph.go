@@ -0,0 +1,311 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"cmd/internal/heapdump"
+)
+
+// A graph is the reference graph of the objects in a heap dump.
+//
+// Node 0 is a pseudo-root with an edge to every object that is
+// referenced from a root, such as a global variable or a stack frame.
+// Node i+1 is the object d.Objects[i].
+type graph struct {
+	d *heapdump.Dump
+
+	// The edges out of node v are edges[start[v]:start[v+1]].
+	// The edges into node v are redges[rstart[v]:rstart[v+1]].
+	start  []int
+	edges  []int32
+	rstart []int
+	redges []int32
+
+	// roots[k] describes the root behind edges[k], an edge out of node 0.
+	roots []string
+}
+
+// newGraph builds the reference graph of d.
+func newGraph(d *heapdump.Dump) *graph {
+	g := &graph{d: d}
+
+	// Edges out of the pseudo-root.
+	g.start = make([]int, 0, len(d.Objects)+2)
+	g.start = append(g.start, 0)
+	addRoot := func(desc string, ptr uint64) {
+		if o := g.node(ptr); o != 0 {
+			g.edges = append(g.edges, o)
+			g.roots = append(g.roots, desc)
+		}
+	}
+	for _, s := range []*heapdump.Segment{d.Data, d.BSS} {
+		if s == nil {
+			continue
+		}
+		d.Pointers(s.Data, s.Fields, func(off, ptr uint64) {
+			addRoot(fmt.Sprintf("global variable at %#x", s.Addr+off), ptr)
+		})
+	}
+	for _, gr := range d.Goroutines {
+		for _, f := range gr.Frames {
+			d.Pointers(f.Data, f.Fields, func(off, ptr uint64) {
+				addRoot(fmt.Sprintf("local variable in %s (goroutine %d)", f.Func, gr.ID), ptr)
+			})
+		}
+		addRoot(fmt.Sprintf("context of goroutine %d", gr.ID), gr.Ctxt)
+	}
+	for _, df := range d.Defers {
+		addRoot("deferred function", df.FuncVal)
+	}
+	for _, p := range d.Panics {
+		addRoot("panic value", p.Data)
+	}
+	for _, r := range d.OtherRoots {
+		addRoot(r.Description, r.Addr)
+	}
+	for _, f := range d.Finalizers {
+		addRoot(fmt.Sprintf("finalizer for %#x", f.Obj), f.FuncVal)
+		if f.Queued {
+			addRoot("queued finalizer argument", f.Obj)
+			continue
+		}
+		// The garbage collector keeps everything that an object with
+		// a finalizer points to alive, but not the object itself.
+		if o := d.FindObject(f.Obj); o != nil {
+			d.Pointers(o.Data, o.Fields, func(_, ptr uint64) {
+				addRoot(fmt.Sprintf("object %#x with finalizer", o.Addr), ptr)
+			})
+		}
+	}
+	g.start = append(g.start, len(g.edges))
+
+	// Edges out of objects.
+	for _, o := range d.Objects {
+		d.Pointers(o.Data, o.Fields, func(_, ptr uint64) {
+			if n := g.node(ptr); n != 0 {
+				g.edges = append(g.edges, n)
+			}
+		})
+		g.start = append(g.start, len(g.edges))
+	}
+
+	g.reverse()
+	return g
+}
+
+// reverse computes the reverse edges of g from its edges.
+func (g *graph) reverse() {
+	n := g.numNodes()
+	g.rstart = make([]int, n+1)
+	for _, w := range g.edges {
+		g.rstart[w+1]++
+	}
+	for v := 0; v < n; v++ {
+		g.rstart[v+1] += g.rstart[v]
+	}
+	g.redges = make([]int32, len(g.edges))
+	next := append([]int(nil), g.rstart[:n]...)
+	for v := 0; v < n; v++ {
+		for _, w := range g.succ(int32(v)) {
+			g.redges[next[w]] = int32(v)
+			next[w]++
+		}
+	}
+}
+
+// numNodes returns the number of nodes in g, including the pseudo-root.
+func (g *graph) numNodes() int {
+	return len(g.d.Objects) + 1
+}
+
+// node returns the node of the object containing addr,
+// or 0 if addr is not in an object.
+func (g *graph) node(addr uint64) int32 {
+	objs := g.d.Objects
+	i := sort.Search(len(objs), func(i int) bool {
+		return objs[i].Addr > addr
+	})
+	if i == 0 || addr-objs[i-1].Addr >= objs[i-1].Size() {
+		return 0
+	}
+	return int32(i)
+}
+
+// object returns the object of node v, which must not be the pseudo-root.
+func (g *graph) object(v int32) *heapdump.Object {
+	return g.d.Objects[v-1]
+}
+
+// size returns the size of node v.
+func (g *graph) size(v int32) uint64 {
+	if v == 0 {
+		return 0
+	}
+	return g.object(v).Size()
+}
+
+func (g *graph) succ(v int32) []int32 {
+	return g.edges[g.start[v]:g.start[v+1]]
+}
+
+func (g *graph) pred(v int32) []int32 {
+	return g.redges[g.rstart[v]:g.rstart[v+1]]
+}
+
+// shortestPaths returns, for each node, the previous node on a shortest
+// path from the pseudo-root, or -1 if the node is unreachable. For nodes
+// directly referenced by a root, root[v] is the index of that root in
+// g.roots.
+func (g *graph) shortestPaths() (prev, root []int32) {
+	n := g.numNodes()
+	prev = make([]int32, n)
+	root = make([]int32, n)
+	for i := range prev {
+		prev[i] = -1
+		root[i] = -1
+	}
+	prev[0] = 0
+	queue := []int32{0}
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		for k, w := range g.succ(v) {
+			if prev[w] >= 0 {
+				continue
+			}
+			prev[w] = v
+			if v == 0 {
+				root[w] = int32(k)
+			}
+			queue = append(queue, w)
+		}
+	}
+	return prev, root
+}
+
+// dominators returns the immediate dominator of each node, or -1 for
+// the pseudo-root and unreachable nodes, using the Lengauer-Tarjan
+// algorithm. It also returns the reachable nodes in depth-first order,
+// so that every node comes after its immediate dominator.
+func (g *graph) dominators() (idom, order []int32) {
+	n := g.numNodes()
+
+	// Number the reachable nodes in depth-first order.
+	dfnum := make([]int32, n) // depth-first number of each node, or -1
+	parent := make([]int32, n)
+	for i := range dfnum {
+		dfnum[i] = -1
+	}
+	type frame struct {
+		v    int32
+		next int // index of the next successor to visit
+	}
+	stack := []frame{{0, 0}}
+	dfnum[0] = 0
+	order = append(order, 0)
+	for len(stack) > 0 {
+		f := &stack[len(stack)-1]
+		succ := g.succ(f.v)
+		if f.next == len(succ) {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		w := succ[f.next]
+		f.next++
+		if dfnum[w] < 0 {
+			dfnum[w] = int32(len(order))
+			order = append(order, w)
+			parent[w] = f.v
+			stack = append(stack, frame{w, 0})
+		}
+	}
+
+	semi := make([]int32, n) // depth-first number of the semidominator
+	ancestor := make([]int32, n)
+	label := make([]int32, n)
+	idom = make([]int32, n)
+	bucket := make([]int32, n) // head of the list of nodes with semidominator v
+	bucketNext := make([]int32, n)
+	for i := range semi {
+		semi[i] = dfnum[i]
+		ancestor[i] = -1
+		label[i] = int32(i)
+		idom[i] = -1
+		bucket[i] = -1
+	}
+
+	var path []int32
+	eval := func(v int32) int32 {
+		if ancestor[v] < 0 {
+			return v
+		}
+		// Compress the path from v to the root of its tree in the
+		// forest, so that label[v] is the node with the smallest
+		// semidominator on it.
+		path = path[:0]
+		for x := v; ancestor[ancestor[x]] >= 0; x = ancestor[x] {
+			path = append(path, x)
+		}
+		for i := len(path) - 1; i >= 0; i-- {
+			x := path[i]
+			a := ancestor[x]
+			if semi[label[a]] < semi[label[x]] {
+				label[x] = label[a]
+			}
+			ancestor[x] = ancestor[a]
+		}
+		return label[v]
+	}
+
+	for i := len(order) - 1; i > 0; i-- {
+		w := order[i]
+		for _, v := range g.pred(w) {
+			if dfnum[v] < 0 {
+				continue
+			}
+			if u := eval(v); semi[u] < semi[w] {
+				semi[w] = semi[u]
+			}
+		}
+		s := order[semi[w]]
+		bucketNext[w] = bucket[s]
+		bucket[s] = w
+
+		p := parent[w]
+		ancestor[w] = p
+		for v := bucket[p]; v >= 0; v = bucketNext[v] {
+			if u := eval(v); semi[u] < semi[v] {
+				idom[v] = u
+			} else {
+				idom[v] = p
+			}
+		}
+		bucket[p] = -1
+	}
+	for _, w := range order[1:] {
+		if idom[w] != order[semi[w]] {
+			idom[w] = idom[idom[w]]
+		}
+	}
+	return idom, order
+}
+
+// retainedSizes returns the retained size of each node: the total size
+// of the objects that it dominates, including itself. These are the
+// objects that would be freed if the node became unreachable.
+func (g *graph) retainedSizes(idom, order []int32) []uint64 {
+	retained := make([]uint64, g.numNodes())
+	for i := len(order) - 1; i >= 0; i-- {
+		v := order[i]
+		retained[v] += g.size(v)
+		if d := idom[v]; d >= 0 {
+			retained[d] += retained[v]
+		}
+	}
+	return retained
+}
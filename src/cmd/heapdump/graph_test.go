@@ -0,0 +1,121 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"cmd/internal/heapdump"
+)
+
+// makeGraph returns a graph with the given successors of each node.
+// Node v > 0 is an object of v bytes.
+func makeGraph(succ [][]int32) *graph {
+	d := new(heapdump.Dump)
+	for v := 1; v < len(succ); v++ {
+		d.Objects = append(d.Objects, &heapdump.Object{
+			Addr: uint64(v) << 8,
+			Data: make([]byte, v),
+		})
+	}
+	g := &graph{d: d, start: []int{0}}
+	for _, s := range succ {
+		g.edges = append(g.edges, s...)
+		g.start = append(g.start, len(g.edges))
+	}
+	g.reverse()
+	return g
+}
+
+func TestDominators(t *testing.T) {
+	// The example graph from Lengauer and Tarjan,
+	// "A Fast Algorithm for Finding Dominators in a Flowgraph".
+	const (
+		R = iota
+		A
+		B
+		C
+		D
+		E
+		F
+		G
+		H
+		I
+		J
+		K
+		L
+	)
+	g := makeGraph([][]int32{
+		R: {A, B, C},
+		A: {D},
+		B: {A, D, E},
+		C: {F, G},
+		D: {L},
+		E: {H},
+		F: {I},
+		G: {I, J},
+		H: {E, K},
+		I: {K},
+		J: {I},
+		K: {I, R},
+		L: {H},
+	})
+	idom, order := g.dominators()
+	want := []int32{
+		R: -1,
+		A: R,
+		B: R,
+		C: R,
+		D: R,
+		E: R,
+		F: C,
+		G: C,
+		H: R,
+		I: R,
+		J: G,
+		K: R,
+		L: D,
+	}
+	if !reflect.DeepEqual(idom, want) {
+		t.Errorf("got idom %v, want %v", idom, want)
+	}
+	if len(order) != len(want) {
+		t.Errorf("got %d reachable nodes, want %d", len(order), len(want))
+	}
+
+	retained := g.retainedSizes(idom, order)
+	wantRetained := map[int32]uint64{
+		R: 78,
+		C: C + F + G + J,
+		D: D + L,
+		G: G + J,
+		L: L,
+	}
+	for v, want := range wantRetained {
+		if retained[v] != want {
+			t.Errorf("node %d retains %d bytes, want %d", v, retained[v], want)
+		}
+	}
+}
+
+func TestDominatorsUnreachable(t *testing.T) {
+	g := makeGraph([][]int32{
+		{1},
+		{2},
+		{},
+		{2}, // unreachable
+	})
+	idom, order := g.dominators()
+	if want := []int32{-1, 0, 1, -1}; !reflect.DeepEqual(idom, want) {
+		t.Errorf("got idom %v, want %v", idom, want)
+	}
+	if want := []int32{0, 1, 2}; !reflect.DeepEqual(order, want) {
+		t.Errorf("got order %v, want %v", order, want)
+	}
+	if prev, _ := g.shortestPaths(); prev[3] != -1 {
+		t.Errorf("unreachable node has a path from node %d", prev[3])
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"cmd/internal/heapdump"
+)
+
+const usageMessage = `usage: go tool heapdump [flags] command args...
+
+Commands:
+	types dump              objects and bytes grouped by type
+	top dump                objects with the largest retained size
+	retainers dump address  what keeps the object at address alive
+	diff old new            change in objects and bytes per type
+
+Flags:
+`
+
+var maxRows = flag.Int("n", 25, "print at most `n` rows; 0 means no limit")
+
+func usage() {
+	fmt.Fprint(os.Stderr, usageMessage)
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("heapdump: ")
+	flag.Usage = usage
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		usage()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "types":
+		if len(args) != 1 {
+			usage()
+		}
+		types(w, readDump(args[0]))
+	case "top":
+		if len(args) != 1 {
+			usage()
+		}
+		top(w, readDump(args[0]))
+	case "retainers":
+		if len(args) != 2 {
+			usage()
+		}
+		addr, err := strconv.ParseUint(args[1], 0, 64)
+		if err != nil {
+			log.Fatalf("invalid address %q", args[1])
+		}
+		retainers(w, readDump(args[0]), addr)
+	case "diff":
+		if len(args) != 2 {
+			usage()
+		}
+		diff(w, readDump(args[0]), readDump(args[1]))
+	default:
+		log.Printf("unknown command %q", cmd)
+		usage()
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func readDump(file string) *heapdump.Dump {
+	f, err := os.Open(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	d, err := heapdump.Read(f)
+	if err != nil {
+		log.Fatalf("%s: %v", file, err)
+	}
+	return d
+}
+
+// typeName returns the name used to group o with similar objects.
+func typeName(o *heapdump.Object) string {
+	t := o.Type
+	if t == nil {
+		return fmt.Sprintf("<unknown %d-byte block>", o.Size())
+	}
+	if t.Size > 0 && o.Size() >= 2*t.Size {
+		return "[]" + t.Name
+	}
+	return t.Name
+}
+
+// A typeStat is the number and total size of the objects of a type.
+type typeStat struct {
+	name  string
+	count int64
+	bytes int64
+}
+
+func typeStats(d *heapdump.Dump) map[string]*typeStat {
+	stats := make(map[string]*typeStat)
+	for _, o := range d.Objects {
+		name := typeName(o)
+		s := stats[name]
+		if s == nil {
+			s = &typeStat{name: name}
+			stats[name] = s
+		}
+		s.count++
+		s.bytes += int64(o.Size())
+	}
+	return stats
+}
+
+// limit returns the number of rows to print out of n.
+func limit(n int) int {
+	if *maxRows > 0 && n > *maxRows {
+		return *maxRows
+	}
+	return n
+}
+
+// types prints the number and size of the objects of each type,
+// largest first.
+func types(w io.Writer, d *heapdump.Dump) {
+	var list []*typeStat
+	var total typeStat
+	for _, s := range typeStats(d) {
+		list = append(list, s)
+		total.count += s.count
+		total.bytes += s.bytes
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].bytes != list[j].bytes {
+			return list[i].bytes > list[j].bytes
+		}
+		return list[i].name < list[j].name
+	})
+	fmt.Fprintf(w, "count\tbytes\t %%bytes\t type\n")
+	for _, s := range list[:limit(len(list))] {
+		fmt.Fprintf(w, "%d\t%d\t %.2f%%\t %s\n", s.count, s.bytes, percent(s.bytes, total.bytes), s.name)
+	}
+	fmt.Fprintf(w, "%d\t%d\t \t total\n", total.count, total.bytes)
+}
+
+func percent(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+// top prints the objects that retain the most memory: the objects
+// whose removal from the heap would free the most bytes.
+func top(w io.Writer, d *heapdump.Dump) {
+	g := newGraph(d)
+	idom, order := g.dominators()
+	retained := g.retainedSizes(idom, order)
+
+	nodes := append([]int32(nil), order[1:]...)
+	sort.Slice(nodes, func(i, j int) bool {
+		if retained[nodes[i]] != retained[nodes[j]] {
+			return retained[nodes[i]] > retained[nodes[j]]
+		}
+		return nodes[i] < nodes[j]
+	})
+	fmt.Fprintf(w, "retained\tsize\t address\t type\n")
+	for _, v := range nodes[:limit(len(nodes))] {
+		o := g.object(v)
+		fmt.Fprintf(w, "%d\t%d\t %#x\t %s\n", retained[v], o.Size(), o.Addr, typeName(o))
+	}
+	fmt.Fprintf(w, "%d\t\t \t reachable from roots\n", retained[0])
+}
+
+// retainers prints why the object containing addr is alive: a shortest
+// path of references from a root to it, and the objects that dominate
+// it, which are the objects that keep it alive on every such path.
+func retainers(w io.Writer, d *heapdump.Dump, addr uint64) {
+	o := d.FindObject(addr)
+	if o == nil {
+		log.Fatalf("no object at %#x", addr)
+	}
+	g := newGraph(d)
+	v := g.node(addr)
+	prev, root := g.shortestPaths()
+	if prev[v] < 0 {
+		fmt.Fprintf(w, "object %#x (%s) is not reachable from any root\n", o.Addr, typeName(o))
+		return
+	}
+	idom, order := g.dominators()
+	retained := g.retainedSizes(idom, order)
+	fmt.Fprintf(w, "object %#x (%s), %d bytes, retains %d bytes\n", o.Addr, typeName(o), o.Size(), retained[v])
+
+	var path []int32
+	for x := v; x != 0; x = prev[x] {
+		path = append(path, x)
+	}
+	fmt.Fprintf(w, "\nshortest path from a root:\n")
+	fmt.Fprintf(w, "    %s\n", g.roots[root[path[len(path)-1]]])
+	for i := len(path) - 1; i >= 0; i-- {
+		o := g.object(path[i])
+		fmt.Fprintf(w, "    %#x (%s)\n", o.Addr, typeName(o))
+	}
+
+	fmt.Fprintf(w, "\ndominated by:\n")
+	n := 0
+	for x := idom[v]; x > 0 && (*maxRows <= 0 || n < *maxRows); x = idom[x] {
+		o := g.object(x)
+		fmt.Fprintf(w, "    %#x (%s), retains %d bytes\n", o.Addr, typeName(o), retained[x])
+		n++
+	}
+	if n == 0 {
+		fmt.Fprintf(w, "    only the roots\n")
+	}
+}
+
+// diff prints how the number and size of the objects of each type
+// changed from dump old to dump new, largest change first.
+func diff(w io.Writer, old, new *heapdump.Dump) {
+	olds, news := typeStats(old), typeStats(new)
+	var list []*typeStat
+	var total typeStat
+	for name, s := range news {
+		d := &typeStat{name: name, count: s.count, bytes: s.bytes}
+		if o := olds[name]; o != nil {
+			d.count -= o.count
+			d.bytes -= o.bytes
+		}
+		if d.count != 0 || d.bytes != 0 {
+			list = append(list, d)
+		}
+	}
+	for name, o := range olds {
+		if news[name] == nil {
+			list = append(list, &typeStat{name: name, count: -o.count, bytes: -o.bytes})
+		}
+	}
+	for _, s := range list {
+		total.count += s.count
+		total.bytes += s.bytes
+	}
+	sort.Slice(list, func(i, j int) bool {
+		bi, bj := abs(list[i].bytes), abs(list[j].bytes)
+		if bi != bj {
+			return bi > bj
+		}
+		return list[i].name < list[j].name
+	})
+	fmt.Fprintf(w, "count\tbytes\t type\n")
+	for _, s := range list[:limit(len(list))] {
+		fmt.Fprintf(w, "%+d\t%+d\t %s\n", s.count, s.bytes, s.name)
+	}
+	fmt.Fprintf(w, "%+d\t%+d\t total\n", total.count, total.bytes)
+}
+
+func abs(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
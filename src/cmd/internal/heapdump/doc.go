@@ -0,0 +1,99 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package heapdump reads heap dumps written by runtime/debug.WriteHeapDump.
+
+# Format
+
+A heap dump starts with a header line that identifies the version of
+the format, followed by a sequence of records. Two versions exist:
+
+	"go1.7 heap dump\n"   objects carry no type information
+	"go1.22 heap dump\n"  object records carry a type address
+
+The only difference between the two versions is the type field of the
+object record; everything else is shared.
+
+Every integer in the dump, including record tags, is an unsigned
+varint as written by encoding/binary.PutUvarint. Addresses are
+integers. A bool is an integer that is 0 or 1. A string, and any
+other run of bytes, is an integer length followed by that many bytes.
+
+Several records end with a field list, which describes the pointers in
+the memory contents of the record. A field list is a sequence of
+(kind, offset) integer pairs, terminated by a lone kind of 0:
+
+	1  pointer at offset
+	2  non-empty interface at offset (pointer data word at offset+ptrsize)
+	3  empty interface at offset (pointer data word at offset+ptrsize)
+
+Offsets are relative to the start of the contents. The runtime only
+writes kind 1; kinds 2 and 3 are reserved by earlier versions of the
+format.
+
+Each record starts with a tag, followed by tag-specific contents:
+
+	0   EOF           end of the dump; nothing follows
+	1   object        address, type address (go1.22 only; 0 if unknown),
+	                  contents, field list
+	2   other root    description string, pointer
+	3   type          address, size, name string,
+	                  bool: values are stored indirectly in interfaces
+	4   goroutine     address of G, stack pointer, goroutine ID,
+	                  PC of the go statement that created it, status,
+	                  bool: system goroutine, bool: background goroutine,
+	                  nanotime at which it started waiting,
+	                  wait reason string, context pointer, address of M,
+	                  address of top defer record, address of top panic record
+	5   stack frame   stack pointer (lowest address in frame),
+	                  depth (0 is the innermost frame),
+	                  stack pointer of the child frame (0 if innermost),
+	                  frame contents, entry PC of the function, PC,
+	                  continuation PC, function name string, field list
+	6   params        bool: big-endian, pointer size, heap start address,
+	                  heap end address, GOARCH string, Go version string,
+	                  number of CPUs
+	7   finalizer     object address, funcval address, function PC,
+	                  address of the function's argument type,
+	                  address of the object's pointer type
+	8   itab          itab address, address of its dynamic type
+	9   OS thread     address of M, M ID, OS thread ID
+	10  memstats      the runtime.MemStats fields Alloc through
+	                  PauseTotalNs in declaration order, the 256 entries
+	                  of PauseNs, and NumGC
+	11  queued finalizer  as finalizer, for an object whose finalizer
+	                  is ready to run
+	12  data segment  address, contents, field list
+	13  BSS segment   address, contents, field list
+	14  defer         address of defer record, address of G, stack pointer,
+	                  PC, funcval address, function PC, address of next
+	                  defer record
+	15  panic         address of panic record, address of G,
+	                  type address of the panic value, data word of the
+	                  panic value, 0, address of next panic record
+	16  memprof       address of the bucket, allocation size,
+	                  number of frames, then for each frame a function name
+	                  string, a file name string, and a line number; then
+	                  the number of allocations and frees
+	17  alloc sample  object address, address of memprof bucket
+
+A type record appears before the first object or itab record that
+refers to it, and may be written more than once. Other type addresses,
+such as those in finalizer and panic records, may have no type record.
+
+The params record comes first. Object records describe every allocated
+block in the heap, including the unused space at the end of blocks in
+size classes larger than the requested size. An object that is at
+least twice the size of its type holds an array of that type, such as
+the backing store of a slice; the allocator never rounds a single value
+up that far.
+
+Object types are only recorded when the program is run with
+GODEBUG=heapdumptypes=1. Otherwise, and for objects allocated before
+the setting took effect, tiny allocations that may hold several
+objects, and untyped allocations such as the bytes of a string, the
+type address is 0.
+*/
+package heapdump
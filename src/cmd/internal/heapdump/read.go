@@ -0,0 +1,561 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heapdump
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"sort"
+)
+
+// Record tags.
+const (
+	tagEOF             = 0
+	tagObject          = 1
+	tagOtherRoot       = 2
+	tagType            = 3
+	tagGoroutine       = 4
+	tagStackFrame      = 5
+	tagParams          = 6
+	tagFinalizer       = 7
+	tagItab            = 8
+	tagOSThread        = 9
+	tagMemStats        = 10
+	tagQueuedFinalizer = 11
+	tagData            = 12
+	tagBSS             = 13
+	tagDefer           = 14
+	tagPanic           = 15
+	tagMemProf         = 16
+	tagAllocSample     = 17
+)
+
+// Versions of the dump format, identified by the dump header.
+const (
+	Version17  = "go1.7"  // objects have no type
+	Version122 = "go1.22" // objects have a type address
+)
+
+var headers = map[string]string{
+	"go1.7 heap dump\n":  Version17,
+	"go1.22 heap dump\n": Version122,
+}
+
+// A Dump is the contents of a heap dump.
+type Dump struct {
+	Version      string // Version17 or Version122
+	Params       Params
+	Types        map[uint64]*Type  // by address
+	Itabs        map[uint64]uint64 // itab address to type address
+	Objects      []*Object         // sorted by address
+	Goroutines   []*Goroutine
+	Threads      []*Thread
+	Data         *Segment
+	BSS          *Segment
+	OtherRoots   []*OtherRoot
+	Finalizers   []*Finalizer
+	Defers       []*Defer
+	Panics       []*Panic
+	MemStats     runtime.MemStats
+	MemProf      []*MemProfBucket
+	AllocSamples []*AllocSample
+}
+
+// Params describes the dumped process.
+type Params struct {
+	BigEndian bool
+	PtrSize   uint64
+	HeapStart uint64
+	HeapEnd   uint64
+	GOARCH    string
+	GoVersion string
+	NCPU      uint64
+}
+
+// A Type is a Go type that is referenced from the dump.
+type Type struct {
+	Addr uint64
+	Size uint64
+	Name string
+
+	// IndirectIface reports whether values of the type are stored
+	// indirectly in the data word of interfaces.
+	IndirectIface bool
+}
+
+// A FieldKind describes the kind of a Field.
+type FieldKind uint64
+
+const (
+	FieldPtr   FieldKind = 1 // a pointer
+	FieldIface FieldKind = 2 // a non-empty interface
+	FieldEface FieldKind = 3 // an empty interface
+)
+
+// A Field describes a pointer-holding word of memory contents.
+type Field struct {
+	Kind   FieldKind
+	Offset uint64
+}
+
+// An Object is an allocated block in the heap.
+type Object struct {
+	Addr   uint64
+	Type   *Type // nil if unknown
+	Data   []byte
+	Fields []Field
+}
+
+// Size returns the size of the block in bytes.
+func (o *Object) Size() uint64 {
+	return uint64(len(o.Data))
+}
+
+// A Segment is the data or BSS segment of the program.
+type Segment struct {
+	Addr   uint64
+	Data   []byte
+	Fields []Field
+}
+
+// A Goroutine is a goroutine that was not dead when the dump was written.
+type Goroutine struct {
+	Addr       uint64
+	SP         uint64
+	ID         uint64
+	GoPC       uint64
+	Status     uint64
+	System     bool
+	Background bool
+	WaitSince  uint64
+	WaitReason string
+	Ctxt       uint64
+	M          uint64
+	Defer      uint64
+	Panic      uint64
+	Frames     []*Frame // innermost first
+}
+
+// A Frame is a stack frame of a goroutine.
+type Frame struct {
+	Goroutine *Goroutine
+	SP        uint64
+	Depth     uint64
+	ChildSP   uint64
+	Data      []byte
+	Entry     uint64
+	PC        uint64
+	ContPC    uint64
+	Func      string
+	Fields    []Field
+}
+
+// A Thread is an OS thread (an M) of the runtime.
+type Thread struct {
+	Addr   uint64
+	ID     uint64
+	ProcID uint64
+}
+
+// An OtherRoot is a root of the heap that is not a global variable
+// or on a goroutine stack.
+type OtherRoot struct {
+	Description string
+	Addr        uint64
+}
+
+// A Finalizer is a finalizer set on an object.
+type Finalizer struct {
+	Obj     uint64
+	FuncVal uint64
+	PC      uint64
+	ArgType uint64
+	PtrType uint64
+
+	// Queued reports whether the object is unreachable and the
+	// finalizer is queued to run.
+	Queued bool
+}
+
+// A Defer is a pending deferred call.
+type Defer struct {
+	Addr    uint64
+	G       uint64
+	SP      uint64
+	PC      uint64
+	FuncVal uint64
+	FuncPC  uint64
+	Link    uint64
+}
+
+// A Panic is an active panic.
+type Panic struct {
+	Addr uint64
+	G    uint64
+	Type uint64 // type address of the panic value
+	Data uint64 // data word of the panic value
+	Link uint64
+}
+
+// A MemProfBucket is a memory profile bucket, describing the
+// allocations at one call stack.
+type MemProfBucket struct {
+	Addr   uint64
+	Size   uint64
+	Stack  []MemProfFrame
+	Allocs uint64
+	Frees  uint64
+}
+
+// A MemProfFrame is a frame of a memory profile call stack.
+type MemProfFrame struct {
+	Func string
+	File string
+	Line uint64
+}
+
+// An AllocSample is an object whose allocation was sampled by the
+// memory profiler.
+type AllocSample struct {
+	Addr   uint64
+	Bucket uint64
+}
+
+// FindObject returns the object containing addr, or nil if addr is not
+// in any object.
+func (d *Dump) FindObject(addr uint64) *Object {
+	i := sort.Search(len(d.Objects), func(i int) bool {
+		return d.Objects[i].Addr > addr
+	})
+	if i == 0 {
+		return nil
+	}
+	o := d.Objects[i-1]
+	if addr-o.Addr >= o.Size() {
+		return nil
+	}
+	return o
+}
+
+// Pointers calls f for each non-nil pointer in data described by fields,
+// passing its offset in data and its value.
+func (d *Dump) Pointers(data []byte, fields []Field, f func(off, ptr uint64)) {
+	for _, fld := range fields {
+		off := fld.Offset
+		if fld.Kind != FieldPtr {
+			// Only the data word of an interface is a heap pointer.
+			off += d.Params.PtrSize
+		}
+		if off+d.Params.PtrSize > uint64(len(data)) {
+			continue
+		}
+		if p := d.word(data[off:]); p != 0 {
+			f(off, p)
+		}
+	}
+}
+
+// word reads a pointer-sized word from b.
+func (d *Dump) word(b []byte) uint64 {
+	var order binary.ByteOrder = binary.LittleEndian
+	if d.Params.BigEndian {
+		order = binary.BigEndian
+	}
+	if d.Params.PtrSize == 4 {
+		return uint64(order.Uint32(b))
+	}
+	return order.Uint64(b)
+}
+
+// Read reads a heap dump from r.
+func Read(r io.Reader) (*Dump, error) {
+	p := &parser{
+		r: bufio.NewReader(r),
+		d: &Dump{
+			Types: make(map[uint64]*Type),
+			Itabs: make(map[uint64]uint64),
+		},
+	}
+	if err := p.parse(); err != nil {
+		return nil, fmt.Errorf("heapdump: %v", err)
+	}
+	return p.d, nil
+}
+
+type parser struct {
+	r   *bufio.Reader
+	d   *Dump
+	g   *Goroutine // goroutine whose frames are being read
+	err error
+}
+
+func (p *parser) parse() error {
+	hdr, err := p.r.ReadString('\n')
+	if err != nil {
+		return errors.New("missing header")
+	}
+	v, ok := headers[hdr]
+	if !ok {
+		return fmt.Errorf("unsupported header %q", hdr)
+	}
+	d := p.d
+	d.Version = v
+
+	for {
+		tag := p.uvarint()
+		if p.err != nil {
+			if p.err == io.ErrUnexpectedEOF {
+				return errors.New("missing EOF record")
+			}
+			return p.err
+		}
+		switch tag {
+		case tagEOF:
+			sort.Slice(d.Objects, func(i, j int) bool {
+				return d.Objects[i].Addr < d.Objects[j].Addr
+			})
+			return nil
+		case tagObject:
+			o := &Object{Addr: p.uvarint()}
+			if d.Version != Version17 {
+				if t := p.uvarint(); t != 0 {
+					o.Type = p.typ(t)
+				}
+			}
+			o.Data = p.bytes()
+			o.Fields = p.fields()
+			d.Objects = append(d.Objects, o)
+		case tagOtherRoot:
+			d.OtherRoots = append(d.OtherRoots, &OtherRoot{
+				Description: p.string(),
+				Addr:        p.uvarint(),
+			})
+		case tagType:
+			t := &Type{
+				Addr:          p.uvarint(),
+				Size:          p.uvarint(),
+				Name:          p.string(),
+				IndirectIface: p.bool(),
+			}
+			d.Types[t.Addr] = t
+		case tagGoroutine:
+			g := &Goroutine{
+				Addr:       p.uvarint(),
+				SP:         p.uvarint(),
+				ID:         p.uvarint(),
+				GoPC:       p.uvarint(),
+				Status:     p.uvarint(),
+				System:     p.bool(),
+				Background: p.bool(),
+				WaitSince:  p.uvarint(),
+				WaitReason: p.string(),
+				Ctxt:       p.uvarint(),
+				M:          p.uvarint(),
+				Defer:      p.uvarint(),
+				Panic:      p.uvarint(),
+			}
+			d.Goroutines = append(d.Goroutines, g)
+			p.g = g
+		case tagStackFrame:
+			if p.g == nil {
+				return errors.New("stack frame outside goroutine")
+			}
+			f := &Frame{
+				Goroutine: p.g,
+				SP:        p.uvarint(),
+				Depth:     p.uvarint(),
+				ChildSP:   p.uvarint(),
+				Data:      p.bytes(),
+				Entry:     p.uvarint(),
+				PC:        p.uvarint(),
+				ContPC:    p.uvarint(),
+				Func:      p.string(),
+				Fields:    p.fields(),
+			}
+			p.g.Frames = append(p.g.Frames, f)
+		case tagParams:
+			d.Params = Params{
+				BigEndian: p.bool(),
+				PtrSize:   p.uvarint(),
+				HeapStart: p.uvarint(),
+				HeapEnd:   p.uvarint(),
+				GOARCH:    p.string(),
+				GoVersion: p.string(),
+				NCPU:      p.uvarint(),
+			}
+			if ps := d.Params.PtrSize; ps != 4 && ps != 8 {
+				return fmt.Errorf("unsupported pointer size %d", ps)
+			}
+		case tagFinalizer, tagQueuedFinalizer:
+			d.Finalizers = append(d.Finalizers, &Finalizer{
+				Obj:     p.uvarint(),
+				FuncVal: p.uvarint(),
+				PC:      p.uvarint(),
+				ArgType: p.uvarint(),
+				PtrType: p.uvarint(),
+				Queued:  tag == tagQueuedFinalizer,
+			})
+		case tagItab:
+			addr := p.uvarint()
+			d.Itabs[addr] = p.uvarint()
+		case tagOSThread:
+			d.Threads = append(d.Threads, &Thread{
+				Addr:   p.uvarint(),
+				ID:     p.uvarint(),
+				ProcID: p.uvarint(),
+			})
+		case tagMemStats:
+			p.memStats(&d.MemStats)
+		case tagData, tagBSS:
+			s := &Segment{
+				Addr:   p.uvarint(),
+				Data:   p.bytes(),
+				Fields: p.fields(),
+			}
+			if tag == tagData {
+				d.Data = s
+			} else {
+				d.BSS = s
+			}
+		case tagDefer:
+			d.Defers = append(d.Defers, &Defer{
+				Addr:    p.uvarint(),
+				G:       p.uvarint(),
+				SP:      p.uvarint(),
+				PC:      p.uvarint(),
+				FuncVal: p.uvarint(),
+				FuncPC:  p.uvarint(),
+				Link:    p.uvarint(),
+			})
+		case tagPanic:
+			pa := &Panic{
+				Addr: p.uvarint(),
+				G:    p.uvarint(),
+				Type: p.uvarint(),
+				Data: p.uvarint(),
+			}
+			p.uvarint() // formerly the defer record
+			pa.Link = p.uvarint()
+			d.Panics = append(d.Panics, pa)
+		case tagMemProf:
+			b := &MemProfBucket{
+				Addr: p.uvarint(),
+				Size: p.uvarint(),
+			}
+			n := p.uvarint()
+			for i := uint64(0); i < n && p.err == nil; i++ {
+				b.Stack = append(b.Stack, MemProfFrame{
+					Func: p.string(),
+					File: p.string(),
+					Line: p.uvarint(),
+				})
+			}
+			b.Allocs = p.uvarint()
+			b.Frees = p.uvarint()
+			d.MemProf = append(d.MemProf, b)
+		case tagAllocSample:
+			d.AllocSamples = append(d.AllocSamples, &AllocSample{
+				Addr:   p.uvarint(),
+				Bucket: p.uvarint(),
+			})
+		default:
+			return fmt.Errorf("unknown record tag %d", tag)
+		}
+		if p.err != nil {
+			if p.err == io.EOF {
+				p.err = io.ErrUnexpectedEOF
+			}
+			return p.err
+		}
+	}
+}
+
+// typ returns the type at addr, which must have been described
+// by an earlier type record.
+func (p *parser) typ(addr uint64) *Type {
+	t := p.d.Types[addr]
+	if t == nil && p.err == nil {
+		p.err = fmt.Errorf("object refers to undescribed type %#x", addr)
+	}
+	return t
+}
+
+func (p *parser) memStats(m *runtime.MemStats) {
+	for _, f := range []*uint64{
+		&m.Alloc, &m.TotalAlloc, &m.Sys, &m.Lookups, &m.Mallocs, &m.Frees,
+		&m.HeapAlloc, &m.HeapSys, &m.HeapIdle, &m.HeapInuse, &m.HeapReleased, &m.HeapObjects,
+		&m.StackInuse, &m.StackSys, &m.MSpanInuse, &m.MSpanSys, &m.MCacheInuse, &m.MCacheSys,
+		&m.BuckHashSys, &m.GCSys, &m.OtherSys, &m.NextGC, &m.LastGC, &m.PauseTotalNs,
+	} {
+		*f = p.uvarint()
+	}
+	for i := range m.PauseNs {
+		m.PauseNs[i] = p.uvarint()
+	}
+	m.NumGC = uint32(p.uvarint())
+}
+
+func (p *parser) uvarint() uint64 {
+	if p.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(p.r)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		p.err = err
+	}
+	return v
+}
+
+func (p *parser) bool() bool {
+	return p.uvarint() != 0
+}
+
+func (p *parser) bytes() []byte {
+	n := p.uvarint()
+	if p.err != nil {
+		return nil
+	}
+	if n > uint64(math.MaxInt) {
+		p.err = fmt.Errorf("invalid length %d", n)
+		return nil
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(p.r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		p.err = err
+		return nil
+	}
+	return b
+}
+
+func (p *parser) string() string {
+	return string(p.bytes())
+}
+
+func (p *parser) fields() []Field {
+	var fields []Field
+	for p.err == nil {
+		kind := FieldKind(p.uvarint())
+		if kind == 0 {
+			break
+		}
+		if kind > FieldEface {
+			p.err = fmt.Errorf("unknown field kind %d", kind)
+			break
+		}
+		fields = append(fields, Field{Kind: kind, Offset: p.uvarint()})
+	}
+	return fields
+}
@@ -0,0 +1,202 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heapdump
+
+import (
+	"bytes"
+	"encoding/binary"
+	"internal/testenv"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+// A dumpWriter writes a synthetic heap dump.
+type dumpWriter struct {
+	bytes.Buffer
+}
+
+func (w *dumpWriter) int(vs ...uint64) {
+	for _, v := range vs {
+		w.Write(binary.AppendUvarint(nil, v))
+	}
+}
+
+func (w *dumpWriter) bytes(b []byte) {
+	w.int(uint64(len(b)))
+	w.Write(b)
+}
+
+func (w *dumpWriter) string(s string) {
+	w.bytes([]byte(s))
+}
+
+// syntheticDump returns a little-endian 64-bit dump with two objects,
+// the second pointing to the first, and a global pointing to the second.
+func syntheticDump(version string) []byte {
+	var w dumpWriter
+	w.WriteString(version + " heap dump\n")
+	w.int(tagParams, 0, 8, 0x1000, 0x2000)
+	w.string("amd64")
+	w.string("go1.x")
+	w.int(4)
+
+	w.int(tagType, 0x500, 16)
+	w.string("main.T")
+	w.int(1)
+
+	obj := func(addr, typ uint64, ptr uint64) {
+		w.int(tagObject, addr)
+		if version != Version17 {
+			w.int(typ)
+		}
+		data := binary.LittleEndian.AppendUint64(nil, ptr)
+		data = binary.LittleEndian.AppendUint64(data, 0)
+		w.bytes(data)
+		w.int(1, 0, 0) // pointer at offset 0, end of fields
+	}
+	obj(0x1020, 0x500, 0x1008)
+	obj(0x1000, 0, 0)
+
+	w.int(tagData, 0x800)
+	w.bytes(binary.LittleEndian.AppendUint64(nil, 0x1020))
+	w.int(1, 0, 0)
+
+	w.int(tagEOF)
+	return w.Bytes()
+}
+
+func TestReadSynthetic(t *testing.T) {
+	for _, version := range []string{Version17, Version122} {
+		t.Run(version, func(t *testing.T) {
+			d, err := Read(bytes.NewReader(syntheticDump(version)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Version != version {
+				t.Errorf("got version %q, want %q", d.Version, version)
+			}
+			if d.Params.PtrSize != 8 || d.Params.GOARCH != "amd64" || d.Params.NCPU != 4 {
+				t.Errorf("got params %+v", d.Params)
+			}
+			if len(d.Objects) != 2 || d.Objects[0].Addr != 0x1000 || d.Objects[1].Addr != 0x1020 {
+				t.Fatalf("objects not read or not sorted by address")
+			}
+			o := d.FindObject(0x1008)
+			if o != d.Objects[0] {
+				t.Errorf("FindObject(0x1008) = %v, want object at 0x1000", o)
+			}
+			if o := d.FindObject(0x1010); o != nil {
+				t.Errorf("FindObject(0x1010) = object at %#x, want nil", o.Addr)
+			}
+			typ := d.Objects[1].Type
+			if version == Version17 {
+				if typ != nil {
+					t.Errorf("got type %v in %s dump", typ.Name, version)
+				}
+			} else if typ == nil || typ.Name != "main.T" || typ.Size != 16 || !typ.IndirectIface {
+				t.Errorf("got type %+v, want main.T", typ)
+			}
+			var ptrs []uint64
+			d.Pointers(d.Objects[1].Data, d.Objects[1].Fields, func(off, ptr uint64) {
+				ptrs = append(ptrs, ptr)
+			})
+			if len(ptrs) != 1 || ptrs[0] != 0x1008 {
+				t.Errorf("got pointers %#x, want [0x1008]", ptrs)
+			}
+			if d.Data == nil || d.Data.Addr != 0x800 {
+				t.Errorf("data segment not read")
+			}
+		})
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	dump := syntheticDump(Version122)
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"empty", nil, "missing header"},
+		{"header", []byte("go1.3 heap dump\n"), "unsupported header"},
+		{"truncated", dump[:len(dump)-3], "unexpected EOF"},
+		{"no EOF", dump[:len(dump)-1], "missing EOF record"},
+		{"tag", append(append([]byte{}, dump[:len(dump)-1]...), 99), "unknown record tag 99"},
+	}
+	for _, tt := range tests {
+		_, err := Read(bytes.NewReader(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+type testNode struct {
+	next *testNode
+	data [32]byte
+}
+
+var testList *testNode
+
+func TestMain(m *testing.M) {
+	if file := os.Getenv("GO_HEAPDUMP_TEST_FILE"); file != "" {
+		// Write a dump of this process and exit.
+		for i := 0; i < 100; i++ {
+			testList = &testNode{next: testList}
+		}
+		f, err := os.Create(file)
+		if err != nil {
+			panic(err)
+		}
+		debug.WriteHeapDump(f.Fd())
+		if err := f.Close(); err != nil {
+			panic(err)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestReadLive(t *testing.T) {
+	if runtime.GOOS == "js" || runtime.GOOS == "wasip1" {
+		t.Skipf("WriteHeapDump is not available on %s", runtime.GOOS)
+	}
+	testenv.MustHaveExec(t)
+
+	file := filepath.Join(t.TempDir(), "dump")
+	cmd := testenv.Command(t, os.Args[0])
+	cmd.Env = append(os.Environ(), "GO_HEAPDUMP_TEST_FILE="+file, "GODEBUG=heapdumptypes=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("writing dump: %v\n%s", err, out)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d, err := Read(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Version != Version122 {
+		t.Errorf("got version %q, want %q", d.Version, Version122)
+	}
+	if d.Params.GOARCH != runtime.GOARCH {
+		t.Errorf("got GOARCH %q, want %q", d.Params.GOARCH, runtime.GOARCH)
+	}
+	n := 0
+	for _, o := range d.Objects {
+		if o.Type != nil && o.Type.Name == "cmd/internal/heapdump.testNode" {
+			n++
+		}
+	}
+	if n < 100 {
+		t.Errorf("found %d objects of type testNode, want at least 100", n)
+	}
+}
@@ -882,9 +882,11 @@ func (ctxt *Link) linksetup() {
 		}
 
 		// Set runtime.disableMemoryProfiling bool if
-		// runtime.MemProfile is not retained in the binary after
-		// deadcode (and we're not dynamically linking).
-		memProfile := ctxt.loader.Lookup("runtime.MemProfile", abiInternalVer)
+		// runtime.memProfileWithLifetimes is not retained in the binary
+		// after deadcode (and we're not dynamically linking).
+		// runtime.MemProfile is small enough to be inlined into its
+		// callers, so look for the function it calls instead.
+		memProfile := ctxt.loader.Lookup("runtime.memProfileWithLifetimes", abiInternalVer)
 		if memProfile != 0 && !ctxt.loader.AttrReachable(memProfile) && !ctxt.DynlinkingGo() {
 			memProfSym := ctxt.loader.LookupOrCreateSym("runtime.disableMemoryProfiling", 0)
 			sb := ctxt.loader.MakeSymbolUpdater(memProfSym)
@@ -23,6 +23,7 @@ import (
 func init() {
 	http.HandleFunc("/usertasks", httpUserTasks)
 	http.HandleFunc("/usertask", httpUserTask)
+	http.HandleFunc("/usertaskpath", httpUserTaskPath)
 	http.HandleFunc("/userregions", httpUserRegions)
 	http.HandleFunc("/userregion", httpUserRegion)
 }
@@ -261,9 +262,10 @@ func httpUserTask(w http.ResponseWriter, r *http.Request) {
 }
 
 type annotationAnalysisResult struct {
-	tasks    map[uint64]*taskDesc          // tasks
-	regions  map[regionTypeID][]regionDesc // regions
-	gcEvents []*trace.Event                // GCStartevents, sorted
+	tasks        map[uint64]*taskDesc          // tasks
+	regions      map[regionTypeID][]regionDesc // regions
+	gcEvents     []*trace.Event                // GCStartevents, sorted
+	assistEvents []*trace.Event                // GCMarkAssistStart events, sorted
 }
 
 type regionTypeID struct {
@@ -286,7 +288,7 @@ func analyzeAnnotations() (annotationAnalysisResult, error) {
 
 	tasks := allTasks{}
 	regions := map[regionTypeID][]regionDesc{}
-	var gcEvents []*trace.Event
+	var gcEvents, assistEvents []*trace.Event
 
 	for _, ev := range events {
 		switch typ := ev.Type; typ {
@@ -308,6 +310,8 @@ func analyzeAnnotations() (annotationAnalysisResult, error) {
 
 		case trace.EvGCStart:
 			gcEvents = append(gcEvents, ev)
+		case trace.EvGCMarkAssistStart:
+			assistEvents = append(assistEvents, ev)
 		}
 	}
 	// combine region info.
@@ -341,7 +345,7 @@ func analyzeAnnotations() (annotationAnalysisResult, error) {
 			return task.regions[i].lastTimestamp() < task.regions[j].lastTimestamp()
 		})
 	}
-	return annotationAnalysisResult{tasks: tasks, regions: regions, gcEvents: gcEvents}, nil
+	return annotationAnalysisResult{tasks: tasks, regions: regions, gcEvents: gcEvents, assistEvents: assistEvents}, nil
 }
 
 // taskDesc represents a task.
@@ -1074,6 +1078,7 @@ Search log text: <form onsubmit="window.location.search+='&logtext='+window.logt
                 <td>
 <a href="/trace?focustask={{$el.ID}}#{{asMillisecond $el.Start}}:{{asMillisecond $el.End}}">Task {{$el.ID}}</a>
 <a href="/trace?taskid={{$el.ID}}#{{asMillisecond $el.Start}}:{{asMillisecond $el.End}}">(goroutine view)</a>
+<a href="/usertaskpath?id={{$el.ID}}">(critical path)</a>
 ({{if .Complete}}complete{{else}}incomplete{{end}})</td>
         </tr>
         {{range $el.Events}}
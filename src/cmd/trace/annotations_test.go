@@ -12,11 +12,14 @@ import (
 	"flag"
 	"fmt"
 	traceparser "internal/trace"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
 	"runtime/debug"
 	"runtime/trace"
 	"sort"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -323,6 +326,92 @@ func TestAnalyzeAnnotationGC(t *testing.T) {
 	}
 }
 
+// prog3 runs a task that waits for a worker goroutine,
+// which does the work of the task outside of it.
+func prog3() {
+	req := make(chan int)
+	resp := make(chan int)
+	go func() { // worker
+		n := <-req
+		for i := 0; i < 1e6; i++ {
+			n += i
+		}
+		resp <- n
+	}()
+	ctx, task := trace.NewTask(context.Background(), "taskWithWorker")
+	trace.WithRegion(ctx, "taskWithWorker.wait", func() {
+		req <- 1
+		<-resp
+	})
+	task.End()
+}
+
+func TestTaskCriticalPath(t *testing.T) {
+	if err := traceProgram(t, prog3, "TestTaskCriticalPath"); err != nil {
+		t.Fatalf("failed to trace the program: %v", err)
+	}
+	res, err := analyzeAnnotations()
+	if err != nil {
+		t.Fatalf("failed to analyzeAnnotations: %v", err)
+	}
+	var task *taskDesc
+	for _, tk := range res.tasks {
+		if tk.name == "taskWithWorker" {
+			task = tk
+		}
+	}
+	if task == nil || !task.complete() {
+		t.Fatalf("taskWithWorker not found or incomplete: %v", task)
+	}
+
+	// The goroutine of the task is blocked on the worker.
+	if b := task.breakdown(res.assistEvents); b.BlockTime <= 0 || b.TotalTime > int64(task.duration()) {
+		t.Errorf("got breakdown %+v, want sync block time and total time <= %v", b, task.duration())
+	}
+
+	tr, err := parseTrace()
+	if err != nil {
+		t.Fatalf("failed to parse trace: %v", err)
+	}
+	path := task.criticalPath(goroutineStateEvents(tr.Events))
+	if len(path) == 0 {
+		t.Fatalf("empty critical path")
+	}
+	// The path covers the task without gaps, and goes through the
+	// worker, which unblocked the goroutine of the task.
+	if start, end := path[0].Start, path[len(path)-1].End; start != task.firstTimestamp() || end != task.endTimestamp() {
+		t.Errorf("critical path covers [%d, %d], want [%d, %d]", start, end, task.firstTimestamp(), task.endTimestamp())
+	}
+	var worker uint64
+	for i, s := range path {
+		if i > 0 && s.Start != path[i-1].End {
+			t.Errorf("gap in critical path between %+v and %+v", path[i-1], s)
+		}
+		if s.G == task.end.G && s.From != 0 {
+			worker = s.From
+		}
+	}
+	var workerRan bool
+	for _, s := range path {
+		if s.G == worker && s.Kind == "running" {
+			workerRan = true
+		}
+	}
+	if worker == 0 || !workerRan {
+		buf := new(bytes.Buffer)
+		for _, s := range path {
+			fmt.Fprintf(buf, " %+v\n", s)
+		}
+		t.Errorf("critical path does not go through the worker running:\n%s", buf)
+	}
+
+	w := httptest.NewRecorder()
+	httpUserTaskPath(w, httptest.NewRequest("GET", fmt.Sprintf("/usertaskpath?id=%d", task.id), nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "made runnable by goroutine") {
+		t.Errorf("/usertaskpath returned %d:\n%s", w.Code, w.Body)
+	}
+}
+
 // traceProgram runs the provided function while tracing is enabled,
 // parses the captured trace, and sets the global trace loader to
 // point to the parsed trace.
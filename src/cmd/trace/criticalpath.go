@@ -0,0 +1,336 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Breakdown of the latency of user tasks.
+
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"internal/trace"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// httpUserTaskPath presents where the time of the selected task went:
+// the time the goroutines of the task spent in each state within the
+// task's regions, and the critical path of the task.
+func httpUserTaskPath(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.FormValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse id parameter %q: %v", r.FormValue("id"), err), http.StatusBadRequest)
+		return
+	}
+	res, err := analyzeAnnotations()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	task, ok := res.tasks[id]
+	if !ok {
+		http.Error(w, fmt.Sprintf("task %d not found", id), http.StatusNotFound)
+		return
+	}
+	tr, err := parseTrace()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	path := task.criticalPath(goroutineStateEvents(tr.Events))
+	type kindTime struct {
+		Kind string
+		Time time.Duration
+	}
+	var total []kindTime
+	byKind := make(map[string]int)
+	for _, s := range path {
+		i, ok := byKind[s.Kind]
+		if !ok {
+			i = len(total)
+			byKind[s.Kind] = i
+			total = append(total, kindTime{Kind: s.Kind})
+		}
+		total[i].Time += s.Duration()
+	}
+	sort.SliceStable(total, func(i, j int) bool {
+		return total[i].Time > total[j].Time
+	})
+
+	start := task.firstTimestamp()
+	err = templUserTaskPath.Execute(w, struct {
+		ID        uint64
+		Name      string
+		Duration  time.Duration
+		Complete  bool
+		Breakdown taskBreakdown
+		Path      []criticalSegment
+		Total     []kindTime
+		Start     int64
+	}{
+		ID:        task.id,
+		Name:      task.name,
+		Duration:  task.duration(),
+		Complete:  task.complete(),
+		Breakdown: task.breakdown(res.assistEvents),
+		Path:      path,
+		Total:     total,
+		Start:     start,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to execute template: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// taskBreakdown is the time the goroutines of a task spent in each
+// state within the regions of the task.
+type taskBreakdown struct {
+	trace.GExecutionStat
+
+	// AssistTime is the time spent in GC mark assists, in
+	// nanoseconds, which is part of ExecTime.
+	AssistTime int64
+}
+
+// breakdown returns the time the goroutines of the task spent in each
+// state within the regions of the task. Regions nested in other
+// regions of the task on the same goroutine are not counted twice.
+func (task *taskDesc) breakdown(assistEvents []*trace.Event) taskBreakdown {
+	var b taskBreakdown
+	lastRegionEnd := make(map[uint64]int64) // the end of the previous region per goroutine
+	for _, region := range task.regions {
+		start, end := region.firstTimestamp(), region.lastTimestamp()
+		if start < lastRegionEnd[region.G] { // skip nested regions
+			continue
+		}
+		lastRegionEnd[region.G] = end
+		b.ExecTime += region.ExecTime
+		b.SchedWaitTime += region.SchedWaitTime
+		b.IOTime += region.IOTime
+		b.BlockTime += region.BlockTime
+		b.SyscallTime += region.SyscallTime
+		b.GCTime += region.GCTime
+		b.SweepTime += region.SweepTime
+		b.TotalTime += region.TotalTime
+	}
+	for _, ev := range assistEvents {
+		if o, overlapped := task.overlappingDuration(ev); overlapped {
+			b.AssistTime += int64(o)
+		}
+	}
+	return b
+}
+
+// criticalSegment is a part of the critical path of a task,
+// during which goroutine G was in the state described by Kind.
+type criticalSegment struct {
+	G          uint64
+	Start, End int64
+	Kind       string
+
+	// From is the goroutine that unblocked or created G
+	// at the start of the segment, or 0.
+	From uint64
+}
+
+func (s criticalSegment) Duration() time.Duration {
+	return time.Duration(s.End-s.Start) * time.Nanosecond
+}
+
+// goroutineStateEvents returns the events that change the state of
+// each goroutine, keyed by goroutine and sorted by time.
+func goroutineStateEvents(events []*trace.Event) map[uint64][]*trace.Event {
+	gevents := make(map[uint64][]*trace.Event)
+	for _, ev := range events {
+		switch ev.Type {
+		case trace.EvGoCreate, trace.EvGoUnblock:
+			g := ev.Args[0]
+			gevents[g] = append(gevents[g], ev)
+		case trace.EvGoStart, trace.EvGoStartLabel, trace.EvGoEnd, trace.EvGoStop,
+			trace.EvGoSched, trace.EvGoPreempt, trace.EvGoSleep, trace.EvGoBlock,
+			trace.EvGoBlockSend, trace.EvGoBlockRecv, trace.EvGoBlockSelect,
+			trace.EvGoBlockSync, trace.EvGoBlockCond, trace.EvGoBlockNet,
+			trace.EvGoBlockGC, trace.EvGoSysBlock, trace.EvGoSysExit,
+			trace.EvGoWaiting, trace.EvGoInSyscall:
+			gevents[ev.G] = append(gevents[ev.G], ev)
+		}
+	}
+	return gevents
+}
+
+// criticalPath returns the critical path of the task, sorted by time.
+//
+// The critical path is found by walking back in time from the end of
+// the task, on the goroutine that ended it. When the goroutine was
+// made runnable by another goroutine, that unblocked it or created it,
+// the walk continues on that other goroutine. It stops at the start of
+// the task. Shortening any segment of the critical path, such as
+// running less or waiting less to be scheduled, shortens the task.
+//
+// gevents are the events that change the state of each goroutine,
+// as returned by goroutineStateEvents.
+func (task *taskDesc) criticalPath(gevents map[uint64][]*trace.Event) []criticalSegment {
+	if task == nil || task.end == nil {
+		return nil
+	}
+	start := task.firstTimestamp()
+	g, t := task.end.G, task.end.Ts
+	evs := gevents[g]
+	i := sort.Search(len(evs), func(i int) bool { return evs[i].Ts > t }) - 1
+
+	var path []criticalSegment
+	add := func(s criticalSegment) {
+		if n := len(path); n > 0 {
+			last := &path[n-1]
+			if last.G == s.G && last.Kind == s.Kind && last.Start == s.End && last.From == 0 {
+				last.Start, last.From = s.Start, s.From
+				return
+			}
+		}
+		path = append(path, s)
+	}
+	for t > start {
+		if i < 0 {
+			// The state of the goroutine before the first
+			// event is unknown.
+			add(criticalSegment{G: g, Start: start, End: t, Kind: "unknown"})
+			break
+		}
+		ev := evs[i]
+		s := criticalSegment{G: g, Start: max(ev.Ts, start), End: t}
+		next := g
+		switch ev.Type {
+		case trace.EvGoStart, trace.EvGoStartLabel:
+			s.Kind = "running"
+		case trace.EvGoUnblock:
+			s.Kind = "scheduler wait"
+			if ev.P < trace.FakeP && ev.G != 0 {
+				s.From, next = ev.G, ev.G
+			}
+		case trace.EvGoCreate:
+			s.Kind = "scheduler wait"
+			s.From, next = ev.G, ev.G
+		case trace.EvGoSched, trace.EvGoPreempt, trace.EvGoSysExit:
+			s.Kind = "scheduler wait"
+		case trace.EvGoSleep:
+			s.Kind = "sleep"
+		case trace.EvGoBlockNet:
+			s.Kind = "network wait"
+		case trace.EvGoSysBlock, trace.EvGoInSyscall:
+			s.Kind = "syscall"
+		case trace.EvGoBlockGC:
+			s.Kind = "GC assist wait"
+		case trace.EvGoBlock, trace.EvGoBlockSend, trace.EvGoBlockRecv,
+			trace.EvGoBlockSelect, trace.EvGoBlockSync, trace.EvGoBlockCond,
+			trace.EvGoWaiting:
+			s.Kind = "sync block"
+		default:
+			// The goroutine is not running any more, which should
+			// not happen on the path.
+			s.Kind = "unknown"
+			next = 0
+		}
+		add(s)
+		t = s.Start
+		if next == 0 {
+			break
+		}
+		if next == g {
+			i--
+			continue
+		}
+		g, evs = next, gevents[next]
+		i = sort.Search(len(evs), func(i int) bool { return evs[i].Ts > t }) - 1
+	}
+
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+var templUserTaskPath = template.Must(template.New("userTaskPath").Funcs(template.FuncMap{
+	"prettyDuration": func(nsec int64) template.HTML {
+		d := time.Duration(nsec) * time.Nanosecond
+		return template.HTML(niceDuration(d))
+	},
+	"since": func(ts, start int64) time.Duration {
+		return time.Duration(ts-start) * time.Nanosecond
+	},
+}).Parse(`
+<!DOCTYPE html>
+<title>Task {{.ID}}: {{.Name}}</title>
+<style>
+th {
+  background-color: #050505;
+  color: #fff;
+}
+table {
+  border-collapse: collapse;
+}
+td {
+  text-align: right;
+  border: 1px solid #000;
+  padding: 0 0.5em;
+}
+td.id {
+  text-align: left;
+}
+</style>
+
+<h2>Task {{.ID}}: {{.Name}}</h2>
+<p>Duration: {{.Duration}} ({{if .Complete}}complete{{else}}incomplete{{end}})</p>
+
+<h3>Time in the task's regions</h3>
+<p>Time the goroutines of the task spent in each state within the regions of the task.
+Goroutines run in parallel, so the total may exceed the duration of the task.</p>
+<table>
+<tr><th>Total</th><th>Execution</th><th>GC assist</th><th>Scheduler wait</th><th>Network wait</th><th>Blocking syscall</th><th>Sync block</th><th>GC sweeping</th><th>GC pause</th></tr>
+{{with .Breakdown}}
+<tr>
+  <td>{{prettyDuration .TotalTime}}</td>
+  <td>{{prettyDuration .ExecTime}}</td>
+  <td>{{prettyDuration .AssistTime}}</td>
+  <td>{{prettyDuration .SchedWaitTime}}</td>
+  <td>{{prettyDuration .IOTime}}</td>
+  <td>{{prettyDuration .SyscallTime}}</td>
+  <td>{{prettyDuration .BlockTime}}</td>
+  <td>{{prettyDuration .SweepTime}}</td>
+  <td>{{prettyDuration .GCTime}}</td>
+</tr>
+{{end}}
+</table>
+
+<h3>Critical path</h3>
+{{if .Complete}}
+<p>The critical path follows the goroutine that ended the task back in time,
+and the goroutines that unblocked or created it, to the start of the task.
+Shortening any part of it shortens the task.</p>
+<table>
+<tr><th>State</th><th>Time</th></tr>
+{{range .Total}}
+<tr><td class="id">{{.Kind}}</td><td>{{.Time}}</td></tr>
+{{end}}
+</table>
+<p>
+<table>
+<tr><th>Since task start</th><th>Duration</th><th>Goroutine</th><th>State</th></tr>
+{{range .Path}}
+<tr>
+  <td>{{since .Start $.Start}}</td>
+  <td>{{.Duration}}</td>
+  <td class="id"><a href="/trace?goid={{.G}}">{{.G}}</a></td>
+  <td class="id">{{.Kind}}{{if .From}} (made runnable by goroutine <a href="/trace?goid={{.From}}">{{.From}}</a>){{end}}</td>
+</tr>
+{{end}}
+</table>
+</p>
+{{else}}
+<p>The task does not end in the trace.</p>
+{{end}}
+`))
@@ -33,6 +33,22 @@ Then, you can use the pprof tool to analyze the profile:
 
 	go tool pprof TYPE.pprof
 
+Traces written by Go 1.22 and later are made of segments that cover about
+a second of execution each. To view only part of a large trace, pass a
+window of time, as durations since the start of the trace, and only the
+segments that overlap it are loaded:
+
+	go tool trace -window=10s:15s trace.out
+
+To view the trace in other trace viewers, such as https://ui.perfetto.dev,
+export it in the Perfetto protocol buffer format or in the JSON format of
+the Chrome trace viewer. The export shows the goroutines run on each P,
+the states of each goroutine, GC and stop-the-world pauses, user regions,
+and arrows from the unblocking of each goroutine to its next run:
+
+	go tool trace -export=perfetto trace.out > trace.perfetto
+	go tool trace -export=json trace.out > trace.json
+
 Note that while the various profiles available when launching
 'go tool trace' work on every browser, the trace viewer itself
 (the 'view trace' page) comes from the Chrome/Chromium project
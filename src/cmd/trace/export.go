@@ -0,0 +1,477 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"cmd/internal/traceviewer"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"internal/trace"
+	"io"
+	"sort"
+)
+
+// exportFormats are the formats supported by the -export flag.
+var exportFormats = map[string]func(io.Writer, *exportData) error{
+	"json":     writeExportJSON,
+	"perfetto": writeExportPerfetto,
+}
+
+// exportTrace writes the trace to w in the given format.
+func exportTrace(w io.Writer, format string) error {
+	write, ok := exportFormats[format]
+	if !ok {
+		return fmt.Errorf("unknown export format %q", format)
+	}
+	res, err := parseTrace()
+	if err != nil {
+		return err
+	}
+	return write(w, buildExport(res))
+}
+
+// exportData is a trace prepared for export to other trace viewers.
+// It is made of slices, which are intervals of time on a track, and
+// may be nested, and of flows, which connect two slices.
+type exportData struct {
+	groups []string
+	tracks []exportTrack
+	slices []exportSlice
+}
+
+// Groups of tracks.
+const (
+	exportRuntime    = iota // GC, stop-the-world and unblocking sources
+	exportProcs             // a track per P
+	exportGoroutines        // a track per goroutine with its states
+	exportRegions           // a track per goroutine with its user regions
+)
+
+var exportGroups = []string{
+	exportRuntime:    "Runtime",
+	exportProcs:      "Procs",
+	exportGoroutines: "Goroutines",
+	exportRegions:    "User regions",
+}
+
+type exportTrack struct {
+	group int
+	name  string
+	rank  int // position of the track in its group
+}
+
+type exportSlice struct {
+	track      int // index in exportData.tracks
+	name       string
+	start, end int64
+
+	// flowOut is the flow that starts at this slice, and flowIn the
+	// flow that ends at it, or 0.
+	flowOut, flowIn uint64
+}
+
+// buildExport builds the export of the trace res. It shows the
+// goroutines run on each P, the states of each goroutine, garbage
+// collections and stop-the-world pauses, user regions, and flows from
+// the unblocking of goroutines to their start.
+func buildExport(res trace.ParseResult) *exportData {
+	d := &exportData{groups: exportGroups}
+	type trackKey struct {
+		group int
+		id    uint64
+	}
+	trackIDs := make(map[trackKey]int)
+	track := func(group int, id uint64, name string, rank int) int {
+		k := trackKey{group, id}
+		if i, ok := trackIDs[k]; ok {
+			return i
+		}
+		d.tracks = append(d.tracks, exportTrack{group: group, name: name, rank: rank})
+		trackIDs[k] = len(d.tracks) - 1
+		return len(d.tracks) - 1
+	}
+
+	var lastTs int64
+	if n := len(res.Events); n > 0 {
+		lastTs = res.Events[n-1].Ts
+	}
+	end := func(ev *trace.Event) int64 {
+		if ev.Link == nil {
+			return lastTs
+		}
+		return ev.Link.Ts
+	}
+
+	type gState struct {
+		name   string
+		state  string // name of the current state slice, if any
+		start  int64  // start of the current state slice
+		flowIn uint64
+	}
+	gs := make(map[uint64]*gState)
+	getG := func(g uint64) *gState {
+		s, ok := gs[g]
+		if !ok {
+			s = &gState{name: fmt.Sprintf("G%d", g)}
+			gs[g] = s
+		}
+		return s
+	}
+	// setState ends the current state slice of goroutine g, if any,
+	// and starts a new one, unless state is empty.
+	setState := func(g uint64, ts int64, state string) {
+		s := getG(g)
+		if s.state != "" {
+			d.slices = append(d.slices, exportSlice{
+				track:  track(exportGoroutines, g, s.name, int(g)),
+				name:   s.state,
+				start:  s.start,
+				end:    ts,
+				flowIn: s.flowIn,
+			})
+		}
+		s.state, s.start, s.flowIn = state, ts, 0
+	}
+
+	var flows uint64
+	flowIn := make(map[*trace.Event]uint64) // flows that end at EvGoStart events
+	for _, ev := range res.Events {
+		switch ev.Type {
+		case trace.EvGoCreate:
+			s := getG(ev.Args[0])
+			if stk := res.Stacks[ev.Args[1]]; len(stk) > 0 && stk[0].Fn != "" {
+				s.name = fmt.Sprintf("G%d %s", ev.Args[0], stk[0].Fn)
+			}
+			setState(ev.Args[0], ev.Ts, "runnable")
+		case trace.EvGoStart, trace.EvGoStartLabel:
+			setState(ev.G, ev.Ts, "running")
+			s := getG(ev.G)
+			s.flowIn = flowIn[ev]
+			delete(flowIn, ev)
+			name := s.name
+			if ev.Type == trace.EvGoStartLabel {
+				name += " (" + ev.SArgs[0] + ")"
+			}
+			d.slices = append(d.slices, exportSlice{
+				track: track(exportProcs, uint64(ev.P), fmt.Sprintf("Proc %d", ev.P), ev.P),
+				name:  name,
+				start: ev.Ts,
+				end:   end(ev),
+			})
+		case trace.EvGoEnd, trace.EvGoStop:
+			setState(ev.G, ev.Ts, "")
+		case trace.EvGoSched, trace.EvGoPreempt:
+			setState(ev.G, ev.Ts, "runnable")
+		case trace.EvGoSleep:
+			setState(ev.G, ev.Ts, "sleep")
+		case trace.EvGoBlock, trace.EvGoBlockGC:
+			setState(ev.G, ev.Ts, "blocked")
+		case trace.EvGoBlockSend:
+			setState(ev.G, ev.Ts, "blocked (chan send)")
+		case trace.EvGoBlockRecv:
+			setState(ev.G, ev.Ts, "blocked (chan receive)")
+		case trace.EvGoBlockSelect:
+			setState(ev.G, ev.Ts, "blocked (select)")
+		case trace.EvGoBlockSync, trace.EvGoBlockCond:
+			setState(ev.G, ev.Ts, "blocked (sync)")
+		case trace.EvGoBlockNet:
+			setState(ev.G, ev.Ts, "blocked (network)")
+		case trace.EvGoWaiting:
+			setState(ev.G, ev.Ts, "blocked")
+		case trace.EvGoSysBlock, trace.EvGoInSyscall:
+			setState(ev.G, ev.Ts, "syscall")
+		case trace.EvGoSysExit:
+			setState(ev.G, ev.Ts, "runnable")
+		case trace.EvGoUnblock:
+			g := ev.Args[0]
+			setState(g, ev.Ts, "runnable")
+			if ev.Link == nil {
+				break
+			}
+			var src int
+			switch {
+			case ev.P < trace.FakeP && ev.G != 0:
+				src = track(exportGoroutines, ev.G, getG(ev.G).name, int(ev.G))
+			case ev.P == trace.TimerP:
+				src = track(exportRuntime, trace.TimerP, "Timers", 2)
+			case ev.P == trace.NetpollP:
+				src = track(exportRuntime, trace.NetpollP, "Network", 3)
+			default:
+				src = track(exportRuntime, trace.SyscallP, "Syscalls", 4)
+			}
+			flows++
+			flowIn[ev.Link] = flows
+			d.slices = append(d.slices, exportSlice{
+				track:   src,
+				name:    fmt.Sprintf("unblock %s", getG(g).name),
+				start:   ev.Ts,
+				end:     ev.Ts,
+				flowOut: flows,
+			})
+		case trace.EvGCStart:
+			d.slices = append(d.slices, exportSlice{
+				track: track(exportRuntime, trace.GCP, "GC", 0),
+				name:  "GC",
+				start: ev.Ts,
+				end:   end(ev),
+			})
+		case trace.EvSTWStart:
+			d.slices = append(d.slices, exportSlice{
+				track: track(exportRuntime, 0, "Stop the world", 1),
+				name:  fmt.Sprintf("STW (%s)", ev.SArgs[0]),
+				start: ev.Ts,
+				end:   end(ev),
+			})
+		case trace.EvUserRegion:
+			name := getG(ev.G).name
+			switch ev.Args[1] {
+			case 0: // region start
+				d.slices = append(d.slices, exportSlice{
+					track: track(exportRegions, ev.G, name, int(ev.G)),
+					name:  ev.SArgs[0],
+					start: ev.Ts,
+					end:   end(ev),
+				})
+			case 1: // region end
+				// Regions that end in the trace but start before it
+				// have no start event.
+				if ev.Link != nil {
+					break
+				}
+				d.slices = append(d.slices, exportSlice{
+					track: track(exportRegions, ev.G, name, int(ev.G)),
+					name:  ev.SArgs[0],
+					start: res.Events[0].Ts,
+					end:   ev.Ts,
+				})
+			}
+		}
+	}
+	// Goroutines that do not end have their last state until the end
+	// of the trace.
+	for g := range gs {
+		setState(g, lastTs, "")
+	}
+
+	// Sort slices by start time, and enclosing slices before the
+	// slices they enclose.
+	sort.SliceStable(d.slices, func(i, j int) bool {
+		si, sj := &d.slices[i], &d.slices[j]
+		if si.start != sj.start {
+			return si.start < sj.start
+		}
+		return si.end > sj.end
+	})
+	return d
+}
+
+// writeExportJSON writes d in the JSON format of the Chrome trace
+// viewer, which Perfetto also reads. Each group of tracks is a process,
+// and each track is a thread.
+func writeExportJSON(w io.Writer, d *exportData) error {
+	data := traceviewer.Data{TimeUnit: "ns"}
+	emit := func(ev *traceviewer.Event) {
+		data.Events = append(data.Events, ev)
+	}
+	for i, name := range d.groups {
+		emit(&traceviewer.Event{Name: "process_name", Phase: "M", PID: uint64(i), Arg: &NameArg{name}})
+		emit(&traceviewer.Event{Name: "process_sort_index", Phase: "M", PID: uint64(i), Arg: &SortIndexArg{i}})
+	}
+	for i, t := range d.tracks {
+		emit(&traceviewer.Event{Name: "thread_name", Phase: "M", PID: uint64(t.group), TID: uint64(i), Arg: &NameArg{t.name}})
+		emit(&traceviewer.Event{Name: "thread_sort_index", Phase: "M", PID: uint64(t.group), TID: uint64(i), Arg: &SortIndexArg{t.rank}})
+	}
+	for i := range d.slices {
+		s := &d.slices[i]
+		t := d.tracks[s.track]
+		// Trace viewer wants timestamps in microseconds, and
+		// handles slices with no duration as never ending.
+		dur := float64(s.end-s.start) / 1000
+		if dur <= 0 {
+			dur = 0.0001 // 0.1 nanoseconds
+		}
+		emit(&traceviewer.Event{Name: s.name, Phase: "X", Time: float64(s.start) / 1000, Dur: dur, PID: uint64(t.group), TID: uint64(s.track)})
+		if s.flowOut != 0 {
+			emit(&traceviewer.Event{Name: "unblock", Category: "flow", Phase: "s", ID: s.flowOut, Time: float64(s.start) / 1000, PID: uint64(t.group), TID: uint64(s.track)})
+		}
+		if s.flowIn != 0 {
+			emit(&traceviewer.Event{Name: "unblock", Category: "flow", Phase: "f", BindPoint: "e", ID: s.flowIn, Time: float64(s.start) / 1000, PID: uint64(t.group), TID: uint64(s.track)})
+		}
+	}
+	return json.NewEncoder(w).Encode(data)
+}
+
+// writeExportPerfetto writes d in the protocol buffer format of
+// Perfetto, as a Trace message described in
+// https://perfetto.dev/docs/reference/trace-packet-proto.
+//
+// Each group of tracks and each track is a track, described by a
+// TrackDescriptor. The tracks of a group are its children. Slices are
+// pairs of TrackEvents of type TYPE_SLICE_BEGIN and TYPE_SLICE_END.
+func writeExportPerfetto(w io.Writer, d *exportData) error {
+	// Field numbers of the messages written.
+	const (
+		tracePacket = 1 // Trace
+
+		packetTimestamp       = 8 // TracePacket
+		packetSequenceID      = 10
+		packetTrackEvent      = 11
+		packetSequenceFlags   = 13
+		packetTrackDescriptor = 60
+
+		trackUUID                  = 1 // TrackDescriptor
+		trackName                  = 2
+		trackParentUUID            = 5
+		trackChildOrdering         = 11
+		trackSiblingOrderRank      = 12
+		childOrderingExplicit      = 3
+		sequenceIncrementalCleared = 1
+
+		eventType               = 9 // TrackEvent
+		eventTrackUUID          = 11
+		eventName               = 23
+		eventFlowIDs            = 47
+		eventTerminatingFlowIDs = 48
+		typeSliceBegin          = 1
+		typeSliceEnd            = 2
+
+		sequenceID = 1
+	)
+	groupUUID := func(group int) uint64 { return uint64(group) + 1 }
+	trackUUIDOf := func(track int) uint64 { return uint64(len(d.groups)+track) + 1 }
+
+	var out, packet, msg protoBuffer
+	writePacket := func() error {
+		out.bytes(tracePacket, packet.data)
+		packet.reset()
+		_, err := w.Write(out.data)
+		out.reset()
+		return err
+	}
+
+	for i, name := range d.groups {
+		msg.uint64(trackUUID, groupUUID(i))
+		msg.string(trackName, name)
+		msg.uint64(trackChildOrdering, childOrderingExplicit)
+		msg.uint64(trackSiblingOrderRank, uint64(i))
+		packet.bytes(packetTrackDescriptor, msg.data)
+		msg.reset()
+		if i == 0 {
+			packet.uint64(packetSequenceID, sequenceID)
+			packet.uint64(packetSequenceFlags, sequenceIncrementalCleared)
+		}
+		if err := writePacket(); err != nil {
+			return err
+		}
+	}
+	for i, t := range d.tracks {
+		msg.uint64(trackUUID, trackUUIDOf(i))
+		msg.string(trackName, t.name)
+		msg.uint64(trackParentUUID, groupUUID(t.group))
+		msg.uint64(trackSiblingOrderRank, uint64(t.rank))
+		packet.bytes(packetTrackDescriptor, msg.data)
+		msg.reset()
+		if err := writePacket(); err != nil {
+			return err
+		}
+	}
+
+	// Slices are sorted by start time. Open slices of each track are
+	// kept on a stack, and ended when a slice starts after them, so
+	// that track events are written in time order.
+	open := make([][]*exportSlice, len(d.tracks))
+	writeEvent := func(ts int64, s *exportSlice, typ uint64) error {
+		packet.uint64(packetTimestamp, uint64(ts))
+		packet.uint64(packetSequenceID, sequenceID)
+		msg.uint64(eventType, typ)
+		msg.uint64(eventTrackUUID, trackUUIDOf(s.track))
+		if typ == typeSliceBegin {
+			msg.string(eventName, s.name)
+			if s.flowOut != 0 {
+				msg.fixed64(eventFlowIDs, s.flowOut)
+			}
+			if s.flowIn != 0 {
+				msg.fixed64(eventTerminatingFlowIDs, s.flowIn)
+			}
+		}
+		packet.bytes(packetTrackEvent, msg.data)
+		msg.reset()
+		return writePacket()
+	}
+	// endSlices ends the open slices of all tracks that end at or
+	// before ts, in time order.
+	endSlices := func(ts int64) error {
+		for {
+			var next *exportSlice
+			track := -1
+			for i, stk := range open {
+				if n := len(stk); n > 0 && stk[n-1].end <= ts && (next == nil || stk[n-1].end < next.end) {
+					next, track = stk[n-1], i
+				}
+			}
+			if next == nil {
+				return nil
+			}
+			open[track] = open[track][:len(open[track])-1]
+			if err := writeEvent(next.end, next, typeSliceEnd); err != nil {
+				return err
+			}
+		}
+	}
+	for i := range d.slices {
+		s := &d.slices[i]
+		if err := endSlices(s.start); err != nil {
+			return err
+		}
+		// A slice must end with the slice that encloses it.
+		if stk := open[s.track]; len(stk) > 0 && s.end > stk[len(stk)-1].end {
+			s.end = stk[len(stk)-1].end
+		}
+		if err := writeEvent(s.start, s, typeSliceBegin); err != nil {
+			return err
+		}
+		open[s.track] = append(open[s.track], s)
+	}
+	return endSlices(1<<63 - 1)
+}
+
+// protoBuffer encodes protocol buffer messages.
+type protoBuffer struct {
+	data []byte
+}
+
+func (b *protoBuffer) reset() {
+	b.data = b.data[:0]
+}
+
+func (b *protoBuffer) tag(field, wireType int) {
+	b.data = binary.AppendUvarint(b.data, uint64(field)<<3|uint64(wireType))
+}
+
+// uint64 encodes a varint field, such as an integer or an enum.
+func (b *protoBuffer) uint64(field int, v uint64) {
+	b.tag(field, 0)
+	b.data = binary.AppendUvarint(b.data, v)
+}
+
+// fixed64 encodes a fixed64 field.
+func (b *protoBuffer) fixed64(field int, v uint64) {
+	b.tag(field, 1)
+	b.data = binary.LittleEndian.AppendUint64(b.data, v)
+}
+
+// bytes encodes a length-delimited field, such as an embedded message.
+func (b *protoBuffer) bytes(field int, p []byte) {
+	b.tag(field, 2)
+	b.data = binary.AppendUvarint(b.data, uint64(len(p)))
+	b.data = append(b.data, p...)
+}
+
+func (b *protoBuffer) string(field int, s string) {
+	b.tag(field, 2)
+	b.data = binary.AppendUvarint(b.data, uint64(len(s)))
+	b.data = append(b.data, s...)
+}
@@ -0,0 +1,237 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !js
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"runtime/trace"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExport(t *testing.T) {
+	if err := traceProgram(t, exportProgram, "TestExport"); err != nil {
+		t.Fatalf("failed to trace the program: %v", err)
+	}
+	res, err := parseTrace()
+	if err != nil {
+		t.Fatalf("failed to parse the trace: %v", err)
+	}
+	d := buildExport(res)
+
+	tracks := make(map[string]bool)
+	for _, tr := range d.tracks {
+		tracks[fmt.Sprintf("%s/%s", d.groups[tr.group], tr.name)] = true
+	}
+	for _, want := range []string{"Runtime/GC", "Runtime/Stop the world", "Procs/Proc 0"} {
+		if !tracks[want] {
+			t.Errorf("missing track %s in %v", want, tracks)
+		}
+	}
+
+	// The outer region encloses the inner region on the same track.
+	var outer, inner *exportSlice
+	for i := range d.slices {
+		s := &d.slices[i]
+		switch s.name {
+		case "outer":
+			outer = s
+		case "inner":
+			inner = s
+		}
+	}
+	if outer == nil || inner == nil {
+		t.Fatalf("missing regions: outer %v, inner %v", outer, inner)
+	}
+	if outer.track != inner.track || d.tracks[outer.track].group != exportRegions {
+		t.Errorf("regions are on tracks %d and %d, want the same track of regions", outer.track, inner.track)
+	}
+	if inner.start < outer.start || inner.end > outer.end {
+		t.Errorf("inner region [%d, %d] not within outer region [%d, %d]", inner.start, inner.end, outer.start, outer.end)
+	}
+
+	// The receiving goroutine blocks in the inner region, and the flow
+	// from its unblocking ends at its next run.
+	var blocked bool
+	flows := make(map[uint64]*exportSlice)
+	for i := range d.slices {
+		s := &d.slices[i]
+		if s.track == inner.track || d.tracks[s.track].group != exportGoroutines {
+			continue
+		}
+		if s.name == "blocked (chan receive)" && s.start >= inner.start && s.start <= inner.end {
+			blocked = true
+		}
+		if s.flowOut != 0 {
+			flows[s.flowOut] = s
+		}
+	}
+	if !blocked {
+		t.Errorf("goroutine not blocked on channel receive in inner region")
+	}
+	var linked bool
+	for i := range d.slices {
+		s := &d.slices[i]
+		if s.flowIn == 0 {
+			continue
+		}
+		src, ok := flows[s.flowIn]
+		if !ok {
+			continue
+		}
+		if s.name != "running" {
+			t.Errorf("flow %d ends at %q slice, want running", s.flowIn, s.name)
+		}
+		if s.start < src.start {
+			t.Errorf("flow %d ends at %d before it starts at %d", s.flowIn, s.start, src.start)
+		}
+		if strings.HasSuffix(src.name, "exportProgram.func1") {
+			linked = true
+		}
+	}
+	if !linked {
+		t.Errorf("no flow from the unblocking of the receiving goroutine")
+	}
+
+	var buf bytes.Buffer
+	if err := writeExportJSON(&buf, d); err != nil {
+		t.Fatalf("failed to write JSON: %v", err)
+	}
+	var data struct {
+		TraceEvents []struct {
+			Name  string `json:"name"`
+			Phase string `json:"ph"`
+		} `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &data); err != nil {
+		t.Fatalf("failed to decode JSON: %v", err)
+	}
+	phases := make(map[string]int)
+	for _, ev := range data.TraceEvents {
+		phases[ev.Phase]++
+	}
+	if phases["X"] != len(d.slices) || phases["s"] == 0 || phases["s"] != phases["f"] {
+		t.Errorf("got events %v in JSON, want %d slices and as many flow starts as ends", phases, len(d.slices))
+	}
+
+	buf.Reset()
+	if err := writeExportPerfetto(&buf, d); err != nil {
+		t.Fatalf("failed to write Perfetto trace: %v", err)
+	}
+	// Each packet is a track descriptor or a track event, and there
+	// are as many slice ends as slice beginnings.
+	var descriptors, begins, ends int
+	for p := buf.Bytes(); len(p) > 0; {
+		field, packet, rest, err := readProtoField(p)
+		if err != nil || field != 1 {
+			t.Fatalf("bad trace packet (field %d): %v", field, err)
+		}
+		p = rest
+		for len(packet) > 0 {
+			field, msg, rest, err := readProtoField(packet)
+			if err != nil {
+				t.Fatalf("bad field in trace packet: %v", err)
+			}
+			packet = rest
+			switch field {
+			case 60:
+				descriptors++
+			case 11:
+				for len(msg) > 0 {
+					field, v, rest, err := readProtoField(msg)
+					if err != nil {
+						t.Fatalf("bad field in track event: %v", err)
+					}
+					msg = rest
+					if field == 9 {
+						typ, _ := binary.Uvarint(v)
+						switch typ {
+						case 1:
+							begins++
+						case 2:
+							ends++
+						}
+					}
+				}
+			}
+		}
+	}
+	if descriptors != len(d.groups)+len(d.tracks) {
+		t.Errorf("got %d track descriptors, want %d", descriptors, len(d.groups)+len(d.tracks))
+	}
+	if begins != len(d.slices) || ends != begins {
+		t.Errorf("got %d slice beginnings and %d slice ends, want %d", begins, ends, len(d.slices))
+	}
+}
+
+// exportProgram blocks a goroutine on a channel within nested regions,
+// until the main goroutine unblocks it, and runs a GC.
+func exportProgram() {
+	ctx := context.Background()
+	c := make(chan int)
+	done := make(chan bool)
+	go func() {
+		trace.WithRegion(ctx, "outer", func() {
+			trace.WithRegion(ctx, "inner", func() {
+				<-c
+			})
+		})
+		done <- true
+	}()
+	trace.WithRegion(ctx, "send", func() {
+		// Wait for the goroutine to block.
+		for i := 0; i < 1000; i++ {
+			select {
+			case c <- 1:
+				return
+			default:
+				time.Sleep(time.Millisecond)
+			}
+		}
+		c <- 1
+	})
+	<-done
+	runtime.GC()
+}
+
+// readProtoField reads the first field of the protocol buffer message
+// p, and returns its number, its value, which is a varint or the
+// contents of a length-delimited field, and the rest of p.
+func readProtoField(p []byte) (field int, v, rest []byte, err error) {
+	tag, n := binary.Uvarint(p)
+	if n <= 0 {
+		return 0, nil, nil, fmt.Errorf("bad tag")
+	}
+	p = p[n:]
+	field = int(tag >> 3)
+	switch tag & 7 {
+	case 0:
+		_, n := binary.Uvarint(p)
+		if n <= 0 {
+			return 0, nil, nil, fmt.Errorf("bad varint")
+		}
+		return field, p[:n], p[n:], nil
+	case 1:
+		if len(p) < 8 {
+			return 0, nil, nil, fmt.Errorf("short fixed64")
+		}
+		return field, p[:8], p[8:], nil
+	case 2:
+		l, n := binary.Uvarint(p)
+		if n <= 0 || uint64(len(p)-n) < l {
+			return 0, nil, nil, fmt.Errorf("bad length")
+		}
+		return field, p[n : n+int(l)], p[n+int(l):], nil
+	}
+	return 0, nil, nil, fmt.Errorf("unsupported wire type %d", tag&7)
+}
@@ -13,12 +13,15 @@ import (
 	"internal/trace"
 	"io"
 	"log"
+	"math"
 	"net"
 	"net/http"
 	"os"
 	"runtime"
 	"runtime/debug"
+	"strings"
 	"sync"
+	"time"
 
 	_ "net/http/pprof" // Required to use pprof
 )
@@ -34,6 +37,9 @@ Open a web browser displaying trace:
 Generate a pprof-like profile from the trace:
     go tool trace -pprof=TYPE [pkg.test] trace.out
 
+Convert the trace for other trace viewers:
+    go tool trace -export=FORMAT trace.out > out
+
 [pkg.test] argument is required for traces produced by Go 1.6 and below.
 Go 1.7 does not require the binary argument.
 
@@ -43,10 +49,18 @@ Supported profile types are:
     - syscall: syscall blocking profile
     - sched: scheduler latency profile
 
+Supported export formats are:
+    - perfetto: Perfetto protocol buffer trace
+    - json: Chrome trace viewer JSON trace
+
 Flags:
 	-http=addr: HTTP service address (e.g., ':6060')
 	-pprof=type: print a pprof-like profile instead
+	-export=format: print the trace in another format instead
 	-d: print debug info such as parsed events
+	-window=start:end: only load the part of the trace between start
+	    and end, durations since the start of the trace (e.g., '10s:15s').
+	    Either one may be omitted.
 
 Note that while the various profiles available when launching
 'go tool trace' work on every browser, the trace viewer itself
@@ -55,13 +69,18 @@ and is only actively tested on that browser.
 `
 
 var (
-	httpFlag  = flag.String("http", "localhost:0", "HTTP service address (e.g., ':6060')")
-	pprofFlag = flag.String("pprof", "", "print a pprof-like profile instead")
-	debugFlag = flag.Bool("d", false, "print debug information such as parsed events list")
+	httpFlag   = flag.String("http", "localhost:0", "HTTP service address (e.g., ':6060')")
+	pprofFlag  = flag.String("pprof", "", "print a pprof-like profile instead")
+	exportFlag = flag.String("export", "", "print the trace in another format instead")
+	debugFlag  = flag.Bool("d", false, "print debug information such as parsed events list")
+	windowFlag = flag.String("window", "", "only load the part of the trace between `start:end`")
 
 	// The binary file name, left here for serveSVGProfile.
 	programBinary string
 	traceFile     string
+
+	// The part of the trace to load, in nanoseconds since its start.
+	windowStart, windowEnd int64 = 0, math.MaxInt64
 )
 
 func main() {
@@ -82,6 +101,13 @@ func main() {
 	default:
 		flag.Usage()
 	}
+	if *windowFlag != "" {
+		var err error
+		windowStart, windowEnd, err = parseWindowFlag(*windowFlag)
+		if err != nil {
+			dief("invalid -window flag: %v\n", err)
+		}
+	}
 
 	var pprofFunc func(io.Writer, *http.Request) error
 	switch *pprofFlag {
@@ -103,6 +129,12 @@ func main() {
 	if *pprofFlag != "" {
 		dief("unknown pprof type %s\n", *pprofFlag)
 	}
+	if *exportFlag != "" {
+		if err := exportTrace(os.Stdout, *exportFlag); err != nil {
+			dief("failed to export trace: %v\n", err)
+		}
+		os.Exit(0)
+	}
 
 	ln, err := net.Listen("tcp", *httpFlag)
 	if err != nil {
@@ -165,7 +197,12 @@ func parseTrace() (trace.ParseResult, error) {
 		defer tracef.Close()
 
 		// Parse and symbolize.
-		res, err := trace.Parse(bufio.NewReader(tracef), programBinary)
+		var res trace.ParseResult
+		if windowStart == 0 && windowEnd == math.MaxInt64 {
+			res, err = trace.Parse(bufio.NewReader(tracef), programBinary)
+		} else {
+			res, err = parseWindow(tracef, programBinary, windowStart, windowEnd)
+		}
 		if err != nil {
 			loader.err = fmt.Errorf("failed to parse trace: %v", err)
 			return
@@ -175,6 +212,79 @@ func parseTrace() (trace.ParseResult, error) {
 	return loader.res, loader.err
 }
 
+// parseWindowFlag parses the value of the -window flag, of the form
+// start:end, and returns start and end in nanoseconds.
+func parseWindowFlag(s string) (start, end int64, err error) {
+	from, to, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("%q is not of the form start:end", s)
+	}
+	start, end = 0, math.MaxInt64
+	if from != "" {
+		d, err := time.ParseDuration(from)
+		if err != nil {
+			return 0, 0, err
+		}
+		start = int64(d)
+	}
+	if to != "" {
+		d, err := time.ParseDuration(to)
+		if err != nil {
+			return 0, 0, err
+		}
+		end = int64(d)
+	}
+	if start < 0 || end < start {
+		return 0, 0, fmt.Errorf("%q is not a valid window", s)
+	}
+	return start, end, nil
+}
+
+// parseWindow parses the part of the trace in r between start and end,
+// in nanoseconds since the start of the trace.
+//
+// The trace is read one segment at a time, and only the segments that
+// overlap the window are kept, so that a window of a trace that is too
+// large to load as a whole can be loaded. The events of those segments
+// keep their times since the start of the trace.
+func parseWindow(r io.Reader, bin string, start, end int64) (trace.ParseResult, error) {
+	sr := trace.NewSegmentReader(bufio.NewReader(r), bin)
+	var res trace.ParseResult
+	for {
+		seg, err := sr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return trace.ParseResult{}, err
+		}
+		if n := len(seg.Events); n == 0 || seg.Events[n-1].Ts < start {
+			// Drop the segment, and make sure that the following
+			// ones do not depend on it.
+			sr.Restart()
+			continue
+		}
+		if seg.Events[0].Ts > end {
+			break
+		}
+		if res.Stacks == nil {
+			res = seg
+			continue
+		}
+		res.Events = append(res.Events, seg.Events...)
+		for id, stk := range seg.Stacks {
+			res.Stacks[id] = stk
+		}
+	}
+	if sr.Version() < 1007 && bin == "" {
+		return trace.ParseResult{}, fmt.Errorf("for traces produced by go 1.6 or below, the binary argument must be provided")
+	}
+	if res.Stacks == nil {
+		return trace.ParseResult{}, fmt.Errorf("trace has no events between %v and %v", time.Duration(start), time.Duration(end))
+	}
+	return res, nil
+}
+
 // httpMain serves the starting page.
 func httpMain(w http.ResponseWriter, r *http.Request) {
 	if err := templMain.Execute(w, ranges); err != nil {
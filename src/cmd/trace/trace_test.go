@@ -7,10 +7,12 @@
 package main
 
 import (
+	"bytes"
 	"cmd/internal/traceviewer"
 	"context"
 	"internal/trace"
 	"io"
+	"math"
 	rtrace "runtime/trace"
 	"strings"
 	"sync"
@@ -267,3 +269,84 @@ func TestDirectSemaphoreHandoff(t *testing.T) {
 		t.Fatalf("failed to parse the trace: %v", err)
 	}
 }
+
+func TestParseWindowFlag(t *testing.T) {
+	for _, tc := range []struct {
+		in         string
+		start, end int64
+		ok         bool
+	}{
+		{"1s:2s", 1e9, 2e9, true},
+		{"500ms:", 5e8, 1<<63 - 1, true},
+		{":1m", 0, 60e9, true},
+		{":", 0, 1<<63 - 1, true},
+		{"1s", 0, 0, false},
+		{"2s:1s", 0, 0, false},
+		{"-1s:1s", 0, 0, false},
+		{"x:1s", 0, 0, false},
+	} {
+		start, end, err := parseWindowFlag(tc.in)
+		if !tc.ok {
+			if err == nil {
+				t.Errorf("parseWindowFlag(%q) succeeded, want error", tc.in)
+			}
+			continue
+		}
+		if err != nil || start != tc.start || end != tc.end {
+			t.Errorf("parseWindowFlag(%q) = %d, %d, %v, want %d, %d", tc.in, start, end, err, tc.start, tc.end)
+		}
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	if rtrace.IsEnabled() {
+		t.Skip("skipping because -test.trace is set")
+	}
+	// A flight recorder snapshot is made of many short segments.
+	fr := rtrace.NewFlightRecorder(rtrace.FlightRecorderConfig{MinAge: 100 * time.Millisecond})
+	if err := fr.Start(); err != nil {
+		t.Fatalf("failed to start flight recorder: %v", err)
+	}
+	defer fr.Stop()
+	c := make(chan int)
+	go func() {
+		for range c {
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		c <- i
+		time.Sleep(time.Millisecond)
+	}
+	close(c)
+	var buf bytes.Buffer
+	if _, err := fr.WriteTo(&buf); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+	data := buf.Bytes()
+
+	all, err := trace.Parse(bytes.NewReader(data), "")
+	if err != nil {
+		t.Fatalf("failed to parse trace: %v", err)
+	}
+	last := all.Events[len(all.Events)-1].Ts
+	mid := last / 2
+	res, err := parseWindow(bytes.NewReader(data), "", mid, mid)
+	if err != nil {
+		t.Fatalf("parseWindow: %v", err)
+	}
+	first, end := res.Events[0].Ts, res.Events[len(res.Events)-1].Ts
+	if first > mid || end < mid {
+		t.Errorf("window [%d, %d] does not include %d", first, end, mid)
+	}
+	if len(res.Events) >= len(all.Events) {
+		t.Errorf("window has %d events, want fewer than the %d of the whole trace", len(res.Events), len(all.Events))
+	}
+	params := &traceParams{parsed: res, endTime: math.MaxInt64}
+	if err := generateTrace(params, viewerDataTraceConsumer(io.Discard, 0, 1<<63-1)); err != nil {
+		t.Errorf("generateTrace failed on window: %v", err)
+	}
+
+	if _, err := parseWindow(bytes.NewReader(data), "", last+1, math.MaxInt64); err == nil {
+		t.Errorf("parseWindow succeeded on empty window")
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package trace
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Version is the version of a trace format. It is the minor version of
+// the Go release that introduced the format, such as 21 for Go 1.21.
+type Version int
+
+func (v Version) String() string {
+	return fmt.Sprintf("go1.%d", int(v))
+}
+
+// Time is the time of an event, in nanoseconds since the first event
+// of the trace.
+type Time int64
+
+// Sub returns the duration t-t0.
+func (t Time) Sub(t0 Time) time.Duration {
+	return time.Duration(t - t0)
+}
+
+// GoID is the ID of a goroutine.
+type GoID int64
+
+// NoGoroutine indicates that an event is not associated with any
+// goroutine.
+const NoGoroutine GoID = -1
+
+// ProcID is the ID of a P, the resource that a goroutine needs to run
+// Go code. There are GOMAXPROCS Ps.
+type ProcID int64
+
+// NoProc indicates that an event is not associated with any P.
+const NoProc ProcID = -1
+
+// TaskID is the ID of a user task created with runtime/trace.NewTask.
+type TaskID uint64
+
+// NoTask indicates that an event is not associated with any task.
+const NoTask TaskID = 0
+
+// EventKind is the kind of an event.
+type EventKind uint8
+
+const (
+	EventBad EventKind = iota
+
+	// EventStateTransition is a change in the state of a goroutine
+	// or a P, described by Event.Transition.
+	EventStateTransition
+
+	// EventMetric is a sample of a runtime metric, described by
+	// Event.Metric.
+	EventMetric
+
+	// EventRangeBegin and EventRangeEnd delimit a period of time during
+	// which the runtime does some work, such as garbage collection,
+	// named by Event.Range.
+	EventRangeBegin
+	EventRangeEnd
+
+	// EventTaskBegin and EventTaskEnd are the creation and the end of
+	// the user task Event.Task, created with runtime/trace.NewTask.
+	EventTaskBegin
+	EventTaskEnd
+
+	// EventRegionBegin and EventRegionEnd delimit a user region on
+	// the event's goroutine, created with runtime/trace.WithRegion
+	// or runtime/trace.StartRegion.
+	EventRegionBegin
+	EventRegionEnd
+
+	// EventLog is a user log message, written with
+	// runtime/trace.Log or runtime/trace.Logf.
+	EventLog
+
+	// EventStackSample is a CPU profile sample of the event's
+	// goroutine, taken while CPU profiling was enabled.
+	EventStackSample
+)
+
+var eventKindStrings = [...]string{
+	EventBad:             "Bad",
+	EventStateTransition: "StateTransition",
+	EventMetric:          "Metric",
+	EventRangeBegin:      "RangeBegin",
+	EventRangeEnd:        "RangeEnd",
+	EventTaskBegin:       "TaskBegin",
+	EventTaskEnd:         "TaskEnd",
+	EventRegionBegin:     "RegionBegin",
+	EventRegionEnd:       "RegionEnd",
+	EventLog:             "Log",
+	EventStackSample:     "StackSample",
+}
+
+func (k EventKind) String() string {
+	if int(k) < len(eventKindStrings) {
+		return eventKindStrings[k]
+	}
+	return eventKindStrings[EventBad]
+}
+
+// GoState is the state of a goroutine.
+type GoState uint8
+
+const (
+	GoUndetermined GoState = iota // state is not known
+	GoNotExist                    // goroutine does not exist
+	GoRunnable                    // goroutine is ready to run
+	GoRunning                     // goroutine is running
+	GoWaiting                     // goroutine is blocked
+	GoSyscall                     // goroutine is in a system call
+)
+
+var goStateStrings = [...]string{
+	GoUndetermined: "Undetermined",
+	GoNotExist:     "NotExist",
+	GoRunnable:     "Runnable",
+	GoRunning:      "Running",
+	GoWaiting:      "Waiting",
+	GoSyscall:      "Syscall",
+}
+
+func (s GoState) String() string {
+	if int(s) < len(goStateStrings) {
+		return goStateStrings[s]
+	}
+	return "Bad"
+}
+
+// ProcState is the state of a P.
+type ProcState uint8
+
+const (
+	ProcUndetermined ProcState = iota // state is not known
+	ProcIdle                          // P is not running any goroutine
+	ProcRunning                       // P is running goroutines
+)
+
+var procStateStrings = [...]string{
+	ProcUndetermined: "Undetermined",
+	ProcIdle:         "Idle",
+	ProcRunning:      "Running",
+}
+
+func (s ProcState) String() string {
+	if int(s) < len(procStateStrings) {
+		return procStateStrings[s]
+	}
+	return "Bad"
+}
+
+// ResourceKind is the kind of resource whose state an
+// EventStateTransition changes.
+type ResourceKind uint8
+
+const (
+	ResourceNone      ResourceKind = iota
+	ResourceGoroutine              // a goroutine, identified by a GoID
+	ResourceProc                   // a P, identified by a ProcID
+)
+
+// StateTransition describes a change in the state of a goroutine or
+// a P.
+type StateTransition struct {
+	Resource ResourceKind
+
+	// Goroutine, GoFrom and GoTo describe the transition of a
+	// goroutine, if Resource is ResourceGoroutine. The goroutine
+	// need not be the one the event happened on: for example, a
+	// goroutine creates another goroutine, or unblocks it.
+	Goroutine    GoID
+	GoFrom, GoTo GoState
+
+	// Proc, ProcFrom and ProcTo describe the transition of a P, if
+	// Resource is ResourceProc.
+	Proc             ProcID
+	ProcFrom, ProcTo ProcState
+
+	// Reason is a short explanation of the transition, such as
+	// "chan receive" for a goroutine that blocks on a channel, or
+	// the empty string.
+	Reason string
+
+	// Stack is the stack that the transitioning goroutine starts
+	// with, for a goroutine that is created.
+	Stack Stack
+}
+
+// Metric is a sample of a runtime metric. Name is the name of the
+// metric in the format used by runtime/metrics.
+type Metric struct {
+	Name  string
+	Value uint64
+}
+
+// Frame is a frame in a stack trace.
+type Frame struct {
+	PC   uint64
+	Func string
+	File string
+	Line int
+}
+
+// Stack is a stack trace, innermost frame first.
+type Stack []Frame
+
+// An Event is a single event in an execution trace.
+//
+// The fields after Stack are specific to some kinds of events, and
+// are zero for the other kinds.
+type Event struct {
+	Kind EventKind
+	Time Time
+
+	// Goroutine and Proc are the goroutine and the P on which the
+	// event happened, or NoGoroutine and NoProc.
+	Goroutine GoID
+	Proc      ProcID
+
+	// Stack is the stack trace of the goroutine at the event, if
+	// the event records one.
+	Stack Stack
+
+	// Transition describes an EventStateTransition.
+	Transition StateTransition
+
+	// Metric describes an EventMetric.
+	Metric Metric
+
+	// Range is the name of the range for EventRangeBegin and
+	// EventRangeEnd, such as "GC concurrent mark phase".
+	Range string
+
+	// Task is the user task of an EventTaskBegin, EventTaskEnd,
+	// EventRegionBegin, EventRegionEnd or EventLog, or NoTask.
+	// Parent is the parent task of an EventTaskBegin, or NoTask.
+	Task   TaskID
+	Parent TaskID
+
+	// Name is the type of the task or region, or the category of
+	// the log message, of an EventTaskBegin, EventTaskEnd,
+	// EventRegionBegin, EventRegionEnd or EventLog.
+	Name string
+
+	// Message is the message of an EventLog.
+	Message string
+}
+
+// String returns a short human-readable description of the event.
+func (e *Event) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%v %v G=%d P=%d", e.Time, e.Kind, e.Goroutine, e.Proc)
+	switch e.Kind {
+	case EventStateTransition:
+		t := &e.Transition
+		switch t.Resource {
+		case ResourceGoroutine:
+			fmt.Fprintf(&sb, " goroutine %d %v->%v", t.Goroutine, t.GoFrom, t.GoTo)
+		case ResourceProc:
+			fmt.Fprintf(&sb, " proc %d %v->%v", t.Proc, t.ProcFrom, t.ProcTo)
+		}
+		if t.Reason != "" {
+			fmt.Fprintf(&sb, " reason=%q", t.Reason)
+		}
+	case EventMetric:
+		fmt.Fprintf(&sb, " %s=%d", e.Metric.Name, e.Metric.Value)
+	case EventRangeBegin, EventRangeEnd:
+		fmt.Fprintf(&sb, " %q", e.Range)
+	case EventTaskBegin, EventTaskEnd, EventRegionBegin, EventRegionEnd:
+		fmt.Fprintf(&sb, " task=%d name=%q", e.Task, e.Name)
+		if e.Parent != NoTask {
+			fmt.Fprintf(&sb, " parent=%d", e.Parent)
+		}
+	case EventLog:
+		fmt.Fprintf(&sb, " task=%d category=%q message=%q", e.Task, e.Name, e.Message)
+	}
+	return sb.String()
+}
@@ -0,0 +1,282 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package trace reads execution traces produced by the Go runtime, for
+// example with runtime/trace.Start or the -trace flag of go test.
+//
+// A [Reader] reads a trace incrementally and returns its events one at
+// a time, in time order, described by an event model that does not
+// depend on the version of the trace format. Events describe the
+// transitions of goroutines and Ps between states, garbage collection,
+// runtime metrics, user tasks, regions and log messages, and CPU
+// profile samples.
+//
+// The runtime writes traces that are made of one or more self-contained
+// segments; in particular, each snapshot written by a
+// runtime/trace.FlightRecorder consists of several segments, and the
+// runtime starts a new segment about every second while tracing. A
+// Reader holds at most one segment in memory at a time. A trace that
+// was cut short, for example because the program crashed, can be read
+// up to the end of its last complete segment.
+//
+// Goroutines that already exist when a trace starts appear to be
+// created at its start, and are then immediately blocked or in a
+// system call, if they were. Goroutines that end in the short interval
+// between two segments appear never to end.
+package trace
+
+import (
+	"fmt"
+	itrace "internal/trace"
+	"io"
+)
+
+// A Reader reads the events of an execution trace.
+type Reader struct {
+	sr     *itrace.SegmentReader
+	seg    itrace.ParseResult
+	next   int              // index of the next event in seg
+	stacks map[uint64]Stack // converted stacks of seg, by stack ID
+	queue  []Event          // events converted but not returned yet
+	stw    []string         // names of the stop-the-world ranges in progress
+	tasks  map[TaskID]string
+	err    error
+}
+
+// NewReader returns a Reader that reads a trace from r. It reads and
+// verifies the first segment of the trace before returning.
+func NewReader(r io.Reader) (*Reader, error) {
+	rd := &Reader{
+		sr:    itrace.NewSegmentReader(r, ""),
+		tasks: make(map[TaskID]string),
+	}
+	if err := rd.readSegment(); err != nil {
+		if err == io.EOF {
+			err = fmt.Errorf("trace is empty")
+		}
+		return nil, err
+	}
+	return rd, nil
+}
+
+// Version returns the version of the trace format.
+func (r *Reader) Version() Version {
+	return Version(r.sr.Version() % 1000)
+}
+
+// ReadEvent returns the next event of the trace. It returns io.EOF
+// after the last event.
+func (r *Reader) ReadEvent() (Event, error) {
+	for len(r.queue) == 0 {
+		if r.err != nil {
+			return Event{}, r.err
+		}
+		if r.next == len(r.seg.Events) {
+			r.err = r.readSegment()
+			continue
+		}
+		ev := r.seg.Events[r.next]
+		r.seg.Events[r.next] = nil // let the garbage collector free it
+		r.next++
+		r.convert(ev)
+	}
+	ev := r.queue[0]
+	r.queue = r.queue[1:]
+	return ev, nil
+}
+
+// readSegment reads the next segment of the trace.
+func (r *Reader) readSegment() error {
+	seg, err := r.sr.Next()
+	if err != nil {
+		return err
+	}
+	r.seg = seg
+	r.next = 0
+	r.stacks = make(map[uint64]Stack)
+	return nil
+}
+
+// stack returns the converted stack with the given ID, or nil.
+func (r *Reader) stack(id uint64) Stack {
+	if id == 0 {
+		return nil
+	}
+	stk, ok := r.stacks[id]
+	if !ok {
+		for _, f := range r.seg.Stacks[id] {
+			stk = append(stk, Frame{PC: f.PC, Func: f.Fn, File: f.File, Line: f.Line})
+		}
+		r.stacks[id] = stk
+	}
+	return stk
+}
+
+// goReasons maps the internal events that block the running goroutine
+// to the reason for the transition.
+var goReasons = map[byte]string{
+	itrace.EvGoStop:        "forever",
+	itrace.EvGoSched:       "yield",
+	itrace.EvGoPreempt:     "preempted",
+	itrace.EvGoSleep:       "sleep",
+	itrace.EvGoBlockSend:   "chan send",
+	itrace.EvGoBlockRecv:   "chan receive",
+	itrace.EvGoBlockSelect: "select",
+	itrace.EvGoBlockSync:   "sync",
+	itrace.EvGoBlockCond:   "sync.(*Cond).Wait",
+	itrace.EvGoBlockNet:    "network",
+	itrace.EvGoBlockGC:     "GC mark assist wait for work",
+}
+
+// convert converts an internal event to zero or more events and adds
+// them to the queue.
+func (r *Reader) convert(ev *itrace.Event) {
+	e := Event{
+		Time:      Time(ev.Ts),
+		Goroutine: NoGoroutine,
+		Proc:      NoProc,
+		Stack:     r.stack(ev.StkID),
+	}
+	if ev.G != 0 {
+		e.Goroutine = GoID(ev.G)
+	}
+	if ev.P >= 0 && ev.P < itrace.FakeP {
+		e.Proc = ProcID(ev.P)
+	}
+	goTransition := func(id uint64, from, to GoState, reason string) {
+		e.Kind = EventStateTransition
+		e.Transition = StateTransition{
+			Resource:  ResourceGoroutine,
+			Goroutine: GoID(id),
+			GoFrom:    from,
+			GoTo:      to,
+			Reason:    reason,
+		}
+		r.queue = append(r.queue, e)
+	}
+	procTransition := func(from, to ProcState) {
+		e.Kind = EventStateTransition
+		e.Transition = StateTransition{
+			Resource: ResourceProc,
+			Proc:     e.Proc,
+			ProcFrom: from,
+			ProcTo:   to,
+		}
+		r.queue = append(r.queue, e)
+	}
+	rangeEvent := func(kind EventKind, name string) {
+		e.Kind = kind
+		e.Range = name
+		r.queue = append(r.queue, e)
+	}
+	metric := func(name string, value uint64) {
+		e.Kind = EventMetric
+		e.Metric = Metric{Name: name, Value: value}
+		r.queue = append(r.queue, e)
+	}
+
+	switch ev.Type {
+	case itrace.EvProcStart:
+		procTransition(ProcIdle, ProcRunning)
+	case itrace.EvProcStop:
+		procTransition(ProcRunning, ProcIdle)
+	case itrace.EvGoCreate:
+		e.Kind = EventStateTransition
+		e.Transition = StateTransition{
+			Resource:  ResourceGoroutine,
+			Goroutine: GoID(ev.Args[0]),
+			GoFrom:    GoNotExist,
+			GoTo:      GoRunnable,
+			Stack:     r.stack(ev.Args[1]),
+		}
+		r.queue = append(r.queue, e)
+	case itrace.EvGoWaiting:
+		// This and EvGoInSyscall describe the state of a goroutine
+		// when the trace starts, and do not happen on it.
+		e.Goroutine = NoGoroutine
+		goTransition(ev.G, GoRunnable, GoWaiting, "")
+	case itrace.EvGoInSyscall:
+		e.Goroutine = NoGoroutine
+		goTransition(ev.G, GoRunnable, GoSyscall, "")
+	case itrace.EvGoStart, itrace.EvGoStartLabel:
+		// The stack of the first start of a goroutine is the one it
+		// was created with, which is not the stack of this event.
+		e.Stack = nil
+		goTransition(ev.G, GoRunnable, GoRunning, "")
+	case itrace.EvGoEnd:
+		goTransition(ev.G, GoRunning, GoNotExist, "")
+	case itrace.EvGoSched, itrace.EvGoPreempt:
+		goTransition(ev.G, GoRunning, GoRunnable, goReasons[ev.Type])
+	case itrace.EvGoStop, itrace.EvGoSleep, itrace.EvGoBlock, itrace.EvGoBlockSend,
+		itrace.EvGoBlockRecv, itrace.EvGoBlockSelect, itrace.EvGoBlockSync,
+		itrace.EvGoBlockCond, itrace.EvGoBlockNet, itrace.EvGoBlockGC:
+		goTransition(ev.G, GoRunning, GoWaiting, goReasons[ev.Type])
+	case itrace.EvGoUnblock:
+		goTransition(ev.Args[0], GoWaiting, GoRunnable, "")
+	case itrace.EvGoSysCall:
+		goTransition(ev.G, GoRunning, GoSyscall, "")
+		if ev.Link == nil {
+			// The system call did not block, and the goroutine
+			// kept running.
+			e.Stack = nil
+			goTransition(ev.G, GoSyscall, GoRunning, "")
+		}
+	case itrace.EvGoSysExit:
+		goTransition(ev.G, GoSyscall, GoRunnable, "")
+	case itrace.EvGCStart:
+		rangeEvent(EventRangeBegin, "GC concurrent mark phase")
+	case itrace.EvGCDone:
+		rangeEvent(EventRangeEnd, "GC concurrent mark phase")
+	case itrace.EvSTWStart:
+		name := "stop-the-world (" + ev.SArgs[0] + ")"
+		r.stw = append(r.stw, name)
+		rangeEvent(EventRangeBegin, name)
+	case itrace.EvSTWDone:
+		name := "stop-the-world (unknown)"
+		if n := len(r.stw); n > 0 {
+			name = r.stw[n-1]
+			r.stw = r.stw[:n-1]
+		}
+		rangeEvent(EventRangeEnd, name)
+	case itrace.EvGCSweepStart:
+		rangeEvent(EventRangeBegin, "GC incremental sweep")
+	case itrace.EvGCSweepDone:
+		rangeEvent(EventRangeEnd, "GC incremental sweep")
+	case itrace.EvGCMarkAssistStart:
+		rangeEvent(EventRangeBegin, "GC mark assist")
+	case itrace.EvGCMarkAssistDone:
+		rangeEvent(EventRangeEnd, "GC mark assist")
+	case itrace.EvHeapAlloc:
+		metric("/memory/classes/heap/objects:bytes", ev.Args[0])
+	case itrace.EvHeapGoal:
+		metric("/gc/heap/goal:bytes", ev.Args[0])
+	case itrace.EvGomaxprocs:
+		metric("/sched/gomaxprocs:threads", ev.Args[0])
+	case itrace.EvUserTaskCreate:
+		e.Kind = EventTaskBegin
+		e.Task, e.Parent, e.Name = TaskID(ev.Args[0]), TaskID(ev.Args[1]), ev.SArgs[0]
+		r.tasks[e.Task] = e.Name
+		r.queue = append(r.queue, e)
+	case itrace.EvUserTaskEnd:
+		e.Kind = EventTaskEnd
+		e.Task = TaskID(ev.Args[0])
+		e.Name = r.tasks[e.Task]
+		delete(r.tasks, e.Task)
+		r.queue = append(r.queue, e)
+	case itrace.EvUserRegion:
+		e.Kind = EventRegionBegin
+		if ev.Args[1] == 1 {
+			e.Kind = EventRegionEnd
+		}
+		e.Task, e.Name = TaskID(ev.Args[0]), ev.SArgs[0]
+		r.queue = append(r.queue, e)
+	case itrace.EvUserLog:
+		e.Kind = EventLog
+		e.Task, e.Name, e.Message = TaskID(ev.Args[0]), ev.SArgs[0], ev.SArgs[1]
+		r.queue = append(r.queue, e)
+	case itrace.EvCPUSample:
+		e.Kind = EventStackSample
+		r.queue = append(r.queue, e)
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package trace_test
+
+import (
+	"bytes"
+	"context"
+	. "debug/trace"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	rtrace "runtime/trace"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// readAll reads all events of the trace in data and checks that they
+// are in time order and that state transitions are consistent.
+func readAll(t *testing.T, data []byte) []Event {
+	t.Helper()
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	var events []Event
+	goStates := make(map[GoID]GoState)
+	procStates := make(map[ProcID]ProcState)
+	var last Time
+	for {
+		ev, err := r.ReadEvent()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadEvent: %v", err)
+		}
+		if ev.Time < last {
+			t.Fatalf("event %v is before previous event at %v", &ev, last)
+		}
+		last = ev.Time
+		if ev.Kind == EventStateTransition {
+			tr := &ev.Transition
+			switch tr.Resource {
+			case ResourceGoroutine:
+				if s, ok := goStates[tr.Goroutine]; ok && s != tr.GoFrom {
+					t.Fatalf("event %v: goroutine is %v", &ev, s)
+				}
+				goStates[tr.Goroutine] = tr.GoTo
+			case ResourceProc:
+				if s, ok := procStates[tr.Proc]; ok && s != tr.ProcFrom {
+					t.Fatalf("event %v: proc is %v", &ev, s)
+				}
+				procStates[tr.Proc] = tr.ProcTo
+			default:
+				t.Fatalf("event %v has no resource", &ev)
+			}
+		}
+		events = append(events, ev)
+	}
+	if _, err := r.ReadEvent(); err != io.EOF {
+		t.Fatalf("ReadEvent after end: got %v, want io.EOF", err)
+	}
+	return events
+}
+
+func TestReaderTestdata(t *testing.T) {
+	files, err := filepath.Glob("../../internal/trace/testdata/*_1_*_good")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no test traces")
+	}
+	for _, file := range files {
+		// Traces produced by go 1.6 or below have no symbols.
+		if strings.Contains(file, "_1_5_") {
+			continue
+		}
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			events := readAll(t, data)
+			if len(events) == 0 {
+				t.Fatal("no events")
+			}
+		})
+	}
+}
+
+func TestReaderVersion(t *testing.T) {
+	data, err := os.ReadFile("../../internal/trace/testdata/http_1_19_good")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := r.Version(); v != 19 || v.String() != "go1.19" {
+		t.Errorf("Version() = %d (%v), want 19 (go1.19)", v, v)
+	}
+}
+
+func TestReaderBad(t *testing.T) {
+	for _, data := range []string{"", "not a trace", "go 1.21 trace\x00\x00\x00\x00"} {
+		if _, err := NewReader(strings.NewReader(data)); err == nil {
+			t.Errorf("NewReader(%q) succeeded", data)
+		}
+	}
+}
+
+func TestReaderUserAnnotation(t *testing.T) {
+	if rtrace.IsEnabled() {
+		t.Skip("skipping because -test.trace is set")
+	}
+	buf := new(bytes.Buffer)
+	if err := rtrace.Start(buf); err != nil {
+		t.Fatalf("failed to start tracing: %v", err)
+	}
+	ctx, task := rtrace.NewTask(context.Background(), "task0")
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		rtrace.WithRegion(ctx, "region0", func() {
+			rtrace.Log(ctx, "key0", "0123456789abcdef")
+		})
+	}()
+	wg.Wait()
+	task.End()
+	rtrace.Stop()
+
+	var taskID TaskID
+	var got []string
+	for _, ev := range readAll(t, buf.Bytes()) {
+		switch ev.Kind {
+		case EventTaskBegin:
+			if ev.Name == "task0" {
+				taskID = ev.Task
+				got = append(got, "task begin")
+			}
+		case EventTaskEnd:
+			if ev.Task == taskID && ev.Name == "task0" {
+				got = append(got, "task end")
+			}
+		case EventRegionBegin, EventRegionEnd:
+			if ev.Task == taskID && ev.Name == "region0" {
+				got = append(got, ev.Kind.String())
+			}
+		case EventLog:
+			if ev.Task == taskID {
+				got = append(got, ev.Name+"="+ev.Message)
+				if len(ev.Stack) == 0 || !strings.HasSuffix(ev.Stack[0].Func, "TestReaderUserAnnotation.func1.1") {
+					t.Errorf("log has stack %v", ev.Stack)
+				}
+			}
+		}
+	}
+	want := []string{"task begin", "RegionBegin", "key0=0123456789abcdef", "RegionEnd", "task end"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("got events %q, want %q", got, want)
+	}
+}
+
+func TestReaderGoroutines(t *testing.T) {
+	if rtrace.IsEnabled() {
+		t.Skip("skipping because -test.trace is set")
+	}
+	buf := new(bytes.Buffer)
+	if err := rtrace.Start(buf); err != nil {
+		t.Fatalf("failed to start tracing: %v", err)
+	}
+	c := make(chan int)
+	done := make(chan bool)
+	go func() {
+		<-c
+		done <- true
+	}()
+	time.Sleep(10 * time.Millisecond)
+	c <- 1
+	<-done
+	runtime.GC()
+	rtrace.Stop()
+
+	var created, blocked, gc bool
+	for _, ev := range readAll(t, buf.Bytes()) {
+		tr := &ev.Transition
+		switch {
+		case ev.Kind == EventStateTransition && tr.Resource == ResourceGoroutine && tr.GoFrom == GoNotExist:
+			if len(tr.Stack) > 0 && strings.HasSuffix(tr.Stack[0].Func, "TestReaderGoroutines.func1") {
+				created = true
+			}
+		case ev.Kind == EventStateTransition && tr.Reason == "chan receive":
+			blocked = true
+		case ev.Kind == EventRangeBegin && ev.Range == "GC concurrent mark phase":
+			gc = true
+		}
+	}
+	if !created {
+		t.Errorf("no goroutine creation")
+	}
+	if !blocked {
+		t.Errorf("no goroutine blocked on channel receive")
+	}
+	if !gc {
+		t.Errorf("no GC")
+	}
+}
+
+func TestReaderFlightRecorder(t *testing.T) {
+	if rtrace.IsEnabled() {
+		t.Skip("skipping because -test.trace is set")
+	}
+	fr := rtrace.NewFlightRecorder(rtrace.FlightRecorderConfig{MinAge: 100 * time.Millisecond})
+	if err := fr.Start(); err != nil {
+		t.Fatalf("failed to start flight recorder: %v", err)
+	}
+	defer fr.Stop()
+	c := make(chan int)
+	go func() {
+		for range c {
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		c <- i
+		time.Sleep(time.Millisecond)
+	}
+	close(c)
+	buf := new(bytes.Buffer)
+	if _, err := fr.WriteTo(buf); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+	if n := bytes.Count(buf.Bytes(), []byte(" trace\x00\x00\x00")); n < 2 {
+		t.Fatalf("snapshot has %d segments, want at least 2", n)
+	}
+	readAll(t, buf.Bytes())
+}
@@ -94,6 +94,15 @@ var depsRules = `
 	RUNTIME
 	< arena;
 
+	RUNTIME
+	< weak;
+
+	RUNTIME
+	< internal/concurrent;
+
+	internal/concurrent, weak
+	< unique;
+
 	syscall !< io;
 	reflect !< sort;
 
@@ -197,6 +206,7 @@ var depsRules = `
 	< html,
 	  internal/dag,
 	  internal/goroot,
+	  internal/traceback,
 	  internal/types/errors,
 	  mime/quotedprintable,
 	  net/internal/socktest,
@@ -288,7 +298,10 @@ var depsRules = `
 	math/big, go/token
 	< go/constant;
 
-	container/heap, go/constant, go/parser, internal/goversion, internal/types/errors
+	FMT, internal/goexperiment
+	< internal/buildcfg;
+
+	container/heap, go/constant, go/parser, internal/buildcfg, internal/goversion, internal/types/errors
 	< go/types;
 
 	# The vast majority of standard library packages should not be resorting to regexp.
@@ -299,9 +312,6 @@ var depsRules = `
 	go/doc/comment, go/parser, internal/lazyregexp, text/template
 	< go/doc;
 
-	FMT, internal/goexperiment
-	< internal/buildcfg;
-
 	go/build/constraint, go/doc, go/parser, internal/buildcfg, internal/goroot, internal/goversion, internal/platform
 	< go/build;
 
@@ -604,7 +614,8 @@ var depsRules = `
 	< os/exec/internal/fdtest;
 
 	FMT, container/heap, math/rand
-	< internal/trace;
+	< internal/trace
+	< debug/trace;
 
 	FMT
 	< internal/diff, internal/txtar;
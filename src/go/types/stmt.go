@@ -10,6 +10,7 @@ import (
 	"go/ast"
 	"go/constant"
 	"go/token"
+	"internal/buildcfg"
 	. "internal/types/errors"
 	"sort"
 )
@@ -850,15 +851,28 @@ func (check *Checker) stmt(ctxt stmtContext, s ast.Stmt) {
 					cause = "receive from send-only channel"
 				}
 			}
-			key, val = rangeKeyVal(u)
-			if key == nil || cause != "" {
+			k, v, kvCause, ok := rangeKeyVal(u)
+			if !ok && cause == "" {
+				cause = kvCause
+			}
+			if !ok || cause != "" {
 				if cause == "" {
 					check.softErrorf(&x, InvalidRangeExpr, "cannot range over %s", &x)
 				} else {
 					check.softErrorf(&x, InvalidRangeExpr, "cannot range over %s (%s)", &x, cause)
 				}
 				// ok to continue
+			} else if _, isFunc := u.(*Signature); isFunc {
+				// The yield function determines how many iteration variables
+				// the loop may declare.
+				switch {
+				case s.Key != nil && k == nil:
+					check.softErrorf(s.Key, InvalidIterVar, "range over %s permits no iteration variables", &x)
+				case s.Value != nil && v == nil:
+					check.softErrorf(s.Value, InvalidIterVar, "range over %s permits only one iteration variable", &x)
+				}
 			}
+			key, val = k, v
 		}
 
 		// Open the for-statement block scope now, after the range clause.
@@ -941,22 +955,57 @@ func (check *Checker) stmt(ctxt stmtContext, s ast.Stmt) {
 }
 
 // rangeKeyVal returns the key and value type produced by a range clause
-// over an expression of type typ. If the range clause is not permitted
-// the results are nil.
-func rangeKeyVal(typ Type) (key, val Type) {
+// over an expression of type typ. If the range clause is not permitted,
+// rangeKeyVal returns ok = false. When ok = false, rangeKeyVal may also
+// return a reason in cause.
+//
+// For range over a function, key and val are nil if the yield function
+// has fewer than one or two parameters, respectively.
+func rangeKeyVal(typ Type) (key, val Type, cause string, ok bool) {
+	bad := func(cause string) (Type, Type, string, bool) {
+		return nil, nil, cause, false
+	}
 	switch typ := arrayPtrDeref(typ).(type) {
 	case *Basic:
 		if isString(typ) {
-			return Typ[Int], universeRune // use 'rune' name
+			return Typ[Int], universeRune, "", true // use 'rune' name
 		}
 	case *Array:
-		return Typ[Int], typ.elem
+		return Typ[Int], typ.elem, "", true
 	case *Slice:
-		return Typ[Int], typ.elem
+		return Typ[Int], typ.elem, "", true
 	case *Map:
-		return typ.key, typ.elem
+		return typ.key, typ.elem, "", true
 	case *Chan:
-		return typ.elem, Typ[Invalid]
+		return typ.elem, Typ[Invalid], "", true
+	case *Signature:
+		if !buildcfg.Experiment.RangeFunc {
+			break
+		}
+		if typ.Params().Len() != 1 {
+			return bad("func must be func(yield func(...) bool): wrong argument count")
+		}
+		if typ.Results().Len() != 0 {
+			return bad("func must be func(yield func(...) bool): unexpected results")
+		}
+		cb, _ := coreType(typ.Params().At(0).Type()).(*Signature)
+		switch {
+		case cb == nil:
+			return bad("func must be func(yield func(...) bool): argument is not func")
+		case cb.Params().Len() > 2:
+			return bad("func must be func(yield func(...) bool): yield func has too many parameters")
+		case cb.Variadic():
+			return bad("func must be func(yield func(...) bool): yield func is variadic")
+		case cb.Results().Len() != 1 || !isBoolean(cb.Results().At(0).Type()):
+			return bad("func must be func(yield func(...) bool): yield func does not return bool")
+		}
+		if cb.Params().Len() >= 1 {
+			key = cb.Params().At(0).Type()
+		}
+		if cb.Params().Len() >= 2 {
+			val = cb.Params().At(1).Type()
+		}
+		return key, val, "", true
 	}
 	return
 }
@@ -162,6 +162,19 @@ var kindNames = []string{
 
 func (t *Type) Kind() Kind { return Kind(t.Kind_ & KindMask) }
 
+// EmptyInterface describes the layout of a "interface{}" or an "any".
+// These are represented differently than non-empty interface, as the first
+// word always points to an abi.Type.
+type EmptyInterface struct {
+	Type *Type
+	Data unsafe.Pointer
+}
+
+// TypeOf returns the abi.Type of some value.
+func TypeOf(a any) *Type {
+	return (*EmptyInterface)(unsafe.Pointer(&a)).Type
+}
+
 func (t *Type) HasName() bool {
 	return t.TFlag&TFlagNamed != 0
 }
@@ -113,4 +113,12 @@ type Flags struct {
 	// NewInliner enables a new+improved version of the function
 	// inlining phase within the Go compiler.
 	NewInliner bool
+
+	// RangeFunc enables range over func.
+	RangeFunc bool
+
+	// SwissMap enables the open-addressing "Swiss table" map
+	// implementation in the runtime in place of the bucket and
+	// overflow chain hash map.
+	SwissMap bool
 }
@@ -101,18 +101,388 @@ func Parse(r io.Reader, bin string) (ParseResult, error) {
 // parse parses, post-processes and verifies the trace. It returns the
 // trace version and the list of events.
 func parse(r io.Reader, bin string) (int, ParseResult, error) {
-	ver, rawEvents, strings, err := readTrace(r)
+	sr := NewSegmentReader(r, bin)
+	var res ParseResult
+	for {
+		seg, err := sr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, ParseResult{}, err
+		}
+		if res.Stacks == nil {
+			res = seg
+			continue
+		}
+		res.Events = append(res.Events, seg.Events...)
+		for id, stk := range seg.Stacks {
+			res.Stacks[id] = stk
+		}
+	}
+	return sr.Version(), res, nil
+}
+
+// A SegmentReader reads a trace one segment at a time, so that only one
+// segment needs to be held in memory.
+//
+// A trace may consist of several complete traces of the same program
+// written one after another, as produced by the runtime/trace flight
+// recorder. Each of them is a segment. Each segment is parsed and
+// verified separately, and its events are then placed on the timeline
+// of the first segment.
+type SegmentReader struct {
+	r   *bufio.Reader
+	bin string
+	off int // offset of the next segment
+
+	ver int
+
+	// The last segment read so far starts at raw timestamp startTicks,
+	// which is at time shift on the timeline, and its raw timestamps
+	// are ticksPerSec per second.
+	startTicks, shift, ticksPerSec int64
+	lastTs                         int64 // timestamp of the last event so far
+	maxStkID                       uint64
+	gs                             map[uint64]gStatus // status of goroutines that have not ended yet
+	running                        map[int]bool       // Ps that have not stopped yet
+
+	// Events of earlier segments that are to be linked to events of
+	// later segments.
+	pending map[uint64]*Event   // last state change of each goroutine
+	starts  map[uint64]*Event   // start of each running goroutine
+	regions map[uint64][]*Event // open user regions of each goroutine
+	tasks   map[uint64]*Event   // open user tasks
+	sweeps  map[int]*Event      // open sweeps of each P
+}
+
+// gSyscall is the status of a goroutine blocked in a system call, as
+// tracked by SegmentReader.
+const gSyscall = gWaiting + 1
+
+// NewSegmentReader returns a SegmentReader that reads the trace from r.
+// bin is the binary that produced the trace, which is required to
+// symbolize traces produced by go 1.6 or below.
+func NewSegmentReader(r io.Reader, bin string) *SegmentReader {
+	return &SegmentReader{
+		r:       bufio.NewReader(r),
+		bin:     bin,
+		gs:      make(map[uint64]gStatus),
+		running: make(map[int]bool),
+		pending: make(map[uint64]*Event),
+		starts:  make(map[uint64]*Event),
+		regions: make(map[uint64][]*Event),
+		tasks:   make(map[uint64]*Event),
+		sweeps:  make(map[int]*Event),
+	}
+}
+
+// Version returns the version of the trace, such as 1021 for go 1.21.
+// It is 0 until the first segment has been read.
+func (sr *SegmentReader) Version() int {
+	return sr.ver
+}
+
+// Next parses, post-processes and verifies the next segment of the
+// trace. It returns io.EOF if there are no more segments. The last
+// segment of a trace that was cut short is incomplete; it is ignored,
+// and Next returns io.EOF instead, so that the trace can be read up to
+// its last complete segment.
+//
+// Stack IDs are renumbered to be unique across segments. Ps that
+// already exist when a segment starts are described at its start by
+// EvProcStart events, and goroutines by EvGoCreate, EvGoWaiting and
+// EvGoInSyscall events. Except in the first segment, a goroutine is
+// only described right before its first event in the segment, and not
+// at all if it has none. A P is described right before its first event
+// in the segment too, with the goroutine that runs on it, if any,
+// which is started with an EvGoStart event, and its sweep, if any.
+// For goroutines and Ps that carry over from the previous segment,
+// these events are dropped, so that a goroutine spanning several
+// segments appears to be created only once. If the status of such a
+// goroutine differs from its status at the end of the previous
+// segment, it is updated with an EvGoUnblock or EvGoSysExit event with
+// no stack, followed by an EvGoWaiting or EvGoInSyscall event if
+// needed.
+//
+// Events of earlier segments that start something that ends in this
+// segment, such as a user region or a blocking of a goroutine, are
+// linked to the event that ends it.
+func (sr *SegmentReader) Next() (ParseResult, error) {
+	if sr.ver != 0 {
+		if _, err := sr.r.Peek(1); err == io.EOF {
+			return ParseResult{}, io.EOF
+		}
+	}
+	off := sr.off
+	ver, seg, startTicks, ticksPerSec, end, err := parseSegment(sr.r, off, sr.bin)
 	if err != nil {
-		return 0, ParseResult{}, err
+		if sr.ver != 0 {
+			if _, perr := sr.r.Peek(1); perr == io.EOF {
+				return ParseResult{}, io.EOF
+			}
+		}
+		return ParseResult{}, err
+	}
+	sr.off = end
+	if sr.ver == 0 {
+		sr.ver = ver
+	} else {
+		if ver != sr.ver {
+			return ParseResult{}, fmt.Errorf("trace at offset 0x%x has version %v, want %v", off, ver, sr.ver)
+		}
+		// The gap since the previous segment is measured with its
+		// frequency, so that the segment starts after its last event
+		// even if the frequencies of the two differ slightly. Use
+		// floating point to avoid integer overflows.
+		shift := sr.shift + int64(float64(startTicks-sr.startTicks)*1e9/float64(sr.ticksPerSec))
+		if shift < sr.lastTs {
+			return ParseResult{}, ErrTimeOrder
+		}
+		seg = sr.merge(seg, shift)
+		sr.shift = shift
+	}
+	sr.startTicks, sr.ticksPerSec = startTicks, ticksPerSec
+	for id := range seg.Stacks {
+		if id > sr.maxStkID {
+			sr.maxStkID = id
+		}
+	}
+	sr.link(seg.Events)
+	for _, ev := range seg.Events {
+		switch ev.Type {
+		case EvGoCreate:
+			sr.gs[ev.Args[0]] = gRunnable
+		case EvGoStart, EvGoStartLabel:
+			sr.gs[ev.G] = gRunning
+		case EvGoSched, EvGoPreempt, EvGoSysExit:
+			sr.gs[ev.G] = gRunnable
+		case EvGoUnblock:
+			sr.gs[ev.Args[0]] = gRunnable
+		case EvGoStop, EvGoSleep, EvGoBlock, EvGoBlockSend, EvGoBlockRecv,
+			EvGoBlockSelect, EvGoBlockSync, EvGoBlockCond, EvGoBlockNet,
+			EvGoBlockGC, EvGoWaiting:
+			sr.gs[ev.G] = gWaiting
+		case EvGoSysBlock, EvGoInSyscall:
+			sr.gs[ev.G] = gSyscall
+		case EvGoEnd:
+			delete(sr.gs, ev.G)
+		case EvProcStart:
+			sr.running[ev.P] = true
+		case EvProcStop:
+			delete(sr.running, ev.P)
+		}
+	}
+	if n := len(seg.Events); n > 0 {
+		sr.lastTs = seg.Events[n-1].Ts
+	}
+	return seg, nil
+}
+
+// Restart makes the next segment start afresh, as if it were the first
+// one, except that its events remain on the timeline of the first
+// segment and its stack IDs remain unique. Goroutines and Ps that exist
+// when it starts are created where they are first described in it,
+// rather than carried over from the segment before. This allows a caller to skip the segments
+// it is not interested in, and still get a consistent trace from the
+// segments that follow.
+func (sr *SegmentReader) Restart() {
+	clear(sr.gs)
+	clear(sr.running)
+	clear(sr.pending)
+	clear(sr.starts)
+	clear(sr.regions)
+	clear(sr.tasks)
+	clear(sr.sweeps)
+}
+
+// link sets the Link of the events of earlier segments that end with
+// one of events, as postProcessTrace does within a segment, and records
+// those of events that may end in a later segment.
+func (sr *SegmentReader) link(events []*Event) {
+	end := func(start, ev *Event) {
+		if start != nil && start.Link == nil {
+			start.Link = ev
+		}
 	}
-	events, stacks, err := parseEvents(ver, rawEvents, strings)
+	for _, ev := range events {
+		switch ev.Type {
+		case EvGoCreate:
+			sr.pending[ev.Args[0]] = ev
+		case EvGoStart, EvGoStartLabel:
+			end(sr.pending[ev.G], ev)
+			delete(sr.pending, ev.G)
+			sr.starts[ev.G] = ev
+		case EvGoSched, EvGoPreempt, EvGoSleep, EvGoBlock, EvGoBlockSend,
+			EvGoBlockRecv, EvGoBlockSelect, EvGoBlockSync, EvGoBlockCond,
+			EvGoBlockNet, EvGoBlockGC:
+			end(sr.starts[ev.G], ev)
+			delete(sr.starts, ev.G)
+			sr.pending[ev.G] = ev
+		case EvGoSysCall, EvGoWaiting, EvGoInSyscall:
+			sr.pending[ev.G] = ev
+		case EvGoSysBlock:
+			end(sr.starts[ev.G], ev)
+			delete(sr.starts, ev.G)
+		case EvGoUnblock:
+			end(sr.pending[ev.Args[0]], ev)
+			sr.pending[ev.Args[0]] = ev
+		case EvGoSysExit:
+			if prev := sr.pending[ev.G]; prev != nil && prev.Type == EvGoSysCall {
+				end(prev, ev)
+			}
+			sr.pending[ev.G] = ev
+		case EvGoStop:
+			end(sr.starts[ev.G], ev)
+			delete(sr.starts, ev.G)
+			delete(sr.pending, ev.G)
+		case EvGoEnd:
+			end(sr.starts[ev.G], ev)
+			delete(sr.starts, ev.G)
+			delete(sr.pending, ev.G)
+			for _, r := range sr.regions[ev.G] {
+				end(r, ev)
+			}
+			delete(sr.regions, ev.G)
+		case EvUserTaskCreate:
+			sr.tasks[ev.Args[0]] = ev
+		case EvUserTaskEnd:
+			end(sr.tasks[ev.Args[0]], ev)
+			delete(sr.tasks, ev.Args[0])
+		case EvGCSweepStart:
+			sr.sweeps[ev.P] = ev
+		case EvGCSweepDone:
+			end(sr.sweeps[ev.P], ev)
+			delete(sr.sweeps, ev.P)
+		case EvUserRegion:
+			regions := sr.regions[ev.G]
+			switch n := len(regions); {
+			case ev.Args[1] == 0:
+				sr.regions[ev.G] = append(regions, ev)
+			case n > 0:
+				if s := regions[n-1]; s.Args[0] == ev.Args[0] && s.SArgs[0] == ev.SArgs[0] {
+					end(s, ev)
+				}
+				if n > 1 {
+					sr.regions[ev.G] = regions[:n-1]
+				} else {
+					delete(sr.regions, ev.G)
+				}
+			}
+		}
+	}
+}
+
+// merge adjusts seg, which directly follows the segments read so far,
+// as described in Next. Its timestamps are shifted by shift nanoseconds.
+func (sr *SegmentReader) merge(seg ParseResult, shift int64) ParseResult {
+	stkShift := sr.maxStkID
+	stacks := make(map[uint64][]*Frame, len(seg.Stacks))
+	for id, stk := range seg.Stacks {
+		stacks[id+stkShift] = stk
+	}
+
+	// Find the status of the goroutines that carry over when the
+	// segment starts. Those running at the end of the previous
+	// segment are described as runnable, and then started again.
+	status := make(map[uint64]gStatus)
+	for _, ev := range seg.Events {
+		switch ev.Type {
+		case EvGoCreate:
+			if _, ok := sr.gs[ev.Args[0]]; ok {
+				status[ev.Args[0]] = gRunnable
+			}
+		case EvGoWaiting:
+			if _, ok := status[ev.G]; ok {
+				status[ev.G] = gWaiting
+			}
+		case EvGoInSyscall:
+			if _, ok := status[ev.G]; ok {
+				status[ev.G] = gSyscall
+			}
+		}
+	}
+	changed := func(g uint64) bool {
+		prev := sr.gs[g]
+		if prev == gRunning {
+			prev = gRunnable
+		}
+		return prev != status[g]
+	}
+
+	started := make(map[int]bool)      // Ps with an EvProcStart in seg
+	restarted := make(map[uint64]bool) // goroutines with an EvGoStart in seg
+	swept := make(map[int]bool)        // Ps with an EvGCSweepStart in seg
+	events := make([]*Event, 0, len(seg.Events))
+	for _, ev := range seg.Events {
+		ev.Ts += shift
+		switch ev.Type {
+		case EvGoCreate:
+			g := ev.Args[0]
+			if _, ok := status[g]; !ok {
+				if ev.Args[1] != 0 {
+					ev.Args[1] += stkShift
+				}
+				break
+			}
+			if changed(g) {
+				switch sr.gs[g] {
+				case gWaiting:
+					events = append(events, &Event{Off: ev.Off, Type: EvGoUnblock, Ts: ev.Ts, P: ev.P, Args: [3]uint64{g}})
+				case gSyscall:
+					events = append(events, &Event{Off: ev.Off, Type: EvGoSysExit, Ts: ev.Ts, P: SyscallP, G: g})
+				}
+			}
+			continue
+		case EvGoWaiting, EvGoInSyscall:
+			if _, ok := status[ev.G]; ok && !changed(ev.G) {
+				continue
+			}
+		case EvProcStart:
+			first := !started[ev.P]
+			started[ev.P] = true
+			if first && sr.running[ev.P] {
+				continue
+			}
+		case EvGoStart, EvGoStartLabel:
+			first := !restarted[ev.G]
+			restarted[ev.G] = true
+			if _, ok := status[ev.G]; ok && first && sr.gs[ev.G] == gRunning {
+				continue
+			}
+		case EvGCSweepStart:
+			first := !swept[ev.P]
+			swept[ev.P] = true
+			if first && sr.sweeps[ev.P] != nil {
+				continue
+			}
+		}
+		if ev.StkID != 0 {
+			ev.StkID += stkShift
+		}
+		events = append(events, ev)
+	}
+	return ParseResult{Events: events, Stacks: stacks}
+}
+
+// parseSegment parses, post-processes and verifies a single trace that
+// starts at offset off of the input. It returns the trace version, the
+// events with timestamps relative to the first event, the raw timestamp
+// of the first event and the frequency of raw timestamps, and the
+// offset at which the trace ends.
+func parseSegment(r *bufio.Reader, off int, bin string) (ver int, res ParseResult, startTicks, ticksPerSec int64, end int, err error) {
+	ver, rawEvents, strings, end, err := readTrace(r, off)
 	if err != nil {
-		return 0, ParseResult{}, err
+		return
+	}
+	events, stacks, startTicks, ticksPerSec, err := parseEvents(ver, rawEvents, strings)
+	if err != nil {
+		return
 	}
 	events = removeFutile(events)
 	err = postProcessTrace(ver, events)
 	if err != nil {
-		return 0, ParseResult{}, err
+		return
 	}
 	// Attach stack traces.
 	for _, ev := range events {
@@ -121,11 +491,11 @@ func parse(r io.Reader, bin string) (int, ParseResult, error) {
 		}
 	}
 	if ver < 1007 && bin != "" {
-		if err := symbolize(events, bin); err != nil {
-			return 0, ParseResult{}, err
+		if err = symbolize(events, bin); err != nil {
+			return
 		}
 	}
-	return ver, ParseResult{Events: events, Stacks: stacks}, nil
+	return ver, ParseResult{Events: events, Stacks: stacks}, startTicks, ticksPerSec, end, nil
 }
 
 // rawEvent is a helper type used during parsing.
@@ -136,22 +506,26 @@ type rawEvent struct {
 	sargs []string
 }
 
-// readTrace does wire-format parsing and verification.
-// It does not care about specific event types and argument meaning.
-func readTrace(r io.Reader) (ver int, events []rawEvent, strings map[uint64]string, err error) {
+// readTrace does wire-format parsing and verification of the trace
+// starting at offset off0 of the input. It stops at the end of the input
+// or at the header of the next trace, and returns the offset at which it
+// stopped. It does not care about specific event types and argument
+// meaning.
+func readTrace(r *bufio.Reader, off0 int) (ver int, events []rawEvent, strings map[uint64]string, off int, err error) {
 	// Read and validate trace header.
 	var buf [16]byte
-	off, err := io.ReadFull(r, buf[:])
+	off, err = io.ReadFull(r, buf[:])
 	if err != nil {
-		err = fmt.Errorf("failed to read header: read %v, err %v", off, err)
+		err = fmt.Errorf("failed to read header at offset 0x%x: read %v, err %v", off0, off, err)
 		return
 	}
+	off += off0
 	ver, err = parseHeader(buf[:])
 	if err != nil {
 		return
 	}
 	switch ver {
-	case 1005, 1007, 1008, 1009, 1010, 1011, 1019, 1021:
+	case 1005, 1007, 1008, 1009, 1010, 1011, 1019, 1021, 1022:
 		// Note: When adding a new version, confirm that canned traces from the
 		// old version are part of the test suite. Add them using mkcanned.bash.
 		break
@@ -163,6 +537,13 @@ func readTrace(r io.Reader) (ver int, events []rawEvent, strings map[uint64]stri
 	// Read events.
 	strings = make(map[uint64]string)
 	for {
+		// Stop at the header of the next trace, if any.
+		if next, _ := r.Peek(len(buf)); len(next) == len(buf) && next[0] == 'g' {
+			if _, err := parseHeader(next); err == nil {
+				break
+			}
+		}
+
 		// Read event type and number of arguments (1 byte).
 		off0 := off
 		var n int
@@ -314,8 +695,8 @@ func parseHeader(buf []byte) (int, error) {
 
 // Parse events transforms raw events into events.
 // It does analyze and verify per-event-type arguments.
-func parseEvents(ver int, rawEvents []rawEvent, strings map[uint64]string) (events []*Event, stacks map[uint64][]*Frame, err error) {
-	var ticksPerSec, lastSeq, lastTs int64
+func parseEvents(ver int, rawEvents []rawEvent, strings map[uint64]string) (events []*Event, stacks map[uint64][]*Frame, minTs, ticksPerSec int64, err error) {
+	var lastSeq, lastTs int64
 	var lastG uint64
 	var lastP int
 	timerGoids := make(map[uint64]bool)
@@ -432,7 +813,7 @@ func parseEvents(ver int, rawEvents []rawEvent, strings map[uint64]string) (even
 						err = fmt.Errorf("unknown STW kind %d", e.Args[0])
 						return
 					}
-				} else if ver == 1021 {
+				} else if ver == 1021 || ver == 1022 {
 					if kind := e.Args[0]; kind < uint64(len(stwReasonStringsGo121)) {
 						e.SArgs = []string{stwReasonStringsGo121[kind]}
 					} else {
@@ -511,7 +892,7 @@ func parseEvents(ver int, rawEvents []rawEvent, strings map[uint64]string) (even
 	}
 
 	// Translate cpu ticks to real time.
-	minTs := events[0].Ts
+	minTs = events[0].Ts
 	// Use floating point to avoid integer overflows.
 	freq := 1e9 / float64(ticksPerSec)
 	for _, ev := range events {
@@ -634,6 +1015,12 @@ func postProcessTrace(ver int, events []*Event) error {
 	}
 
 	for _, ev := range events {
+		if ev.Type == EvCPUSample {
+			// Samples don't change the state of goroutines and Ps, and
+			// may be about a goroutine that is only described later in
+			// the segment, so don't record it here.
+			continue
+		}
 		g := gs[ev.G]
 		p := ps[ev.P]
 
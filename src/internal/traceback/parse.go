@@ -0,0 +1,412 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package traceback
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statuses are the goroutine statuses that the text form prints in
+// place of a wait reason.
+var statuses = map[string]bool{
+	"idle":      true,
+	"runnable":  true,
+	"running":   true,
+	"syscall":   true,
+	"waiting":   true,
+	"dead":      true,
+	"copystack": true,
+	"preempted": true,
+	"???":       true,
+}
+
+// Parse parses the text form of a crash report, as printed by the
+// runtime to standard error. Any output that precedes the report, such
+// as the program's own output, is skipped. It is an error if data does
+// not contain a report.
+func Parse(data []byte) (*Traceback, error) {
+	p := &parser{tb: new(Traceback)}
+	lines := strings.Split(string(bytes.TrimRight(data, "\n")), "\n")
+	for i, line := range lines {
+		p.line = i + 1
+		if err := p.parseLine(strings.TrimSuffix(line, "\r")); err != nil {
+			return nil, fmt.Errorf("traceback: line %d: %v", p.line, err)
+		}
+	}
+	if !p.found {
+		return nil, errors.New("traceback: no crash report found")
+	}
+	if p.frame != nil {
+		return nil, fmt.Errorf("traceback: line %d: missing position of frame %s", p.line, p.frame.Func)
+	}
+	return p.tb, nil
+}
+
+type parser struct {
+	tb    *Traceback
+	line  int
+	found bool // whether the report has started
+
+	// panic is the panic whose value is being parsed, which may
+	// continue on later lines.
+	panic *Panic
+
+	// stack is the stack being parsed, if any, and g its goroutine.
+	stack *Stack
+	g     *Goroutine
+
+	// frame is the frame whose position is expected on the next line.
+	// It is either the last frame of stack or g.CreatedBy.
+	frame *Frame
+
+	// ancestor is the ancestor of g whose stack is being parsed, if any,
+	// printed with GODEBUG=tracebackancestors=N or tracebackcreators=N.
+	ancestor *Ancestor
+}
+
+func (p *parser) parseLine(line string) error {
+	if p.frame != nil {
+		f := p.frame
+		p.frame = nil
+		return parsePosition(f, line)
+	}
+
+	switch {
+	case strings.HasPrefix(line, "fatal error: "):
+		p.start()
+		p.tb.FatalError = strings.TrimPrefix(line, "fatal error: ")
+		return nil
+	case strings.HasPrefix(line, "panic: "), p.panic != nil && strings.HasPrefix(line, "\tpanic: "):
+		p.start()
+		p.tb.Panics = append(p.tb.Panics, Panic{})
+		p.panic = &p.tb.Panics[len(p.tb.Panics)-1]
+		p.setPanicValue(line[strings.Index(line, "panic: ")+len("panic: "):])
+		return nil
+	case strings.HasPrefix(line, "[signal ") && strings.HasSuffix(line, "]"):
+		p.start()
+		return p.parseSignal(line[len("[signal ") : len(line)-1])
+	case strings.HasPrefix(line, "goroutine ") && strings.HasSuffix(line, "]:"):
+		p.start()
+		return p.parseGoroutineHeader(line)
+	case line == "runtime stack:":
+		p.start()
+		p.tb.RuntimeStack = new(Stack)
+		p.stack = p.tb.RuntimeStack
+		p.g = nil
+		return nil
+	}
+
+	if !p.found {
+		return nil
+	}
+	if p.panic != nil {
+		// A multi-line panic value ends at the first line that
+		// starts something else.
+		if line == "" {
+			p.panic = nil
+			return nil
+		}
+		p.setPanicValue(p.panic.Value + "\n" + line)
+		return nil
+	}
+	if line == "" {
+		p.stack, p.g, p.ancestor = nil, nil, nil
+		return nil
+	}
+	if p.stack == nil {
+		// Other output, such as diagnostics printed by the runtime
+		// before a fatal error.
+		return nil
+	}
+	if p.g != nil && strings.HasPrefix(line, "[originating from goroutine ") && strings.HasSuffix(line, "]:") {
+		id, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(line, "[originating from goroutine "), "]:"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("malformed ancestor goroutine ID: %q", line)
+		}
+		p.g.Ancestors = append(p.g.Ancestors, Ancestor{ID: id, Frames: []Frame{}})
+		p.ancestor = &p.g.Ancestors[len(p.g.Ancestors)-1]
+		return nil
+	}
+	if p.ancestor != nil {
+		return p.parseAncestorLine(line)
+	}
+
+	switch {
+	case strings.HasPrefix(line, "labels: {"):
+		if p.g == nil || len(p.g.Frames) > 0 || p.g.Labels != nil {
+			return fmt.Errorf("unexpected labels: %q", line)
+		}
+		labels, err := parseLabels(strings.TrimPrefix(line, "labels: "))
+		if err != nil {
+			return err
+		}
+		p.g.Labels = labels
+	case strings.HasPrefix(line, "...") && strings.HasSuffix(line, " frames elided..."):
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, "..."), " frames elided..."))
+		if err != nil {
+			return fmt.Errorf("malformed elided frame count: %q", line)
+		}
+		p.stack.ElidedFrames = n
+	case line == "\tgoroutine running on other thread; stack unavailable":
+		if p.g == nil {
+			return errors.New("stack unavailable outside goroutine")
+		}
+		p.g.StackUnavailable = true
+	case strings.HasPrefix(line, "created by "):
+		if p.g == nil {
+			return errors.New("created by outside goroutine")
+		}
+		name, creator, ok := strings.Cut(strings.TrimPrefix(line, "created by "), " in goroutine ")
+		if ok {
+			id, err := strconv.ParseUint(creator, 10, 64)
+			if err != nil {
+				return fmt.Errorf("malformed creator goroutine: %q", line)
+			}
+			p.g.CreatorID = id
+		}
+		p.g.CreatedBy = &Frame{Func: name}
+		p.frame = p.g.CreatedBy
+	case strings.HasPrefix(line, "non-Go function at pc="):
+		pc, err := parseHex(strings.TrimPrefix(line, "non-Go function at pc="))
+		if err != nil {
+			return err
+		}
+		p.stack.Frames = append(p.stack.Frames, Frame{PC: pc, Cgo: true})
+	case strings.HasSuffix(line, ")"):
+		i := strings.LastIndex(line, "(")
+		if i <= 0 {
+			return fmt.Errorf("malformed frame: %q", line)
+		}
+		p.stack.Frames = append(p.stack.Frames, Frame{
+			Func:    line[:i],
+			Inlined: line[i:] == "(...)",
+		})
+		p.frame = &p.stack.Frames[len(p.stack.Frames)-1]
+	default:
+		// Output that follows the report.
+		p.stack, p.g = nil, nil
+	}
+	return nil
+}
+
+// parseAncestorLine parses a line of the stack of p.ancestor, which
+// has only frames, a marker for truncated stacks, and the frame that
+// created the ancestor.
+func (p *parser) parseAncestorLine(line string) error {
+	a := p.ancestor
+	switch {
+	case line == "...additional frames elided...":
+		a.FramesTruncated = true
+	case strings.HasPrefix(line, "created by "):
+		a.CreatedBy = &Frame{Func: strings.TrimPrefix(line, "created by ")}
+		p.frame = a.CreatedBy
+	case strings.HasSuffix(line, "(...)"):
+		a.Frames = append(a.Frames, Frame{Func: strings.TrimSuffix(line, "(...)")})
+		p.frame = &a.Frames[len(a.Frames)-1]
+	default:
+		// Output that follows the report.
+		p.stack, p.g, p.ancestor = nil, nil, nil
+	}
+	return nil
+}
+
+// parseLabels parses the profiler labels of a goroutine, for example
+//
+//	{"request": "1234", "user": "gopher"}
+func parseLabels(s string) (map[string]string, error) {
+	orig := s
+	labels := make(map[string]string)
+	s = strings.TrimPrefix(s, "{")
+	for s != "}" {
+		k, rest, err := cutQuoted(s)
+		if err != nil {
+			return nil, fmt.Errorf("malformed labels: %q", orig)
+		}
+		rest, ok := strings.CutPrefix(rest, ": ")
+		if !ok {
+			return nil, fmt.Errorf("malformed labels: %q", orig)
+		}
+		v, rest, err := cutQuoted(rest)
+		if err != nil {
+			return nil, fmt.Errorf("malformed labels: %q", orig)
+		}
+		labels[k] = v
+		if s, ok = strings.CutPrefix(rest, ", "); !ok {
+			s = rest
+			if s != "}" {
+				return nil, fmt.Errorf("malformed labels: %q", orig)
+			}
+		}
+	}
+	return labels, nil
+}
+
+// cutQuoted unquotes the quoted string at the start of s and returns
+// the rest of s. The runtime quotes strings like JSON, which is a subset
+// of Go's quoting.
+func cutQuoted(s string) (value, rest string, err error) {
+	if !strings.HasPrefix(s, `"`) {
+		return "", "", errors.New("missing quote")
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			value, err := strconv.Unquote(s[:i+1])
+			return value, s[i+1:], err
+		}
+	}
+	return "", "", errors.New("missing closing quote")
+}
+
+// start records that the report has started, and ends any panic value.
+func (p *parser) start() {
+	p.found = true
+	p.panic = nil
+}
+
+// setPanicValue sets the value of the current panic to v, which may end
+// with " [recovered]".
+func (p *parser) setPanicValue(v string) {
+	v, p.panic.Recovered = strings.CutSuffix(v, " [recovered]")
+	p.panic.Value = v
+}
+
+// parseSignal parses the contents of the "[signal ...]" line,
+// for example
+//
+//	SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x45b1a3
+func (p *parser) parseSignal(s string) error {
+	sig := new(Signal)
+	var err error
+	for _, f := range []struct {
+		key string
+		val *uint64
+	}{
+		{" pc=", &sig.PC},
+		{" addr=", &sig.Addr},
+		{" code=", &sig.Code},
+	} {
+		i := strings.LastIndex(s, f.key)
+		if i < 0 {
+			return fmt.Errorf("malformed signal: missing %s", strings.TrimSpace(f.key))
+		}
+		if *f.val, err = parseHex(s[i+len(f.key):]); err != nil {
+			return err
+		}
+		s = s[:i]
+	}
+	if strings.HasPrefix(s, "0x") {
+		if sig.Number, err = parseHex(s); err != nil {
+			return err
+		}
+	} else {
+		sig.Name = s
+	}
+	p.tb.Signal = sig
+	return nil
+}
+
+// parseGoroutineHeader parses a goroutine header, for example
+//
+//	goroutine 7 [chan receive, 3 minutes, locked to thread]:
+func (p *parser) parseGoroutineHeader(line string) error {
+	s := strings.TrimSuffix(strings.TrimPrefix(line, "goroutine "), "]:")
+	id, s, ok := strings.Cut(s, " [")
+	if !ok {
+		return fmt.Errorf("malformed goroutine header: %q", line)
+	}
+	g := Goroutine{Stack: Stack{Frames: []Frame{}}}
+	var err error
+	if g.ID, err = strconv.ParseUint(id, 10, 64); err != nil {
+		return fmt.Errorf("malformed goroutine ID: %q", line)
+	}
+	fields := strings.Split(s, ", ")
+	status := strings.TrimSuffix(fields[0], " (scan)")
+	if statuses[status] {
+		g.Status = status
+	} else {
+		g.Status = "waiting"
+		g.WaitReason = status
+	}
+	for _, f := range fields[1:] {
+		switch {
+		case f == "locked to thread":
+			g.LockedToThread = true
+		case strings.HasSuffix(f, " minutes"):
+			min, err := strconv.ParseInt(strings.TrimSuffix(f, " minutes"), 10, 64)
+			if err != nil {
+				return fmt.Errorf("malformed wait time: %q", line)
+			}
+			g.WaitTime = time.Duration(min) * time.Minute
+		default:
+			return fmt.Errorf("unexpected goroutine state %q: %q", f, line)
+		}
+	}
+	p.tb.Goroutines = append(p.tb.Goroutines, g)
+	p.g = &p.tb.Goroutines[len(p.tb.Goroutines)-1]
+	p.stack = &p.g.Stack
+	p.ancestor = nil
+	return nil
+}
+
+// parsePosition parses the line that follows a frame, for example
+//
+//	/home/gopher/x.go:23 +0xf fp=0xc000046f50 sp=0xc000046f30 pc=0x45b1a3
+func parsePosition(f *Frame, line string) error {
+	if !strings.HasPrefix(line, "\t") {
+		return fmt.Errorf("malformed position of frame %s: %q", f.Func, line)
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return fmt.Errorf("malformed position of frame %s: %q", f.Func, line)
+	}
+	// The file name may contain spaces, so find the line number
+	// from the end of the fields that make up the position.
+	n := 1
+	for n < len(fields) && !strings.HasPrefix(fields[n], "+") && !strings.Contains(fields[n], "=") {
+		n++
+	}
+	pos := strings.Join(fields[:n], " ")
+	i := strings.LastIndex(pos, ":")
+	if i < 0 {
+		return fmt.Errorf("malformed position of frame %s: %q", f.Func, line)
+	}
+	l, err := strconv.Atoi(pos[i+1:])
+	if err != nil {
+		return fmt.Errorf("malformed line number of frame %s: %q", f.Func, line)
+	}
+	f.File, f.Line = pos[:i], l
+	for _, field := range fields[n:] {
+		var err error
+		switch {
+		case strings.HasPrefix(field, "+"):
+			f.Offset, err = parseHex(field[1:])
+		case strings.HasPrefix(field, "pc="):
+			f.PC, err = parseHex(field[len("pc="):])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseHex(s string) (uint64, error) {
+	if !strings.HasPrefix(s, "0x") {
+		return 0, fmt.Errorf("malformed hexadecimal number %q", s)
+	}
+	v, err := strconv.ParseUint(s[2:], 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("malformed hexadecimal number %q", s)
+	}
+	return v, nil
+}
@@ -0,0 +1,190 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package traceback
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const panicReport = `program output
+panic: first [recovered]
+	panic: custom "err"
+line2
+[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x49215b]
+
+goroutine 1 [running]:
+main.main.func2()
+	/tmp/x/main.go:19 +0x25
+panic({0x49e640?, 0x5458e0?})
+	/usr/local/go/src/runtime/panic.go:612 +0x132
+main.(*T).f[...](...)
+	/tmp/x/main.go:23
+main.main()
+	/tmp/x/main.go:30 +0x23b fp=0xc000046f50 sp=0xc000046f30 pc=0x49215b
+
+goroutine 7 [chan receive, 3 minutes, locked to thread]:
+main.main.func1.1()
+	/tmp/x/main.go:16 +0x19
+...5 frames elided...
+non-Go function at pc=0x7f00
+created by main.main.func1 in goroutine 1
+	/tmp/x/main.go:16 +0x56
+
+goroutine 8 [running]:
+	goroutine running on other thread; stack unavailable
+created by main.main in goroutine 1
+	/tmp/x/main.go:17 +0x60
+exit status 2
+`
+
+func TestParse(t *testing.T) {
+	got, err := Parse([]byte(panicReport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Traceback{
+		Panics: []Panic{
+			{Value: "first", Recovered: true},
+			{Value: "custom \"err\"\nline2"},
+		},
+		Signal: &Signal{Name: "SIGSEGV: segmentation violation", Code: 1, Addr: 0, PC: 0x49215b},
+		Goroutines: []Goroutine{
+			{
+				ID:     1,
+				Status: "running",
+				Stack: Stack{Frames: []Frame{
+					{Func: "main.main.func2", File: "/tmp/x/main.go", Line: 19, Offset: 0x25},
+					{Func: "panic", File: "/usr/local/go/src/runtime/panic.go", Line: 612, Offset: 0x132},
+					{Func: "main.(*T).f[...]", File: "/tmp/x/main.go", Line: 23, Inlined: true},
+					{Func: "main.main", File: "/tmp/x/main.go", Line: 30, Offset: 0x23b, PC: 0x49215b},
+				}},
+			},
+			{
+				ID:             7,
+				Status:         "waiting",
+				WaitReason:     "chan receive",
+				WaitTime:       3 * time.Minute,
+				LockedToThread: true,
+				Stack: Stack{
+					Frames: []Frame{
+						{Func: "main.main.func1.1", File: "/tmp/x/main.go", Line: 16, Offset: 0x19},
+						{PC: 0x7f00, Cgo: true},
+					},
+					ElidedFrames: 5,
+				},
+				CreatedBy: &Frame{Func: "main.main.func1", File: "/tmp/x/main.go", Line: 16, Offset: 0x56},
+				CreatorID: 1,
+			},
+			{
+				ID:               8,
+				Status:           "running",
+				Stack:            Stack{Frames: []Frame{}},
+				StackUnavailable: true,
+				CreatedBy:        &Frame{Func: "main.main", File: "/tmp/x/main.go", Line: 17, Offset: 0x60},
+				CreatorID:        1,
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestParseFatalError(t *testing.T) {
+	const report = `fatal error: all goroutines are asleep - deadlock!
+
+runtime stack:
+runtime.throw({0x4a1c2e?, 0x0?})
+	/usr/local/go/src/runtime/panic.go:1077 +0x5c fp=0x7ffc5d1a0d30 sp=0x7ffc5d1a0d00 pc=0x4375bc
+
+goroutine 1 [chan receive]:
+main.main()
+	/tmp/x/main.go:5 +0x25
+`
+	got, err := Parse([]byte(report))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.FatalError != "all goroutines are asleep - deadlock!" {
+		t.Errorf("FatalError = %q", got.FatalError)
+	}
+	if got.RuntimeStack == nil || len(got.RuntimeStack.Frames) != 1 || got.RuntimeStack.Frames[0].Func != "runtime.throw" {
+		t.Errorf("RuntimeStack = %+v, want one runtime.throw frame", got.RuntimeStack)
+	}
+	if len(got.Goroutines) != 1 || got.Goroutines[0].WaitReason != "chan receive" {
+		t.Errorf("Goroutines = %+v, want one goroutine waiting in chan receive", got.Goroutines)
+	}
+}
+
+func TestParseLabelsAndAncestors(t *testing.T) {
+	const report = `panic: boom
+
+goroutine 9 [running]:
+labels: {"request": "a\"b, c", "user": "gopher"}
+main.worker()
+	/tmp/x/main.go:12 +0x25
+created by main.serve in goroutine 5
+	/tmp/x/main.go:20 +0x30
+[originating from goroutine 5]:
+main.serve(...)
+	/tmp/x/main.go:20 +0x2b
+...additional frames elided...
+created by main.main
+	/tmp/x/main.go:30 +0x40
+[originating from goroutine 1]:
+`
+	got, err := Parse([]byte(report))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Goroutine{{
+		ID:     9,
+		Status: "running",
+		Labels: map[string]string{"request": "a\"b, c", "user": "gopher"},
+		Stack: Stack{Frames: []Frame{
+			{Func: "main.worker", File: "/tmp/x/main.go", Line: 12, Offset: 0x25},
+		}},
+		CreatedBy: &Frame{Func: "main.serve", File: "/tmp/x/main.go", Line: 20, Offset: 0x30},
+		CreatorID: 5,
+		Ancestors: []Ancestor{
+			{
+				ID: 5,
+				Frames: []Frame{
+					{Func: "main.serve", File: "/tmp/x/main.go", Line: 20, Offset: 0x2b},
+				},
+				FramesTruncated: true,
+				CreatedBy:       &Frame{Func: "main.main", File: "/tmp/x/main.go", Line: 30, Offset: 0x40},
+			},
+			{ID: 1, Frames: []Frame{}},
+		},
+	}}
+	if !reflect.DeepEqual(got.Goroutines, want) {
+		t.Errorf("Parse:\ngot  %+v\nwant %+v", got.Goroutines, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, report := range []string{
+		"",
+		"hello, world\n",
+		"goroutine x [running]:\n",
+		"goroutine 1 [running]:\nmain.main()\n",
+		"goroutine 1 [running]:\nmain.main()\n\t/tmp/x.go +0x1\n",
+		"panic: x\n[signal SIGSEGV code=0x1 addr=0x0]\n",
+		"goroutine 1 [running]:\nlabels: {\"k\": v}\n",
+		"goroutine 1 [running]:\nlabels: {\"k\": \"v\"\n",
+		"goroutine 1 [running]:\nmain.main()\n\t/tmp/x.go:1 +0x1\nlabels: {}\n",
+		"goroutine 1 [running]:\n[originating from goroutine x]:\n",
+	} {
+		if _, err := Parse([]byte(report)); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", report)
+		} else if !strings.HasPrefix(err.Error(), "traceback: ") {
+			t.Errorf("Parse(%q): error %q does not start with \"traceback: \"", report, err)
+		}
+	}
+}
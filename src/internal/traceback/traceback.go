@@ -0,0 +1,187 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package traceback describes the report that the runtime prints when a
+// program crashes because of an unrecovered panic or a fatal error, and
+// parses the text form of that report.
+//
+// By default the runtime prints the report as text. With
+// GODEBUG=tracebackjson=1, it prints it instead as a single line of
+// JSON that encodes a [Traceback], using the JSON names given by the
+// struct tags of the types in this package. The JSON form can be decoded
+// with encoding/json; [Parse] decodes the text form into the same
+// structure, except for the information that the text form leaves out,
+// as noted on each field.
+//
+// Addresses and program counters are JSON numbers. GOTRACEBACK controls
+// which goroutines and frames are included in both forms.
+package traceback
+
+import "time"
+
+// A Traceback is the crash report of a program.
+type Traceback struct {
+	// FatalError is the message of a fatal error, such as
+	// "all goroutines are asleep - deadlock!", or "" if the program
+	// crashed because of a panic.
+	FatalError string `json:"fatalError,omitempty"`
+
+	// Panics are the panics that were in progress, oldest first.
+	Panics []Panic `json:"panics,omitempty"`
+
+	// Signal is the signal that caused the crash, if any.
+	Signal *Signal `json:"signal,omitempty"`
+
+	// RuntimeStack is the stack of the runtime's system stack, which
+	// is included when the crash happened on it.
+	RuntimeStack *Stack `json:"runtimeStack,omitempty"`
+
+	// Goroutines are the goroutines, starting with the one that
+	// crashed, if the crash happened on a goroutine.
+	Goroutines []Goroutine `json:"goroutines,omitempty"`
+}
+
+// A Panic is a panic that was in progress when the program crashed.
+type Panic struct {
+	// Value is the panic value, printed like the runtime's print
+	// function would print it. Errors and Stringers are replaced by
+	// the result of their Error or String method.
+	Value string `json:"value"`
+
+	// Recovered reports whether the panic was recovered before a
+	// later panic replaced it.
+	Recovered bool `json:"recovered,omitempty"`
+}
+
+// A Signal describes the signal that caused a crash.
+type Signal struct {
+	// Name is the name and description of the signal, such as
+	// "SIGSEGV: segmentation violation", or "" if it is not known.
+	Name string `json:"name"`
+
+	// Number is the signal number. The text form only includes it
+	// if Name is "".
+	Number uint64 `json:"number"`
+
+	Code uint64 `json:"code"` // the signal code
+	Addr uint64 `json:"addr"` // the faulting address
+	PC   uint64 `json:"pc"`   // the program counter at the signal
+}
+
+// A Stack is a stack trace.
+type Stack struct {
+	// Frames are the logical frames of the stack, innermost first.
+	Frames []Frame `json:"frames"`
+
+	// ElidedFrames is the number of frames left out in the middle of
+	// a very deep stack: Frames holds the innermost and outermost
+	// frames.
+	ElidedFrames int `json:"elidedFrames,omitempty"`
+}
+
+// A Goroutine describes a goroutine and its stack.
+type Goroutine struct {
+	ID uint64 `json:"id"`
+
+	// Status is the scheduling status of the goroutine, such as
+	// "running", "runnable", "waiting", or "syscall".
+	Status string `json:"status"`
+
+	// WaitReason says why a waiting goroutine is waiting, such as
+	// "chan receive" or "sleep".
+	WaitReason string `json:"waitReason,omitempty"`
+
+	// WaitTime is about how long a waiting goroutine has been
+	// waiting, in nanoseconds in the JSON form. The runtime notes
+	// that a goroutine is waiting when a garbage collection finds
+	// it waiting, and counts from the end of the collection before
+	// that one. WaitTime is zero until a collection other than the
+	// first has found the goroutine waiting. The text form only
+	// includes it in whole minutes, if it is at least one minute.
+	WaitTime time.Duration `json:"waitTime,omitempty"`
+
+	// LockedToThread reports whether the goroutine is locked to its
+	// operating system thread.
+	LockedToThread bool `json:"lockedToThread,omitempty"`
+
+	// Labels are the profiler labels of the goroutine, as set by
+	// runtime/pprof. The text form includes them only with
+	// GODEBUG=tracebacklabels=1.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	Stack
+
+	// StackUnavailable reports that the stack could not be collected
+	// because the goroutine was running on another thread.
+	StackUnavailable bool `json:"stackUnavailable,omitempty"`
+
+	// CreatedBy is the go statement that created the goroutine, or
+	// nil for the main goroutine and, unless GOTRACEBACK=system,
+	// goroutines created by the runtime.
+	CreatedBy *Frame `json:"createdBy,omitempty"`
+
+	// CreatorID is the ID of the goroutine that created this one,
+	// if known.
+	CreatorID uint64 `json:"creatorID,omitempty"`
+
+	// Ancestors are the goroutines that created this one, directly or
+	// indirectly, starting with the one that created it. They are only
+	// recorded with GODEBUG=tracebackancestors=N or tracebackcreators=N.
+	Ancestors []Ancestor `json:"ancestors,omitempty"`
+}
+
+// An Ancestor describes a goroutine in the chain of goroutines that
+// created another one.
+type Ancestor struct {
+	// ID is the ID of the ancestor. The ancestor may have exited since,
+	// and its ID may have been reused.
+	ID uint64 `json:"id"`
+
+	// Frames are the frames of the ancestor's stack when it created the
+	// next goroutine in the chain, innermost first. Only the innermost
+	// physical frame of each call is known, so no frame is marked
+	// inlined. Frames is empty with GODEBUG=tracebackcreators=N, which
+	// does not record stacks.
+	Frames []Frame `json:"frames"`
+
+	// FramesTruncated reports whether the stack had more frames than
+	// the runtime records.
+	FramesTruncated bool `json:"framesTruncated,omitempty"`
+
+	// CreatedBy is the go statement that created the ancestor, or nil
+	// for the main goroutine.
+	CreatedBy *Frame `json:"createdBy,omitempty"`
+}
+
+// A Frame is a logical stack frame: a call to a function, which may be
+// inlined into its caller.
+type Frame struct {
+	// Func is the name of the function, as printed in tracebacks:
+	// the type arguments of generic functions are written "...", and
+	// calls to runtime.gopanic are written "panic". It is "" for a
+	// frame of non-Go code.
+	Func string `json:"func"`
+
+	// File and Line are the position of the call, or of the
+	// instruction being executed in the innermost frame.
+	File string `json:"file"`
+	Line int    `json:"line"`
+
+	// PC is the program counter of the frame. For all but the
+	// innermost frame, it is the return address. The text form only
+	// includes it with GOTRACEBACK=system and for fatal runtime
+	// errors.
+	PC uint64 `json:"pc"`
+
+	// Offset is the offset of PC from the entry of the function.
+	// It is 0 for inlined frames.
+	Offset uint64 `json:"offset,omitempty"`
+
+	// Inlined reports whether the call was inlined into the caller.
+	Inlined bool `json:"inlined,omitempty"`
+
+	// Cgo reports whether this is a frame of non-Go code, for which
+	// only PC is known.
+	Cgo bool `json:"cgo,omitempty"`
+}
@@ -0,0 +1,83 @@
+// -goexperiment=rangefunc
+
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package p
+
+type MyInt int32
+type MyBool bool
+type MyString string
+type MyFunc1 func(func(int) bool)
+type MyFunc2 func(int) bool
+
+func f0(func() bool)
+func f1(func(int) bool)
+func f2(func(int, string) bool)
+func f3(func(int, string, error) bool)
+func f4(func(...int) bool)
+func f5(func(int))
+func f6(func(int) MyBool)
+func f7() func(func(int) bool)
+
+func bad1(func() bool, int)
+func bad2() bool
+func bad3(int)
+
+func test() {
+	for range f0 {}
+	for _ /* ERROR "permits no iteration variables" */ = range f0 {}
+	for x /* ERROR "permits no iteration variables" */ := range f0 { _ = x }
+
+	for range f1 {}
+	for x := range f1 {
+		var _ int = x
+	}
+	for _, _ /* ERROR "permits only one iteration variable" */ = range f1 {}
+
+	for range f2 {}
+	for x := range f2 {
+		var _ int = x
+	}
+	for x, y := range f2 {
+		var _ int = x
+		var _ string = y
+	}
+	var s MyString
+	for _, s /* ERRORx `cannot use .* in assignment` */ = range f2 {}
+	_ = s
+
+	for range f3 /* ERROR "yield func has too many parameters" */ {}
+	for range f4 /* ERROR "yield func is variadic" */ {}
+	for range f5 /* ERROR "yield func does not return bool" */ {}
+	for range f6 {}
+	for range f7 /* ERROR "wrong argument count" */ {}
+	for x := range f7() {
+		var _ int = x
+	}
+	for range MyFunc1(nil) {}
+
+	for range bad1 /* ERROR "wrong argument count" */ {}
+	for range bad2 /* ERROR "wrong argument count" */ {}
+	for range bad3 /* ERROR "argument is not func" */ {}
+	var mf2 MyFunc2
+	for range mf2 /* ERROR "unexpected results" */ {}
+}
+
+func _[T any](f func(func(T) bool)) {
+	for x := range f {
+		var _ T = x
+	}
+}
+
+func _[F ~func(func(int, string) bool)](f F) {
+	for k, v := range f {
+		var _ int = k
+		var _ string = v
+	}
+}
+
+func _[F func(func(int) bool) | func(func(string) bool)](f F) {
+	for range f /* ERROR "has no core type" */ {}
+}
@@ -0,0 +1,421 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"internal/bytealg"
+	"unsafe"
+)
+
+// The CPU and memory limits of a container on Linux are the limits of
+// the cgroups of the process. Both versions of the cgroup file system
+// are supported: in version 1 each controller has its own hierarchy of
+// cgroups, and in version 2 a single hierarchy has all the controllers.
+//
+// /proc/self/cgroup names the cgroup of the process in each hierarchy,
+// relative to the root of the hierarchy, and /proc/self/mountinfo tells
+// where the hierarchies are mounted. The limits are read from the files
+// in the directories of the cgroups:
+//
+//	version 1: cpu.cfs_quota_us, cpu.cfs_period_us and memory.limit_in_bytes
+//	version 2: cpu.max and memory.max
+//
+// In version 2 the limits of the ancestors of a cgroup apply to it too,
+// so the lowest limit of the cgroup and of its ancestors up to the root
+// of the mount is used.
+//
+// sysmon reads the limits again periodically, and it cannot allocate,
+// so reading them uses only the buffers in cgroupState.
+
+const (
+	cgroupPathMax = 1024 // maximum length of a file name, with its NUL
+	cgroupBufSize = 4096 // maximum length of a line of a file that is read
+)
+
+type cgroupVersion uint8
+
+const (
+	cgroupNone cgroupVersion = iota
+	cgroupV1
+	cgroupV2
+)
+
+// cgroupDir is the directory of a cgroup in the cgroup file system.
+type cgroupDir struct {
+	version cgroupVersion
+	found   bool                // path is the directory; otherwise it is the name of the cgroup
+	path    [cgroupPathMax]byte // path[:n] is the directory
+	n       int
+	mount   int // length of the mount point that path starts with
+}
+
+// cgroupState holds the cgroup directories of the process.
+type cgroupState struct {
+	cpu cgroupDir // cgroup with the cpu controller
+	mem cgroupDir // cgroup with the memory controller
+
+	name  [cgroupPathMax]byte // NUL-terminated name of the file to open
+	mount [cgroupPathMax]byte // unescaped mount point
+	buf   [cgroupBufSize]byte // contents of the file being read
+}
+
+// cgroup is the cgroup state of the process.
+var cgroup cgroupState
+
+// osInitContainerLimits finds the cgroups of the process.
+func osInitContainerLimits() {
+	cgroup.init("")
+}
+
+// osCPULimit returns the CPU limit of the container, as a quota of CPU
+// time per period. ok is false if the container has no CPU limit.
+func osCPULimit() (quota, period int64, ok bool) {
+	return cgroup.cpuLimit()
+}
+
+// osMemoryLimit returns the memory limit of the container in bytes.
+// ok is false if the container has no memory limit.
+func osMemoryLimit() (limit int64, ok bool) {
+	return cgroup.memLimit()
+}
+
+// init finds the directories of the cgroups of the process with the
+// cpu and memory controllers. root is prepended to the names of all
+// the files that are read; it is empty except in tests, which use a
+// fake file system.
+func (cg *cgroupState) init(root string) {
+	cg.cpu.version, cg.cpu.found = cgroupNone, false
+	cg.mem.version, cg.mem.found = cgroupNone, false
+	cg.readLines(root, "/proc/self/cgroup", func(line string) {
+		cg.parseCgroupLine(line)
+	})
+	if cg.cpu.version != cgroupNone || cg.mem.version != cgroupNone {
+		cg.readLines(root, "/proc/self/mountinfo", func(line string) {
+			cg.parseMountLine(root, line)
+		})
+	}
+	if !cg.cpu.found {
+		cg.cpu.version = cgroupNone
+	}
+	if !cg.mem.found {
+		cg.mem.version = cgroupNone
+	}
+}
+
+// parseCgroupLine parses a line of /proc/self/cgroup, of the form
+//
+//	hierarchy-ID:controller-list:cgroup-path
+//
+// The controller list is empty for the version 2 hierarchy, which has
+// the controllers that are not in a version 1 hierarchy.
+func (cg *cgroupState) parseCgroupLine(line string) {
+	_, line = cgroupCut(line, ':')
+	controllers, path := cgroupCut(line, ':')
+	if controllers == "" {
+		if cg.cpu.version == cgroupNone {
+			cg.cpu.setName(cgroupV2, path)
+		}
+		if cg.mem.version == cgroupNone {
+			cg.mem.setName(cgroupV2, path)
+		}
+		return
+	}
+	for controllers != "" {
+		var c string
+		c, controllers = cgroupCut(controllers, ',')
+		switch c {
+		case "cpu":
+			cg.cpu.setName(cgroupV1, path)
+		case "memory":
+			cg.mem.setName(cgroupV1, path)
+		}
+	}
+}
+
+// setName records that the cgroup of the process is name in a
+// hierarchy of the given version.
+func (d *cgroupDir) setName(version cgroupVersion, name string) {
+	if name == "" || len(name) >= len(d.path) {
+		return
+	}
+	d.version = version
+	d.n = copy(d.path[:], name)
+}
+
+// parseMountLine parses a line of /proc/self/mountinfo, of the form
+//
+//	36 35 98:0 /root /mount/point rw,noatime master:1 - fstype source super,options
+//
+// where the number of optional fields before the "-" varies.
+func (cg *cgroupState) parseMountLine(root, line string) {
+	var mountRoot, mountPoint string
+	for i := 0; ; i++ {
+		var field string
+		field, line = cgroupCut(line, ' ')
+		if i == 3 {
+			mountRoot = field
+		} else if i == 4 {
+			mountPoint = field
+		} else if i >= 6 && field == "-" {
+			break
+		}
+		if line == "" {
+			return
+		}
+	}
+	fstype, line := cgroupCut(line, ' ')
+	_, options := cgroupCut(line, ' ')
+	switch fstype {
+	case "cgroup2":
+		if cg.cpu.version == cgroupV2 {
+			cg.setDir(&cg.cpu, root, mountRoot, mountPoint)
+		}
+		if cg.mem.version == cgroupV2 {
+			cg.setDir(&cg.mem, root, mountRoot, mountPoint)
+		}
+	case "cgroup":
+		if cg.cpu.version == cgroupV1 && cgroupHasOption(options, "cpu") {
+			cg.setDir(&cg.cpu, root, mountRoot, mountPoint)
+		}
+		if cg.mem.version == cgroupV1 && cgroupHasOption(options, "memory") {
+			cg.setDir(&cg.mem, root, mountRoot, mountPoint)
+		}
+	}
+}
+
+// setDir sets the directory of the cgroup of d from the mount of its
+// hierarchy at mountPoint, whose root is the cgroup mountRoot. It does
+// nothing if the cgroup of d is not under mountRoot.
+func (cg *cgroupState) setDir(d *cgroupDir, root, mountRoot, mountPoint string) {
+	if d.found {
+		return
+	}
+	name := cgroupString(d.path[:d.n])
+	if mountRoot != "/" {
+		if !hasPrefix(name, mountRoot) || len(name) > len(mountRoot) && name[len(mountRoot)] != '/' {
+			return
+		}
+		name = name[len(mountRoot):]
+	}
+	if name == "/" {
+		name = ""
+	}
+	m, ok := cgroupUnescape(cg.mount[:], mountPoint)
+	if !ok || len(root)+m+len(name) >= len(d.path) {
+		return
+	}
+	// name is in d.path, so move it to its place first.
+	copy(d.path[len(root)+m:], name)
+	copy(d.path[:], root)
+	copy(d.path[len(root):], cg.mount[:m])
+	d.n = len(root) + m + len(name)
+	d.mount = len(root) + m
+	d.found = true
+}
+
+// cpuLimit returns the CPU limit of the cgroups of the process.
+func (cg *cgroupState) cpuLimit() (quota, period int64, ok bool) {
+	d := &cg.cpu
+	switch d.version {
+	case cgroupV1:
+		q, ok1 := cg.readInt(d, d.n, "/cpu.cfs_quota_us")
+		p, ok2 := cg.readInt(d, d.n, "/cpu.cfs_period_us")
+		if !ok1 || !ok2 || q <= 0 || p <= 0 {
+			// A quota of -1 means no limit.
+			return 0, 0, false
+		}
+		return q, p, true
+	case cgroupV2:
+		for n := d.n; n >= d.mount; n = d.parent(n) {
+			// cpu.max is "$MAX $PERIOD", where $MAX is "max" for no limit.
+			s, ok1 := cg.readFile(d, n, "/cpu.max")
+			if !ok1 {
+				continue
+			}
+			qs, ps := cgroupCut(s, ' ')
+			q, ok1 := atoi64(qs)
+			p, ok2 := atoi64(ps)
+			if !ok1 || !ok2 || q <= 0 || p <= 0 {
+				continue
+			}
+			if !ok || float64(q)/float64(p) < float64(quota)/float64(period) {
+				quota, period, ok = q, p, true
+			}
+		}
+	}
+	return quota, period, ok
+}
+
+// memLimit returns the memory limit of the cgroups of the process.
+func (cg *cgroupState) memLimit() (limit int64, ok bool) {
+	d := &cg.mem
+	switch d.version {
+	case cgroupV1:
+		// Without a limit, memory.limit_in_bytes is a huge
+		// number, rounded down to a multiple of the page size.
+		limit, ok = cg.readInt(d, d.n, "/memory.limit_in_bytes")
+		if !ok || limit <= 0 || limit >= 1<<62 {
+			return 0, false
+		}
+		return limit, true
+	case cgroupV2:
+		for n := d.n; n >= d.mount; n = d.parent(n) {
+			// memory.max is "max" for no limit.
+			l, ok1 := cg.readInt(d, n, "/memory.max")
+			if ok1 && l > 0 && (!ok || l < limit) {
+				limit, ok = l, true
+			}
+		}
+	}
+	return limit, ok
+}
+
+// parent returns the length of the directory of the parent of the
+// cgroup in d.path[:n], or -1 if d.path[:n] is the root of the mount.
+func (d *cgroupDir) parent(n int) int {
+	if n <= d.mount {
+		return -1
+	}
+	for n--; n > d.mount && d.path[n] != '/'; n-- {
+	}
+	return n
+}
+
+// readInt returns the number in the file dir/file, where dir is
+// d.path[:n].
+func (cg *cgroupState) readInt(d *cgroupDir, n int, file string) (int64, bool) {
+	s, ok := cg.readFile(d, n, file)
+	if !ok {
+		return 0, false
+	}
+	return atoi64(s)
+}
+
+// readFile returns the first line of the file dir/file, where dir is
+// d.path[:n]. The result points into cg.buf.
+func (cg *cgroupState) readFile(d *cgroupDir, n int, file string) (string, bool) {
+	if !cg.setFileName(cgroupString(d.path[:n]), file) {
+		return "", false
+	}
+	fd := open(&cg.name[0], 0 /* O_RDONLY */, 0)
+	if fd < 0 {
+		return "", false
+	}
+	r := read(fd, unsafe.Pointer(&cg.buf[0]), int32(len(cg.buf)))
+	closefd(fd)
+	if r <= 0 {
+		return "", false
+	}
+	s, _ := cgroupCut(cgroupString(cg.buf[:r]), '\n')
+	return s, true
+}
+
+// readLines calls f with each line of the file root+file, without its
+// newline. The line points into cg.buf. Lines longer than cg.buf are
+// skipped.
+func (cg *cgroupState) readLines(root, file string, f func(line string)) {
+	if !cg.setFileName(root, file) {
+		return
+	}
+	fd := open(&cg.name[0], 0 /* O_RDONLY */, 0)
+	if fd < 0 {
+		return
+	}
+	n := 0        // length of the data in cg.buf
+	skip := false // whether the data in cg.buf ends a line that is too long
+	for {
+		r := read(fd, unsafe.Pointer(&cg.buf[n]), int32(len(cg.buf)-n))
+		if r <= 0 {
+			if n > 0 && !skip {
+				f(cgroupString(cg.buf[:n]))
+			}
+			break
+		}
+		n += int(r)
+		start := 0
+		for {
+			i := bytealg.IndexByte(cg.buf[start:n], '\n')
+			if i < 0 {
+				break
+			}
+			if !skip {
+				f(cgroupString(cg.buf[start : start+i]))
+			}
+			skip = false
+			start += i + 1
+		}
+		n = copy(cg.buf[:], cg.buf[start:n])
+		if n == len(cg.buf) {
+			n = 0
+			skip = true
+		}
+	}
+	closefd(fd)
+}
+
+// setFileName sets cg.name to dir+file, NUL-terminated.
+func (cg *cgroupState) setFileName(dir, file string) bool {
+	if len(dir)+len(file) >= len(cg.name) {
+		return false
+	}
+	copy(cg.name[:], dir)
+	copy(cg.name[len(dir):], file)
+	cg.name[len(dir)+len(file)] = 0
+	return true
+}
+
+// cgroupString returns the contents of b as a string, without copying.
+func cgroupString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	ss := stringStruct{str: unsafe.Pointer(&b[0]), len: len(b)}
+	return *(*string)(unsafe.Pointer(&ss))
+}
+
+// cgroupCut slices s around the first instance of sep.
+func cgroupCut(s string, sep byte) (before, after string) {
+	if i := bytealg.IndexByteString(s, sep); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+// cgroupHasOption reports whether the comma-separated list of mount
+// options has option.
+func cgroupHasOption(options, option string) bool {
+	for options != "" {
+		var o string
+		o, options = cgroupCut(options, ',')
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// cgroupUnescape copies s to dst, replacing the octal escapes \ooo
+// that mountinfo uses for space, tab, newline and backslash with the
+// characters they stand for. It returns the length of the result.
+func cgroupUnescape(dst []byte, s string) (int, bool) {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if n >= len(dst) {
+			return 0, false
+		}
+		c := s[i]
+		if c == '\\' && i+3 < len(s) && isOctal(s[i+1]) && isOctal(s[i+2]) && isOctal(s[i+3]) {
+			c = (s[i+1]-'0')<<6 | (s[i+2]-'0')<<3 | (s[i+3] - '0')
+			i += 3
+		}
+		dst[n] = c
+		n++
+	}
+	return n, true
+}
+
+func isOctal(c byte) bool {
+	return '0' <= c && c <= '7'
+}
@@ -0,0 +1,177 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime_test
+
+import (
+	"os"
+	"path/filepath"
+	. "runtime"
+	"testing"
+)
+
+const (
+	mountinfoRoot = "22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw\n"
+	mountinfoV2   = "30 23 0:26 / /sys/fs/cgroup rw,nosuid,nodev,noexec,relatime shared:4 - cgroup2 cgroup2 rw,nsdelegate\n"
+)
+
+var cgroupTests = []struct {
+	name  string
+	files map[string]string
+
+	quota, period int64
+	cpuOK         bool
+	mem           int64
+	memOK         bool
+}{
+	{
+		name:  "none",
+		files: map[string]string{},
+	},
+	{
+		name: "v2",
+		files: map[string]string{
+			"proc/self/cgroup":                           "0::/kubepods/pod1/ctr\n",
+			"proc/self/mountinfo":                        mountinfoRoot + mountinfoV2,
+			"sys/fs/cgroup/kubepods/cpu.max":             "400000 100000\n",
+			"sys/fs/cgroup/kubepods/pod1/cpu.max":        "250000 100000\n",
+			"sys/fs/cgroup/kubepods/pod1/ctr/cpu.max":    "max 100000\n",
+			"sys/fs/cgroup/kubepods/memory.max":          "max\n",
+			"sys/fs/cgroup/kubepods/pod1/memory.max":     "2147483648\n",
+			"sys/fs/cgroup/kubepods/pod1/ctr/memory.max": "1073741824\n",
+		},
+		quota: 250000, period: 100000, cpuOK: true,
+		mem: 1 << 30, memOK: true,
+	},
+	{
+		name: "v2-unlimited",
+		files: map[string]string{
+			"proc/self/cgroup":                    "0::/user.slice\n",
+			"proc/self/mountinfo":                 mountinfoRoot + mountinfoV2,
+			"sys/fs/cgroup/user.slice/cpu.max":    "max 100000\n",
+			"sys/fs/cgroup/user.slice/memory.max": "max\n",
+		},
+	},
+	{
+		name: "v2-namespace",
+		files: map[string]string{
+			"proc/self/cgroup":      "0::/\n",
+			"proc/self/mountinfo":   mountinfoRoot + "30 23 0:26 / /sys/fs/cgroup ro,nosuid - cgroup2 cgroup2 rw\n",
+			"sys/fs/cgroup/cpu.max": "50000 100000\n",
+		},
+		quota: 50000, period: 100000, cpuOK: true,
+	},
+	{
+		name: "v1",
+		files: map[string]string{
+			"proc/self/cgroup": "12:memory:/docker/abc\n" +
+				"4:cpu,cpuacct:/docker/abc\n" +
+				"1:name=systemd:/docker/abc\n",
+			"proc/self/mountinfo": mountinfoRoot +
+				"33 25 0:29 /docker/abc /sys/fs/cgroup/cpu,cpuacct ro,nosuid,nodev,noexec,relatime master:11 - cgroup cgroup rw,cpu,cpuacct\n" +
+				"34 25 0:30 /docker/abc /sys/fs/cgroup/memory ro,nosuid,nodev,noexec,relatime master:12 - cgroup cgroup rw,memory\n",
+			"sys/fs/cgroup/cpu,cpuacct/cpu.cfs_quota_us":  "150000\n",
+			"sys/fs/cgroup/cpu,cpuacct/cpu.cfs_period_us": "100000\n",
+			"sys/fs/cgroup/memory/memory.limit_in_bytes":  "536870912\n",
+		},
+		quota: 150000, period: 100000, cpuOK: true,
+		mem: 512 << 20, memOK: true,
+	},
+	{
+		name: "v1-unlimited",
+		files: map[string]string{
+			"proc/self/cgroup": "12:memory:/system.slice/foo.service\n" +
+				"4:cpu,cpuacct:/system.slice/foo.service\n",
+			"proc/self/mountinfo": mountinfoRoot +
+				"33 25 0:29 / /sys/fs/cgroup/cpu,cpuacct rw,nosuid shared:11 - cgroup cgroup rw,cpu,cpuacct\n" +
+				"34 25 0:30 / /sys/fs/cgroup/memory rw,nosuid shared:12 - cgroup cgroup rw,memory\n",
+			"sys/fs/cgroup/cpu,cpuacct/system.slice/foo.service/cpu.cfs_quota_us":  "-1\n",
+			"sys/fs/cgroup/cpu,cpuacct/system.slice/foo.service/cpu.cfs_period_us": "100000\n",
+			"sys/fs/cgroup/memory/system.slice/foo.service/memory.limit_in_bytes":  "9223372036854771712\n",
+		},
+	},
+	{
+		// The cpu controller has a version 1 hierarchy, and the
+		// memory controller is in the version 2 hierarchy.
+		name: "hybrid",
+		files: map[string]string{
+			"proc/self/cgroup": "4:cpu,cpuacct:/app\n" +
+				"0::/app\n",
+			"proc/self/mountinfo": mountinfoRoot +
+				"33 25 0:29 / /sys/fs/cgroup/cpu,cpuacct rw,nosuid shared:11 - cgroup cgroup rw,cpu,cpuacct\n" +
+				"35 25 0:31 / /sys/fs/cgroup/unified rw,nosuid shared:13 - cgroup2 cgroup2 rw\n",
+			"sys/fs/cgroup/cpu,cpuacct/app/cpu.cfs_quota_us":  "300000\n",
+			"sys/fs/cgroup/cpu,cpuacct/app/cpu.cfs_period_us": "100000\n",
+			"sys/fs/cgroup/unified/app/cpu.max":               "100000 100000\n",
+			"sys/fs/cgroup/unified/app/memory.max":            "1048576\n",
+		},
+		quota: 300000, period: 100000, cpuOK: true,
+		mem: 1 << 20, memOK: true,
+	},
+	{
+		name: "escaped-mount-point",
+		files: map[string]string{
+			"proc/self/cgroup":              "0::/a\n",
+			"proc/self/mountinfo":           mountinfoRoot + "30 23 0:26 / /sys/fs/cgroup\\040v2 rw shared:4 - cgroup2 cgroup2 rw\n",
+			"sys/fs/cgroup v2/a/cpu.max":    "150000 50000\n",
+			"sys/fs/cgroup v2/a/memory.max": "4096\n",
+		},
+		quota: 150000, period: 50000, cpuOK: true,
+		mem: 4096, memOK: true,
+	},
+	{
+		// The cgroup of the process is not in the mounted part of
+		// the hierarchy.
+		name: "outside-mount",
+		files: map[string]string{
+			"proc/self/cgroup":      "0::/other\n",
+			"proc/self/mountinfo":   mountinfoRoot + "30 23 0:26 /ctr /sys/fs/cgroup rw shared:4 - cgroup2 cgroup2 rw\n",
+			"sys/fs/cgroup/cpu.max": "100000 100000\n",
+		},
+	},
+}
+
+func TestCgroupLimits(t *testing.T) {
+	for _, tt := range cgroupTests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for name, data := range tt.files {
+				name = filepath.Join(root, name)
+				if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			quota, period, cpuOK, mem, memOK := CgroupLimits(root)
+			if quota != tt.quota || period != tt.period || cpuOK != tt.cpuOK {
+				t.Errorf("CPU limit = %d, %d, %v; want %d, %d, %v", quota, period, cpuOK, tt.quota, tt.period, tt.cpuOK)
+			}
+			if mem != tt.mem || memOK != tt.memOK {
+				t.Errorf("memory limit = %d, %v; want %d, %v", mem, memOK, tt.mem, tt.memOK)
+			}
+		})
+	}
+}
+
+func TestLimitGOMAXPROCS(t *testing.T) {
+	for _, tt := range []struct {
+		ncpu          int32
+		quota, period int64
+		want          int32
+	}{
+		{96, 200000, 100000, 2},
+		{96, 250000, 100000, 3},
+		{96, 50000, 100000, 2},
+		{96, 100000, 100000, 2},
+		{4, 800000, 100000, 4},
+		{1, 50000, 100000, 1},
+		{96, 9600000, 100000, 96},
+	} {
+		if got := LimitGOMAXPROCS(tt.ncpu, tt.quota, tt.period); got != tt.want {
+			t.Errorf("LimitGOMAXPROCS(%d, %d, %d) = %d, want %d", tt.ncpu, tt.quota, tt.period, got, tt.want)
+		}
+	}
+}
@@ -220,6 +220,23 @@ func TestGoexitDeadlock(t *testing.T) {
 	}
 }
 
+func TestPartialDeadlock(t *testing.T) {
+	output := runTestProg(t, "testprog", "PartialDeadlock", "GODEBUG=partialdeadlock=1")
+	if n := strings.Count(output, "runtime: partial deadlock: 4 goroutines blocked forever"); n != 1 {
+		t.Errorf("got %d partial deadlock reports, want 1", n)
+	}
+	for _, want := range []string{
+		"[chan receive]:\nmain.partialDeadlockExchange(",
+		"[sync.Mutex.Lock]:\nsync.runtime_SemacquireMutex(",
+		"main.partialDeadlockLock(",
+		"deadlocked goroutines: 4\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output does not contain %q:\n%s", want, output)
+		}
+	}
+}
+
 func TestStackOverflow(t *testing.T) {
 	output := runTestProg(t, "testprog", "StackOverflow")
 	want := []string{
@@ -11,13 +11,24 @@ import (
 
 // GOMAXPROCS sets the maximum number of CPUs that can be executing
 // simultaneously and returns the previous setting. It defaults to
-// the value of runtime.NumCPU. If n < 1, it does not change the current setting.
+// the value of runtime.NumCPU, capped on Linux by the CPU limit of the
+// container the process runs in. If n < 1, it does not change the current setting.
+// Once GOMAXPROCS is called with n >= 1, even if n is the current setting,
+// the setting no longer follows changes of the CPU limit of the container.
 // This call will go away when the scheduler improves.
 func GOMAXPROCS(n int) int {
 	if GOARCH == "wasm" && n > 1 {
 		n = 1 // WebAssembly has no threads yet, so only one CPU is possible.
 	}
 
+	if n > 0 {
+		// Once set explicitly, even to the current setting, GOMAXPROCS
+		// no longer follows the CPU limit of the container. Record this
+		// before reading the current setting, so that the container
+		// limits helper cannot change it after that.
+		ctrlimits.customProcs.Store(true)
+	}
+
 	lock(&sched.lock)
 	ret := int(gomaxprocs)
 	unlock(&sched.lock)
@@ -166,7 +166,13 @@ func SetPanicOnFault(enabled bool) bool {
 // connected to a pipe or socket whose other end is in the same Go
 // process; instead, use a temporary file or network socket.
 //
-// The heap dump format is defined at https://golang.org/s/go15heapdump.
+// The heap dump format is documented in the source of package
+// cmd/internal/heapdump, and "go tool heapdump" reads and analyzes it.
+// By default, heap objects in the dump have no type information;
+// setting GODEBUG=heapdumptypes=1 when the program starts makes the
+// runtime record the type of every object it allocates for use in dumps.
+// That setting slows down every allocation and uses extra memory, so it
+// is meant for debugging, not for programs running in production.
 func WriteHeapDump(fd uintptr)
 
 // SetTraceback sets the amount of detail printed by the runtime in
@@ -229,6 +235,10 @@ func SetTraceback(level string)
 // TiB. These suffixes represent quantities of bytes as defined by
 // the IEC 80000-13 standard. That is, they are based on powers of
 // two: KiB means 2^10 bytes, MiB means 2^20 bytes, and so on.
+// On Linux, GODEBUG=containermemlimit=1 makes the initial setting,
+// when GOMEMLIMIT is not set, follow the memory limit of the container
+// of the process until the first call to SetMemoryLimit with a
+// non-negative limit; see the runtime package documentation.
 //
 // SetMemoryLimit returns the previously set memory limit.
 // A negative input does not adjust the limit, and allows for
@@ -236,3 +246,50 @@ func SetTraceback(level string)
 func SetMemoryLimit(limit int64) int64 {
 	return setMemoryLimit(limit)
 }
+
+// SetScavengePolicy sets how eagerly the runtime returns free heap
+// memory to the operating system, and returns the previous policy.
+// The policies are:
+//
+//   - "default" keeps enough memory to grow the heap to the next heap
+//     goal, plus 10%, and avoids returning memory from densely used
+//     parts of the heap.
+//   - "release" keeps only the memory that was in use at the end of the
+//     last garbage collection, and ignores density. It trades CPU time
+//     and page faults for a smaller footprint, which suits batch jobs.
+//   - "retain" keeps all free memory, which suits latency-sensitive
+//     services.
+//   - "hugepage" keeps as much memory as "default", but only returns
+//     memory from regions of the heap that are entirely free, so that
+//     transparent huge pages in use are never broken up.
+//
+// No policy affects returning memory to stay under the memory limit
+// (see SetMemoryLimit) or in FreeOSMemory. A target set with
+// SetScavengeRetain takes the place of the amount of memory the policy
+// keeps.
+//
+// The initial policy is "default", unless set with
+// GODEBUG=scavengepolicy=name. After the first call to
+// SetScavengePolicy, GODEBUG no longer affects the policy.
+// An empty policy does not change the policy, and allows for retrieval
+// of the current one. SetScavengePolicy panics if policy is not one
+// of the above.
+func SetScavengePolicy(policy string) string {
+	return setScavengePolicy(policy)
+}
+
+// SetScavengeRetain sets a target for the amount of heap memory, in
+// bytes, that the runtime retains rather than returning it to the
+// operating system, and returns the previous target. The runtime
+// returns free memory whenever the heap retains more than the target,
+// and not otherwise, in place of the amount chosen by the scavenging
+// policy (see SetScavengePolicy). A zero target lets the policy decide
+// again. The memory limit (see SetMemoryLimit) still applies.
+//
+// The initial target is zero, unless set with GODEBUG=scavengeretain=N,
+// in MiB. After the first call to SetScavengeRetain with a non-negative
+// target, GODEBUG no longer affects the target. A negative input does
+// not adjust the target, and allows for retrieval of the current one.
+func SetScavengeRetain(bytes int64) int64 {
+	return setScavengeRetain(bytes)
+}
@@ -224,6 +224,42 @@ func abs64(a int64) int64 {
 	return a
 }
 
+func TestSetScavengePolicy(t *testing.T) {
+	old := SetScavengePolicy("release")
+	defer SetScavengePolicy(old)
+	if got := SetScavengePolicy(""); got != "release" {
+		t.Errorf("SetScavengePolicy(\"release\"); SetScavengePolicy(\"\") = %q, want \"release\"", got)
+	}
+	if got := SetScavengePolicy("retain"); got != "release" {
+		t.Errorf("SetScavengePolicy(\"retain\") = %q, want \"release\"", got)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("SetScavengePolicy(\"bogus\") did not panic")
+			}
+		}()
+		SetScavengePolicy("bogus")
+	}()
+	if got := SetScavengePolicy(""); got != "retain" {
+		t.Errorf("policy after failed SetScavengePolicy is %q, want \"retain\"", got)
+	}
+}
+
+func TestSetScavengeRetain(t *testing.T) {
+	old := SetScavengeRetain(64 << 20)
+	defer SetScavengeRetain(old)
+	if got := SetScavengeRetain(-1); got != 64<<20 {
+		t.Errorf("SetScavengeRetain(64 MiB); SetScavengeRetain(-1) = %d, want %d", got, 64<<20)
+	}
+	if got := SetScavengeRetain(0); got != 64<<20 {
+		t.Errorf("SetScavengeRetain(0) = %d, want %d", got, 64<<20)
+	}
+	if got := SetScavengeRetain(-1); got != 0 {
+		t.Errorf("SetScavengeRetain(0); SetScavengeRetain(-1) = %d, want 0", got)
+	}
+}
+
 func TestSetMaxThreadsOvf(t *testing.T) {
 	// Verify that a big threads count will not overflow the int32
 	// maxmcount variable, causing a panic (see Issue 16076).
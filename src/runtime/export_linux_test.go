@@ -15,3 +15,13 @@ var Add = add
 
 type Siginfo siginfo
 type Sigevent sigevent
+
+// CgroupLimits returns the CPU and memory limits of the cgroups of the
+// process in the file system under root.
+func CgroupLimits(root string) (quota, period int64, cpuOK bool, mem int64, memOK bool) {
+	cg := new(cgroupState)
+	cg.init(root)
+	quota, period, cpuOK = cg.cpuLimit()
+	mem, memOK = cg.memLimit()
+	return
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build goexperiment.swissmap
+
+package runtime
+
+import "unsafe"
+
+func MapTombstoneCheck(m map[int]int) {
+	// Make sure the full and deleted slots agree with count and
+	// ndeleted, that the table is not overloaded, and that every
+	// key can still be found from its probe sequence.
+	h := *(**hmap)(unsafe.Pointer(&m))
+	i := any(m)
+	t := *(**maptype)(unsafe.Pointer(&i))
+
+	full, deleted := 0, uintptr(0)
+	for x := uintptr(0); x < bucketShift(h.B); x++ {
+		b := group(t, h.buckets, x)
+		for i := uintptr(0); i < bucketCnt; i++ {
+			switch c := b.tophash[i]; {
+			case isFull(c):
+				full++
+				k := b.key(t, i)
+				if rk, _ := mapaccessK(t, h, k); rk != k {
+					panic("full slot not reachable from its probe sequence")
+				}
+			case c == ctrlDeleted:
+				deleted++
+			case c != ctrlEmpty:
+				panic("bad control byte")
+			}
+		}
+	}
+	if full != h.count {
+		panic("full slots do not match count")
+	}
+	if deleted != h.ndeleted {
+		panic("deleted slots do not match ndeleted")
+	}
+	if uintptr(h.count)+h.ndeleted > maxLoad(h.B) {
+		panic("table over max load")
+	}
+}
+
+// MapTableStats returns the log_2 of the number of groups of m and the
+// number of full and deleted slots in them.
+func MapTableStats(m map[int]int) (B uint8, full int, deleted uintptr) {
+	h := *(**hmap)(unsafe.Pointer(&m))
+	return h.B, h.count, h.ndeleted
+}
+
+// CtrlMatch returns the slots of a group with control bytes ctrl that
+// matchTop(top), matchEmpty, matchEmptyOrDeleted and matchFull report,
+// as masks with bit i set for slot i.
+func CtrlMatch(ctrl [bucketCnt]uint8, top uint8) (match, empty, emptyOrDeleted, full uint8) {
+	var b bmap
+	b.tophash = ctrl
+	g := b.ctrl()
+	return g.matchTop(top).slots(), g.matchEmpty().slots(), g.matchEmptyOrDeleted().slots(), g.matchFull().slots()
+}
+
+func (b bitset) slots() uint8 {
+	var s uint8
+	for ; b != 0; b = b.removeFirst() {
+		s |= 1 << b.first()
+	}
+	return s
+}
+
+const (
+	CtrlEmpty   = ctrlEmpty
+	CtrlDeleted = ctrlDeleted
+	CtrlFull    = ctrlFull
+)
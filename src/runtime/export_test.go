@@ -34,6 +34,7 @@ var Fastlog2 = fastlog2
 var Atoi = atoi
 var Atoi32 = atoi32
 var ParseByteCount = parseByteCount
+var LimitGOMAXPROCS = limitGOMAXPROCS
 
 var Nanotime = nanotime
 var NetpollBreak = netpollBreak
@@ -690,42 +691,6 @@ func stackOverflow(x *byte) {
 	stackOverflow(&buf[0])
 }
 
-func MapTombstoneCheck(m map[int]int) {
-	// Make sure emptyOne and emptyRest are distributed correctly.
-	// We should have a series of filled and emptyOne cells, followed by
-	// a series of emptyRest cells.
-	h := *(**hmap)(unsafe.Pointer(&m))
-	i := any(m)
-	t := *(**maptype)(unsafe.Pointer(&i))
-
-	for x := 0; x < 1<<h.B; x++ {
-		b0 := (*bmap)(add(h.buckets, uintptr(x)*uintptr(t.BucketSize)))
-		n := 0
-		for b := b0; b != nil; b = b.overflow(t) {
-			for i := 0; i < bucketCnt; i++ {
-				if b.tophash[i] != emptyRest {
-					n++
-				}
-			}
-		}
-		k := 0
-		for b := b0; b != nil; b = b.overflow(t) {
-			for i := 0; i < bucketCnt; i++ {
-				if k < n && b.tophash[i] == emptyRest {
-					panic("early emptyRest")
-				}
-				if k >= n && b.tophash[i] != emptyRest {
-					panic("late non-emptyRest")
-				}
-				if k == n-1 && b.tophash[i] == emptyOne {
-					panic("last non-emptyRest entry is emptyOne")
-				}
-				k++
-			}
-		}
-	}
-}
-
 func RunGetgThreadSwitchTest() {
 	// Test that getg works correctly with thread switch.
 	// With gccgo, if we generate getg inlined, the backend
@@ -955,7 +920,7 @@ func (p *PageAlloc) Bounds() (ChunkIdx, ChunkIdx) {
 func (p *PageAlloc) Scavenge(nbytes uintptr) (r uintptr) {
 	pp := (*pageAlloc)(p)
 	systemstack(func() {
-		r = pp.scavenge(nbytes, nil, true)
+		r = pp.scavenge(nbytes, nil, true, false)
 	})
 	return
 }
@@ -1533,14 +1498,8 @@ func (c *GCController) SetMaxIdleMarkWorkers(max int32) {
 	c.setMaxIdleMarkWorkers(max)
 }
 
-var alwaysFalse bool
-var escapeSink any
-
 func Escape[T any](x T) T {
-	if alwaysFalse {
-		escapeSink = x
-	}
-	return x
+	return escape(x)
 }
 
 // Acquirem blocks preemption.
@@ -1757,12 +1716,13 @@ func NewScavengeIndex(min, max ChunkIdx) *ScavengeIndex {
 	s.i.min.Store(uintptr(min))
 	s.i.max.Store(uintptr(max))
 	s.i.minHeapIdx.Store(uintptr(min))
+	s.i.hugePageChunks.Store(uintptr(max - min))
 	s.i.test = true
 	return s
 }
 
-func (s *ScavengeIndex) Find(force bool) (ChunkIdx, uint) {
-	ci, off := s.i.find(force)
+func (s *ScavengeIndex) Find(force, forLimit bool) (ChunkIdx, uint) {
+	ci, off := s.i.find(force, forLimit)
 	return ChunkIdx(ci), off
 }
 
@@ -1823,6 +1783,23 @@ func (s *ScavengeIndex) SetNoHugePage(ci ChunkIdx) bool {
 	return s.i.setNoHugePage(chunkIdx(ci))
 }
 
+func (s *ScavengeIndex) HugePageChunks() uintptr {
+	return s.i.hugePageChunks.Load()
+}
+
+// SetScavengePolicy sets the scavenging policy as if by
+// GODEBUG=scavengepolicy=name and returns the previous policy's name.
+func SetScavengePolicy(name string) string {
+	old := scavengePolicyNames[debug.scavengepolicy.Load()]
+	for i, n := range scavengePolicyNames {
+		if n == name {
+			debug.scavengepolicy.Store(int32(i))
+			return old
+		}
+	}
+	panic("unknown scavenging policy " + name)
+}
+
 func CheckPackScavChunkData(gen uint32, inUse, lastInUse uint16, flags uint8) bool {
 	sc0 := scavChunkData{
 		gen:            gen,
@@ -1932,3 +1909,7 @@ func SetPinnerLeakPanic(f func()) {
 func GetPinnerLeakPanic() func() {
 	return pinnerLeakPanic
 }
+
+func UsageEnabled() bool {
+	return usageEnabled.Load()
+}
@@ -29,7 +29,8 @@ The supported suffixes include B, KiB, MiB, GiB, and TiB. These suffixes
 represent quantities of bytes as defined by the IEC 80000-13 standard. That is,
 they are based on powers of two: KiB means 2^10 bytes, MiB means 2^20 bytes,
 and so on. The default setting is math.MaxInt64, which effectively disables the
-memory limit. [runtime/debug.SetMemoryLimit] allows changing this limit at run
+memory limit, unless GODEBUG=containermemlimit=1 derives it from the memory limit
+of the container on Linux. [runtime/debug.SetMemoryLimit] allows changing this limit at run
 time.
 
 The GODEBUG variable controls debugging variables within the runtime.
@@ -55,6 +56,20 @@ It is a comma-separated list of name=val pairs setting these named variables:
 	cgocheck mode can be enabled using GOEXPERIMENT (which
 	requires a rebuild), see https://pkg.go.dev/internal/goexperiment for details.
 
+	containermaxprocs: on Linux, the default GOMAXPROCS is capped by the CPU
+	limit of the cgroup of the process, as in a container (cpu.max in cgroup v2,
+	cpu.cfs_quota_us and cpu.cfs_period_us in cgroup v1). The limit is rounded up
+	to a whole number of CPUs, and is at least 2. Setting containermaxprocs=0
+	makes the default GOMAXPROCS the number of CPUs, as runtime.NumCPU reports.
+
+	containermemlimit: on Linux, setting containermemlimit=1 makes the default
+	memory limit, when GOMEMLIMIT is not set, 90% of the memory limit of the
+	cgroup of the process (memory.max in cgroup v2, memory.limit_in_bytes in
+	cgroup v1). The rest of the cgroup limit is left for memory that the Go
+	runtime does not account for. The runtime checks the cgroup limit once per
+	second and updates the memory limit when it changes, until the program calls
+	runtime/debug.SetMemoryLimit.
+
 	dontfreezetheworld: by default, the start of a fatal panic or throw
 	"freezes the world", preempting all threads to stop all running
 	goroutines, which makes it possible to traceback all goroutines, and
@@ -113,6 +128,15 @@ It is a comma-separated list of name=val pairs setting these named variables:
 	but is helpful in debugging scavenger-related issues on other platforms. Currently,
 	only supported on Linux.
 
+	heapdumptypes: setting heapdumptypes=1 causes the allocator to record the
+	type of every heap object it allocates, so that runtime/debug.WriteHeapDump
+	can include it in the dump. It must be set when the program starts to cover
+	all objects. This setting is for debugging only, and is expensive: every
+	allocation takes the allocator's debugging path to store its type, the
+	first allocation from each span takes the global heap lock, and the types
+	take up to two words of memory per object slot of each span allocated from.
+	Allocation-heavy programs should expect to run noticeably slower.
+
 	inittrace: setting inittrace=1 causes the runtime to emit a single line to standard
 	error for each package with init work, summarizing the execution time and memory
 	allocation. No information is printed for inits executed as part of plugin loading
@@ -134,6 +158,13 @@ It is a comma-separated list of name=val pairs setting these named variables:
 	of MADV_FREE. This is less efficient, but causes RSS numbers to drop
 	more quickly.
 
+	memproflifetimes: setting memproflifetimes=1 causes the memory profiler to record,
+	for each sampled allocation, the garbage collection cycle in which it was
+	allocated, and to keep a histogram per allocation site of the number of
+	garbage collection cycles that freed objects lived for. The runtime/pprof
+	heap profile reports the histogram with a "lifetime" label. This costs
+	256 bytes of memory per allocation site in the profile.
+
 	memprofilerate: setting memprofilerate=X will update the value of runtime.MemProfileRate.
 	When set to 0 memory profiling is disabled.  Refer to the description of
 	MemProfileRate for the default value.
@@ -145,6 +176,16 @@ It is a comma-separated list of name=val pairs setting these named variables:
 	risk in that scenario. Currently not supported on Windows, plan9 or js/wasm. Setting this
 	option for some applications can produce large traces, so use with care.
 
+	partialdeadlock: setting partialdeadlock=1 makes every garbage collection look
+	for goroutines that are blocked forever on a channel, sync.Mutex, sync.RWMutex
+	or sync.WaitGroup that no goroutine that can still run refers to, as the
+	goroutineleak profile in runtime/pprof does. When a collection finds such
+	goroutines, it prints a message and the traceback of each of them to standard
+	error, and the program keeps running. Each goroutine is reported once. The
+	number of goroutines found so far is available as the
+	/sched/goroutines/deadlocked:goroutines metric. This makes stop-the-world
+	pauses longer, since the stacks of blocked goroutines are scanned during them.
+
 	invalidptr: invalidptr=1 (the default) causes the garbage collector and stack
 	copier to crash the program if an invalid pointer value (for example, 1)
 	is found in a pointer-typed location. Setting invalidptr=0 disables this check.
@@ -155,6 +196,28 @@ It is a comma-separated list of name=val pairs setting these named variables:
 	with a trivial allocator that obtains memory from the operating system and
 	never reclaims any memory.
 
+	scavengepolicy: setting scavengepolicy=name picks how eagerly the runtime returns
+	free heap memory to the operating system. The default policy, "default", keeps
+	enough memory to grow the heap to the next heap goal, plus 10%, and avoids
+	returning memory from densely used parts of the heap. "release" keeps only the
+	memory that was in use at the end of the last garbage collection and ignores
+	density, trading CPU time and page faults for a smaller footprint, which suits
+	batch jobs. "retain" keeps all free memory, which suits latency-sensitive
+	services. "hugepage" keeps as much memory as "default", but only returns memory
+	from regions of the heap that are entirely free, so that transparent huge pages
+	in use are never broken up.
+	None of the policies affect returning memory to stay under the memory limit
+	(see GOMEMLIMIT) or in runtime/debug.FreeOSMemory. The policy may be changed
+	while the program runs by updating GODEBUG with os.Setenv; it takes effect
+	no later than the next garbage collection. runtime/debug.SetScavengePolicy
+	also changes it, and overrides this setting from then on.
+
+	scavengeretain: setting scavengeretain=N makes the runtime return free heap memory
+	to the operating system whenever the heap retains more than N MiB, and not
+	otherwise, in place of the goal chosen by scavengepolicy. The memory limit
+	still applies. Like scavengepolicy, it may be changed while the program runs,
+	and runtime/debug.SetScavengeRetain overrides it.
+
 	scavtrace: setting scavtrace=1 causes the runtime to emit a single line to standard
 	error, roughly once per GC cycle, summarizing the amount of work done by the
 	scavenger as well as the total amount of memory returned to the operating system
@@ -183,11 +246,41 @@ It is a comma-separated list of name=val pairs setting these named variables:
 	IDs will refer to the ID of the goroutine at the time of creation; it's possible for this
 	ID to be reused for another goroutine. Setting N to 0 will report no ancestry information.
 
+	tracebackcreators: setting tracebackcreators=N extends tracebacks with the go
+	statements that created the ancestors of each goroutine, where N limits the number
+	of ancestor goroutines to report. Unlike tracebackancestors, it does not record the
+	stacks of the ancestors, so it is cheap enough to leave on in production. If
+	tracebackancestors is also set, it takes precedence.
+
+	tracebackjson: setting tracebackjson=1 makes an unrecovered panic or fatal error
+	print a single line of JSON to standard error, in place of the text that
+	describes the fatal error, the panic values, the signal, and the goroutine
+	stack traces. GOTRACEBACK still controls which goroutines and frames are
+	included. The format is described below, after GOTRACEBACK.
+	Crashes in non-Go code and other diagnostic output, such as the output of
+	GOTRACEBACK=crash, are still printed as text.
+
+	tracebacklabels: setting tracebacklabels=1 makes tracebacks, including those
+	printed by runtime.Stack and the debug=2 goroutine profile, print the profiler
+	labels of each goroutine that has any, set with runtime/pprof.SetGoroutineLabels
+	or runtime/pprof.Do, on the line after the goroutine's header.
+
 	tracefpunwindoff: setting tracefpunwindoff=1 forces the execution tracer to
 	use the runtime's default stack unwinder instead of frame pointer unwinding.
 	This increases tracer overhead, but could be helpful as a workaround or for
 	debugging unexpected regressions caused by frame pointer unwinding.
 
+	traceadvanceperiod: setting traceadvanceperiod=X makes the execution tracer
+	start a new generation of the trace approximately every X nanoseconds
+	(default 1 second). Each generation of a trace can be read on its own.
+	Setting traceadvanceperiod=0 writes each trace as a single generation,
+	unless a runtime/trace.FlightRecorder starts new ones.
+
+	updatemaxprocs: with the default GOMAXPROCS, the runtime checks the CPU limit
+	of the cgroup of the process once per second and updates GOMAXPROCS when it
+	changes, until the program calls runtime.GOMAXPROCS with a positive argument.
+	Setting updatemaxprocs=0 disables these updates.
+
 	asyncpreemptoff: asyncpreemptoff=1 disables signal-based
 	asynchronous goroutine preemption. This makes some loops
 	non-preemptible for long periods, which may delay GC and
@@ -202,7 +295,9 @@ The GOMAXPROCS variable limits the number of operating system threads that
 can execute user-level Go code simultaneously. There is no limit to the number of threads
 that can be blocked in system calls on behalf of Go code; those do not count against
 the GOMAXPROCS limit. This package's GOMAXPROCS function queries and changes
-the limit.
+the limit. If the GOMAXPROCS variable is not set, the limit defaults to the number
+of CPUs, capped by the CPU limit of the container on Linux; see containermaxprocs
+and updatemaxprocs above.
 
 The GORACE variable configures the race detector, for programs built using -race.
 See https://golang.org/doc/articles/race_detector.html for details.
@@ -224,11 +319,73 @@ SIGABRT to trigger a core dump.
 GOTRACEBACK=wer is like “crash” but doesn't disable Windows Error Reporting (WER).
 For historical reasons, the GOTRACEBACK settings 0, 1, and 2 are synonyms for
 none, all, and system, respectively.
+Setting GODEBUG=tracebackjson=1 prints the same information as JSON
+instead of text; see the tracebackjson setting above.
 The runtime/debug package's SetTraceback function allows increasing the
 amount of output at run time, but it cannot reduce the amount below that
 specified by the environment variable.
 See https://golang.org/pkg/runtime/debug/#SetTraceback.
 
+The JSON report printed with GODEBUG=tracebackjson=1 is a single line
+holding one JSON object. Fields that are empty, false, or zero are
+omitted, except for those marked "always". Numbers are JSON numbers,
+including addresses and program counters. The report object has
+these fields:
+
+	fatalError    the fatal error message, such as
+	              "all goroutines are asleep - deadlock!"
+	panics        the panics in progress, oldest first, as objects with
+	              fields value (the panic value, printed as by print,
+	              using the Error or String method if it has one) and
+	              recovered
+	signal        the signal that caused the crash, as an object with
+	              fields name, number, code, addr and pc (always)
+	runtimeStack  the stack of the runtime's system stack, if the crash
+	              happened on it
+	goroutines    the goroutines, starting with the one that crashed
+
+A stack is an object with these fields:
+
+	frames        the frames, innermost first (always)
+	elidedFrames  the number of frames left out of the middle of a very
+	              deep stack
+
+A frame is a logical frame, that is, a call that may be inlined into its
+caller, with these fields:
+
+	func          the function name, as printed in text tracebacks, or
+	              "" for non-Go code (always)
+	file, line    the position of the call (always)
+	pc            the program counter, the return address for all but
+	              the innermost frame (always)
+	offset        the offset of pc from the entry of the function
+	inlined       whether the call was inlined into the caller
+	cgo           whether this is a frame of non-Go code
+
+A goroutine is a stack with these additional fields:
+
+	id                the goroutine ID (always)
+	status            the status, such as "running", "runnable",
+	                  "waiting", or "syscall" (always)
+	waitReason        why a waiting goroutine waits, such as "chan receive"
+	waitTime          about how long a waiting goroutine has waited, in
+	                  nanoseconds, counted from the end of the garbage
+	                  collection before the first one that found it
+	                  waiting; unknown until such a collection ran
+	lockedToThread    whether the goroutine is locked to its thread
+	labels            the profiler labels, as an object of strings
+	stackUnavailable  whether the stack is missing because the goroutine
+	                  was running on another thread
+	createdBy         the frame of the go statement that created it
+	creatorID         the ID of the goroutine that created it
+	ancestors         the goroutines that created it, nearest first, with
+	                  GODEBUG=tracebackancestors=N or tracebackcreators=N;
+	                  each has fields id, frames, framesTruncated and
+	                  createdBy
+
+New fields may be added. The internal/traceback package describes the
+format in more detail.
+
 The GOARCH, GOOS, GOPATH, and GOROOT environment variables complete
 the set of Go environment variables. They influence the building of Go programs
 (see https://golang.org/cmd/go and https://golang.org/pkg/go/build).
@@ -916,6 +916,14 @@ func TestMemoryLimit(t *testing.T) {
 	}
 }
 
+func TestScavengePolicyRetain(t *testing.T) {
+	got := runTestProg(t, "testprog", "GCScavengeRetain", "GODEBUG=scavengepolicy=retain")
+	want := "OK\n"
+	if got != want {
+		t.Fatalf("expected %q, but got %q", want, got)
+	}
+}
+
 func TestMemoryLimitNoGCPercent(t *testing.T) {
 	if testing.Short() {
 		t.Skip("stress test that takes time to run")
@@ -6,14 +6,15 @@
 // objects in the heap plus additional info (roots, threads,
 // finalizers, etc.) to a file.
 
-// The format of the dumped file is described at
-// https://golang.org/s/go15heapdump.
+// The format of the dumped file is described in the documentation
+// of package cmd/internal/heapdump, which reads it.
 
 package runtime
 
 import (
 	"internal/abi"
 	"internal/goarch"
+	"runtime/internal/sys"
 	"unsafe"
 )
 
@@ -208,10 +209,12 @@ func dumptype(t *_type) {
 	dumpbool(t.Kind_&kindDirectIface == 0 || t.PtrBytes != 0)
 }
 
-// dump an object.
-func dumpobj(obj unsafe.Pointer, size uintptr, bv bitvector) {
+// dump an object. typ is the object's type, or nil if unknown.
+func dumpobj(obj unsafe.Pointer, size uintptr, typ *_type, bv bitvector) {
+	dumptype(typ)
 	dumpint(tagObject)
 	dumpint(uint64(uintptr(obj)))
+	dumpint(uint64(uintptr(unsafe.Pointer(typ))))
 	dumpmemrange(obj, size)
 	dumpfields(bv)
 }
@@ -499,7 +502,11 @@ func dumpobjs() {
 				freemark[j] = false
 				continue
 			}
-			dumpobj(unsafe.Pointer(p), size, makeheapobjbv(p, size))
+			var typ *_type
+			if s.heapdumpTypes != nil {
+				typ = (*_type)(unsafe.Pointer(s.heapdumpTypes.types[j]))
+			}
+			dumpobj(unsafe.Pointer(p), size, typ, makeheapobjbv(p, size))
 		}
 	}
 }
@@ -666,7 +673,7 @@ func dumpmemprof() {
 	}
 }
 
-var dumphdr = []byte("go1.7 heap dump\n")
+var dumphdr = []byte("go1.22 heap dump\n")
 
 func mdump(m *MemStats) {
 	assertWorldStopped()
@@ -713,6 +720,73 @@ func writeheapdump_m(fd uintptr, m *MemStats) {
 	casgstatus(gp.m.curg, _Gwaiting, _Grunning)
 }
 
+// Object types for heap dumps.
+//
+// The heap bitmap only records which words of an object hold pointers,
+// so the runtime does not otherwise know the type of a heap object.
+// When GODEBUG=heapdumptypes=1 is set, mallocgc records the type of
+// each allocation in a table hanging off its span, and dumpobjs
+// reports it in the object's record. Objects allocated before the
+// setting took effect, tiny allocations (which may combine several
+// objects), and untyped allocations such as string data are reported
+// without a type.
+//
+// This is deliberately a debugging mode, and a slow one. Setting
+// heapdumptypes sets debug.malloc, so every allocation takes the
+// debugging path in mallocgc and stores into the type table, and the
+// first allocation from each span allocates the table under the heap
+// lock. The tables are rounded up to a power of two entries, so they
+// cost up to two words per object slot of each span allocated from.
+// Spans do not otherwise know the types of their objects, so the
+// types cannot be recovered from span metadata at dump time.
+
+// heapdumpTypeClasses is the number of sizes of mspan.heapdumpTypes
+// tables. A table of class i has 1<<i entries, so the largest holds
+// maxObjsPerSpan entries.
+const heapdumpTypeClasses = 11
+
+// heapdumpTypeTable is an mspan.heapdumpTypes table. Only the first
+// span.nelems entries are allocated.
+//
+// The types are stored as uintptrs because the table is not in the
+// heap. This is safe because types are never freed: they are either
+// in a module's read-only data or cached forever by package reflect.
+type heapdumpTypeTable struct {
+	_     sys.NotInHeap
+	types [maxObjsPerSpan]uintptr
+}
+
+// heapdumpTypeClass returns the class of the smallest type table
+// that holds nelems entries.
+func heapdumpTypeClass(nelems uintptr) int {
+	c := 0
+	for uintptr(1)<<c < nelems {
+		c++
+	}
+	if c >= heapdumpTypeClasses {
+		throw("heapdump: too many objects in span")
+	}
+	return c
+}
+
+// heapdumpRecordType records typ as the type of the object at x in
+// span s, allocating the span's type table if needed. typ may be nil
+// if the type is unknown.
+//
+// The caller must own s, either because s is cached in the current
+// mcache or because s holds a single large object being allocated,
+// so that no one else is recording types in s concurrently.
+func heapdumpRecordType(s *mspan, x unsafe.Pointer, typ *_type) {
+	if s.heapdumpTypes == nil {
+		systemstack(func() {
+			lock(&mheap_.lock)
+			s.heapdumpTypes = (*heapdumpTypeTable)(mheap_.heapdumpTypesAlloc[heapdumpTypeClass(s.nelems)].alloc())
+			unlock(&mheap_.lock)
+		})
+	}
+	s.heapdumpTypes.types[s.objIndex(uintptr(x))] = uintptr(unsafe.Pointer(typ))
+}
+
 // dumpint() the kind & offset of each field in an object.
 func dumpfields(bv bitvector) {
 	dumpbv(&bv, 0)
@@ -188,3 +188,38 @@ func timeHistogramMetricsBuckets() []float64 {
 	b[len(b)-1] = float64Inf()
 	return b
 }
+
+// lenHistNumBuckets is the number of buckets of a lenHistogram.
+const lenHistNumBuckets = 18
+
+// lenHistogram represents a distribution of small counts, such as
+// queue lengths, in power-of-2 sized buckets: [0, 1), [1, 2), [2, 4),
+// [4, 8) and so on. The last bucket holds all the counts of at least
+// 1<<(lenHistNumBuckets-2).
+//
+// The histogram is safe for concurrent reads and writes.
+type lenHistogram struct {
+	counts [lenHistNumBuckets]atomic.Uint64
+}
+
+// record adds the given count to the distribution.
+//
+//go:nosplit
+func (h *lenHistogram) record(n uint64) {
+	bucket := sys.Len64(n)
+	if bucket >= lenHistNumBuckets {
+		bucket = lenHistNumBuckets - 1
+	}
+	h.counts[bucket].Add(1)
+}
+
+// lenHistogramMetricsBuckets generates a slice of boundaries for
+// the lenHistogram.
+func lenHistogramMetricsBuckets() []float64 {
+	b := make([]float64, lenHistNumBuckets+1)
+	for i := 1; i < lenHistNumBuckets; i++ {
+		b[i] = float64(uint64(1) << (i - 1))
+	}
+	b[len(b)-1] = float64Inf()
+	return b
+}
@@ -999,6 +999,12 @@ func mallocgc(size uintptr, typ *_type, needzero bool) unsafe.Pointer {
 	// GC is not currently active.
 	assistG := deductAssistCredit(size)
 
+	// Charge the allocation to the goroutine, see ReadGoroutineUsage.
+	if gp := getg().m.curg; gp != nil && usageEnabled.Load() {
+		gp.usage.allocBytes += uint64(userSize)
+		gp.usage.allocObjects++
+	}
+
 	// Set mp.mallocing to keep from being preempted by GC.
 	mp := acquirem()
 	if mp.mallocing != 0 {
@@ -1198,6 +1204,15 @@ func mallocgc(size uintptr, typ *_type, needzero bool) unsafe.Pointer {
 		asanunpoison(x, userSize)
 	}
 
+	if debug.malloc && debug.heapdumptypes != 0 {
+		if span.spanclass == tinySpanClass {
+			// A tiny block may hold several objects of different types.
+			heapdumpRecordType(span, x, nil)
+		} else {
+			heapdumpRecordType(span, x, typ)
+		}
+	}
+
 	if rate := MemProfileRate; rate > 0 {
 		// Note cache c only valid while m acquired; see #47302
 		if rate != 1 && size < c.nextSample {
@@ -2,6 +2,8 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+//go:build !goexperiment.swissmap
+
 package runtime
 
 // This file contains the implementation of Go's map type.
@@ -1722,3 +1724,43 @@ func copyValues(t *maptype, h *hmap, b *bmap, s *slice, offset uint8) {
 		b = b.overflow(t)
 	}
 }
+
+// mapRangeNoWB calls f with the key and elem of each entry of h, a map
+// of type t, in no particular order. Unlike mapiterinit and
+// mapiternext, it has no write barriers and does not allocate, so it
+// can be used while crashing. h must not be written to concurrently.
+func mapRangeNoWB(t *maptype, h *hmap, f func(k, e unsafe.Pointer)) {
+	if h == nil || h.count == 0 {
+		return
+	}
+	scan := func(b *bmap) {
+		for ; b != nil; b = b.overflow(t) {
+			for i := uintptr(0); i < bucketCnt; i++ {
+				if b.tophash[i] < minTopHash {
+					continue
+				}
+				k := add(unsafe.Pointer(b), dataOffset+i*uintptr(t.KeySize))
+				if t.IndirectKey() {
+					k = *((*unsafe.Pointer)(k))
+				}
+				e := add(unsafe.Pointer(b), dataOffset+bucketCnt*uintptr(t.KeySize)+i*uintptr(t.ValueSize))
+				if t.IndirectElem() {
+					e = *((*unsafe.Pointer)(e))
+				}
+				f(k, e)
+			}
+		}
+	}
+	// Entries in old buckets that have not been evacuated yet are not
+	// in the new buckets, so each entry is seen once.
+	if h.oldbuckets != nil {
+		for i := uintptr(0); i < h.noldbuckets(); i++ {
+			if b := (*bmap)(add(h.oldbuckets, i*uintptr(t.BucketSize))); !evacuated(b) {
+				scan(b)
+			}
+		}
+	}
+	for i := uintptr(0); i < bucketShift(h.B); i++ {
+		scan((*bmap)(add(h.buckets, i*uintptr(t.BucketSize))))
+	}
+}
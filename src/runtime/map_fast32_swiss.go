@@ -0,0 +1,289 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build goexperiment.swissmap
+
+package runtime
+
+import (
+	"internal/abi"
+	"internal/goarch"
+	"unsafe"
+)
+
+func mapaccess1_fast32(t *maptype, h *hmap, key uint32) unsafe.Pointer {
+	if raceenabled && h != nil {
+		callerpc := getcallerpc()
+		racereadpc(unsafe.Pointer(h), callerpc, abi.FuncPCABIInternal(mapaccess1_fast32))
+	}
+	if h == nil || h.count == 0 {
+		return unsafe.Pointer(&zeroVal[0])
+	}
+	if h.flags&hashWriting != 0 {
+		fatal("concurrent map read and map write")
+	}
+	if h.B == 0 {
+		// One-group table. No need to hash.
+		b := (*bmap)(h.buckets)
+		for i, k := uintptr(0), b.keys(); i < bucketCnt; i, k = i+1, add(k, 4) {
+			if *(*uint32)(k) == key && isFull(b.tophash[i]) {
+				return add(unsafe.Pointer(b), dataOffset+bucketCnt*4+i*uintptr(t.ValueSize))
+			}
+		}
+		return unsafe.Pointer(&zeroVal[0])
+	}
+	hash := t.Hasher(noescape(unsafe.Pointer(&key)), uintptr(h.hash0))
+	top := tophash(hash)
+	for seq := makeProbeSeq(hash, bucketMask(h.B)); ; seq = seq.next() {
+		b := group(t, h.buckets, seq.offset)
+		g := b.ctrl()
+		for match := g.matchTop(top); match != 0; match = match.removeFirst() {
+			i := match.first()
+			if *(*uint32)(add(unsafe.Pointer(b), dataOffset+i*4)) == key {
+				return add(unsafe.Pointer(b), dataOffset+bucketCnt*4+i*uintptr(t.ValueSize))
+			}
+		}
+		if g.matchEmpty() != 0 || seq.last() {
+			return unsafe.Pointer(&zeroVal[0])
+		}
+	}
+}
+
+func mapaccess2_fast32(t *maptype, h *hmap, key uint32) (unsafe.Pointer, bool) {
+	if raceenabled && h != nil {
+		callerpc := getcallerpc()
+		racereadpc(unsafe.Pointer(h), callerpc, abi.FuncPCABIInternal(mapaccess2_fast32))
+	}
+	if h == nil || h.count == 0 {
+		return unsafe.Pointer(&zeroVal[0]), false
+	}
+	if h.flags&hashWriting != 0 {
+		fatal("concurrent map read and map write")
+	}
+	if h.B == 0 {
+		// One-group table. No need to hash.
+		b := (*bmap)(h.buckets)
+		for i, k := uintptr(0), b.keys(); i < bucketCnt; i, k = i+1, add(k, 4) {
+			if *(*uint32)(k) == key && isFull(b.tophash[i]) {
+				return add(unsafe.Pointer(b), dataOffset+bucketCnt*4+i*uintptr(t.ValueSize)), true
+			}
+		}
+		return unsafe.Pointer(&zeroVal[0]), false
+	}
+	hash := t.Hasher(noescape(unsafe.Pointer(&key)), uintptr(h.hash0))
+	top := tophash(hash)
+	for seq := makeProbeSeq(hash, bucketMask(h.B)); ; seq = seq.next() {
+		b := group(t, h.buckets, seq.offset)
+		g := b.ctrl()
+		for match := g.matchTop(top); match != 0; match = match.removeFirst() {
+			i := match.first()
+			if *(*uint32)(add(unsafe.Pointer(b), dataOffset+i*4)) == key {
+				return add(unsafe.Pointer(b), dataOffset+bucketCnt*4+i*uintptr(t.ValueSize)), true
+			}
+		}
+		if g.matchEmpty() != 0 || seq.last() {
+			return unsafe.Pointer(&zeroVal[0]), false
+		}
+	}
+}
+
+func mapassign_fast32(t *maptype, h *hmap, key uint32) unsafe.Pointer {
+	if h == nil {
+		panic(plainError("assignment to entry in nil map"))
+	}
+	if raceenabled {
+		callerpc := getcallerpc()
+		racewritepc(unsafe.Pointer(h), callerpc, abi.FuncPCABIInternal(mapassign_fast32))
+	}
+	if h.flags&hashWriting != 0 {
+		fatal("concurrent map writes")
+	}
+	hash := t.Hasher(noescape(unsafe.Pointer(&key)), uintptr(h.hash0))
+
+	// Set hashWriting after calling t.hasher for consistency with mapassign.
+	h.flags ^= hashWriting
+
+	if h.buckets == nil {
+		h.buckets = newobject(t.Bucket) // newarray(t.bucket, 1)
+	}
+	top := tophash(hash)
+
+	var insertb *bmap
+	var inserti uintptr
+	var insertk unsafe.Pointer
+
+again:
+	insertb = nil
+	for seq := makeProbeSeq(hash, bucketMask(h.B)); ; seq = seq.next() {
+		b := group(t, h.buckets, seq.offset)
+		g := b.ctrl()
+		for match := g.matchTop(top); match != 0; match = match.removeFirst() {
+			i := match.first()
+			if *(*uint32)(add(unsafe.Pointer(b), dataOffset+i*4)) != key {
+				continue
+			}
+			insertb = b
+			inserti = i
+			goto done
+		}
+		if insertb == nil {
+			if match := g.matchEmptyOrDeleted(); match != 0 {
+				insertb = b
+				inserti = match.first()
+			}
+		}
+		if g.matchEmpty() != 0 || seq.last() {
+			break
+		}
+	}
+
+	// Did not find mapping for key. Allocate new slot & add entry.
+
+	// If the table is out of free slots, rehash it and try again.
+	if h.needRehash(insertb, inserti) {
+		rehash(t, h)
+		goto again
+	}
+
+	insertk = add(unsafe.Pointer(insertb), dataOffset+inserti*4)
+	// store new key at insert position
+	*(*uint32)(insertk) = key
+	h.useSlot(insertb, inserti, top)
+
+done:
+	elem := add(unsafe.Pointer(insertb), dataOffset+bucketCnt*4+inserti*uintptr(t.ValueSize))
+	if h.flags&hashWriting == 0 {
+		fatal("concurrent map writes")
+	}
+	h.flags &^= hashWriting
+	return elem
+}
+
+func mapassign_fast32ptr(t *maptype, h *hmap, key unsafe.Pointer) unsafe.Pointer {
+	if h == nil {
+		panic(plainError("assignment to entry in nil map"))
+	}
+	if raceenabled {
+		callerpc := getcallerpc()
+		racewritepc(unsafe.Pointer(h), callerpc, abi.FuncPCABIInternal(mapassign_fast32))
+	}
+	if h.flags&hashWriting != 0 {
+		fatal("concurrent map writes")
+	}
+	hash := t.Hasher(noescape(unsafe.Pointer(&key)), uintptr(h.hash0))
+
+	// Set hashWriting after calling t.hasher for consistency with mapassign.
+	h.flags ^= hashWriting
+
+	if h.buckets == nil {
+		h.buckets = newobject(t.Bucket) // newarray(t.bucket, 1)
+	}
+	top := tophash(hash)
+
+	var insertb *bmap
+	var inserti uintptr
+	var insertk unsafe.Pointer
+
+again:
+	insertb = nil
+	for seq := makeProbeSeq(hash, bucketMask(h.B)); ; seq = seq.next() {
+		b := group(t, h.buckets, seq.offset)
+		g := b.ctrl()
+		for match := g.matchTop(top); match != 0; match = match.removeFirst() {
+			i := match.first()
+			if *(*unsafe.Pointer)(add(unsafe.Pointer(b), dataOffset+i*4)) != key {
+				continue
+			}
+			insertb = b
+			inserti = i
+			goto done
+		}
+		if insertb == nil {
+			if match := g.matchEmptyOrDeleted(); match != 0 {
+				insertb = b
+				inserti = match.first()
+			}
+		}
+		if g.matchEmpty() != 0 || seq.last() {
+			break
+		}
+	}
+
+	// Did not find mapping for key. Allocate new slot & add entry.
+
+	// If the table is out of free slots, rehash it and try again.
+	if h.needRehash(insertb, inserti) {
+		rehash(t, h)
+		goto again
+	}
+
+	insertk = add(unsafe.Pointer(insertb), dataOffset+inserti*4)
+	// store new key at insert position
+	*(*unsafe.Pointer)(insertk) = key
+	h.useSlot(insertb, inserti, top)
+
+done:
+	elem := add(unsafe.Pointer(insertb), dataOffset+bucketCnt*4+inserti*uintptr(t.ValueSize))
+	if h.flags&hashWriting == 0 {
+		fatal("concurrent map writes")
+	}
+	h.flags &^= hashWriting
+	return elem
+}
+
+func mapdelete_fast32(t *maptype, h *hmap, key uint32) {
+	if raceenabled && h != nil {
+		callerpc := getcallerpc()
+		racewritepc(unsafe.Pointer(h), callerpc, abi.FuncPCABIInternal(mapdelete_fast32))
+	}
+	if h == nil || h.count == 0 {
+		return
+	}
+	if h.flags&hashWriting != 0 {
+		fatal("concurrent map writes")
+	}
+
+	hash := t.Hasher(noescape(unsafe.Pointer(&key)), uintptr(h.hash0))
+
+	// Set hashWriting after calling t.hasher for consistency with mapdelete
+	h.flags ^= hashWriting
+
+	top := tophash(hash)
+search:
+	for seq := makeProbeSeq(hash, bucketMask(h.B)); ; seq = seq.next() {
+		b := group(t, h.buckets, seq.offset)
+		g := b.ctrl()
+		for match := g.matchTop(top); match != 0; match = match.removeFirst() {
+			i := match.first()
+			k := add(unsafe.Pointer(b), dataOffset+i*4)
+			if key != *(*uint32)(k) {
+				continue
+			}
+			// Only clear key if there are pointers in it.
+			// This can only happen if pointers are 32 bit
+			// wide as 64 bit pointers do not fit into a 32 bit key.
+			if goarch.PtrSize == 4 && t.Key.PtrBytes != 0 {
+				// The key must be a pointer as we checked pointers are
+				// 32 bits wide and the key is 32 bits wide also.
+				*(*unsafe.Pointer)(k) = nil
+			}
+			e := add(unsafe.Pointer(b), dataOffset+bucketCnt*4+i*uintptr(t.ValueSize))
+			if t.Elem.PtrBytes != 0 {
+				memclrHasPointers(e, t.Elem.Size_)
+			} else {
+				memclrNoHeapPointers(e, t.Elem.Size_)
+			}
+			h.deleteSlot(b, i)
+			break search
+		}
+		if g.matchEmpty() != 0 || seq.last() {
+			break
+		}
+	}
+
+	if h.flags&hashWriting == 0 {
+		fatal("concurrent map writes")
+	}
+	h.flags &^= hashWriting
+}
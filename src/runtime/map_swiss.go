@@ -0,0 +1,1199 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build goexperiment.swissmap
+
+package runtime
+
+// This file contains an open-addressing implementation of Go's map
+// type, in the style of Abseil's "Swiss tables". It is enabled with
+// GOEXPERIMENT=swissmap and replaces map.go, map_fast32.go,
+// map_fast64.go and map_faststr.go.
+//
+// The table is a power-of-two sized array of groups. Each group holds
+// 8 key/elem slots and 8 control bytes, one per slot. A control byte
+// is either empty, deleted (a tombstone), or full, in which case it
+// holds the top 7 bits of the hash of the key in the slot (the "H2"
+// bits). The low-order bits of the hash select the group a probe
+// sequence starts at.
+//
+// A lookup loads the 8 control bytes of a group as a single 64-bit
+// word and uses SWAR ("SIMD within a register") arithmetic to find
+// the slots whose H2 bits match the key's, comparing only those keys.
+// If the group has an empty slot the key cannot be further along the
+// probe sequence and the lookup stops; otherwise it moves on to the
+// next group along a triangular probe sequence, which visits every
+// group of a power-of-two sized table exactly once.
+//
+// Groups share the layout of the buckets used by map.go (and encoded
+// by the compiler in cmd/compile/internal/reflectdata/reflect.go):
+// 8 control bytes in place of tophash, followed by 8 keys, then 8
+// elems, then an overflow pointer, which is always nil here. Zeroed
+// memory is an empty group, so the stack-allocated first bucket the
+// compiler provides for small non-escaping maps works as is.
+//
+// There is no incremental growth. When an insert would take the
+// number of full and deleted slots above 7/8 of the table, the table
+// is rehashed into a newly allocated array, twice as large unless
+// deletes have left fewer than half of the slots full. The old array
+// is never written to again, so iterators keep walking their snapshot
+// of it and look keys up in the current table to observe updates and
+// deletes, as they do over old buckets in map.go.
+//
+// Compared with map.go there are no overflow buckets, so maps whose
+// keys and elems contain no pointers need no extra bookkeeping to keep
+// them alive, and the maximum load is 7/8 instead of 13/16.
+
+import (
+	"internal/abi"
+	"internal/goarch"
+	"runtime/internal/math"
+	"runtime/internal/sys"
+	"unsafe"
+)
+
+const (
+	// Number of slots in a group.
+	bucketCntBits = abi.MapBucketCountBits
+	bucketCnt     = abi.MapBucketCount
+
+	// Maximum average number of full and deleted slots in a group
+	// before the table is rehashed is bucketCnt*7/8.
+	// Represent as loadFactorNum/loadFactorDen, to allow integer math.
+	loadFactorDen = 8
+	loadFactorNum = bucketCnt * 7
+
+	// Maximum key or elem size to keep inline (instead of mallocing per element).
+	// Must fit in a uint8.
+	// Fast versions cannot handle big elems - the cutoff size for
+	// fast versions in cmd/compile/internal/gc/walk.go must be at most this elem.
+	maxKeySize  = abi.MapMaxKeyBytes
+	maxElemSize = abi.MapMaxElemBytes
+
+	// data offset should be the size of the bmap struct, but needs to be
+	// aligned correctly. For amd64p32 this means 64-bit alignment
+	// even though pointers are 32 bit.
+	dataOffset = unsafe.Offsetof(struct {
+		b bmap
+		v int64
+	}{}.v)
+
+	// Control byte values. Full slots have ctrlFull set and the H2
+	// bits of the hash in the low 7 bits. An all-zero group is empty.
+	ctrlEmpty   = 0x00 // this slot is empty
+	ctrlDeleted = 0x01 // this slot is empty, but was full when the probe sequence passed through
+	ctrlFull    = 0x80 // this slot holds a key/elem pair
+
+	// flags
+	hashWriting = 4 // a goroutine is writing to the map
+)
+
+// isFull reports whether the given control byte represents a full slot.
+func isFull(x uint8) bool {
+	return x&ctrlFull != 0
+}
+
+// A header for a Go map.
+type hmap struct {
+	// Note: the format of the hmap is also encoded in cmd/compile/internal/reflectdata/reflect.go.
+	// Make sure this stays in sync with the compiler's definition.
+	count int // # live cells == size of map.  Must be first (used by len() builtin)
+	flags uint8
+	B     uint8  // log_2 of # of groups (can hold up to loadFactor * 2^B items)
+	_     uint16 // noverflow in map.go; unused
+	hash0 uint32 // hash seed
+
+	buckets    unsafe.Pointer // array of 2^B groups. may be nil if count==0.
+	oldbuckets unsafe.Pointer // always nil; kept for the linker's and debuggers' view of hmap
+	ndeleted   uintptr        // # of deleted slots in buckets
+
+	extra unsafe.Pointer // always nil; kept for the compiler's view of hmap
+
+	clearseq uintptr // incremented by mapclear, so that iterators can tell the map was cleared
+}
+
+// A group of a Go map.
+type bmap struct {
+	// tophash holds the control byte of each slot in this group.
+	tophash [bucketCnt]uint8
+	// Followed by bucketCnt keys and then bucketCnt elems.
+	// NOTE: packing all the keys together and then all the elems together makes the
+	// code a bit more complicated than alternating key/elem/key/elem/... but it allows
+	// us to eliminate padding which would be needed for, e.g., map[int64]int8.
+	// Followed by an overflow pointer, which is always nil. It costs a
+	// pointer per group, but the compiler, reflect.MapOf and the linker's
+	// DWARF all lay out groups as map.go's buckets, and dropping it would
+	// need each of them to know which implementation is in use.
+}
+
+// A hash iteration structure.
+// If you modify hiter, also change cmd/compile/internal/reflectdata/reflect.go
+// and reflect/value.go to match the layout of this structure.
+type hiter struct {
+	key         unsafe.Pointer // Must be in first position.  Write nil to indicate iteration end (see cmd/compile/internal/walk/range.go).
+	elem        unsafe.Pointer // Must be in second position (see cmd/compile/internal/walk/range.go).
+	t           *maptype
+	h           *hmap
+	buckets     unsafe.Pointer // group array at hash_iter initialization time
+	bptr        *bmap          // current group
+	overflow    *[]*bmap       // unused
+	oldoverflow *[]*bmap       // unused
+	startBucket uintptr        // group iteration started at
+	offset      uint8          // intra-group offset to start from during iteration (should be big enough to hold bucketCnt-1)
+	wrapped     bool           // already wrapped around from end of group array to beginning
+	B           uint8
+	i           uint8
+	bucket      uintptr
+	clearseq    uintptr // h.clearseq at hash_iter initialization time
+}
+
+// bucketShift returns 1<<b, optimized for code generation.
+func bucketShift(b uint8) uintptr {
+	// Masking the shift amount allows overflow checks to be elided.
+	return uintptr(1) << (b & (goarch.PtrSize*8 - 1))
+}
+
+// bucketMask returns 1<<b - 1, optimized for code generation.
+func bucketMask(b uint8) uintptr {
+	return bucketShift(b) - 1
+}
+
+// maxLoad returns the number of full and deleted slots a table of
+// 1<<b groups may hold before it must be rehashed. A single group is
+// allowed to fill up completely, as there is nowhere else to probe.
+func maxLoad(b uint8) uintptr {
+	if b == 0 {
+		return bucketCnt
+	}
+	return bucketShift(b) * loadFactorNum / loadFactorDen
+}
+
+// overMaxLoad reports whether count items placed in 1<<B groups is over maxLoad.
+func overMaxLoad(count int, B uint8) bool {
+	return count > bucketCnt && uintptr(count) > maxLoad(B)
+}
+
+// tophash calculates the control byte of a full slot for hash.
+func tophash(hash uintptr) uint8 {
+	return uint8(hash>>(goarch.PtrSize*8-7)) | ctrlFull
+}
+
+// A ctrlGroup is the control bytes of a group loaded into a single
+// word, with the control byte of slot i in bits 8i through 8i+7.
+type ctrlGroup uint64
+
+// A bitset has the high bit of byte i set for each matching slot i.
+type bitset uint64
+
+const (
+	ctrlLSB = 0x0101010101010101
+	ctrlMSB = 0x8080808080808080
+)
+
+// ctrl loads the control bytes of b.
+func (b *bmap) ctrl() ctrlGroup {
+	c := &b.tophash
+	return ctrlGroup(uint64(c[0]) | uint64(c[1])<<8 | uint64(c[2])<<16 | uint64(c[3])<<24 |
+		uint64(c[4])<<32 | uint64(c[5])<<40 | uint64(c[6])<<48 | uint64(c[7])<<56)
+}
+
+// matchTop returns the slots whose control byte may be top.
+// It can report false positives, but only for full slots,
+// whose keys are compared anyway.
+func (g ctrlGroup) matchTop(top uint8) bitset {
+	v := uint64(g) ^ (ctrlLSB * uint64(top))
+	return bitset((v - ctrlLSB) &^ v & ctrlMSB)
+}
+
+// matchEmpty returns the empty slots.
+func (g ctrlGroup) matchEmpty() bitset {
+	// Only ctrlEmpty has both its high and its low bit clear.
+	v := uint64(g)
+	return bitset(^v &^ (v << 7) & ctrlMSB)
+}
+
+// matchFull returns the full slots.
+func (g ctrlGroup) matchFull() bitset {
+	return bitset(uint64(g) & ctrlMSB)
+}
+
+// matchEmptyOrDeleted returns the slots that are not full.
+func (g ctrlGroup) matchEmptyOrDeleted() bitset {
+	return bitset(^uint64(g) & ctrlMSB)
+}
+
+// first returns the index of the first slot in b. b must not be empty.
+func (b bitset) first() uintptr {
+	return uintptr(sys.TrailingZeros64(uint64(b))) >> 3
+}
+
+// removeFirst returns b without its first slot.
+func (b bitset) removeFirst() bitset {
+	return b & (b - 1)
+}
+
+// A probeSeq is the triangular probe sequence of group indexes
+// followed by lookups for a hash: hash, hash+1, hash+3, hash+6, ...
+// modulo the number of groups.
+type probeSeq struct {
+	mask   uintptr
+	offset uintptr
+	index  uintptr
+}
+
+func makeProbeSeq(hash, mask uintptr) probeSeq {
+	return probeSeq{mask: mask, offset: hash & mask}
+}
+
+func (s probeSeq) next() probeSeq {
+	s.index++
+	s.offset = (s.offset + s.index) & s.mask
+	return s
+}
+
+// last reports whether s is at the last group of its sequence, that is,
+// whether every group of the table has been visited.
+func (s probeSeq) last() bool {
+	return s.index == s.mask
+}
+
+// group returns the group at index i of the group array buckets.
+func group(t *maptype, buckets unsafe.Pointer, i uintptr) *bmap {
+	return (*bmap)(add(buckets, i*uintptr(t.BucketSize)))
+}
+
+func (b *bmap) keys() unsafe.Pointer {
+	return add(unsafe.Pointer(b), dataOffset)
+}
+
+func (b *bmap) key(t *maptype, i uintptr) unsafe.Pointer {
+	return add(unsafe.Pointer(b), dataOffset+i*uintptr(t.KeySize))
+}
+
+func (b *bmap) elem(t *maptype, i uintptr) unsafe.Pointer {
+	return add(unsafe.Pointer(b), dataOffset+bucketCnt*uintptr(t.KeySize)+i*uintptr(t.ValueSize))
+}
+
+// deleteSlot marks slot i of group b, whose key and elem have been
+// cleared, as no longer full. If the group has an empty slot no probe
+// sequence can have continued past it, so slot i can be made empty
+// too; otherwise it must become a tombstone.
+func (h *hmap) deleteSlot(b *bmap, i uintptr) {
+	if h.B == 0 || b.ctrl().matchEmpty() != 0 {
+		b.tophash[i&(bucketCnt-1)] = ctrlEmpty
+	} else {
+		b.tophash[i&(bucketCnt-1)] = ctrlDeleted
+		h.ndeleted++
+	}
+	h.count--
+	// Reset the hash seed to make it more difficult for attackers to
+	// repeatedly trigger hash collisions. See issue 25237.
+	if h.count == 0 {
+		h.hash0 = fastrand()
+	}
+}
+
+// needRehash reports whether inserting into slot i of group b,
+// found by a probe for a missing key, requires the table to be
+// rehashed first. b is nil if the probe found no free slot.
+func (h *hmap) needRehash(b *bmap, i uintptr) bool {
+	if b == nil {
+		return true
+	}
+	// Reusing a tombstone does not change the load.
+	return b.tophash[i&(bucketCnt-1)] == ctrlEmpty && uintptr(h.count)+h.ndeleted >= maxLoad(h.B)
+}
+
+// useSlot marks slot i of group b, found by a probe for a missing
+// key, as full with control byte top.
+func (h *hmap) useSlot(b *bmap, i uintptr, top uint8) {
+	if b.tophash[i&(bucketCnt-1)] == ctrlDeleted {
+		h.ndeleted--
+	}
+	b.tophash[i&(bucketCnt-1)] = top // mask i to avoid bounds checks
+	h.count++
+}
+
+func makemap64(t *maptype, hint int64, h *hmap) *hmap {
+	if int64(int(hint)) != hint {
+		hint = 0
+	}
+	return makemap(t, int(hint), h)
+}
+
+// makemap_small implements Go map creation for make(map[k]v) and
+// make(map[k]v, hint) when hint is known to be at most bucketCnt
+// at compile time and the map needs to be allocated on the heap.
+func makemap_small() *hmap {
+	h := new(hmap)
+	h.hash0 = fastrand()
+	return h
+}
+
+// makemap implements Go map creation for make(map[k]v, hint).
+// If the compiler has determined that the map or the first group
+// can be created on the stack, h and/or group may be non-nil.
+// If h != nil, the map can be created directly in h.
+// If h.buckets != nil, group pointed to can be used as the first group.
+func makemap(t *maptype, hint int, h *hmap) *hmap {
+	mem, overflow := math.MulUintptr(uintptr(hint), t.Bucket.Size_)
+	if overflow || mem > maxAlloc {
+		hint = 0
+	}
+
+	// initialize Hmap
+	if h == nil {
+		h = new(hmap)
+	}
+	h.hash0 = fastrand()
+
+	// Find the size parameter B which will hold the requested # of elements.
+	// For hint < 0 overMaxLoad returns false since hint < bucketCnt.
+	B := uint8(0)
+	for overMaxLoad(hint, B) {
+		B++
+	}
+	h.B = B
+
+	// allocate initial hash table
+	// if B == 0, the buckets field is allocated lazily later (in mapassign)
+	// If hint is large zeroing this memory could take a while.
+	if h.B != 0 {
+		h.buckets = newarray(t.Bucket, int(bucketShift(h.B)))
+	}
+
+	return h
+}
+
+// mapaccess1 returns a pointer to h[key].  Never returns nil, instead
+// it will return a reference to the zero object for the elem type if
+// the key is not in the map.
+// NOTE: The returned pointer may keep the whole map live, so don't
+// hold onto it for very long.
+func mapaccess1(t *maptype, h *hmap, key unsafe.Pointer) unsafe.Pointer {
+	if raceenabled && h != nil {
+		callerpc := getcallerpc()
+		pc := abi.FuncPCABIInternal(mapaccess1)
+		racereadpc(unsafe.Pointer(h), callerpc, pc)
+		raceReadObjectPC(t.Key, key, callerpc, pc)
+	}
+	if msanenabled && h != nil {
+		msanread(key, t.Key.Size_)
+	}
+	if asanenabled && h != nil {
+		asanread(key, t.Key.Size_)
+	}
+	if h == nil || h.count == 0 {
+		if t.HashMightPanic() {
+			t.Hasher(key, 0) // see issue 23734
+		}
+		return unsafe.Pointer(&zeroVal[0])
+	}
+	if h.flags&hashWriting != 0 {
+		fatal("concurrent map read and map write")
+	}
+	_, e := mapfind(t, h, key)
+	if e == nil {
+		return unsafe.Pointer(&zeroVal[0])
+	}
+	return e
+}
+
+func mapaccess2(t *maptype, h *hmap, key unsafe.Pointer) (unsafe.Pointer, bool) {
+	if raceenabled && h != nil {
+		callerpc := getcallerpc()
+		pc := abi.FuncPCABIInternal(mapaccess2)
+		racereadpc(unsafe.Pointer(h), callerpc, pc)
+		raceReadObjectPC(t.Key, key, callerpc, pc)
+	}
+	if msanenabled && h != nil {
+		msanread(key, t.Key.Size_)
+	}
+	if asanenabled && h != nil {
+		asanread(key, t.Key.Size_)
+	}
+	if h == nil || h.count == 0 {
+		if t.HashMightPanic() {
+			t.Hasher(key, 0) // see issue 23734
+		}
+		return unsafe.Pointer(&zeroVal[0]), false
+	}
+	if h.flags&hashWriting != 0 {
+		fatal("concurrent map read and map write")
+	}
+	_, e := mapfind(t, h, key)
+	if e == nil {
+		return unsafe.Pointer(&zeroVal[0]), false
+	}
+	return e, true
+}
+
+// returns both key and elem. Used by map iterator.
+func mapaccessK(t *maptype, h *hmap, key unsafe.Pointer) (unsafe.Pointer, unsafe.Pointer) {
+	if h == nil || h.count == 0 {
+		return nil, nil
+	}
+	return mapfind(t, h, key)
+}
+
+// mapfind returns pointers to the key and elem of the slot holding key,
+// or nil, nil if key is not in the non-empty map h.
+func mapfind(t *maptype, h *hmap, key unsafe.Pointer) (unsafe.Pointer, unsafe.Pointer) {
+	hash := t.Hasher(key, uintptr(h.hash0))
+	top := tophash(hash)
+	for seq := makeProbeSeq(hash, bucketMask(h.B)); ; seq = seq.next() {
+		b := group(t, h.buckets, seq.offset)
+		g := b.ctrl()
+		for match := g.matchTop(top); match != 0; match = match.removeFirst() {
+			i := match.first()
+			k := b.key(t, i)
+			if t.IndirectKey() {
+				k = *((*unsafe.Pointer)(k))
+			}
+			if t.Key.Equal(key, k) {
+				e := b.elem(t, i)
+				if t.IndirectElem() {
+					e = *((*unsafe.Pointer)(e))
+				}
+				return k, e
+			}
+		}
+		if g.matchEmpty() != 0 || seq.last() {
+			return nil, nil
+		}
+	}
+}
+
+func mapaccess1_fat(t *maptype, h *hmap, key, zero unsafe.Pointer) unsafe.Pointer {
+	e := mapaccess1(t, h, key)
+	if e == unsafe.Pointer(&zeroVal[0]) {
+		return zero
+	}
+	return e
+}
+
+func mapaccess2_fat(t *maptype, h *hmap, key, zero unsafe.Pointer) (unsafe.Pointer, bool) {
+	e := mapaccess1(t, h, key)
+	if e == unsafe.Pointer(&zeroVal[0]) {
+		return zero, false
+	}
+	return e, true
+}
+
+// Like mapaccess, but allocates a slot for the key if it is not present in the map.
+func mapassign(t *maptype, h *hmap, key unsafe.Pointer) unsafe.Pointer {
+	if h == nil {
+		panic(plainError("assignment to entry in nil map"))
+	}
+	if raceenabled {
+		callerpc := getcallerpc()
+		pc := abi.FuncPCABIInternal(mapassign)
+		racewritepc(unsafe.Pointer(h), callerpc, pc)
+		raceReadObjectPC(t.Key, key, callerpc, pc)
+	}
+	if msanenabled {
+		msanread(key, t.Key.Size_)
+	}
+	if asanenabled {
+		asanread(key, t.Key.Size_)
+	}
+	if h.flags&hashWriting != 0 {
+		fatal("concurrent map writes")
+	}
+	hash := t.Hasher(key, uintptr(h.hash0))
+
+	// Set hashWriting after calling t.hasher, since t.hasher may panic,
+	// in which case we have not actually done a write.
+	h.flags ^= hashWriting
+
+	if h.buckets == nil {
+		h.buckets = newobject(t.Bucket) // newarray(t.Bucket, 1)
+	}
+	top := tophash(hash)
+
+	var insertb *bmap
+	var inserti uintptr
+	var insertk unsafe.Pointer
+	var elem unsafe.Pointer
+again:
+	insertb = nil
+	for seq := makeProbeSeq(hash, bucketMask(h.B)); ; seq = seq.next() {
+		b := group(t, h.buckets, seq.offset)
+		g := b.ctrl()
+		for match := g.matchTop(top); match != 0; match = match.removeFirst() {
+			i := match.first()
+			k := b.key(t, i)
+			if t.IndirectKey() {
+				k = *((*unsafe.Pointer)(k))
+			}
+			if !t.Key.Equal(key, k) {
+				continue
+			}
+			// already have a mapping for key. Update it.
+			if t.NeedKeyUpdate() {
+				typedmemmove(t.Key, k, key)
+			}
+			elem = b.elem(t, i)
+			goto done
+		}
+		if insertb == nil {
+			if match := g.matchEmptyOrDeleted(); match != 0 {
+				insertb = b
+				inserti = match.first()
+			}
+		}
+		if g.matchEmpty() != 0 || seq.last() {
+			break
+		}
+	}
+
+	// Did not find mapping for key. Allocate new slot & add entry.
+
+	// If the table is out of free slots, rehash it and try again.
+	if h.needRehash(insertb, inserti) {
+		rehash(t, h)
+		goto again
+	}
+
+	// store new key/elem at insert position
+	insertk = insertb.key(t, inserti)
+	elem = insertb.elem(t, inserti)
+	if t.IndirectKey() {
+		kmem := newobject(t.Key)
+		*(*unsafe.Pointer)(insertk) = kmem
+		insertk = kmem
+	}
+	if t.IndirectElem() {
+		vmem := newobject(t.Elem)
+		*(*unsafe.Pointer)(elem) = vmem
+	}
+	typedmemmove(t.Key, insertk, key)
+	h.useSlot(insertb, inserti, top)
+
+done:
+	if h.flags&hashWriting == 0 {
+		fatal("concurrent map writes")
+	}
+	h.flags &^= hashWriting
+	if t.IndirectElem() {
+		elem = *((*unsafe.Pointer)(elem))
+	}
+	return elem
+}
+
+func mapdelete(t *maptype, h *hmap, key unsafe.Pointer) {
+	if raceenabled && h != nil {
+		callerpc := getcallerpc()
+		pc := abi.FuncPCABIInternal(mapdelete)
+		racewritepc(unsafe.Pointer(h), callerpc, pc)
+		raceReadObjectPC(t.Key, key, callerpc, pc)
+	}
+	if msanenabled && h != nil {
+		msanread(key, t.Key.Size_)
+	}
+	if asanenabled && h != nil {
+		asanread(key, t.Key.Size_)
+	}
+	if h == nil || h.count == 0 {
+		if t.HashMightPanic() {
+			t.Hasher(key, 0) // see issue 23734
+		}
+		return
+	}
+	if h.flags&hashWriting != 0 {
+		fatal("concurrent map writes")
+	}
+
+	hash := t.Hasher(key, uintptr(h.hash0))
+
+	// Set hashWriting after calling t.hasher, since t.hasher may panic,
+	// in which case we have not actually done a write (delete).
+	h.flags ^= hashWriting
+
+	top := tophash(hash)
+search:
+	for seq := makeProbeSeq(hash, bucketMask(h.B)); ; seq = seq.next() {
+		b := group(t, h.buckets, seq.offset)
+		g := b.ctrl()
+		for match := g.matchTop(top); match != 0; match = match.removeFirst() {
+			i := match.first()
+			k := b.key(t, i)
+			k2 := k
+			if t.IndirectKey() {
+				k2 = *((*unsafe.Pointer)(k2))
+			}
+			if !t.Key.Equal(key, k2) {
+				continue
+			}
+			// Only clear key if there are pointers in it.
+			if t.IndirectKey() {
+				*(*unsafe.Pointer)(k) = nil
+			} else if t.Key.PtrBytes != 0 {
+				memclrHasPointers(k, t.Key.Size_)
+			}
+			e := b.elem(t, i)
+			if t.IndirectElem() {
+				*(*unsafe.Pointer)(e) = nil
+			} else if t.Elem.PtrBytes != 0 {
+				memclrHasPointers(e, t.Elem.Size_)
+			} else {
+				memclrNoHeapPointers(e, t.Elem.Size_)
+			}
+			h.deleteSlot(b, i)
+			break search
+		}
+		if g.matchEmpty() != 0 || seq.last() {
+			break
+		}
+	}
+
+	if h.flags&hashWriting == 0 {
+		fatal("concurrent map writes")
+	}
+	h.flags &^= hashWriting
+}
+
+// rehash moves the contents of h into a newly allocated group array,
+// twice as large as the current one unless fewer than half of the
+// slots it may use are full, dropping all tombstones.
+// The old group array is left untouched for the benefit of iterators.
+func rehash(t *maptype, h *hmap) {
+	B := h.B
+	if uintptr(h.count) >= maxLoad(B)/2 {
+		B++
+	}
+	oldbuckets := h.buckets
+	newbuckets := newarray(t.Bucket, int(bucketShift(B)))
+	mask := bucketMask(B)
+
+	for x := uintptr(0); x < bucketShift(h.B); x++ {
+		b := group(t, oldbuckets, x)
+		for match := b.ctrl().matchFull(); match != 0; match = match.removeFirst() {
+			i := match.first()
+			k := b.key(t, i)
+			k2 := k
+			if t.IndirectKey() {
+				k2 = *((*unsafe.Pointer)(k2))
+			}
+			// If k != k (NaNs) the hash is not repeatable, but as
+			// such keys cannot be looked up any slot will do.
+			hash := t.Hasher(k2, uintptr(h.hash0))
+			var dst *bmap
+			var di uintptr
+			for seq := makeProbeSeq(hash, mask); ; seq = seq.next() {
+				dst = group(t, newbuckets, seq.offset)
+				if empty := dst.ctrl().matchEmpty(); empty != 0 {
+					di = empty.first()
+					break
+				}
+			}
+			dst.tophash[di&(bucketCnt-1)] = b.tophash[i&(bucketCnt-1)]
+			dk := dst.key(t, di)
+			if t.IndirectKey() {
+				*(*unsafe.Pointer)(dk) = *(*unsafe.Pointer)(k)
+			} else {
+				typedmemmove(t.Key, dk, k)
+			}
+			e, de := b.elem(t, i), dst.elem(t, di)
+			if t.IndirectElem() {
+				*(*unsafe.Pointer)(de) = *(*unsafe.Pointer)(e)
+			} else {
+				typedmemmove(t.Elem, de, e)
+			}
+		}
+	}
+
+	// commit the rehash (atomic wrt gc)
+	h.B = B
+	h.buckets = newbuckets
+	h.ndeleted = 0
+}
+
+// mapiterinit initializes the hiter struct used for ranging over maps.
+// The hiter struct pointed to by 'it' is allocated on the stack
+// by the compilers order pass or on the heap by reflect_mapiterinit.
+// Both need to have zeroed hiter since the struct contains pointers.
+func mapiterinit(t *maptype, h *hmap, it *hiter) {
+	if raceenabled && h != nil {
+		callerpc := getcallerpc()
+		racereadpc(unsafe.Pointer(h), callerpc, abi.FuncPCABIInternal(mapiterinit))
+	}
+
+	it.t = t
+	if h == nil || h.count == 0 {
+		return
+	}
+
+	if unsafe.Sizeof(hiter{})/goarch.PtrSize != 12 {
+		throw("hash_iter size incorrect") // see cmd/compile/internal/reflectdata/reflect.go
+	}
+	it.h = h
+
+	// grab snapshot of group state
+	it.B = h.B
+	it.buckets = h.buckets
+	it.clearseq = h.clearseq
+
+	// decide where to start
+	var r uintptr
+	if h.B > 31-bucketCntBits {
+		r = uintptr(fastrand64())
+	} else {
+		r = uintptr(fastrand())
+	}
+	it.startBucket = r & bucketMask(h.B)
+	it.offset = uint8(r >> h.B & (bucketCnt - 1))
+
+	// iterator state
+	it.bucket = it.startBucket
+
+	mapiternext(it)
+}
+
+func mapiternext(it *hiter) {
+	h := it.h
+	if raceenabled {
+		callerpc := getcallerpc()
+		racereadpc(unsafe.Pointer(h), callerpc, abi.FuncPCABIInternal(mapiternext))
+	}
+	if h.flags&hashWriting != 0 {
+		fatal("concurrent map iteration and map write")
+	}
+	t := it.t
+	bucket := it.bucket
+	b := it.bptr
+	i := it.i
+
+	if h.clearseq != it.clearseq {
+		// The map was cleared since the iterator was started,
+		// so nothing it has not returned yet may be returned.
+		// See issue #59411.
+		it.key = nil
+		it.elem = nil
+		return
+	}
+
+next:
+	if b == nil {
+		if bucket == it.startBucket && it.wrapped {
+			// end of iteration
+			it.key = nil
+			it.elem = nil
+			return
+		}
+		b = group(t, it.buckets, bucket)
+		bucket++
+		if bucket == bucketShift(it.B) {
+			bucket = 0
+			it.wrapped = true
+		}
+		i = 0
+	}
+	for ; i < bucketCnt; i++ {
+		offi := (i + it.offset) & (bucketCnt - 1)
+		if !isFull(b.tophash[offi]) {
+			continue
+		}
+		k := b.key(t, uintptr(offi))
+		if t.IndirectKey() {
+			k = *((*unsafe.Pointer)(k))
+		}
+		if it.buckets == h.buckets || !(t.ReflexiveKey() || t.Key.Equal(k, k)) {
+			// This is the golden data, we can return it.
+			// OR
+			// key!=key, so the entry can't be deleted or updated, so we can just return it.
+			// That's lucky for us because when key!=key we can't look it up successfully.
+			it.key = k
+			e := b.elem(t, uintptr(offi))
+			if t.IndirectElem() {
+				e = *((*unsafe.Pointer)(e))
+			}
+			it.elem = e
+		} else {
+			// The table has been rehashed since the iterator was started.
+			// The golden data for this key is now somewhere else.
+			// Check the current hash table for the data.
+			// This code handles the case where the key
+			// has been deleted, updated, or deleted and reinserted.
+			// NOTE: we need to regrab the key as it has potentially been
+			// updated to an equal() but not identical key (e.g. +0.0 vs -0.0).
+			rk, re := mapaccessK(t, h, k)
+			if rk == nil {
+				continue // key has been deleted
+			}
+			it.key = rk
+			it.elem = re
+		}
+		it.bucket = bucket
+		if it.bptr != b { // avoid unnecessary write barrier; see issue 14921
+			it.bptr = b
+		}
+		it.i = i + 1
+		return
+	}
+	b = nil
+	goto next
+}
+
+// mapclear deletes all keys from a map.
+func mapclear(t *maptype, h *hmap) {
+	if raceenabled && h != nil {
+		callerpc := getcallerpc()
+		pc := abi.FuncPCABIInternal(mapclear)
+		racewritepc(unsafe.Pointer(h), callerpc, pc)
+	}
+
+	if h == nil || h.count == 0 {
+		return
+	}
+
+	if h.flags&hashWriting != 0 {
+		fatal("concurrent map writes")
+	}
+
+	h.flags ^= hashWriting
+
+	// Terminate existing iterators, see issue #59411.
+	h.clearseq++
+
+	size := bucketShift(h.B) * uintptr(t.BucketSize)
+	if t.Bucket.PtrBytes != 0 {
+		memclrHasPointers(h.buckets, size)
+	} else {
+		memclrNoHeapPointers(h.buckets, size)
+	}
+	h.count = 0
+	h.ndeleted = 0
+
+	// Reset the hash seed to make it more difficult for attackers to
+	// repeatedly trigger hash collisions. See issue 25237.
+	h.hash0 = fastrand()
+
+	if h.flags&hashWriting == 0 {
+		fatal("concurrent map writes")
+	}
+	h.flags &^= hashWriting
+}
+
+// Reflect stubs. Called from ../reflect/asm_*.s
+
+//go:linkname reflect_makemap reflect.makemap
+func reflect_makemap(t *maptype, cap int) *hmap {
+	// Check invariants and reflects math.
+	if t.Key.Equal == nil {
+		throw("runtime.reflect_makemap: unsupported map key type")
+	}
+	if t.Key.Size_ > maxKeySize && (!t.IndirectKey() || t.KeySize != uint8(goarch.PtrSize)) ||
+		t.Key.Size_ <= maxKeySize && (t.IndirectKey() || t.KeySize != uint8(t.Key.Size_)) {
+		throw("key size wrong")
+	}
+	if t.Elem.Size_ > maxElemSize && (!t.IndirectElem() || t.ValueSize != uint8(goarch.PtrSize)) ||
+		t.Elem.Size_ <= maxElemSize && (t.IndirectElem() || t.ValueSize != uint8(t.Elem.Size_)) {
+		throw("elem size wrong")
+	}
+	if t.Key.Align_ > bucketCnt {
+		throw("key align too big")
+	}
+	if t.Elem.Align_ > bucketCnt {
+		throw("elem align too big")
+	}
+	if t.Key.Size_%uintptr(t.Key.Align_) != 0 {
+		throw("key size not a multiple of key align")
+	}
+	if t.Elem.Size_%uintptr(t.Elem.Align_) != 0 {
+		throw("elem size not a multiple of elem align")
+	}
+	if bucketCnt != 8 {
+		throw("group size must be 8 for the control word")
+	}
+	if dataOffset%uintptr(t.Key.Align_) != 0 {
+		throw("need padding in bucket (key)")
+	}
+	if dataOffset%uintptr(t.Elem.Align_) != 0 {
+		throw("need padding in bucket (elem)")
+	}
+
+	return makemap(t, cap, nil)
+}
+
+//go:linkname reflect_mapaccess reflect.mapaccess
+func reflect_mapaccess(t *maptype, h *hmap, key unsafe.Pointer) unsafe.Pointer {
+	elem, ok := mapaccess2(t, h, key)
+	if !ok {
+		// reflect wants nil for a missing element
+		elem = nil
+	}
+	return elem
+}
+
+//go:linkname reflect_mapaccess_faststr reflect.mapaccess_faststr
+func reflect_mapaccess_faststr(t *maptype, h *hmap, key string) unsafe.Pointer {
+	elem, ok := mapaccess2_faststr(t, h, key)
+	if !ok {
+		// reflect wants nil for a missing element
+		elem = nil
+	}
+	return elem
+}
+
+//go:linkname reflect_mapassign reflect.mapassign0
+func reflect_mapassign(t *maptype, h *hmap, key unsafe.Pointer, elem unsafe.Pointer) {
+	p := mapassign(t, h, key)
+	typedmemmove(t.Elem, p, elem)
+}
+
+//go:linkname reflect_mapassign_faststr reflect.mapassign_faststr0
+func reflect_mapassign_faststr(t *maptype, h *hmap, key string, elem unsafe.Pointer) {
+	p := mapassign_faststr(t, h, key)
+	typedmemmove(t.Elem, p, elem)
+}
+
+//go:linkname reflect_mapdelete reflect.mapdelete
+func reflect_mapdelete(t *maptype, h *hmap, key unsafe.Pointer) {
+	mapdelete(t, h, key)
+}
+
+//go:linkname reflect_mapdelete_faststr reflect.mapdelete_faststr
+func reflect_mapdelete_faststr(t *maptype, h *hmap, key string) {
+	mapdelete_faststr(t, h, key)
+}
+
+//go:linkname reflect_mapiterinit reflect.mapiterinit
+func reflect_mapiterinit(t *maptype, h *hmap, it *hiter) {
+	mapiterinit(t, h, it)
+}
+
+//go:linkname reflect_mapiternext reflect.mapiternext
+func reflect_mapiternext(it *hiter) {
+	mapiternext(it)
+}
+
+//go:linkname reflect_mapiterkey reflect.mapiterkey
+func reflect_mapiterkey(it *hiter) unsafe.Pointer {
+	return it.key
+}
+
+//go:linkname reflect_mapiterelem reflect.mapiterelem
+func reflect_mapiterelem(it *hiter) unsafe.Pointer {
+	return it.elem
+}
+
+//go:linkname reflect_maplen reflect.maplen
+func reflect_maplen(h *hmap) int {
+	if h == nil {
+		return 0
+	}
+	if raceenabled {
+		callerpc := getcallerpc()
+		racereadpc(unsafe.Pointer(h), callerpc, abi.FuncPCABIInternal(reflect_maplen))
+	}
+	return h.count
+}
+
+//go:linkname reflect_mapclear reflect.mapclear
+func reflect_mapclear(t *maptype, h *hmap) {
+	mapclear(t, h)
+}
+
+//go:linkname reflectlite_maplen internal/reflectlite.maplen
+func reflectlite_maplen(h *hmap) int {
+	if h == nil {
+		return 0
+	}
+	if raceenabled {
+		callerpc := getcallerpc()
+		racereadpc(unsafe.Pointer(h), callerpc, abi.FuncPCABIInternal(reflect_maplen))
+	}
+	return h.count
+}
+
+const maxZero = 1024 // must match value in reflect/value.go:maxZero cmd/compile/internal/gc/walk.go:zeroValSize
+var zeroVal [maxZero]byte
+
+// mapinitnoop is a no-op function known the Go linker; if a given global
+// map (of the right size) is determined to be dead, the linker will
+// rewrite the relocation (from the package init func) from the outlined
+// map init function to this symbol. Defined in assembly so as to avoid
+// complications with instrumentation (coverage, etc).
+func mapinitnoop()
+
+// mapclone for implementing maps.Clone
+//
+//go:linkname mapclone maps.clone
+func mapclone(m any) any {
+	e := efaceOf(&m)
+	e.data = unsafe.Pointer(mapclone2((*maptype)(unsafe.Pointer(e._type)), (*hmap)(e.data)))
+	return m
+}
+
+// mapclone2 returns a copy of src. As groups never overflow, the copy
+// has the same shape as src and the group array is copied wholesale.
+func mapclone2(t *maptype, src *hmap) *hmap {
+	dst := makemap(t, 0, nil)
+	dst.hash0 = src.hash0
+	//flags do not need to be copied here, just like a new map has no flags.
+
+	if src.count == 0 {
+		return dst
+	}
+
+	if src.flags&hashWriting != 0 {
+		fatal("concurrent map clone and map write")
+	}
+
+	n := bucketShift(src.B)
+	dst.B = src.B
+	dst.buckets = newarray(t.Bucket, int(n))
+	if t.Bucket.PtrBytes == 0 {
+		memmove(dst.buckets, src.buckets, n*uintptr(t.BucketSize))
+	} else {
+		for x := uintptr(0); x < n; x++ {
+			typedmemmove(t.Bucket, unsafe.Pointer(group(t, dst.buckets, x)), unsafe.Pointer(group(t, src.buckets, x)))
+		}
+	}
+	dst.count = src.count
+	dst.ndeleted = src.ndeleted
+
+	if src.flags&hashWriting != 0 {
+		fatal("concurrent map clone and map write")
+	}
+
+	if !t.IndirectKey() && !t.IndirectElem() {
+		return dst
+	}
+	// Keys and elems stored indirectly must not be shared with src.
+	for x := uintptr(0); x < n; x++ {
+		b := group(t, dst.buckets, x)
+		for match := b.ctrl().matchFull(); match != 0; match = match.removeFirst() {
+			i := match.first()
+			if t.IndirectKey() {
+				k := (*unsafe.Pointer)(b.key(t, i))
+				kmem := newobject(t.Key)
+				typedmemmove(t.Key, kmem, *k)
+				*k = kmem
+			}
+			if t.IndirectElem() {
+				e := (*unsafe.Pointer)(b.elem(t, i))
+				vmem := newobject(t.Elem)
+				typedmemmove(t.Elem, vmem, *e)
+				*e = vmem
+			}
+		}
+	}
+	return dst
+}
+
+// keys for implementing maps.keys
+//
+//go:linkname keys maps.keys
+func keys(m any, p unsafe.Pointer) {
+	e := efaceOf(&m)
+	t := (*maptype)(unsafe.Pointer(e._type))
+	h := (*hmap)(e.data)
+
+	if h == nil || h.count == 0 {
+		return
+	}
+	s := (*slice)(p)
+	r := int(fastrand())
+	offset := uint8(r >> h.B & (bucketCnt - 1))
+	arraySize := int(bucketShift(h.B))
+	buckets := h.buckets
+	for i := 0; i < arraySize; i++ {
+		bucket := (i + r) & (arraySize - 1)
+		copyKeys(t, h, group(t, buckets, uintptr(bucket)), s, offset)
+	}
+}
+
+func copyKeys(t *maptype, h *hmap, b *bmap, s *slice, offset uint8) {
+	for i := uintptr(0); i < bucketCnt; i++ {
+		offi := (i + uintptr(offset)) & (bucketCnt - 1)
+		if !isFull(b.tophash[offi]) {
+			continue
+		}
+		if h.flags&hashWriting != 0 {
+			fatal("concurrent map read and map write")
+		}
+		k := b.key(t, offi)
+		if t.IndirectKey() {
+			k = *((*unsafe.Pointer)(k))
+		}
+		if s.len >= s.cap {
+			fatal("concurrent map read and map write")
+		}
+		typedmemmove(t.Key, add(s.array, uintptr(s.len)*uintptr(t.KeySize)), k)
+		s.len++
+	}
+}
+
+// values for implementing maps.values
+//
+//go:linkname values maps.values
+func values(m any, p unsafe.Pointer) {
+	e := efaceOf(&m)
+	t := (*maptype)(unsafe.Pointer(e._type))
+	h := (*hmap)(e.data)
+	if h == nil || h.count == 0 {
+		return
+	}
+	s := (*slice)(p)
+	r := int(fastrand())
+	offset := uint8(r >> h.B & (bucketCnt - 1))
+	arraySize := int(bucketShift(h.B))
+	buckets := h.buckets
+	for i := 0; i < arraySize; i++ {
+		bucket := (i + r) & (arraySize - 1)
+		copyValues(t, h, group(t, buckets, uintptr(bucket)), s, offset)
+	}
+}
+
+func copyValues(t *maptype, h *hmap, b *bmap, s *slice, offset uint8) {
+	for i := uintptr(0); i < bucketCnt; i++ {
+		offi := (i + uintptr(offset)) & (bucketCnt - 1)
+		if !isFull(b.tophash[offi]) {
+			continue
+		}
+
+		if h.flags&hashWriting != 0 {
+			fatal("concurrent map read and map write")
+		}
+
+		ele := b.elem(t, offi)
+		if t.IndirectElem() {
+			ele = *((*unsafe.Pointer)(ele))
+		}
+		if s.len >= s.cap {
+			fatal("concurrent map read and map write")
+		}
+		typedmemmove(t.Elem, add(s.array, uintptr(s.len)*uintptr(t.ValueSize)), ele)
+		s.len++
+	}
+}
+
+// mapRangeNoWB calls f with the key and elem of each entry of h, a map
+// of type t, in no particular order. Unlike mapiterinit and
+// mapiternext, it has no write barriers and does not allocate, so it
+// can be used while crashing. h must not be written to concurrently.
+func mapRangeNoWB(t *maptype, h *hmap, f func(k, e unsafe.Pointer)) {
+	if h == nil || h.count == 0 {
+		return
+	}
+	for i := uintptr(0); i < bucketShift(h.B); i++ {
+		b := group(t, h.buckets, i)
+		for j := uintptr(0); j < bucketCnt; j++ {
+			if !isFull(b.tophash[j]) {
+				continue
+			}
+			k := b.key(t, j)
+			if t.IndirectKey() {
+				k = *((*unsafe.Pointer)(k))
+			}
+			e := b.elem(t, j)
+			if t.IndirectElem() {
+				e = *((*unsafe.Pointer)(e))
+			}
+			f(k, e)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build goexperiment.swissmap
+
+package runtime_test
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"testing"
+)
+
+func TestSwissCtrlMatch(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	ctrlByte := func() uint8 {
+		switch r.Intn(4) {
+		case 0:
+			return runtime.CtrlEmpty
+		case 1:
+			return runtime.CtrlDeleted
+		default:
+			// Favor few distinct values, so that slots often match.
+			return runtime.CtrlFull | uint8(r.Intn(4))
+		}
+	}
+	for n := 0; n < 100000; n++ {
+		var ctrl [8]uint8
+		for i := range ctrl {
+			ctrl[i] = ctrlByte()
+		}
+		top := runtime.CtrlFull | uint8(r.Intn(4))
+		if n%4 == 0 {
+			top = runtime.CtrlFull | uint8(r.Intn(0x80))
+		}
+
+		match, empty, emptyOrDeleted, full := runtime.CtrlMatch(ctrl, top)
+		var wantMatch, wantEmpty, wantFull uint8
+		for i, c := range ctrl {
+			if c == top {
+				wantMatch |= 1 << i
+			}
+			if c == runtime.CtrlEmpty {
+				wantEmpty |= 1 << i
+			}
+			if c&runtime.CtrlFull != 0 {
+				wantFull |= 1 << i
+			}
+		}
+		// matchTop may report false positives, but only full slots.
+		if match&wantMatch != wantMatch || match&^wantMatch&^wantFull != 0 {
+			t.Fatalf("ctrl %#x: matchTop(%#x) = %08b, want %08b", ctrl, top, match, wantMatch)
+		}
+		if empty != wantEmpty {
+			t.Fatalf("ctrl %#x: matchEmpty = %08b, want %08b", ctrl, empty, wantEmpty)
+		}
+		if emptyOrDeleted != ^wantFull {
+			t.Fatalf("ctrl %#x: matchEmptyOrDeleted = %08b, want %08b", ctrl, emptyOrDeleted, ^wantFull)
+		}
+		if full != wantFull {
+			t.Fatalf("ctrl %#x: matchFull = %08b, want %08b", ctrl, full, wantFull)
+		}
+	}
+}
+
+func TestSwissTombstoneReuse(t *testing.T) {
+	m := make(map[int]int, 100)
+	for i := 0; i < 112; i++ {
+		m[i] = i
+	}
+	B, _, _ := runtime.MapTableStats(m)
+
+	// Deleting a key from a group that has no empty slot leaves a
+	// tombstone, and inserting the key again reuses it: its probe
+	// sequence starts at the same group.
+	reused := 0
+	for i := 0; i < 112; i++ {
+		_, _, before := runtime.MapTableStats(m)
+		delete(m, i)
+		_, _, deleted := runtime.MapTableStats(m)
+		m[i] = i
+		if deleted == before {
+			continue
+		}
+		b, full, after := runtime.MapTableStats(m)
+		if after != before || b != B || full != 112 {
+			t.Fatalf("reinserting %d: B=%d full=%d deleted=%d, want B=%d full=112 deleted=%d", i, b, full, after, B, before)
+		}
+		runtime.MapTombstoneCheck(m)
+		reused++
+	}
+	if reused == 0 {
+		t.Skip("no delete left a tombstone")
+	}
+}
+
+func TestSwissRehashWithDeletes(t *testing.T) {
+	// A map whose size stays the same while keys are replaced must not
+	// grow without bound: once tombstones make up enough of the load,
+	// the table is rehashed into one of the same size.
+	const n = 100
+	m := make(map[int]int, n)
+	for i := 0; i < n; i++ {
+		m[i] = i
+	}
+	for i := 0; i < 100*n; i++ {
+		delete(m, i)
+		m[i+n] = i + n
+		if i%n == 0 {
+			runtime.MapTombstoneCheck(m)
+		}
+	}
+	runtime.MapTombstoneCheck(m)
+	if B, full, _ := runtime.MapTableStats(m); B > 5 || full != n {
+		t.Errorf("after churn: B=%d full=%d, want B<=5 full=%d", B, full, n)
+	}
+	for i := 100 * n; i < 101*n; i++ {
+		if m[i] != i {
+			t.Fatalf("m[%d] = %d, want %d", i, m[i], i)
+		}
+	}
+}
+
+func TestSwissIterateGrow(t *testing.T) {
+	const n = 50
+	for _, del := range []bool{false, true} {
+		m := make(map[int]int)
+		for i := 0; i < n; i++ {
+			m[i] = i
+		}
+		seen := make(map[int]bool)
+		deleted := make(map[int]bool)
+		first := true
+		for k, v := range m {
+			if seen[k] {
+				t.Fatalf("key %d returned twice", k)
+			}
+			if deleted[k] {
+				t.Fatalf("deleted key %d returned", k)
+			}
+			if k < n && v != k || k >= n && v != -k {
+				t.Fatalf("m[%d] returned %d", k, v)
+			}
+			seen[k] = true
+			if first {
+				first = false
+				// Grow the table several times and update the old
+				// keys, so that the iterator walks an old snapshot
+				// and must look the keys up in the new table.
+				for i := n; i < 20*n; i++ {
+					m[i] = -i
+				}
+				for i := 0; i < n; i++ {
+					if del && i%2 == 0 && !seen[i] {
+						delete(m, i)
+						deleted[i] = true
+					}
+				}
+			}
+		}
+		for i := 0; i < n; i++ {
+			if !seen[i] && !deleted[i] {
+				t.Errorf("del=%v: key %d not returned", del, i)
+			}
+		}
+	}
+}
+
+func TestSwissIterateClear(t *testing.T) {
+	// NaN keys cannot be looked up, so an iterator walking a snapshot
+	// taken before a rehash would return them even after clear, if it
+	// could not tell the map was cleared.
+	m := make(map[float64]int)
+	for i := 0; i < 8; i++ {
+		m[math.NaN()] = i
+	}
+	n := 0
+	for range m {
+		if n == 0 {
+			for i := 0; i < 100; i++ {
+				m[math.NaN()] = i
+			}
+			clear(m)
+		}
+		n++
+	}
+	if n != 1 {
+		t.Errorf("iteration returned %d entries, want 1", n)
+	}
+	if len(m) != 0 {
+		t.Errorf("len(m) = %d after clear, want 0", len(m))
+	}
+
+	// Many clears between iterator steps must not go unnoticed.
+	m2 := make(map[float64]int)
+	for i := 0; i < 8; i++ {
+		m2[math.NaN()] = i
+	}
+	n = 0
+	for range m2 {
+		if n == 0 {
+			for i := 0; i < 1<<16; i++ {
+				m2[math.NaN()] = i
+				clear(m2)
+			}
+		}
+		n++
+	}
+	if n != 1 {
+		t.Errorf("iteration after 1<<16 clears returned %d entries, want 1", n)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"internal/abi"
 	"internal/goarch"
+	"internal/goexperiment"
 	"math"
 	"reflect"
 	"runtime"
@@ -22,7 +23,11 @@ func TestHmapSize(t *testing.T) {
 	// The structure of hmap is defined in runtime/map.go
 	// and in cmd/compile/internal/gc/reflect.go and must be in sync.
 	// The size of hmap should be 48 bytes on 64 bit and 28 bytes on 32 bit platforms.
+	// The Swiss table implementation adds a word.
 	var hmapSize = uintptr(8 + 5*goarch.PtrSize)
+	if goexperiment.SwissMap {
+		hmapSize += goarch.PtrSize
+	}
 	if runtime.RuntimeHmapSize != hmapSize {
 		t.Errorf("sizeof(runtime.hmap{})==%d, want %d", runtime.RuntimeHmapSize, hmapSize)
 	}
@@ -718,6 +723,9 @@ func TestMapBuckets(t *testing.T) {
 	// on the stack. Escaping maps start with a non-nil bucket pointer if
 	// hint size is above bucketCnt and thereby have more than one bucket.
 	// These tests depend on bucketCnt and loadFactor* in map.go.
+	if goexperiment.SwissMap {
+		t.Skip("bucket counts depend on the load factor of map.go")
+	}
 	t.Run("mapliteral", func(t *testing.T) {
 		for _, tt := range mapBucketTests {
 			localMap := map[int]int{}
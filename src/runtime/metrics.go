@@ -24,6 +24,7 @@ var (
 
 	sizeClassBuckets []float64
 	timeHistBuckets  []float64
+	lenHistBuckets   []float64
 )
 
 type metricData struct {
@@ -84,6 +85,7 @@ func initMetrics() {
 	sizeClassBuckets = append(sizeClassBuckets, float64Inf())
 
 	timeHistBuckets = timeHistogramMetricsBuckets()
+	lenHistBuckets = lenHistogramMetricsBuckets()
 	metrics = map[string]metricData{
 		"/cgo/go-to-c-calls:calls": {
 			compute: func(_ *statAggregate, out *metricValue) {
@@ -213,6 +215,36 @@ func initMetrics() {
 				out.scalar = in.gcStats.totalScan
 			},
 		},
+		"/gc/scavenge/hugepage-breaks:events": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = mheap_.pages.scav.hugePageBreaks.Load()
+			},
+		},
+		"/gc/scavenge/hugepage-eligible:bytes": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = uint64(mheap_.pages.scav.index.hugePageChunks.Load()) * pallocChunkBytes
+			},
+		},
+		"/gc/scavenge/released/background:bytes": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = mheap_.pages.scav.totalReleasedBg.Load()
+			},
+		},
+		"/gc/scavenge/released/eager:bytes": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = mheap_.pages.scav.totalReleasedEager.Load()
+			},
+		},
+		"/gc/scavenge/released/forced:bytes": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = mheap_.pages.scav.totalReleasedForced.Load()
+			},
+		},
 		"/gc/heap/allocs-by-size:bytes": {
 			deps: makeStatDepSet(heapStatsDep),
 			compute: func(in *statAggregate, out *metricValue) {
@@ -439,20 +471,58 @@ func initMetrics() {
 				out.scalar = uint64(gomaxprocs)
 			},
 		},
+		"/sched/goroutines/deadlocked:goroutines": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = goroutineLeak.count.Load()
+			},
+		},
 		"/sched/goroutines:goroutines": {
 			compute: func(_ *statAggregate, out *metricValue) {
 				out.kind = metricKindUint64
 				out.scalar = uint64(gcount())
 			},
 		},
+		"/sched/latencies/created:seconds": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				sched.timeToRunByReason[runnableCreated].write(out)
+			},
+		},
+		"/sched/latencies/preempted:seconds": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				sched.timeToRunByReason[runnablePreempted].write(out)
+			},
+		},
+		"/sched/latencies/woken:seconds": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				sched.timeToRunByReason[runnableWoken].write(out)
+			},
+		},
 		"/sched/latencies:seconds": {
 			compute: func(_ *statAggregate, out *metricValue) {
-				hist := out.float64HistOrInit(timeHistBuckets)
-				hist.counts[0] = sched.timeToRun.underflow.Load()
-				for i := range sched.timeToRun.counts {
-					hist.counts[i+1] = sched.timeToRun.counts[i].Load()
-				}
-				hist.counts[len(hist.counts)-1] = sched.timeToRun.overflow.Load()
+				sched.timeToRun.write(out)
+			},
+		},
+		"/sched/runqueue/global:goroutines": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				sched.globalRunqLen.write(out)
+			},
+		},
+		"/sched/runqueue/local:goroutines": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				sched.localRunqLen.write(out)
+			},
+		},
+		"/sched/spinning:cpu-seconds": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				out.kind = metricKindFloat64
+				out.scalar = float64bits(nsToSec(sched.totalSpinningTime.Load()))
+			},
+		},
+		"/sched/steals:goroutines": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = sched.steals.Load()
 			},
 		},
 		"/sync/mutex/wait/total:seconds": {
@@ -775,6 +845,24 @@ func (v *metricValue) float64HistOrInit(buckets []float64) *metricFloat64Histogr
 	return hist
 }
 
+// write copies the distribution in h into out.
+func (h *timeHistogram) write(out *metricValue) {
+	hist := out.float64HistOrInit(timeHistBuckets)
+	hist.counts[0] = h.underflow.Load()
+	for i := range h.counts {
+		hist.counts[i+1] = h.counts[i].Load()
+	}
+	hist.counts[len(hist.counts)-1] = h.overflow.Load()
+}
+
+// write copies the distribution in h into out.
+func (h *lenHistogram) write(out *metricValue) {
+	hist := out.float64HistOrInit(lenHistBuckets)
+	for i := range h.counts {
+		hist.counts[i] = h.counts[i].Load()
+	}
+}
+
 // metricFloat64Histogram is a runtime copy of runtime/metrics.Float64Histogram
 // and must be kept structurally identical to that type.
 type metricFloat64Histogram struct {
@@ -313,6 +313,42 @@ var allDesc = []Description{
 		Description: "The total amount space that is scannable. Sum of all metrics in /gc/scan.",
 		Kind:        KindUint64,
 	},
+	{
+		Name: "/gc/scavenge/hugepage-breaks:events",
+		Description: "Count of times the scavenger returned memory to the underlying system " +
+			"from a region of the heap that was eligible for transparent huge pages, " +
+			"and marked the region ineligible for them in the process.",
+		Kind:       KindUint64,
+		Cumulative: true,
+	},
+	{
+		Name: "/gc/scavenge/hugepage-eligible:bytes",
+		Description: "Heap address space that the runtime has not marked ineligible for " +
+			"transparent huge pages. Whether it is actually backed by huge pages is up to " +
+			"the underlying system. Only meaningful on Linux.",
+		Kind: KindUint64,
+	},
+	{
+		Name: "/gc/scavenge/released/background:bytes",
+		Description: "Cumulative sum of heap memory returned to the underlying system " +
+			"by the background scavenger.",
+		Kind:       KindUint64,
+		Cumulative: true,
+	},
+	{
+		Name: "/gc/scavenge/released/eager:bytes",
+		Description: "Cumulative sum of heap memory returned to the underlying system " +
+			"by the allocator, to offset heap growth or to stay under the memory limit.",
+		Kind:       KindUint64,
+		Cumulative: true,
+	},
+	{
+		Name: "/gc/scavenge/released/forced:bytes",
+		Description: "Cumulative sum of heap memory returned to the underlying system " +
+			"by calls to runtime/debug.FreeOSMemory.",
+		Kind:       KindUint64,
+		Cumulative: true,
+	},
 	{
 		Name:        "/gc/stack/starting-size:bytes",
 		Description: "The stack size of new goroutines.",
@@ -404,17 +440,64 @@ var allDesc = []Description{
 		Description: "The current runtime.GOMAXPROCS setting, or the number of operating system threads that can execute user-level Go code simultaneously.",
 		Kind:        KindUint64,
 	},
+	{
+		Name:        "/sched/goroutines/deadlocked:goroutines",
+		Description: "Count of goroutines found to be blocked forever on a channel, sync.Mutex, sync.RWMutex or sync.WaitGroup that no other goroutine can reach. Such goroutines are only looked for when collecting the goroutineleak profile from runtime/pprof, or in every GC cycle with GODEBUG=partialdeadlock=1.",
+		Kind:        KindUint64,
+	},
 	{
 		Name:        "/sched/goroutines:goroutines",
 		Description: "Count of live goroutines.",
 		Kind:        KindUint64,
 	},
+	{
+		Name:        "/sched/latencies/created:seconds",
+		Description: "Distribution of the time new goroutines have spent in the scheduler in a runnable state before running for the first time. Bucket counts increase monotonically.",
+		Kind:        KindFloat64Histogram,
+		Cumulative:  true,
+	},
+	{
+		Name:        "/sched/latencies/preempted:seconds",
+		Description: "Distribution of the time goroutines have spent in the scheduler in a runnable state before running again, after they were preempted or yielded. Bucket counts increase monotonically.",
+		Kind:        KindFloat64Histogram,
+		Cumulative:  true,
+	},
+	{
+		Name:        "/sched/latencies/woken:seconds",
+		Description: "Distribution of the time goroutines have spent in the scheduler in a runnable state before running again, after they were blocked or in a system call. Bucket counts increase monotonically.",
+		Kind:        KindFloat64Histogram,
+		Cumulative:  true,
+	},
 	{
 		Name:        "/sched/latencies:seconds",
 		Description: "Distribution of the time goroutines have spent in the scheduler in a runnable state before actually running. Bucket counts increase monotonically.",
 		Kind:        KindFloat64Histogram,
 		Cumulative:  true,
 	},
+	{
+		Name:        "/sched/runqueue/global:goroutines",
+		Description: "Distribution of the length of the global run queue, sampled when goroutines are scheduled, at the same rate as /sched/latencies:seconds. Bucket counts increase monotonically.",
+		Kind:        KindFloat64Histogram,
+		Cumulative:  true,
+	},
+	{
+		Name:        "/sched/runqueue/local:goroutines",
+		Description: "Distribution of the length of the run queue of the P scheduling a goroutine, sampled when goroutines are scheduled, at the same rate as /sched/latencies:seconds. Bucket counts increase monotonically.",
+		Kind:        KindFloat64Histogram,
+		Cumulative:  true,
+	},
+	{
+		Name:        "/sched/spinning:cpu-seconds",
+		Description: "Estimated total CPU time threads have spent spinning, looking for goroutines to run without finding any. This metric is an overestimate, and not directly comparable to system CPU time measurements. A high value relative to /cpu/classes/total:cpu-seconds may indicate too many threads for the work available, for example a GOMAXPROCS value too high for a bursty workload.",
+		Kind:        KindFloat64,
+		Cumulative:  true,
+	},
+	{
+		Name:        "/sched/steals:goroutines",
+		Description: "Count of goroutines stolen by threads from the run queues of other threads, to balance the work.",
+		Kind:        KindUint64,
+		Cumulative:  true,
+	},
 	{
 		Name:        "/sync/mutex/wait/total:seconds",
 		Description: "Approximate cumulative time goroutines have spent blocked on a sync.Mutex or sync.RWMutex. This metric is useful for identifying global changes in lock contention. Collect a mutex or block profile using the runtime/pprof package for more detailed contention data.",
@@ -227,6 +227,31 @@ Below is the full list of supported metrics, ordered lexicographically.
 		The total amount space that is scannable. Sum of all metrics in
 		/gc/scan.
 
+	/gc/scavenge/hugepage-breaks:events
+		Count of times the scavenger returned memory to the underlying
+		system from a region of the heap that was eligible for
+		transparent huge pages, and marked the region ineligible for
+		them in the process.
+
+	/gc/scavenge/hugepage-eligible:bytes
+		Heap address space that the runtime has not marked ineligible
+		for transparent huge pages. Whether it is actually backed by
+		huge pages is up to the underlying system. Only meaningful on
+		Linux.
+
+	/gc/scavenge/released/background:bytes
+		Cumulative sum of heap memory returned to the underlying system
+		by the background scavenger.
+
+	/gc/scavenge/released/eager:bytes
+		Cumulative sum of heap memory returned to the underlying system
+		by the allocator, to offset heap growth or to stay under the
+		memory limit.
+
+	/gc/scavenge/released/forced:bytes
+		Cumulative sum of heap memory returned to the underlying system
+		by calls to runtime/debug.FreeOSMemory.
+
 	/gc/stack/starting-size:bytes
 		The stack size of new goroutines.
 
@@ -378,14 +403,61 @@ Below is the full list of supported metrics, ordered lexicographically.
 		operating system threads that can execute user-level Go code
 		simultaneously.
 
+	/sched/goroutines/deadlocked:goroutines
+		Count of goroutines found to be blocked forever on a channel,
+		sync.Mutex, sync.RWMutex or sync.WaitGroup that no other
+		goroutine can reach. Such goroutines are only looked for when
+		collecting the goroutineleak profile from runtime/pprof,
+		or in every GC cycle with GODEBUG=partialdeadlock=1.
+
 	/sched/goroutines:goroutines
 		Count of live goroutines.
 
+	/sched/latencies/created:seconds
+		Distribution of the time new goroutines have spent in the
+		scheduler in a runnable state before running for the first time.
+		Bucket counts increase monotonically.
+
+	/sched/latencies/preempted:seconds
+		Distribution of the time goroutines have spent in the scheduler
+		in a runnable state before running again, after they were
+		preempted or yielded. Bucket counts increase monotonically.
+
+	/sched/latencies/woken:seconds
+		Distribution of the time goroutines have spent in the
+		scheduler in a runnable state before running again, after
+		they were blocked or in a system call. Bucket counts increase
+		monotonically.
+
 	/sched/latencies:seconds
 		Distribution of the time goroutines have spent in the scheduler
 		in a runnable state before actually running. Bucket counts
 		increase monotonically.
 
+	/sched/runqueue/global:goroutines
+		Distribution of the length of the global run queue,
+		sampled when goroutines are scheduled, at the same rate as
+		/sched/latencies:seconds. Bucket counts increase monotonically.
+
+	/sched/runqueue/local:goroutines
+		Distribution of the length of the run queue of the P scheduling
+		a goroutine, sampled when goroutines are scheduled, at the
+		same rate as /sched/latencies:seconds. Bucket counts increase
+		monotonically.
+
+	/sched/spinning:cpu-seconds
+		Estimated total CPU time threads have spent spinning,
+		looking for goroutines to run without finding any.
+		This metric is an overestimate, and not directly comparable
+		to system CPU time measurements. A high value relative to
+		/cpu/classes/total:cpu-seconds may indicate too many threads for
+		the work available, for example a GOMAXPROCS value too high for
+		a bursty workload.
+
+	/sched/steals:goroutines
+		Count of goroutines stolen by threads from the run queues of
+		other threads, to balance the work.
+
 	/sync/mutex/wait/total:seconds
 		Approximate cumulative time goroutines have spent blocked
 		on a sync.Mutex or sync.RWMutex. This metric is useful for
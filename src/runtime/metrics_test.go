@@ -758,3 +758,103 @@ func TestCPUMetricsSleep(t *testing.T) {
 	}
 	t.Errorf(`time.Sleep did not contribute enough to "idle" class: minimum idle time = %.5fs`, minIdleCPUSeconds)
 }
+
+func TestSchedMetrics(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	names := []string{
+		"/sched/latencies/created:seconds",
+		"/sched/latencies/preempted:seconds",
+		"/sched/latencies/woken:seconds",
+		"/sched/latencies:seconds",
+		"/sched/runqueue/global:goroutines",
+		"/sched/runqueue/local:goroutines",
+	}
+	count := func(samples []metrics.Sample) []uint64 {
+		metrics.Read(samples)
+		counts := make([]uint64, len(samples))
+		for i := range samples {
+			for _, c := range samples[i].Value.Float64Histogram().Counts {
+				counts[i] += c
+			}
+		}
+		return counts
+	}
+	samples := make([]metrics.Sample, len(names))
+	for i := range names {
+		samples[i].Name = names[i]
+	}
+	before := count(samples)
+
+	// Create goroutines that block on a channel, and yield.
+	// Only one in gTrackingPeriod scheduling events is sampled,
+	// so do it many times.
+	c := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < 1000; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			runtime.Gosched()
+			c <- 1
+		}()
+		go func() {
+			defer wg.Done()
+			<-c
+		}()
+	}
+	wg.Wait()
+
+	after := count(samples)
+	for i := range names {
+		if after[i] <= before[i] {
+			t.Errorf("%s: no new samples: got %d, previously %d", names[i], after[i], before[i])
+		}
+	}
+	// The latencies by reason add up to the total latencies, but
+	// scheduling may happen between reads, so only check the order.
+	if split := after[0] + after[1] + after[2]; split < before[3] {
+		t.Errorf("sum of latencies by reason %d less than total latencies %d read before", split, before[3])
+	}
+
+	var scalars [2]metrics.Sample
+	scalars[0].Name = "/sched/spinning:cpu-seconds"
+	scalars[1].Name = "/sched/steals:goroutines"
+	metrics.Read(scalars[:])
+	if s := scalars[0].Value.Float64(); s < 0 {
+		t.Errorf("negative spinning time: %f", s)
+	}
+	if scalars[1].Value.Kind() != metrics.KindUint64 {
+		t.Errorf("unexpected kind for %s: %v", scalars[1].Name, scalars[1].Value.Kind())
+	}
+}
+
+func TestSchedSpinningTimeBound(t *testing.T) {
+	// Ms woken up by startm to spin must not count the time they were
+	// parked. Make them park and wake up often.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	const name = "/sched/spinning:cpu-seconds"
+	s := []metrics.Sample{{Name: name}}
+	metrics.Read(s)
+	before := s[0].Value.Float64()
+	start := time.Now()
+	for i := 0; i < 1000; i++ {
+		var wg sync.WaitGroup
+		for j := 0; j < runtime.GOMAXPROCS(0); j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				time.Sleep(10 * time.Microsecond)
+			}()
+		}
+		wg.Wait()
+	}
+	wall := time.Since(start).Seconds()
+	metrics.Read(s)
+	spinning := s[0].Value.Float64() - before
+
+	if limit := wall * float64(runtime.GOMAXPROCS(0)); spinning > limit {
+		t.Errorf("%s increased by %fs in %fs of wall time with GOMAXPROCS=%d, want at most %fs",
+			name, spinning, wall, runtime.GOMAXPROCS(0), limit)
+	}
+}
@@ -202,6 +202,21 @@ func runfinq() {
 			for i := fb.cnt; i > 0; i-- {
 				f := &fb.fin[i-1]
 
+				// arg is only nil for cleanups queued by
+				// freeSpecial. Cleanups take no arguments:
+				// the argument is captured by the closure.
+				if f.arg == nil {
+					fn := unsafe.Pointer(f.fn)
+					cleanup := *(*func())(unsafe.Pointer(&fn))
+					fingStatus.Or(fingRunningFinalizer)
+					cleanup()
+					fingStatus.And(^fingRunningFinalizer)
+
+					f.fn = nil
+					atomic.Store(&fb.cnt, i-1)
+					continue
+				}
+
 				var regs abi.RegArgs
 				// The args may be passed in registers or on stack. Even for
 				// the register case, we still need the spill slots.
@@ -190,6 +190,7 @@ func gcinit() {
 	work.markDoneSema = 1
 	lockInit(&work.sweepWaiters.lock, lockRankSweepWaiters)
 	lockInit(&work.assistQueue.lock, lockRankAssistQueue)
+	lockInit(&work.strongFromWeak.lock, lockRankStrongFromWeakQueue)
 	lockInit(&work.wbufSpans.lock, lockRankWbufSpans)
 }
 
@@ -403,6 +404,26 @@ type workType struct {
 		q    gQueue
 	}
 
+	// strongFromWeak controls how the GC interacts with weak->strong
+	// pointer conversions.
+	strongFromWeak struct {
+		// block is a flag set during mark termination that prevents
+		// new weak->strong conversions from executing by blocking the
+		// goroutine and enqueuing it onto q.
+		//
+		// Mutated only by one goroutine at a time in gcMarkDone,
+		// with globally-synchronizing events like forEachP and
+		// stopTheWorld.
+		block bool
+
+		// q is a queue of goroutines that attempted to perform a
+		// weak->strong conversion during mark termination.
+		//
+		// Protected by lock.
+		lock mutex
+		q    gQueue
+	}
+
 	// sweepWaiters is a list of blocked goroutines to wake when
 	// we transition from mark termination to sweep.
 	sweepWaiters struct {
@@ -710,6 +731,13 @@ func gcStart(trigger gcTrigger) {
 		schedEnableUser(false)
 	}
 
+	// Pick the goroutine leak candidates if requested. This
+	// must happen before write barriers are enabled.
+	if goroutineLeak.pending.Load() || debug.partialdeadlock > 0 {
+		goroutineLeak.pending.Store(false)
+		gcLeakPrepare()
+	}
+
 	// Enter concurrent mark phase and enable
 	// write barriers.
 	//
@@ -828,6 +856,10 @@ top:
 	// stop the world later, so acquire worldsema now.
 	semacquire(&worldsema)
 
+	// Prevent weak->strong conversions from generating additional
+	// GC work. forEachP will guarantee that it is observed globally.
+	work.strongFromWeak.block = true
+
 	// Flush all local buffers and collect flushedWork flags.
 	gcMarkDoneFlushed = 0
 	systemstack(func() {
@@ -899,6 +931,13 @@ top:
 			}
 		}
 	})
+	if !restart && goroutineLeak.enabled {
+		// Marking has reached a fixed point without some of the
+		// goroutine leak candidates. Either some of them have
+		// become reachable, or the rest are leaked; either way,
+		// scan their stacks and keep marking.
+		restart = gcLeakMarkDone()
+	}
 	if restart {
 		getg().m.preemptoff = ""
 		systemstack(func() {
@@ -923,6 +962,11 @@ top:
 	// start the world again.
 	gcWakeAllAssists()
 
+	// Wake all blocked weak->strong conversions. These will run
+	// when we start the world again.
+	work.strongFromWeak.block = false
+	gcWakeAllStrongFromWeak()
+
 	// Likewise, release the transition lock. Blocked
 	// workers and assists will run when we start the
 	// world again.
@@ -1216,6 +1260,16 @@ func gcMarkTermination() {
 	releasem(mp)
 	mp = nil
 
+	// Notify the unique package that it should clean up its maps.
+	// This must not block, so if the cleanup goroutine is still busy
+	// with the previous cycle, skip this one.
+	if uniqueMapCleanup != nil {
+		select {
+		case uniqueMapCleanup <- struct{}{}:
+		default:
+		}
+	}
+
 	// now that gc is done, kick off finalizer thread if needed
 	if !concurrentSweep {
 		// give the queued finalizers, if any, a chance to run
@@ -1661,6 +1715,20 @@ func sync_runtime_registerPoolCleanup(f func()) {
 	poolcleanup = f
 }
 
+var uniqueMapCleanup chan struct{} // for unique
+
+//go:linkname unique_runtime_registerUniqueMapCleanup unique.runtime_registerUniqueMapCleanup
+func unique_runtime_registerUniqueMapCleanup(f func()) {
+	// Start the goroutine in the runtime so it's counted as a system goroutine.
+	uniqueMapCleanup = make(chan struct{}, 1)
+	go func(cleanup func()) {
+		for {
+			<-uniqueMapCleanup
+			cleanup()
+		}
+	}(f)
+}
+
 //go:linkname boring_registerCache crypto/internal/boring/bcache.registerCache
 func boring_registerCache(p unsafe.Pointer) {
 	boringCaches = append(boringCaches, p)
@@ -1782,7 +1850,7 @@ func gcTestIsReachable(ptrs ...unsafe.Pointer) (mask uint64) {
 		s := (*specialReachable)(mheap_.specialReachableAlloc.alloc())
 		unlock(&mheap_.speciallock)
 		s.special.kind = _KindSpecialReachable
-		if !addspecial(p, &s.special) {
+		if !addspecial(p, &s.special, false) {
 			throw("already have a reachable special (duplicate pointer?)")
 		}
 		specials[i] = s
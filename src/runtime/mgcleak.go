@@ -0,0 +1,272 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Garbage collector: goroutine leak detection.
+//
+// A goroutine blocked on a channel operation or on a semaphore (as
+// used by sync.Mutex, sync.RWMutex and sync.WaitGroup) can only be
+// woken up by another goroutine that can reach that channel or
+// semaphore. If no goroutine that could ever run again can reach it,
+// the blocked goroutine is leaked: it will never run again.
+//
+// On request (see goroutineLeakGC), or in every cycle with
+// GODEBUG=partialdeadlock=1, a GC cycle finds such goroutines as part
+// of marking.
+// When the cycle starts, every goroutine blocked in one of these
+// operations becomes a leak candidate. The GC does not treat a
+// candidate's stack as a root. Instead, marking proceeds from all
+// other roots, and whenever it runs out of work, gcMarkDone checks
+// each candidate: if it has been woken up, or if any object it is
+// blocked on has been marked, its stack is scanned and marking
+// resumes. Once this reaches a fixed point, the remaining candidates
+// are leaked. Their stacks are then scanned as well, so that leak
+// detection never frees memory a normal cycle would have retained.
+//
+// The runtime itself keeps pointers from every blocked goroutine to
+// the objects it is blocked on (g.waiting to the channel sudogs, and
+// the semtable to semaphore sudogs). To keep these from making every
+// channel and semaphore reachable, the cycle hides them from the GC
+// while the world is stopped, before write barriers are enabled, and
+// restores them once the goroutine is woken up or scanned.
+
+package runtime
+
+import (
+	"runtime/internal/atomic"
+	"unsafe"
+)
+
+var goroutineLeak struct {
+	// pending is set to request that the next GC cycle look for
+	// leaked goroutines.
+	pending atomic.Bool
+
+	// enabled indicates that the current GC cycle is looking for
+	// leaked goroutines. It is only accessed with the world
+	// stopped.
+	enabled bool
+
+	// count is the number of goroutines found to be leaked so
+	// far. Leaked goroutines never exit, so it never decreases.
+	count atomic.Uint64
+}
+
+// goroutineLeakGC runs a full GC cycle that looks for leaked
+// goroutines, and blocks until it completes. Goroutines found to be
+// leaked have their leaked flag set.
+func goroutineLeakGC() {
+	goroutineLeak.pending.Store(true)
+	GC()
+}
+
+// isLeakCandidate reports whether gp is blocked in an operation that
+// goroutine leak detection understands.
+//
+// The world must be stopped.
+func isLeakCandidate(gp *g) bool {
+	if gp.leaked || readgstatus(gp) != _Gwaiting || isSystemGoroutine(gp, false) {
+		return false
+	}
+	switch gp.waitreason {
+	case waitReasonChanReceiveNilChan, waitReasonChanSendNilChan, waitReasonSelectNoCases:
+		return true
+	case waitReasonChanReceive, waitReasonChanSend, waitReasonSelect:
+		return gp.waiting != nil
+	case waitReasonSemacquire, waitReasonSyncMutexLock, waitReasonSyncRWMutexLock, waitReasonSyncRWMutexRLock:
+		return gp.waitsema != nil
+	}
+	return false
+}
+
+// gcLeakPrepare marks the leak candidates for this GC cycle and hides
+// the pointers to the objects they are blocked on from the GC.
+//
+// The world must be stopped and write barriers must not be enabled
+// yet, since they would shade the pointers being hidden.
+func gcLeakPrepare() {
+	assertWorldStopped()
+	if writeBarrier.enabled {
+		throw("gcLeakPrepare: write barrier enabled")
+	}
+	goroutineLeak.enabled = true
+	forEachGRace(func(gp *g) {
+		if !isLeakCandidate(gp) {
+			return
+		}
+		gp.leakCandidate = true
+		if gp.waiting != nil {
+			gp.hiddenWaiting = uintptr(unsafe.Pointer(gp.waiting))
+			gp.waiting = nil
+		}
+		if s := gp.waitsema; s != nil && s.elem != nil {
+			s.hiddenElem = uintptr(s.elem)
+			s.elem = nil
+		}
+	})
+}
+
+// gcLeakUnhide restores the pointers hidden from the GC by
+// gcLeakPrepare. Write barriers shade the restored pointers.
+func gcLeakUnhide(gp *g) {
+	if gp.hiddenWaiting != 0 {
+		gp.waiting = (*sudog)(unsafe.Pointer(gp.hiddenWaiting))
+		gp.hiddenWaiting = 0
+	}
+	if s := gp.waitsema; s != nil && s.hiddenElem != 0 {
+		s.elem = unsafe.Pointer(s.hiddenElem)
+		s.hiddenElem = 0
+	}
+}
+
+// gcLeakStillBlocked reports whether leak candidate gp is still
+// blocked and nothing it is blocked on has been marked.
+//
+// The world must be stopped.
+func gcLeakStillBlocked(gp *g) bool {
+	if readgstatus(gp) != _Gwaiting {
+		return false
+	}
+	switch gp.waitreason {
+	case waitReasonChanReceiveNilChan, waitReasonChanSendNilChan, waitReasonSelectNoCases:
+		return true
+	case waitReasonChanReceive, waitReasonChanSend, waitReasonSelect:
+		// If gp.waiting is no longer hidden, gp has been woken up
+		// and is now blocked on something else.
+		if gp.hiddenWaiting == 0 {
+			return false
+		}
+		for sg := (*sudog)(unsafe.Pointer(gp.hiddenWaiting)); sg != nil; sg = sg.waitlink {
+			if sg.c == nil || gcLeakIsMarked(uintptr(unsafe.Pointer(sg.c))) {
+				return false
+			}
+		}
+		return true
+	case waitReasonSemacquire, waitReasonSyncMutexLock, waitReasonSyncRWMutexLock, waitReasonSyncRWMutexRLock:
+		s := gp.waitsema
+		return s != nil && s.hiddenElem != 0 && !gcLeakIsMarked(s.hiddenElem)
+	}
+	return false
+}
+
+// gcLeakIsMarked reports whether the heap object containing p has
+// been marked in the current cycle. Pointers outside the heap are
+// treated as marked.
+func gcLeakIsMarked(p uintptr) bool {
+	s := spanOfHeap(p)
+	if s == nil {
+		return true
+	}
+	return s.markBitsForIndex(s.objIndex(p)).isMarked()
+}
+
+// gcLeakMarkDone is called by gcMarkDone once marking has run out of
+// work during a cycle that looks for leaked goroutines. It scans the
+// stacks of candidates that have become reachable. If there are none,
+// it marks all remaining candidates as leaked, scans their stacks, and
+// ends leak detection for this cycle.
+//
+// It reports whether it found more mark work, in which case marking
+// must resume before the cycle can terminate.
+//
+// The world must be stopped. This must not allocate, since mark
+// assists could deadlock on markDoneSema.
+func gcLeakMarkDone() bool {
+	assertWorldStopped()
+
+	found := false
+	systemstack(func() {
+		// Mark the user stack as preemptible so that suspendG
+		// does not consider it stuck at an unsafe point.
+		curg := getg().m.curg
+		casGToWaiting(curg, _Grunning, waitReasonGCMarkTermination)
+
+		pp := getg().m.p.ptr()
+		for _, gp := range work.stackRoots {
+			if gp.leakCandidate && !gcLeakStillBlocked(gp) {
+				gcLeakScan(gp, &pp.gcw)
+				found = true
+			}
+		}
+		if !found {
+			// Nothing can wake up the remaining candidates.
+			n := 0
+			for _, gp := range work.stackRoots {
+				if gp.leakCandidate {
+					gp.leaked = true
+					n++
+				}
+			}
+			if n > 0 {
+				goroutineLeak.count.Add(int64(n))
+				if debug.partialdeadlock > 0 {
+					gcLeakReport(n)
+				}
+			}
+			for _, gp := range work.stackRoots {
+				if gp.leakCandidate {
+					gcLeakScan(gp, &pp.gcw)
+					found = true
+				}
+			}
+			goroutineLeak.enabled = false
+		}
+
+		// Publish the new work so the mark workers find it once
+		// the world restarts.
+		wbBufFlush1(pp)
+		pp.gcw.dispose()
+
+		casgstatus(curg, _Gwaiting, _Grunning)
+	})
+	return found
+}
+
+// gcLeakScan restores the pointers hidden from the GC for leak
+// candidate gp and scans its stack, as markroot would have.
+//
+// The world must be stopped.
+//
+//go:systemstack
+func gcLeakScan(gp *g, gcw *gcWork) {
+	gcLeakUnhide(gp)
+	gp.leakCandidate = false
+	stopped := suspendG(gp)
+	if stopped.dead {
+		gp.gcscandone = true
+		return
+	}
+	if gp.gcscandone {
+		throw("g already scanned")
+	}
+	workDone := scanstack(gp, gcw)
+	gp.gcscandone = true
+	resumeG(stopped)
+	gcController.stackScanWork.Add(workDone)
+}
+
+// gcLeakReport prints the n goroutines that the current GC cycle has
+// just found to be leaked, for GODEBUG=partialdeadlock=1.
+//
+// The world must be stopped, so that the stacks of these goroutines
+// cannot be shrunk while they are printed.
+//
+//go:systemstack
+func gcLeakReport(n int) {
+	printlock()
+	print("runtime: partial deadlock: ", n, " goroutine")
+	if n > 1 {
+		print("s")
+	}
+	print(" blocked forever\n")
+	for _, gp := range work.stackRoots {
+		if !gp.leakCandidate {
+			continue
+		}
+		print("\n")
+		goroutineheader(gp)
+		traceback(^uintptr(0), ^uintptr(0), 0, gp)
+	}
+	print("\n")
+	printunlock()
+}
@@ -1307,6 +1307,9 @@ func setMemoryLimit(in int64) (out int64) {
 	// Run on the system stack since we grab the heap lock.
 	systemstack(func() {
 		lock(&mheap_.lock)
+		if in >= 0 {
+			ctrlimits.customMemLimit.Store(true)
+		}
 		out = gcController.setMemoryLimit(in)
 		if in < 0 || out == in {
 			// If we're just checking the value or not changing
@@ -1322,7 +1325,14 @@ func setMemoryLimit(in int64) (out int64) {
 
 func readGOMEMLIMIT() int64 {
 	p := gogetenv("GOMEMLIMIT")
-	if p == "" || p == "off" {
+	if p == "" {
+		if n, ok := defaultMemoryLimit(); ok {
+			return n
+		}
+		return maxInt64
+	}
+	ctrlimits.customMemLimit.Store(true)
+	if p == "off" {
 		return maxInt64
 	}
 	n, ok := parseByteCount(p)
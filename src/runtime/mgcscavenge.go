@@ -87,6 +87,12 @@
 // "dense" packing heuristics are ignored (in other words, scavenging is "forced") because
 // in these scenarios returning memory to the OS is more important than keeping CPU
 // overheads low.
+//
+// Applications with unusual needs can pick a different trade-off with
+// GODEBUG=scavengepolicy=name (see scavengePolicy*) and can replace the gcPercent
+// goal with a fixed amount of retained memory with GODEBUG=scavengeretain=MiB,
+// or do the same with runtime/debug.SetScavengePolicy and SetScavengeRetain.
+// Neither affects scavenging for the memory limit or for debug.FreeOSMemory.
 
 package runtime
 
@@ -146,6 +152,110 @@ const (
 	scavChunkHiOccPages = uint16(scavChunkHiOccFrac * pallocChunkPages)
 )
 
+// Scavenging policies, selected with GODEBUG=scavengepolicy=name. The
+// names are in scavengePolicyNames, which is a slice rather than an array
+// so that dbgvars can refer to it statically: GODEBUG is parsed before
+// package initialization.
+const (
+	// scavengePolicyDefault balances RSS against the cost of reusing
+	// released memory, as described at the top of this file.
+	scavengePolicyDefault = iota
+
+	// scavengePolicyRelease returns free memory to the OS as soon as
+	// possible. The gcPercent goal only covers the heap in use at the end
+	// of the last GC, and the background and heap-growth scavengers
+	// ignore the density heuristics, as if forced.
+	scavengePolicyRelease
+
+	// scavengePolicyRetain keeps free memory for reuse. There is no
+	// gcPercent goal, so only the memory limit, a scavengeretain target,
+	// or debug.FreeOSMemory cause memory to be returned.
+	scavengePolicyRetain
+
+	// scavengePolicyHugePage never breaks up huge pages that may be in
+	// use. The background and heap-growth scavengers only release memory
+	// from chunks that are entirely free, and leave those chunks eligible
+	// for huge pages.
+	scavengePolicyHugePage
+)
+
+var scavengePolicyNames = []string{
+	scavengePolicyDefault:  "default",
+	scavengePolicyRelease:  "release",
+	scavengePolicyRetain:   "retain",
+	scavengePolicyHugePage: "hugepage",
+}
+
+// scavengeSettings are the scavenging settings made with runtime/debug.
+// Once made, they take precedence over GODEBUG, which may otherwise change
+// at any time.
+var scavengeSettings struct {
+	customPolicy atomic.Bool
+	policy       atomic.Int32
+	customRetain atomic.Bool
+	retain       atomic.Uint64 // bytes, or 0 for none
+}
+
+// scavengePolicy returns the current scavenging policy.
+func scavengePolicy() int32 {
+	if scavengeSettings.customPolicy.Load() {
+		return scavengeSettings.policy.Load()
+	}
+	return debug.scavengepolicy.Load()
+}
+
+// scavengeRetain returns the amount of retained heap memory the
+// application asked for, in bytes, or 0 if the policy decides.
+func scavengeRetain() uint64 {
+	if scavengeSettings.customRetain.Load() {
+		return scavengeSettings.retain.Load()
+	}
+	if retain := debug.scavengeretain.Load(); retain > 0 {
+		return uint64(retain) << 20
+	}
+	return 0
+}
+
+//go:linkname setScavengePolicy runtime/debug.setScavengePolicy
+func setScavengePolicy(name string) string {
+	old := scavengePolicyNames[scavengePolicy()]
+	if name == "" {
+		return old
+	}
+	for i, n := range scavengePolicyNames {
+		if n == name {
+			scavengeSettings.policy.Store(int32(i))
+			scavengeSettings.customPolicy.Store(true)
+			scavengeCommit()
+			return old
+		}
+	}
+	panic("runtime/debug: unknown scavenging policy " + name)
+}
+
+//go:linkname setScavengeRetain runtime/debug.setScavengeRetain
+func setScavengeRetain(in int64) int64 {
+	old := int64(scavengeRetain())
+	if in < 0 {
+		return old
+	}
+	scavengeSettings.retain.Store(uint64(in))
+	scavengeSettings.customRetain.Store(true)
+	scavengeCommit()
+	return old
+}
+
+// scavengeCommit applies a change of the scavenging settings to the
+// scavenger's goals right away, rather than at the next GC.
+func scavengeCommit() {
+	// Run on the system stack since we grab the heap lock.
+	systemstack(func() {
+		lock(&mheap_.lock)
+		gcControllerCommit()
+		unlock(&mheap_.lock)
+	})
+}
+
 // heapRetained returns an estimate of the current heap RSS.
 func heapRetained() uint64 {
 	return gcController.heapInUse.load() + gcController.heapFree.load()
@@ -199,13 +309,28 @@ func gcPaceScavenger(memoryLimit int64, heapGoal, lastHeapGoal uint64) {
 		return
 	}
 	// Compute our scavenging goal.
-	goalRatio := float64(heapGoal) / float64(lastHeapGoal)
-	gcPercentGoal := uint64(float64(memstats.lastHeapInUse) * goalRatio)
-	// Add retainExtraPercent overhead to retainedGoal. This calculation
-	// looks strange but the purpose is to arrive at an integer division
-	// (e.g. if retainExtraPercent = 12.5, then we get a divisor of 8)
-	// that also avoids the overflow from a multiplication.
-	gcPercentGoal += gcPercentGoal / (1.0 / (retainExtraPercent / 100.0))
+	var gcPercentGoal uint64
+	if retain := scavengeRetain(); retain > 0 {
+		// The application picked the goal.
+		gcPercentGoal = retain
+	} else {
+		switch scavengePolicy() {
+		case scavengePolicyRetain:
+			scavenge.gcPercentGoal.Store(^uint64(0))
+			return
+		case scavengePolicyRelease:
+			// Don't leave room for the heap to grow into.
+			gcPercentGoal = memstats.lastHeapInUse
+		default:
+			goalRatio := float64(heapGoal) / float64(lastHeapGoal)
+			gcPercentGoal = uint64(float64(memstats.lastHeapInUse) * goalRatio)
+			// Add retainExtraPercent overhead to retainedGoal. This calculation
+			// looks strange but the purpose is to arrive at an integer division
+			// (e.g. if retainExtraPercent = 12.5, then we get a divisor of 8)
+			// that also avoids the overflow from a multiplication.
+			gcPercentGoal += gcPercentGoal / (1.0 / (retainExtraPercent / 100.0))
+		}
+	}
 	// Align it to a physical page boundary to make the following calculations
 	// a bit more exact.
 	gcPercentGoal = (gcPercentGoal + uint64(physPageSize) - 1) &^ (uint64(physPageSize) - 1)
@@ -392,7 +517,9 @@ func (s *scavengerState) init() {
 	if s.scavenge == nil {
 		s.scavenge = func(n uintptr) (uintptr, int64) {
 			start := nanotime()
-			r := mheap_.pages.scavenge(n, nil, false)
+			force := scavengePolicy() == scavengePolicyRelease
+			forLimit := gcController.mappedReady.Load() > scavenge.memoryLimitGoal.Load()
+			r := mheap_.pages.scavenge(n, nil, force, forLimit)
 			end := nanotime()
 			if start >= end {
 				return r, 0
@@ -659,6 +786,7 @@ func bgscavenge(c chan int) {
 			continue
 		}
 		mheap_.pages.scav.releasedBg.Add(released)
+		mheap_.pages.scav.totalReleasedBg.Add(int64(released))
 		scavenger.sleep(workTime)
 	}
 }
@@ -666,16 +794,18 @@ func bgscavenge(c chan int) {
 // scavenge scavenges nbytes worth of free pages, starting with the
 // highest address first. Successive calls continue from where it left
 // off until the heap is exhausted. force makes all memory available to
-// scavenge, ignoring huge page heuristics.
+// scavenge, ignoring huge page heuristics. forLimit indicates that the
+// memory is scavenged for the memory limit, so that the scavenge policy
+// does not restrict it.
 //
 // Returns the amount of memory scavenged in bytes.
 //
 // scavenge always tries to scavenge nbytes worth of memory, and will
 // only fail to do so if the heap is exhausted for now.
-func (p *pageAlloc) scavenge(nbytes uintptr, shouldStop func() bool, force bool) uintptr {
+func (p *pageAlloc) scavenge(nbytes uintptr, shouldStop func() bool, force, forLimit bool) uintptr {
 	released := uintptr(0)
 	for released < nbytes {
-		ci, pageIdx := p.scav.index.find(force)
+		ci, pageIdx := p.scav.index.find(force, forLimit)
 		if ci == 0 {
 			break
 		}
@@ -770,8 +900,13 @@ func (p *pageAlloc) scavengeOne(ci chunkIdx, searchIdx uint, max uintptr) uintpt
 			p.update(addr, uintptr(npages), true, true)
 
 			// Grab whether the chunk is hugepage backed and if it is,
-			// clear it. We're about to break up this huge page.
-			shouldNoHugePage := p.scav.index.setNoHugePage(ci)
+			// clear it. We're about to break up this huge page, unless
+			// the chunk is entirely free and the policy is to keep such
+			// chunks eligible for huge pages, for when they are reused.
+			shouldNoHugePage := false
+			if scavengePolicy() != scavengePolicyHugePage || p.scav.index.chunks[ci].load().inUse != 0 {
+				shouldNoHugePage = p.scav.index.setNoHugePage(ci)
+			}
 
 			// With that done, it's safe to unlock.
 			unlock(p.mheapLock)
@@ -783,6 +918,7 @@ func (p *pageAlloc) scavengeOne(ci chunkIdx, searchIdx uint, max uintptr) uintpt
 				// It's dangerous to do so otherwise.
 				if shouldNoHugePage {
 					sysNoHugePage(unsafe.Pointer(chunkBase(ci)), pallocChunkBytes)
+					p.scav.hugePageBreaks.Add(1)
 				}
 				sysUnused(unsafe.Pointer(addr), uintptr(npages)*pageSize)
 
@@ -1057,6 +1193,10 @@ type scavengeIndex struct {
 	// Generation counter. Updated by nextGen at the end of each mark phase.
 	gen uint32
 
+	// hugePageChunks is the number of chunks whose scavChunkNoHugePage
+	// flag is unset. Updates are serialized by the pageAlloc lock.
+	hugePageChunks atomic.Uintptr
+
 	// test indicates whether or not we're in a test.
 	test bool
 }
@@ -1082,12 +1222,16 @@ func (s *scavengeIndex) grow(base, limit uintptr, sysStat *sysMemStat) uintptr {
 	if baseIdx := uintptr(chunkIndex(base)); minHeapIdx == 0 || baseIdx < minHeapIdx {
 		s.minHeapIdx.Store(baseIdx)
 	}
+	// New chunks start out eligible for huge pages. See scavChunkNoHugePage.
+	s.hugePageChunks.Add(uintptr(chunkIndex(limit) - chunkIndex(base)))
 	return s.sysGrow(base, limit, sysStat)
 }
 
 // find returns the highest chunk index that may contain pages available to scavenge.
 // It also returns an offset to start searching in the highest chunk.
-func (s *scavengeIndex) find(force bool) (chunkIdx, uint) {
+// Unless force or forLimit is set, the scavenge policy may restrict it
+// to chunks that are entirely free.
+func (s *scavengeIndex) find(force, forLimit bool) (chunkIdx, uint) {
 	cursor := &s.searchAddrBg
 	if force {
 		cursor = &s.searchAddrForce
@@ -1102,16 +1246,29 @@ func (s *scavengeIndex) find(force bool) (chunkIdx, uint) {
 	gen := s.gen
 	min := chunkIdx(s.minHeapIdx.Load())
 	start := chunkIndex(uintptr(searchAddr))
+	freeOnly := !force && !forLimit && scavengePolicy() == scavengePolicyHugePage
+	// skipped is set once a chunk that only freeOnly excludes is
+	// skipped. The cursor is then left alone, so that scavenging for
+	// the memory limit, which shares the cursor, still finds the chunk.
+	skipped := false
 	// N.B. We'll never map the 0'th chunk, so minHeapIdx ensures this loop overflow.
 	for i := start; i >= min; i-- {
 		// Skip over chunks.
-		if !s.chunks[i].load().shouldScavenge(gen, force) {
+		sc := s.chunks[i].load()
+		if !sc.shouldScavenge(gen, force) {
+			continue
+		}
+		if freeOnly && sc.inUse != 0 {
+			skipped = true
 			continue
 		}
 		// We're still scavenging this chunk.
 		if i == start {
 			return i, chunkPageIndex(uintptr(searchAddr))
 		}
+		if skipped {
+			return i, pallocChunkPages - 1
+		}
 		// Try to reduce searchAddr to newSearchAddr.
 		newSearchAddr := chunkBase(i) + pallocChunkBytes - pageSize
 		if marked {
@@ -1129,7 +1286,9 @@ func (s *scavengeIndex) find(force bool) (chunkIdx, uint) {
 		return i, pallocChunkPages - 1
 	}
 	// Clear searchAddr, because we've exhausted the heap.
-	cursor.Clear()
+	if !skipped {
+		cursor.Clear()
+	}
 	return 0, 0
 }
 
@@ -1143,6 +1302,7 @@ func (s *scavengeIndex) alloc(ci chunkIdx, npages uint) {
 	if !sc.isHugePage() && sc.inUse > scavChunkHiOccPages {
 		// Mark dense chunks as specifically backed by huge pages.
 		sc.setHugePage()
+		s.hugePageChunks.Add(1)
 		if !s.test {
 			sysHugePage(unsafe.Pointer(chunkBase(ci)), pallocChunkBytes)
 		}
@@ -1211,6 +1371,7 @@ func (s *scavengeIndex) setNoHugePage(ci chunkIdx) bool {
 	}
 	val.setNoHugePage()
 	s.chunks[ci].store(val)
+	s.hugePageChunks.Add(^uintptr(0))
 	return true
 }
 
@@ -615,7 +615,7 @@ func TestScavengeIndex(t *testing.T) {
 		find = func(want ChunkIdx, wantOffset uint) {
 			t.Helper()
 
-			got, gotOffset := si.Find(force)
+			got, gotOffset := si.Find(force, false)
 			if want != got {
 				t.Errorf("find: wanted chunk index %d, got %d", want, got)
 			}
@@ -829,6 +829,71 @@ func TestScavengeIndex(t *testing.T) {
 	})
 }
 
+func TestScavengeIndexHugePagePolicy(t *testing.T) {
+	defer SetScavengePolicy(SetScavengePolicy("hugepage"))
+
+	si := NewScavengeIndex(BaseChunkIdx, BaseChunkIdx+4)
+	si.AllocRange(PageBase(BaseChunkIdx, 0), PageBase(BaseChunkIdx+4, 0))
+	si.NextGen()
+	si.FreeRange(PageBase(BaseChunkIdx, 0), PageBase(BaseChunkIdx+4, 0))
+	for ci := BaseChunkIdx; ci < BaseChunkIdx+4; ci++ {
+		si.SetEmpty(ci)
+	}
+	si.ResetSearchAddrs()
+
+	// Free all of the first chunk, and leave some pages in use in the
+	// third, which the background scavenger finds first.
+	si.AllocRange(PageBase(BaseChunkIdx, 0), PageBase(BaseChunkIdx+1, 0))
+	si.FreeRange(PageBase(BaseChunkIdx, 0), PageBase(BaseChunkIdx+1, 0))
+	si.AllocRange(PageBase(BaseChunkIdx+2, 0), PageBase(BaseChunkIdx+2, 20))
+	si.FreeRange(PageBase(BaseChunkIdx+2, 10), PageBase(BaseChunkIdx+2, 20))
+	si.NextGen()
+
+	find := func(force, forLimit bool, want ChunkIdx) {
+		t.Helper()
+		if got, _ := si.Find(force, forLimit); got != want {
+			t.Fatalf("Find(%v, %v): got chunk index %d, want %d", force, forLimit, got, want)
+		}
+		if want != 0 {
+			si.SetEmpty(want)
+		}
+	}
+	// The background scavenger only gets the free chunk.
+	find(false, false, BaseChunkIdx)
+	find(false, false, 0)
+	// Scavenging for the memory limit ignores the policy, even after
+	// the background scavenger skipped the chunk.
+	find(false, true, BaseChunkIdx+2)
+	find(false, true, 0)
+
+	// Forced scavenging ignores the policy.
+	si.AllocRange(PageBase(BaseChunkIdx+2, 10), PageBase(BaseChunkIdx+2, 20))
+	si.FreeRange(PageBase(BaseChunkIdx+2, 10), PageBase(BaseChunkIdx+2, 20))
+	find(true, false, BaseChunkIdx+2)
+	find(true, false, 0)
+}
+
+func TestScavengeIndexHugePageChunks(t *testing.T) {
+	si := NewScavengeIndex(BaseChunkIdx, BaseChunkIdx+4)
+	if got := si.HugePageChunks(); got != 4 {
+		t.Fatalf("got %d huge page chunks initially, want 4", got)
+	}
+	if !si.SetNoHugePage(BaseChunkIdx + 1) {
+		t.Fatal("SetNoHugePage failed for a huge page chunk")
+	}
+	if si.SetNoHugePage(BaseChunkIdx + 1) {
+		t.Fatal("SetNoHugePage succeeded twice")
+	}
+	if got := si.HugePageChunks(); got != 3 {
+		t.Fatalf("got %d huge page chunks after SetNoHugePage, want 3", got)
+	}
+	// Densely allocating the chunk makes it eligible again.
+	si.AllocRange(PageBase(BaseChunkIdx+1, 0), PageBase(BaseChunkIdx+2, 0))
+	if got := si.HugePageChunks(); got != 4 {
+		t.Fatalf("got %d huge page chunks after dense allocation, want 4", got)
+	}
+}
+
 func TestScavChunkDataPack(t *testing.T) {
 	if !CheckPackScavChunkData(1918237402, 512, 512, 0b11) {
 		t.Error("failed pack/unpack check for scavChunkData 1")
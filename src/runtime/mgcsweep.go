@@ -545,6 +545,11 @@ func (sl *sweepLocked) sweep(preserve bool) bool {
 	// 2. A tiny object can have several finalizers setup for different offsets.
 	//    If such object is not marked, we need to queue all finalizers at once.
 	// Both 1 and 2 are possible at the same time.
+	// 3. Weak handles are cleared as soon as an object is found to be
+	//    unreachable, even if a finalizer is about to resurrect it.
+	// 4. Cleanups do not resurrect the object, so they are queued when
+	//    the object is freed, like profile records. If the object also
+	//    has a finalizer, the cleanups wait until it is freed later.
 	hadSpecials := s.specials != nil
 	siter := newSpecialsIter(s)
 	for siter.valid() {
@@ -565,13 +570,15 @@ func (sl *sweepLocked) sweep(preserve bool) bool {
 					break
 				}
 			}
-			// Pass 2: queue all finalizers _or_ handle profile record.
+			// Pass 2: queue all finalizers and clear any weak handles. Weak handles are cleared
+			// before finalization as specified by the weak package. See the documentation
+			// for that package for more details.
 			for siter.valid() && uintptr(siter.s.offset) < endOffset {
 				// Find the exact byte for which the special was setup
 				// (as opposed to object beginning).
 				special := siter.s
 				p := s.base() + uintptr(special.offset)
-				if special.kind == _KindSpecialFinalizer || !hasFin {
+				if special.kind == _KindSpecialFinalizer || special.kind == _KindSpecialWeakHandle || !hasFin {
 					siter.unlinkAndNext()
 					freeSpecial(special, unsafe.Pointer(p), size)
 				} else {
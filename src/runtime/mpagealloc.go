@@ -278,6 +278,17 @@ type pageAlloc struct {
 		// releasedEager is the amount of memory released eagerly this scavenge
 		// cycle.
 		releasedEager atomic.Uintptr
+
+		// totalReleasedBg, totalReleasedEager, and totalReleasedForced
+		// are the total amounts of memory released in the background,
+		// eagerly by the allocator, and by debug.FreeOSMemory.
+		totalReleasedBg     atomic.Uint64
+		totalReleasedEager  atomic.Uint64
+		totalReleasedForced atomic.Uint64
+
+		// hugePageBreaks is the number of times the scavenger marked a
+		// chunk ineligible for huge pages.
+		hugePageBreaks atomic.Uint64
 	}
 
 	// mheap_.lock. This level of indirection makes it possible
@@ -41,6 +41,9 @@ const (
 
 	// max depth of stack to record in bucket
 	maxStack = 32
+
+	// number of buckets in the histogram of object lifetimes
+	memProfLifetimeBuckets = 8
 )
 
 type bucketType int
@@ -128,6 +131,12 @@ type memRecord struct {
 	// C becomes the active cycle and when we've flushed it to
 	// active.
 	future [3]memRecordCycle
+
+	// lifetimes is the histogram of the lifetimes of the freed
+	// objects, or nil if GODEBUG=memproflifetimes=1 was not set
+	// when this bucket was created. It is accumulated in the same
+	// way as the counts above.
+	lifetimes *memLifetimes
 }
 
 // memRecordCycle
@@ -144,6 +153,44 @@ func (a *memRecordCycle) add(b *memRecordCycle) {
 	a.free_bytes += b.free_bytes
 }
 
+// memLifetimes records how long the objects freed from a memory profile
+// bucket lived, measured in heap profile cycles (that is, in garbage
+// collections) between allocation and free.
+type memLifetimes struct {
+	_      sys.NotInHeap
+	active memLifetimeCycle
+	future [3]memLifetimeCycle // indexed like memRecord.future
+}
+
+// memLifetimeCycle is a histogram of object lifetimes. Element 0 counts
+// objects that lived for fewer than 2 cycles, including those freed in
+// the cycle they were allocated in. Element i > 0 counts objects that
+// lived for [2^i, 2^(i+1)) cycles, except that the last element counts
+// all objects that lived longer.
+type memLifetimeCycle [memProfLifetimeBuckets]uintptr
+
+// add accumulates b into a. It does not zero b.
+func (a *memLifetimeCycle) add(b *memLifetimeCycle) {
+	for i := range a {
+		a[i] += b[i]
+	}
+}
+
+// memLifetimeBucket returns the element of a memLifetimeCycle that
+// counts objects that were allocated in heap profile cycle alloc and
+// freed in cycle free.
+func memLifetimeBucket(alloc, free uint32) int {
+	age := (free + mProfCycleWrap - alloc) % mProfCycleWrap
+	if age == 0 {
+		return 0
+	}
+	i := sys.Len64(uint64(age)) - 1
+	if i >= memProfLifetimeBuckets {
+		i = memProfLifetimeBuckets - 1
+	}
+	return i
+}
+
 // A blockRecord is the bucket data for a bucket of type blockProfile,
 // which is used in blocking and mutex profiles.
 type blockRecord struct {
@@ -218,6 +265,9 @@ func newBucket(typ bucketType, nstk int) *bucket {
 		throw("invalid profile bucket type")
 	case memProfile:
 		size += unsafe.Sizeof(memRecord{})
+		if debug.memproflifetimes != 0 {
+			size += unsafe.Sizeof(memLifetimes{})
+		}
 	case blockProfile, mutexProfile:
 		size += unsafe.Sizeof(blockRecord{})
 	}
@@ -225,6 +275,10 @@ func newBucket(typ bucketType, nstk int) *bucket {
 	b := (*bucket)(persistentalloc(size, 0, &memstats.buckhash_sys))
 	b.typ = typ
 	b.nstk = uintptr(nstk)
+	if typ == memProfile && debug.memproflifetimes != 0 {
+		mp := b.mp()
+		mp.lifetimes = (*memLifetimes)(add(unsafe.Pointer(mp), unsafe.Sizeof(*mp)))
+	}
 	return b
 }
 
@@ -391,6 +445,12 @@ func mProf_FlushLocked(index uint32) {
 		mpc := &mp.future[index]
 		mp.active.add(mpc)
 		*mpc = memRecordCycle{}
+
+		if lt := mp.lifetimes; lt != nil {
+			ltc := &lt.future[index]
+			lt.active.add(ltc)
+			*ltc = memLifetimeCycle{}
+		}
 	}
 }
 
@@ -419,7 +479,8 @@ func mProf_Malloc(p unsafe.Pointer, size uintptr) {
 	var stk [maxStack]uintptr
 	nstk := callers(4, stk[:])
 
-	index := (mProfCycle.read() + 2) % uint32(len(memRecord{}.future))
+	cycle := mProfCycle.read()
+	index := (cycle + 2) % uint32(len(memRecord{}.future))
 
 	b := stkbucket(memProfile, size, stk[:nstk], true)
 	mp := b.mp()
@@ -435,13 +496,15 @@ func mProf_Malloc(p unsafe.Pointer, size uintptr) {
 	// deadlocks. Since the object must be alive during the call to
 	// mProf_Malloc, it's fine to do this non-atomically.
 	systemstack(func() {
-		setprofilebucket(p, b)
+		setprofilebucket(p, b, cycle)
 	})
 }
 
-// Called when freeing a profiled block.
-func mProf_Free(b *bucket, size uintptr) {
-	index := (mProfCycle.read() + 1) % uint32(len(memRecord{}.future))
+// Called when freeing a profiled block that was allocated
+// in heap profile cycle allocCycle.
+func mProf_Free(b *bucket, size uintptr, allocCycle uint32) {
+	cycle := mProfCycle.read()
+	index := (cycle + 1) % uint32(len(memRecord{}.future))
 
 	mp := b.mp()
 	mpc := &mp.future[index]
@@ -449,6 +512,9 @@ func mProf_Free(b *bucket, size uintptr) {
 	lock(&profMemFutureLock[index])
 	mpc.frees++
 	mpc.free_bytes += size
+	if lt := mp.lifetimes; lt != nil {
+		lt.future[index][memLifetimeBucket(allocCycle, cycle)]++
+	}
 	unlock(&profMemFutureLock[index])
 }
 
@@ -506,7 +572,13 @@ func saveblockevent(cycles, rate int64, skip int, which bucketType) {
 	} else {
 		nstk = gcallers(gp.m.curg, skip, stk[:])
 	}
-	b := stkbucket(which, 0, stk[:nstk], true)
+	saveBlockEventStack(cycles, rate, stk[:nstk], which)
+}
+
+// saveBlockEventStack records a block or mutex profile event of the
+// given duration, sampled at rate, with call stack stk.
+func saveBlockEventStack(cycles, rate int64, stk []uintptr, which bucketType) {
+	b := stkbucket(which, 0, stk, true)
 	bp := b.bp()
 
 	lock(&profBlockLock)
@@ -560,6 +632,126 @@ func mutexevent(cycles int64, skip int) {
 	}
 }
 
+// Contention on runtime-internal locks, such as sched.lock, the heap
+// lock or the locks of channels, is sampled at the mutex profile rate
+// and reported in the mutex profile with the call stack of the
+// goroutine that waited for the lock.
+//
+// The stack is captured by lock2 once it acquires the contended lock,
+// but saving it in the profile requires taking profile locks, so it is
+// kept in the M until the M releases its last lock.
+
+// lockTimer measures the time a lock2 call waits for a contended lock.
+type lockTimer struct {
+	lock      *mutex
+	tickStart int64
+}
+
+// begin is called when lock2 finds the lock held.
+func (lt *lockTimer) begin() {
+	rate := int64(atomic.Load64(&mutexprofilerate))
+	if rate > 0 && int64(fastrand())%rate == 0 {
+		lt.tickStart = cputicks()
+	}
+}
+
+// end is called when lock2 acquires the lock after begin.
+func (lt *lockTimer) end() {
+	if lt.tickStart != 0 {
+		getg().m.mLockProfile.recordLock(cputicks()-lt.tickStart, lt.lock)
+	}
+}
+
+// mLockProfile is the sampled contention of an M on runtime-internal
+// locks that is not yet saved in the mutex profile.
+type mLockProfile struct {
+	stack      [maxStack]uintptr // stack of the waiting goroutine, for cycles
+	cycles     int64             // contention to report with stack
+	cyclesLost int64             // contention for which no stack was kept
+	disabled   bool              // saving contention, which must not record more
+}
+
+// recordLock records that the M waited cycles to acquire l, and that
+// it holds l.
+//
+// An M holds at most one sample with its stack. If it waits for
+// another lock before it releases all its locks, the shorter wait is
+// reported as lost, without its stack.
+func (prof *mLockProfile) recordLock(cycles int64, l *mutex) {
+	if cycles <= 0 {
+		cycles = 1
+	}
+	if prof.disabled {
+		// Contention on the profile locks while saving a sample.
+		// Capturing its stack could overwrite the stack being saved.
+		prof.cyclesLost += cycles
+		return
+	}
+	if prof.cycles != 0 {
+		if cycles <= prof.cycles {
+			prof.cyclesLost += cycles
+			return
+		}
+		prof.cyclesLost += prof.cycles
+		prof.cycles = 0
+	}
+
+	gp := getg()
+	mp := gp.m
+	var nstk int
+	switch {
+	case gp == mp.curg || mp.curg == nil:
+		// Skip recordLock, lockTimer.end and lock2.
+		nstk = callers(3, prof.stack[:])
+	case gp == mp.g0:
+		// Report the user goroutine that switched to the system stack.
+		nstk = gcallers(mp.curg, 0, prof.stack[:])
+	default:
+		// The signal handler stack is of no interest.
+		prof.cyclesLost += cycles
+		return
+	}
+	if nstk < len(prof.stack) {
+		prof.stack[nstk] = 0
+	}
+	prof.cycles = cycles
+}
+
+// recordUnlock is called by unlock2 before it decrements m.locks.
+// It saves the sampled contention of the M when the M releases its
+// last lock.
+func (prof *mLockProfile) recordUnlock() {
+	if getg().m.locks == 1 && (prof.cycles != 0 || prof.cyclesLost != 0) {
+		prof.store()
+	}
+}
+
+// store saves the sampled contention of the M in the mutex profile.
+// The M must hold no lock other than the one it is releasing, and
+// m.locks keeps it from being preempted.
+func (prof *mLockProfile) store() {
+	prof.disabled = true
+	rate := int64(atomic.Load64(&mutexprofilerate))
+	if prof.cycles != 0 {
+		nstk := 0
+		for nstk < len(prof.stack) && prof.stack[nstk] != 0 {
+			nstk++
+		}
+		saveBlockEventStack(prof.cycles, rate, prof.stack[:nstk], mutexProfile)
+		prof.cycles = 0
+	}
+	if lost := prof.cyclesLost; lost != 0 {
+		prof.cyclesLost = 0
+		lostStk := [...]uintptr{abi.FuncPCABIInternal(_LostContendedRuntimeLock) + sys.PCQuantum}
+		saveBlockEventStack(lost, rate, lostStk[:], mutexProfile)
+	}
+	prof.disabled = false
+}
+
+// _LostContendedRuntimeLock stands in the mutex profile for the
+// contention on runtime-internal locks whose call stack was not kept.
+func _LostContendedRuntimeLock() { _LostContendedRuntimeLock() }
+
 // Go interface to profile data.
 
 // A StackRecord describes a single execution stack.
@@ -594,9 +786,9 @@ func (r *StackRecord) Stack() []uintptr {
 // at the beginning of main).
 var MemProfileRate int = 512 * 1024
 
-// disableMemoryProfiling is set by the linker if runtime.MemProfile
-// is not used and the link type guarantees nobody else could use it
-// elsewhere.
+// disableMemoryProfiling is set by the linker if memProfileWithLifetimes,
+// which runtime.MemProfile and runtime/pprof call, is not used and the
+// link type guarantees nobody else could use it elsewhere.
 var disableMemoryProfiling bool
 
 // A MemProfileRecord describes the live objects allocated
@@ -648,6 +840,24 @@ func (r *MemProfileRecord) Stack() []uintptr {
 // the testing package's -test.memprofile flag instead
 // of calling MemProfile directly.
 func MemProfile(p []MemProfileRecord, inuseZero bool) (n int, ok bool) {
+	return memProfileWithLifetimes(p, nil, inuseZero)
+}
+
+//go:linkname runtime_memProfileWithLifetimes runtime/pprof.runtime_memProfileWithLifetimes
+func runtime_memProfileWithLifetimes(p []MemProfileRecord, lifetimes [][memProfLifetimeBuckets]int64, inuseZero bool) (n int, ok bool) {
+	return memProfileWithLifetimes(p, lifetimes, inuseZero)
+}
+
+// memProfileWithLifetimes is like MemProfile, but if lifetimes is
+// non-nil it also copies the histogram of the lifetimes of the freed
+// objects of p[i] to lifetimes[i]. The histograms are all zero unless
+// GODEBUG=memproflifetimes=1 is set. lifetimes may be nil. If lifetimes
+// is non-nil, it must have the same length as p.
+func memProfileWithLifetimes(p []MemProfileRecord, lifetimes [][memProfLifetimeBuckets]int64, inuseZero bool) (n int, ok bool) {
+	if lifetimes != nil && len(lifetimes) != len(p) {
+		lifetimes = nil
+	}
+
 	cycle := mProfCycle.read()
 	// If we're between mProf_NextCycle and mProf_Flush, take care
 	// of flushing to the active profile so we only have to look
@@ -680,6 +890,10 @@ func MemProfile(p []MemProfileRecord, inuseZero bool) (n int, ok bool) {
 				lock(&profMemFutureLock[c])
 				mp.active.add(&mp.future[c])
 				mp.future[c] = memRecordCycle{}
+				if lt := mp.lifetimes; lt != nil {
+					lt.active.add(&lt.future[c])
+					lt.future[c] = memLifetimeCycle{}
+				}
 				unlock(&profMemFutureLock[c])
 			}
 			if inuseZero || mp.active.alloc_bytes != mp.active.free_bytes {
@@ -694,6 +908,9 @@ func MemProfile(p []MemProfileRecord, inuseZero bool) (n int, ok bool) {
 			mp := b.mp()
 			if inuseZero || mp.active.alloc_bytes != mp.active.free_bytes {
 				record(&p[idx], b)
+				if lifetimes != nil {
+					recordLifetimes(&lifetimes[idx], b)
+				}
 				idx++
 			}
 		}
@@ -724,6 +941,17 @@ func record(r *MemProfileRecord, b *bucket) {
 	}
 }
 
+// Write the lifetime histogram of b to r.
+func recordLifetimes(r *[memProfLifetimeBuckets]int64, b *bucket) {
+	lt := b.mp().lifetimes
+	for i := range r {
+		r[i] = 0
+		if lt != nil {
+			r[i] = int64(lt.active[i])
+		}
+	}
+}
+
 func iterate_memprof(fn func(*bucket, uintptr, *uintptr, uintptr, uintptr, uintptr)) {
 	lock(&profMemActiveLock)
 	head := (*bucket)(mbuckets.Load())
@@ -1161,6 +1389,60 @@ func goroutineProfileWithLabelsSync(p []StackRecord, labels []unsafe.Pointer) (n
 	return n, ok
 }
 
+//go:linkname runtime_goroutineLeakGC runtime/pprof.runtime_goroutineLeakGC
+func runtime_goroutineLeakGC() {
+	goroutineLeakGC()
+}
+
+//go:linkname runtime_goroutineLeakProfileWithLabels runtime/pprof.runtime_goroutineLeakProfileWithLabels
+func runtime_goroutineLeakProfileWithLabels(p []StackRecord, labels []unsafe.Pointer) (n int, ok bool) {
+	return goroutineLeakProfileWithLabels(p, labels)
+}
+
+// goroutineLeakProfileWithLabels is like goroutineProfileWithLabels,
+// but only reports goroutines that a previous call to goroutineLeakGC
+// found to be leaked.
+//
+// labels may be nil. If labels is non-nil, it must have the same length as p.
+func goroutineLeakProfileWithLabels(p []StackRecord, labels []unsafe.Pointer) (n int, ok bool) {
+	if labels != nil && len(labels) != len(p) {
+		labels = nil
+	}
+
+	stopTheWorld(stwGoroutineProfile)
+
+	// World is stopped, no locking required.
+	forEachGRace(func(gp *g) {
+		if gp.leaked {
+			n++
+		}
+	})
+
+	if n <= len(p) {
+		ok = true
+		r, lbl := p, labels
+		forEachGRace(func(gp *g) {
+			if !gp.leaked || len(r) == 0 {
+				return
+			}
+			// See goroutineProfileWithLabelsSync.
+			systemstack(func() { saveg(^uintptr(0), ^uintptr(0), gp, &r[0]) })
+			if labels != nil {
+				lbl[0] = gp.labels
+				lbl = lbl[1:]
+			}
+			r = r[1:]
+		})
+	}
+
+	if raceenabled {
+		raceacquire(unsafe.Pointer(&labelSync))
+	}
+
+	startTheWorld()
+	return n, ok
+}
+
 // GoroutineProfile returns n, the number of records in the active goroutine stack profile.
 // If len(p) >= n, GoroutineProfile copies the profile into p and returns n, true.
 // If len(p) < n, GoroutineProfile does not change p and returns n, false.
@@ -254,6 +254,16 @@ func panicfloat() {
 	panic(floatError)
 }
 
+var rangeExitError = error(errorString("range function continued iteration after exit"))
+
+// panicrangeexit is called by a range-over-func loop body when the
+// iterator function calls the loop body's yield function again after
+// the loop has exited, either because yield returned false or
+// because the range statement itself finished.
+func panicrangeexit() {
+	panic(rangeExitError)
+}
+
 var memoryError = error(errorString("invalid memory address or nil pointer dereference"))
 
 func panicmem() {
@@ -296,6 +306,151 @@ func deferproc(fn func()) {
 	// been set and must not be clobbered.
 }
 
+// deferrangefunc is called by functions that are about to
+// execute a range-over-function loop in which the loop body
+// may execute a defer statement. That defer needs to add to
+// the chain for the current function, not the func literal synthesized
+// to represent the loop body. To do that, the original function
+// calls deferrangefunc to obtain an opaque token representing
+// the current frame, and then the loop body uses deferprocat
+// instead of deferproc to add to that frame's defer lists.
+//
+// The token is an 'any' with underlying type *atomic.Pointer[_defer].
+// It is the atomically-updated head of a linked list of _defer structs
+// representing deferred calls. At the same time, we create a _defer
+// struct on the main g._defer list with d.head set to this head pointer.
+//
+// The g._defer list is now a linked list of deferred calls,
+// but an atomic list hanging off:
+//
+//	g._defer => d4 -> d3 -> drangefunc -> d2 -> d1 -> nil
+//	                         | .head
+//	                         |
+//	                         +--> dY -> dX -> nil
+//
+// with each -> indicating a d.link pointer, and where drangefunc
+// has the d.rangefunc = true bit set.
+// Note that the function being ranged over may have added
+// its own defers (d4 and d3), so drangefunc need not be at the
+// top of the list when deferprocat is used. This is why we pass
+// the atomic head explicitly.
+//
+// To keep misbehaving programs from crashing the runtime,
+// deferprocat pushes new defers onto the .head list atomically.
+// The fact that it is a separate list from the main goroutine
+// defer list means that the main goroutine's defers can still
+// be handled non-atomically.
+//
+// In the diagram, dY and dX are meant to be processed when
+// drangefunc would be processed, which is to say the defer order
+// should be d4, d3, dY, dX, d2, d1. To make that happen,
+// when defer processing reaches a d with rangefunc=true,
+// it calls deferconvert to atomically take the extras
+// away from d.head and then adds them to the main list.
+//
+// That is, deferconvert changes this list:
+//
+//	g._defer => drangefunc -> d2 -> d1 -> nil
+//	             | .head
+//	             |
+//	             +--> dY -> dX -> nil
+//
+// into this list:
+//
+//	g._defer => dY -> dX -> d2 -> d1 -> nil
+//
+// It also poisons *drangefunc.head so that any future
+// deferprocat using that head will throw.
+// (The atomic head is ordinary garbage collected memory so that
+// it's not a problem if user code holds onto it beyond
+// the lifetime of drangefunc.)
+func deferrangefunc() any {
+	gp := getg()
+	if gp.m.curg != gp {
+		// go code on the system stack can't defer
+		throw("defer on system stack")
+	}
+
+	fn := findfunc(getcallerpc())
+	if fn.deferreturn == 0 {
+		throw("no deferreturn")
+	}
+
+	d := newdefer()
+	d.link = gp._defer
+	gp._defer = d
+	d.pc = fn.entry() + uintptr(fn.deferreturn)
+	// We must not be preempted between calling getcallersp and
+	// storing it to d.sp because getcallersp's result is a
+	// uintptr stack pointer.
+	d.sp = getcallersp()
+
+	d.rangefunc = true
+	d.head = new(atomic.Pointer[_defer])
+
+	return d.head
+}
+
+// badDefer returns a fixed bad defer pointer for poisoning an atomic defer list.
+func badDefer() *_defer {
+	return (*_defer)(unsafe.Pointer(uintptr(1)))
+}
+
+// deferprocat is like deferproc but adds to the atomic list represented by frame.
+// See the doc comment for deferrangefunc for details.
+func deferprocat(fn func(), frame any) {
+	head := frame.(*atomic.Pointer[_defer])
+	if raceenabled {
+		racewritepc(unsafe.Pointer(head), getcallerpc(), abi.FuncPCABIInternal(deferprocat))
+	}
+	d1 := newdefer()
+	d1.fn = fn
+	for {
+		d1.link = head.Load()
+		if d1.link == badDefer() {
+			throw("defer after range func returned")
+		}
+		if head.CompareAndSwap(d1.link, d1) {
+			break
+		}
+	}
+
+	// Must be last - see deferproc above.
+	return0()
+}
+
+// deferconvert converts the rangefunc defer list of d0 into an ordinary list
+// following d0.
+// See the doc comment for deferrangefunc for details.
+func deferconvert(d0 *_defer) {
+	head := d0.head
+	if raceenabled {
+		racereadpc(unsafe.Pointer(head), getcallerpc(), abi.FuncPCABIInternal(deferconvert))
+	}
+	tail := d0.link
+	d0.rangefunc = false
+
+	var d *_defer
+	for {
+		d = head.Load()
+		if head.CompareAndSwap(d, badDefer()) {
+			break
+		}
+	}
+	if d == nil {
+		return
+	}
+	for d1 := d; ; d1 = d1.link {
+		d1.sp = d0.sp
+		d1.pc = d0.pc
+		if d1.link == nil {
+			d1.link = tail
+			break
+		}
+	}
+	d0.link = d
+}
+
 // deferprocStack queues a new deferred function with a defer record on the stack.
 // The defer record must have its fn field initialized.
 // All other fields can contain junk.
@@ -312,6 +467,7 @@ func deferprocStack(d *_defer) {
 	// The other fields are junk on entry to deferprocStack and
 	// are initialized here.
 	d.heap = false
+	d.rangefunc = false
 	d.sp = getcallersp()
 	d.pc = getcallerpc()
 	// The lines below implement:
@@ -695,6 +851,15 @@ func (p *_panic) nextDefer() (func(), bool) {
 		}
 
 		if d := gp._defer; d != nil && d.sp == uintptr(p.sp) {
+			if d.rangefunc {
+				// Splice the defers queued by range-over-func loop
+				// bodies into the main list in place of d.
+				deferconvert(d)
+				gp._defer = d.link
+				freedefer(d)
+				continue
+			}
+
 			fn := d.fn
 			d.fn = nil
 
@@ -831,10 +996,12 @@ func throw(s string) {
 	// Everything throw does should be recursively nosplit so it
 	// can be called even when it's unsafe to grow the stack.
 	systemstack(func() {
-		print("fatal error: ", s, "\n")
+		if debug.tracebackjson == 0 {
+			print("fatal error: ", s, "\n")
+		}
 	})
 
-	fatalthrow(throwTypeRuntime)
+	fatalthrow(throwTypeRuntime, s)
 }
 
 // fatal triggers a fatal error that dumps a stack trace and exits.
@@ -850,10 +1017,12 @@ func fatal(s string) {
 	// Everything fatal does should be recursively nosplit so it
 	// can be called even when it's unsafe to grow the stack.
 	systemstack(func() {
-		print("fatal error: ", s, "\n")
+		if debug.tracebackjson == 0 {
+			print("fatal error: ", s, "\n")
+		}
 	})
 
-	fatalthrow(throwTypeUser)
+	fatalthrow(throwTypeUser, s)
 }
 
 // runningPanicDefers is non-zero while running deferred functions for panic.
@@ -954,10 +1123,11 @@ func recovery(gp *g) {
 
 // fatalthrow implements an unrecoverable runtime throw. It freezes the
 // system, prints stack traces starting from its caller, and terminates the
-// process.
+// process. s is the fatal error message, which the caller has already
+// printed unless GODEBUG=tracebackjson=1 is set.
 //
 //go:nosplit
-func fatalthrow(t throwType) {
+func fatalthrow(t throwType, s string) {
 	pc := getcallerpc()
 	sp := getcallersp()
 	gp := getg()
@@ -973,9 +1143,17 @@ func fatalthrow(t throwType) {
 			exit(2)
 		}
 
-		startpanic_m()
+		var docrash bool
+		if startpanic_m() && debug.tracebackjson != 0 {
+			docrash = dopanicJSON_m(gp, pc, sp, nil, s)
+		} else {
+			if debug.tracebackjson != 0 {
+				print("fatal error: ", s, "\n")
+			}
+			docrash = dopanic_m(gp, pc, sp)
+		}
 
-		if dopanic_m(gp, pc, sp) {
+		if docrash {
 			// crash uses a decent amount of nosplit stack and we're already
 			// low on stack in throw, so crash on the system stack (unlike
 			// fatalpanic).
@@ -1010,6 +1188,10 @@ func fatalpanic(msgs *_panic) {
 			// decrement runningPanicDefers.
 			runningPanicDefers.Add(-1)
 
+			if debug.tracebackjson != 0 {
+				docrash = dopanicJSON_m(gp, pc, sp, msgs, "")
+				return
+			}
 			printpanics(msgs)
 		}
 
@@ -1124,6 +1306,13 @@ func dopanic_m(gp *g, pc, sp uintptr) bool {
 			tracebackothers(gp)
 		}
 	}
+	finishpanic_m()
+	return docrash
+}
+
+// finishpanic_m is called by dopanic_m and dopanicJSON_m once they have
+// printed the crash report.
+func finishpanic_m() {
 	unlock(&paniclk)
 
 	if panicking.Add(-1) != 0 {
@@ -1136,8 +1325,6 @@ func dopanic_m(gp *g, pc, sp uintptr) bool {
 	}
 
 	printDebugLog()
-
-	return docrash
 }
 
 // canpanic returns false if a signal should throw instead of
@@ -99,12 +99,13 @@ import (
 //
 // Each Profile has a unique name. A few profiles are predefined:
 //
-//	goroutine    - stack traces of all current goroutines
-//	heap         - a sampling of memory allocations of live objects
-//	allocs       - a sampling of all past memory allocations
-//	threadcreate - stack traces that led to the creation of new OS threads
-//	block        - stack traces that led to blocking on synchronization primitives
-//	mutex        - stack traces of holders of contended mutexes
+//	goroutine     - stack traces of all current goroutines
+//	goroutineleak - stack traces of goroutines that can never run again
+//	heap          - a sampling of memory allocations of live objects
+//	allocs        - a sampling of all past memory allocations
+//	threadcreate  - stack traces that led to the creation of new OS threads
+//	block         - stack traces that led to blocking on synchronization primitives
+//	mutex         - stack traces of holders of contended mutexes
 //
 // These predefined profiles maintain themselves and panic on an explicit
 // Add or Remove method call.
@@ -122,10 +123,37 @@ import (
 // flags select which to display, defaulting to -inuse_space (live objects,
 // scaled by size).
 //
+// If the program is run with GODEBUG=memproflifetimes=1, the heap profile
+// also records how long the sampled objects lived before being freed, in
+// garbage collection cycles. In the protocol buffer format, the freed
+// objects of each allocation site are reported as separate samples with a
+// numeric "lifetime" label: the objects in a sample with lifetime=n lived
+// for at least n and less than 2n cycles, except that lifetime=1 also
+// includes the objects freed in the cycle that allocated them, and the
+// largest value includes all longer lifetimes. The live objects and the objects
+// freed before the setting took effect have no lifetime label. Pprof's
+// -tagfocus and -tags flags select and summarize samples by lifetime.
+//
 // The allocs profile is the same as the heap profile but changes the default
 // pprof display to -alloc_space, the total number of bytes allocated since
 // the program began (including garbage-collected bytes).
 //
+// The goroutineleak profile runs a garbage collection that looks for
+// goroutines blocked on channel operations, sync.Mutex, sync.RWMutex
+// or sync.WaitGroup that no other goroutine can ever unblock, because
+// nothing that can still run refers to the channel or lock they are
+// blocked on. It reports the stacks of those goroutines. Goroutines
+// blocked on objects that are still reachable, for example through a
+// global variable, are not reported even if they are in fact stuck.
+//
+// The mutex profile reports the contention on sync.Mutex and
+// sync.RWMutex with the stack traces of the goroutines that unlock
+// them. It also reports the contention on locks internal to the
+// runtime, such as the locks of channels and of the scheduler, with the
+// stack traces of the goroutines that waited for them. Those stacks
+// start in runtime functions, and the contention whose stack could not
+// be kept is reported as runtime._LostContendedRuntimeLock.
+//
 // The CPU profile is not available as a Profile. It has a special API,
 // the StartCPUProfile and StopCPUProfile functions, because it streams
 // output to a writer during profiling.
@@ -149,6 +177,12 @@ var goroutineProfile = &Profile{
 	write: writeGoroutine,
 }
 
+var goroutineLeakProfile = &Profile{
+	name:  "goroutineleak",
+	count: countGoroutineLeak,
+	write: writeGoroutineLeak,
+}
+
 var threadcreateProfile = &Profile{
 	name:  "threadcreate",
 	count: countThreadCreate,
@@ -184,12 +218,13 @@ func lockProfiles() {
 	if profiles.m == nil {
 		// Initial built-in profiles.
 		profiles.m = map[string]*Profile{
-			"goroutine":    goroutineProfile,
-			"threadcreate": threadcreateProfile,
-			"heap":         heapProfile,
-			"allocs":       allocsProfile,
-			"block":        blockProfile,
-			"mutex":        mutexProfile,
+			"goroutine":     goroutineProfile,
+			"goroutineleak": goroutineLeakProfile,
+			"threadcreate":  threadcreateProfile,
+			"heap":          heapProfile,
+			"allocs":        allocsProfile,
+			"block":         blockProfile,
+			"mutex":         mutexProfile,
 		}
 	}
 }
@@ -554,22 +589,29 @@ func writeHeapInternal(w io.Writer, debug int, defaultSampleType string) error {
 	// and also try again if we're very unlucky.
 	// The loop should only execute one iteration in the common case.
 	var p []runtime.MemProfileRecord
+	var lifetimes [][memProfileLifetimeBuckets]int64
 	n, ok := runtime.MemProfile(nil, true)
 	for {
 		// Allocate room for a slightly bigger profile,
 		// in case a few more entries have been added
 		// since the call to MemProfile.
 		p = make([]runtime.MemProfileRecord, n+50)
-		n, ok = runtime.MemProfile(p, true)
+		if debug == 0 {
+			lifetimes = make([][memProfileLifetimeBuckets]int64, len(p))
+		}
+		n, ok = runtime_memProfileWithLifetimes(p, lifetimes, true)
 		if ok {
 			p = p[0:n]
+			if lifetimes != nil {
+				lifetimes = lifetimes[0:n]
+			}
 			break
 		}
 		// Profile grew; try again.
 	}
 
 	if debug == 0 {
-		return writeHeapProto(w, p, int64(runtime.MemProfileRate), defaultSampleType)
+		return writeHeapProto(w, p, lifetimes, int64(runtime.MemProfileRate), defaultSampleType)
 	}
 
 	sort.Slice(p, func(i, j int) bool { return p[i].InUseBytes() > p[j].InUseBytes() })
@@ -683,6 +725,14 @@ func countGoroutine() int {
 	return runtime.NumGoroutine()
 }
 
+// memProfileLifetimeBuckets is the number of buckets in the histograms
+// of object lifetimes returned by runtime_memProfileWithLifetimes.
+// It must match memProfLifetimeBuckets in runtime/mprof.go.
+const memProfileLifetimeBuckets = 8
+
+// runtime_memProfileWithLifetimes is defined in runtime/mprof.go
+func runtime_memProfileWithLifetimes(p []runtime.MemProfileRecord, lifetimes [][memProfileLifetimeBuckets]int64, inuseZero bool) (n int, ok bool)
+
 // runtime_goroutineProfileWithLabels is defined in runtime/mprof.go
 func runtime_goroutineProfileWithLabels(p []runtime.StackRecord, labels []unsafe.Pointer) (n int, ok bool)
 
@@ -694,6 +744,26 @@ func writeGoroutine(w io.Writer, debug int) error {
 	return writeRuntimeProfile(w, debug, "goroutine", runtime_goroutineProfileWithLabels)
 }
 
+// runtime_goroutineLeakGC is defined in runtime/mprof.go
+func runtime_goroutineLeakGC()
+
+// runtime_goroutineLeakProfileWithLabels is defined in runtime/mprof.go
+func runtime_goroutineLeakProfileWithLabels(p []runtime.StackRecord, labels []unsafe.Pointer) (n int, ok bool)
+
+// countGoroutineLeak returns the number of goroutines found to be
+// leaked by the most recent goroutine leak detection.
+func countGoroutineLeak() int {
+	n, _ := runtime_goroutineLeakProfileWithLabels(nil, nil)
+	return n
+}
+
+// writeGoroutineLeak runs goroutine leak detection and writes the
+// stacks of the leaked goroutines to w.
+func writeGoroutineLeak(w io.Writer, debug int) error {
+	runtime_goroutineLeakGC()
+	return writeRuntimeProfile(w, debug, "goroutineleak", runtime_goroutineLeakProfileWithLabels)
+}
+
 func writeGoroutineStacks(w io.Writer) error {
 	// We don't know how big the buffer needs to be to collect
 	// all the goroutines. Start with 1 MB and try a few times, doubling each time.
@@ -1228,23 +1228,28 @@ func TestMutexProfile(t *testing.T) {
 		if !strings.HasPrefix(prof, "--- mutex:\ncycles/second=") {
 			t.Errorf("Bad profile header:\n%v", prof)
 		}
-		prof = strings.Trim(prof, "\n")
-		lines := strings.Split(prof, "\n")
-		if len(lines) != 6 {
-			t.Errorf("expected 6 lines, got %d %q\n%s", len(lines), prof, prof)
+		// The profile may also have records of contention on
+		// runtime-internal locks, so find the record of blockMutex.
+		var lines []string
+		for _, rec := range strings.Split(strings.Trim(prof, "\n"), "\n\n") {
+			if strings.Contains(rec, "runtime/pprof.blockMutex") {
+				lines = strings.Split(rec, "\n")
+				lines = lines[max(len(lines)-3, 0):]
+			}
 		}
-		if len(lines) < 6 {
+		if len(lines) != 3 {
+			t.Errorf("expected 3 lines in the record of blockMutex, got %d %q\n%s", len(lines), lines, prof)
 			return
 		}
 		// checking that the line is like "35258904 1 @ 0x48288d 0x47cd28 0x458931"
 		r2 := `^\d+ \d+ @(?: 0x[[:xdigit:]]+)+`
 		//r2 := "^[0-9]+ 1 @ 0x[0-9a-f x]+$"
-		if ok, err := regexp.MatchString(r2, lines[3]); err != nil || !ok {
-			t.Errorf("%q didn't match %q", lines[3], r2)
+		if ok, err := regexp.MatchString(r2, lines[0]); err != nil || !ok {
+			t.Errorf("%q didn't match %q", lines[0], r2)
 		}
 		r3 := "^#.*runtime/pprof.blockMutex.*$"
-		if ok, err := regexp.MatchString(r3, lines[5]); err != nil || !ok {
-			t.Errorf("%q didn't match %q", lines[5], r3)
+		if ok, err := regexp.MatchString(r3, lines[2]); err != nil || !ok {
+			t.Errorf("%q didn't match %q", lines[2], r3)
 		}
 		t.Logf(prof)
 	})
@@ -1272,6 +1277,56 @@ func TestMutexProfile(t *testing.T) {
 	})
 }
 
+func TestMutexProfileRuntimeLocks(t *testing.T) {
+	if runtime.NumCPU() < 2 {
+		t.Skip("contention on runtime locks requires parallelism")
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	old := runtime.SetMutexProfileFraction(1)
+	defer runtime.SetMutexProfileFraction(old)
+	if old != 0 {
+		t.Fatalf("need MutexProfileRate 0, got %d", old)
+	}
+
+	// Goroutines on several Ps sending on a buffered channel
+	// contend on its lock, which is internal to the runtime.
+	want := []string{"runtime.lockWithRank", "runtime.lock", "runtime.chansend", "runtime.chansend1", "runtime/pprof.contendChannel.func1"}
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		contendChannel()
+
+		var w bytes.Buffer
+		Lookup("mutex").WriteTo(&w, 0)
+		p, err := profile.Parse(&w)
+		if err != nil {
+			t.Fatalf("failed to parse profile: %v", err)
+		}
+		if err := p.CheckValid(); err != nil {
+			t.Fatalf("invalid profile: %v", err)
+		}
+		if containsStack(stacks(p), want) {
+			return
+		}
+	}
+	t.Errorf("no contention on a channel lock with stack %v in the mutex profile", want)
+}
+
+func contendChannel() {
+	c := make(chan int, 1000)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10000; j++ {
+				c <- j
+				<-c
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 func TestMutexProfileRateAdjust(t *testing.T) {
 	old := runtime.SetMutexProfileFraction(1)
 	defer runtime.SetMutexProfileFraction(old)
@@ -1462,6 +1517,172 @@ func containsCountsLabels(prof *profile.Profile, countLabels map[int64]map[strin
 	return true
 }
 
+func leakChanSend(c chan int) { c <- 1 }
+func leakChanRecv(c chan int) { <-c }
+func leakNilChan()            { var c chan int; <-c }
+
+func leakSelect(c1, c2 chan int) {
+	select {
+	case <-c1:
+	case c2 <- 1:
+	}
+}
+
+func leakMutexLock(mu *sync.Mutex)         { mu.Lock() }
+func leakWaitGroupWait(wg *sync.WaitGroup) { wg.Wait() }
+
+func stuckChanRecv(c chan int) { <-c }
+
+func stuckMutexLock(mu *sync.Mutex) {
+	mu.Lock()
+	mu.Unlock()
+}
+
+var (
+	stuckChan  = make(chan int)
+	stuckMutex sync.Mutex
+)
+
+func startLeakedGoroutines() {
+	go leakChanSend(make(chan int))
+	go leakChanRecv(make(chan int))
+	go leakSelect(make(chan int), make(chan int))
+	go leakNilChan()
+	// Keep the mutex out of the tiny allocator, where it could share
+	// a block with a reachable object.
+	mu := &new(struct {
+		sync.Mutex
+		_ [16]byte
+	}).Mutex
+	mu.Lock()
+	go leakMutexLock(mu)
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go leakWaitGroupWait(wg)
+}
+
+func TestGoroutineLeakProfile(t *testing.T) {
+	// Setting GOMAXPROCS to 1 ensures we can force all goroutines to the
+	// desired blocking point.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	startLeakedGoroutines()
+	stuckMutex.Lock()
+	go stuckChanRecv(stuckChan)
+	go stuckMutexLock(&stuckMutex)
+	live := make(chan int)
+	go stuckChanRecv(live)
+	for j := 0; j < 10; j++ {
+		runtime.Gosched()
+	}
+
+	var w bytes.Buffer
+	if err := Lookup("goroutineleak").WriteTo(&w, 1); err != nil {
+		t.Fatal(err)
+	}
+	prof := w.String()
+	for _, fn := range []string{"leakChanSend", "leakChanRecv", "leakSelect", "leakNilChan", "leakMutexLock", "leakWaitGroupWait"} {
+		if !strings.Contains(prof, "runtime/pprof."+fn+"+") {
+			t.Errorf("goroutineleak profile does not contain %s:\n%s", fn, prof)
+		}
+	}
+	for _, fn := range []string{"stuckChanRecv", "stuckMutexLock"} {
+		if strings.Contains(prof, "runtime/pprof."+fn+"+") {
+			t.Errorf("goroutineleak profile unexpectedly contains %s:\n%s", fn, prof)
+		}
+	}
+	if n := Lookup("goroutineleak").Count(); n < 6 {
+		t.Errorf("goroutineleak profile count is %d, want at least 6", n)
+	}
+
+	w.Reset()
+	if err := Lookup("goroutineleak").WriteTo(&w, 0); err != nil {
+		t.Fatal(err)
+	}
+	p, err := profile.Parse(&w)
+	if err != nil {
+		t.Fatalf("error parsing protobuf profile: %v", err)
+	}
+	if err := p.CheckValid(); err != nil {
+		t.Errorf("protobuf profile is invalid: %v", err)
+	}
+
+	close(live)
+	stuckChan <- 0
+	stuckMutex.Unlock()
+}
+
+func churnPingPong(ping, pong chan *int, stop chan struct{}) {
+	for {
+		select {
+		case p := <-ping:
+			pong <- p
+		case <-stop:
+			return
+		}
+	}
+}
+
+func churnLock(mu *sync.Mutex, wg *sync.WaitGroup, stop chan struct{}) {
+	defer wg.Done()
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		mu.Lock()
+		runtime.Gosched()
+		mu.Unlock()
+	}
+}
+
+func TestGoroutineLeakProfileChurn(t *testing.T) {
+	// Goroutines that keep waking each other up through objects only
+	// they can reach must never be reported, however the detection
+	// GC cycle interleaves with them.
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		ping, pong := make(chan *int), make(chan *int)
+		go churnPingPong(ping, pong, stop)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case ping <- new(int):
+					<-pong
+				case <-stop:
+					return
+				}
+			}
+		}()
+		mu := &new(struct {
+			sync.Mutex
+			_ [16]byte
+		}).Mutex
+		for j := 0; j < 2; j++ {
+			wg.Add(1)
+			go churnLock(mu, &wg, stop)
+		}
+	}
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	for i := 0; i < 5; i++ {
+		var w bytes.Buffer
+		if err := Lookup("goroutineleak").WriteTo(&w, 1); err != nil {
+			t.Fatal(err)
+		}
+		if prof := w.String(); strings.Contains(prof, "churn") || strings.Contains(prof, "TestGoroutineLeakProfileChurn") {
+			t.Fatalf("goroutineleak profile contains live goroutines:\n%s", prof)
+		}
+	}
+}
+
 func TestGoroutineProfileConcurrency(t *testing.T) {
 	testenv.MustHaveParallelism(t)
 
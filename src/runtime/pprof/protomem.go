@@ -12,7 +12,9 @@ import (
 )
 
 // writeHeapProto writes the current heap profile in protobuf format to w.
-func writeHeapProto(w io.Writer, p []runtime.MemProfileRecord, rate int64, defaultSampleType string) error {
+// lifetimes may be nil. If lifetimes is non-nil, lifetimes[i] is the
+// histogram of the lifetimes of the freed objects of p[i].
+func writeHeapProto(w io.Writer, p []runtime.MemProfileRecord, lifetimes [][memProfileLifetimeBuckets]int64, rate int64, defaultSampleType string) error {
 	b := newProfileBuilder(w)
 	b.pbValueType(tagProfile_PeriodType, "space", "bytes")
 	b.pb.int64Opt(tagProfile_Period, rate)
@@ -26,7 +28,7 @@ func writeHeapProto(w io.Writer, p []runtime.MemProfileRecord, rate int64, defau
 
 	values := []int64{0, 0, 0, 0}
 	var locs []uint64
-	for _, r := range p {
+	for i, r := range p {
 		hideRuntime := true
 		for tries := 0; tries < 2; tries++ {
 			stk := r.Stack()
@@ -50,17 +52,38 @@ func writeHeapProto(w io.Writer, p []runtime.MemProfileRecord, rate int64, defau
 			hideRuntime = false // try again, and show all frames next time.
 		}
 
-		values[0], values[1] = scaleHeapSample(r.AllocObjects, r.AllocBytes, rate)
-		values[2], values[3] = scaleHeapSample(r.InUseObjects(), r.InUseBytes(), rate)
 		var blockSize int64
 		if r.AllocObjects > 0 {
 			blockSize = r.AllocBytes / r.AllocObjects
 		}
-		b.pbSample(values, locs, func() {
+		labels := func() {
 			if blockSize != 0 {
 				b.pbLabel(tagSample_Label, "bytes", "", blockSize)
 			}
-		})
+		}
+
+		// Report the freed objects with a known lifetime in
+		// samples of their own, and the rest in the main sample.
+		allocObjects, allocBytes := r.AllocObjects, r.AllocBytes
+		if lifetimes != nil {
+			for k, count := range lifetimes[i] {
+				if count == 0 {
+					continue
+				}
+				allocObjects -= count
+				allocBytes -= count * blockSize
+				values[0], values[1] = scaleHeapSample(count, count*blockSize, rate)
+				values[2], values[3] = 0, 0
+				b.pbSample(values, locs, func() {
+					labels()
+					b.pbLabel(tagSample_Label, "lifetime", "", 1<<k)
+				})
+			}
+		}
+
+		values[0], values[1] = scaleHeapSample(allocObjects, allocBytes, rate)
+		values[2], values[3] = scaleHeapSample(r.InUseObjects(), r.InUseBytes(), rate)
+		b.pbSample(values, locs, labels)
 	}
 	b.build()
 	return nil
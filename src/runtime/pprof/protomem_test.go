@@ -7,6 +7,9 @@ package pprof
 import (
 	"bytes"
 	"internal/profile"
+	"internal/testenv"
+	"os"
+	"reflect"
 	"runtime"
 	"testing"
 )
@@ -69,7 +72,7 @@ func TestConvertMemProfile(t *testing.T) {
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			var buf bytes.Buffer
-			if err := writeHeapProto(&buf, rec, rate, tc.defaultSampleType); err != nil {
+			if err := writeHeapProto(&buf, rec, nil, rate, tc.defaultSampleType); err != nil {
 				t.Fatalf("writing profile: %v", err)
 			}
 
@@ -82,3 +85,141 @@ func TestConvertMemProfile(t *testing.T) {
 		})
 	}
 }
+
+func TestConvertMemProfileLifetimes(t *testing.T) {
+	addr1, _, _, _ := testPCs(t)
+	a1 := uintptr(addr1) + 1
+	rec := []runtime.MemProfileRecord{
+		{AllocBytes: 6 * 64, FreeBytes: 4 * 64, AllocObjects: 6, FreeObjects: 4, Stack0: [32]uintptr{a1}},
+	}
+	lifetimes := [][memProfileLifetimeBuckets]int64{
+		{0, 3, 0, 0, 0, 0, 0, 1},
+	}
+
+	var buf bytes.Buffer
+	if err := writeHeapProto(&buf, rec, lifetimes, 1, ""); err != nil {
+		t.Fatalf("writing profile: %v", err)
+	}
+	p, err := profile.Parse(&buf)
+	if err != nil {
+		t.Fatalf("profile.Parse: %v", err)
+	}
+
+	// The objects freed with a known lifetime are split off from
+	// the main sample, and the totals are unchanged.
+	want := map[int64][]int64{
+		0:   {2, 2 * 64, 2, 2 * 64},
+		2:   {3, 3 * 64, 0, 0},
+		128: {1, 64, 0, 0},
+	}
+	if len(p.Sample) != len(want) {
+		t.Fatalf("got %d samples, want %d", len(p.Sample), len(want))
+	}
+	for _, s := range p.Sample {
+		var lifetime int64
+		if l := s.NumLabel["lifetime"]; len(l) == 1 {
+			lifetime = l[0]
+		}
+		if !reflect.DeepEqual(s.Value, want[lifetime]) {
+			t.Errorf("sample with lifetime %d: got values %v, want %v", lifetime, s.Value, want[lifetime])
+		}
+		if got := s.NumLabel["bytes"]; !reflect.DeepEqual(got, []int64{64}) {
+			t.Errorf("sample with lifetime %d: got bytes label %v, want [64]", lifetime, got)
+		}
+	}
+}
+
+var (
+	shortLivedSink *[64]byte
+	longLivedSink  []*[128]byte
+)
+
+//go:noinline
+func allocateShortLived() {
+	for i := 0; i < 100; i++ {
+		shortLivedSink = new([64]byte)
+	}
+	shortLivedSink = nil
+}
+
+//go:noinline
+func allocateLongLived() {
+	longLivedSink = make([]*[128]byte, 0, 100)
+	for i := 0; i < 100; i++ {
+		longLivedSink = append(longLivedSink, new([128]byte))
+	}
+}
+
+func TestHeapProfileLifetimes(t *testing.T) {
+	if os.Getenv("GO_PPROF_TEST_LIFETIMES") == "" {
+		testenv.MustHaveExec(t)
+		exe, err := os.Executable()
+		if err != nil {
+			t.Skipf("can't find test executable: %v", err)
+		}
+		cmd := testenv.CleanCmdEnv(testenv.Command(t, exe, "-test.run=^TestHeapProfileLifetimes$", "-test.v"))
+		cmd.Env = append(cmd.Env, "GO_PPROF_TEST_LIFETIMES=1", "GODEBUG=memproflifetimes=1")
+		out, err := cmd.CombinedOutput()
+		t.Logf("%s", out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	defer func(old int) { runtime.MemProfileRate = old }(runtime.MemProfileRate)
+	runtime.MemProfileRate = 1
+
+	allocateShortLived()
+	allocateLongLived()
+	for i := 0; i < 20; i++ {
+		runtime.GC()
+	}
+	longLivedSink = nil
+	// The frees are published once the cycle that swept them
+	// is complete.
+	for i := 0; i < 3; i++ {
+		runtime.GC()
+	}
+
+	var buf bytes.Buffer
+	if err := Lookup("heap").WriteTo(&buf, 0); err != nil {
+		t.Fatalf("writing profile: %v", err)
+	}
+	p, err := profile.Parse(&buf)
+	if err != nil {
+		t.Fatalf("profile.Parse: %v", err)
+	}
+
+	// freed[fn][lifetime] is the number of objects allocated by fn
+	// that were freed with that lifetime label.
+	freed := map[string]map[int64]int64{
+		"runtime/pprof.allocateShortLived": {},
+		"runtime/pprof.allocateLongLived":  {},
+	}
+	for _, s := range p.Sample {
+		l := s.NumLabel["lifetime"]
+		if len(l) != 1 || len(s.Location) == 0 || len(s.Location[0].Line) == 0 {
+			continue
+		}
+		if m, ok := freed[s.Location[0].Line[0].Function.Name]; ok {
+			m[l[0]] += s.Value[0]
+		}
+	}
+	t.Logf("freed objects by lifetime: %v", freed)
+
+	check := func(fn string, ok func(lifetime int64) bool) {
+		var n int64
+		for lifetime, count := range freed[fn] {
+			if !ok(lifetime) {
+				t.Errorf("%s: %d objects freed with lifetime %d", fn, count, lifetime)
+			}
+			n += count
+		}
+		if n < 90 {
+			t.Errorf("%s: got %d objects freed with a lifetime, want about 100", fn, n)
+		}
+	}
+	check("runtime/pprof.allocateShortLived", func(lifetime int64) bool { return lifetime <= 2 })
+	check("runtime/pprof.allocateLongLived", func(lifetime int64) bool { return lifetime >= 16 })
+}
@@ -0,0 +1,147 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pprof
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// runtime_newLabelUsage is defined in runtime/usage.go.
+func runtime_newLabelUsage(epoch uint64) unsafe.Pointer
+
+// runtime_stopLabelUsage is defined in runtime/usage.go.
+func runtime_stopLabelUsage() uint64
+
+// runtime_setLabelUsage is defined in runtime/usage.go.
+func runtime_setLabelUsage(p unsafe.Pointer)
+
+// runtime_readLabelUsage is defined in runtime/usage.go.
+func runtime_readLabelUsage(p unsafe.Pointer) runtime.GoroutineUsage
+
+// LabelUsage describes the resources used by goroutines while they had
+// a set of labels.
+type LabelUsage struct {
+	Labels LabelSet
+
+	// RunningTime is the time, in nanoseconds, the goroutines spent
+	// running Go code, as described by runtime.GoroutineUsage. It is
+	// not CPU time.
+	RunningTime int64
+
+	// AllocBytes and AllocObjects are the cumulative number of bytes
+	// and heap objects allocated by the goroutines.
+	AllocBytes   uint64
+	AllocObjects uint64
+}
+
+var labelUsage struct {
+	mu    sync.Mutex                     // serializes StartLabelUsage and StopLabelUsage
+	epoch uint64                         // runtime epoch of the next label sets; guarded by mu
+	sets  atomic.Pointer[labelUsageSets] // nil if disabled
+}
+
+// labelUsageSets are the label sets of one epoch of label usage
+// accounting, from StartLabelUsage to StopLabelUsage.
+type labelUsageSets struct {
+	epoch uint64
+	m     sync.Map // *labelUsageSet keyed by labelMap.String
+}
+
+type labelUsageSet struct {
+	labels *labelMap
+	usage  unsafe.Pointer // runtime labelUsage
+}
+
+// StartLabelUsage enables the accounting of the resources used by
+// goroutines for each set of labels.
+//
+// Once enabled, the running time and allocations of a goroutine are
+// accounted to its labels from the next time it sets them, with Do or
+// SetGoroutineLabels, as well as those of the goroutines it then
+// creates, which inherit its labels. Goroutines without labels are
+// not accounted.
+//
+// Accounting is cheap enough to cover every request of a server,
+// unlike profiles, which only sample. Each distinct set of labels is
+// kept until StopLabelUsage, so labels should not take unbounded
+// values, such as request IDs.
+func StartLabelUsage() {
+	labelUsage.mu.Lock()
+	defer labelUsage.mu.Unlock()
+	if labelUsage.sets.Load() == nil {
+		labelUsage.sets.Store(&labelUsageSets{epoch: labelUsage.epoch})
+	}
+}
+
+// StopLabelUsage stops the accounting of resources by labels,
+// and discards the usage accounted so far.
+func StopLabelUsage() {
+	labelUsage.mu.Lock()
+	defer labelUsage.mu.Unlock()
+	if labelUsage.sets.Swap(nil) != nil {
+		// Goroutines may still have label sets of this epoch, even
+		// after the next StartLabelUsage. The runtime ignores them.
+		labelUsage.epoch = runtime_stopLabelUsage()
+	}
+}
+
+// ReadLabelUsage returns the resources used by goroutines for each set
+// of labels since StartLabelUsage, sorted by labels.
+//
+// The usage of goroutines other than the caller is updated each time
+// they stop running, so it may miss the current run of running
+// goroutines.
+func ReadLabelUsage() []LabelUsage {
+	sets := labelUsage.sets.Load()
+	if sets == nil {
+		return nil
+	}
+	var keys []string
+	sets.m.Range(func(k, _ any) bool {
+		keys = append(keys, k.(string))
+		return true
+	})
+	sort.Strings(keys)
+	r := make([]LabelUsage, 0, len(keys))
+	for _, k := range keys {
+		v, _ := sets.m.Load(k)
+		s := v.(*labelUsageSet)
+		u := runtime_readLabelUsage(s.usage)
+		var set LabelSet
+		for key, value := range *s.labels {
+			set.list = append(set.list, label{key, value})
+		}
+		sort.Slice(set.list, func(i, j int) bool {
+			return set.list[i].key < set.list[j].key
+		})
+		r = append(r, LabelUsage{
+			Labels:       set,
+			RunningTime:  u.RunningTime,
+			AllocBytes:   u.AllocBytes,
+			AllocObjects: u.AllocObjects,
+		})
+	}
+	return r
+}
+
+// setLabelUsage sets where the usage of the calling goroutine is
+// accounted, when it sets its labels to l.
+func setLabelUsage(l *labelMap) {
+	sets := labelUsage.sets.Load()
+	if sets == nil || l == nil || len(*l) == 0 {
+		runtime_setLabelUsage(nil)
+		return
+	}
+	key := l.String()
+	v, ok := sets.m.Load(key)
+	if !ok {
+		v, _ = sets.m.LoadOrStore(key, &labelUsageSet{labels: l, usage: runtime_newLabelUsage(sets.epoch)})
+	}
+	runtime_setLabelUsage(v.(*labelUsageSet).usage)
+}
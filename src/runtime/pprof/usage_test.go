@@ -0,0 +1,109 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pprof
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var labelUsageSink []byte
+
+func TestLabelUsage(t *testing.T) {
+	StartLabelUsage()
+	defer StopLabelUsage()
+
+	spin := func(d time.Duration) {
+		for start := time.Now(); time.Since(start) < d; {
+		}
+	}
+	ctx := context.Background()
+	Do(ctx, Labels("tenant", "a"), func(ctx context.Context) {
+		for i := 0; i < 1000; i++ {
+			labelUsageSink = make([]byte, 1024)
+		}
+		spin(10 * time.Millisecond)
+	})
+	// Goroutines inherit the labels, and their usage.
+	Do(ctx, Labels("tenant", "b"), func(ctx context.Context) {
+		done := make(chan bool)
+		go func() {
+			spin(30 * time.Millisecond)
+			done <- true
+		}()
+		<-done
+	})
+	// Same labels, created separately.
+	Do(ctx, Labels("tenant", "a"), func(ctx context.Context) {
+		spin(10 * time.Millisecond)
+	})
+	// Unlabeled.
+	spin(10 * time.Millisecond)
+
+	usage := ReadLabelUsage()
+	if len(usage) != 2 {
+		t.Fatalf("got usage for %d label sets, want 2: %+v", len(usage), usage)
+	}
+	a, b := usage[0], usage[1]
+	if want := Labels("tenant", "a"); !reflect.DeepEqual(a.Labels, want) {
+		t.Errorf("got labels %v, want %v", a.Labels, want)
+	}
+	if want := Labels("tenant", "b"); !reflect.DeepEqual(b.Labels, want) {
+		t.Errorf("got labels %v, want %v", b.Labels, want)
+	}
+	// Spinning goroutines may wait to be scheduled after preemption,
+	// which is not running time.
+	if a.RunningTime < int64(10*time.Millisecond) || a.AllocBytes < 1000*1024 || a.AllocObjects < 1000 {
+		t.Errorf("got usage %+v for tenant a, want at least 10ms of running time and 1000 objects of 1KiB", a)
+	}
+	if b.RunningTime < int64(15*time.Millisecond) {
+		t.Errorf("got usage %+v for tenant b, want at least 15ms of running time", b)
+	}
+	if total := a.RunningTime + b.RunningTime; total > int64(100*time.Millisecond) {
+		t.Errorf("got %v of running time for labeled goroutines, want less than 100ms", time.Duration(total))
+	}
+
+	StopLabelUsage()
+	if usage := ReadLabelUsage(); usage != nil {
+		t.Errorf("got usage %+v after StopLabelUsage, want nil", usage)
+	}
+}
+
+func TestLabelUsageStop(t *testing.T) {
+	StartLabelUsage()
+	defer StopLabelUsage()
+
+	alloc, done := make(chan bool), make(chan bool)
+	Do(context.Background(), Labels("tenant", "a"), func(ctx context.Context) {
+		go func() {
+			<-alloc
+			for i := 0; i < 1000; i++ {
+				labelUsageSink = make([]byte, 1024)
+			}
+			done <- true
+		}()
+	})
+	var set *labelUsageSet
+	labelUsage.sets.Load().m.Range(func(_, v any) bool {
+		set = v.(*labelUsageSet)
+		return false
+	})
+
+	// The goroutine still has the labels, but not the label set,
+	// once accounting stops, even if it starts again.
+	StopLabelUsage()
+	StartLabelUsage()
+	before := runtime_readLabelUsage(set.usage)
+	alloc <- true
+	<-done
+	if after := runtime_readLabelUsage(set.usage); after != before {
+		t.Errorf("got usage %+v after StopLabelUsage, want %+v", after, before)
+	}
+	if usage := ReadLabelUsage(); len(usage) != 0 {
+		t.Errorf("got usage %+v for goroutines labeled before StopLabelUsage, want none", usage)
+	}
+}
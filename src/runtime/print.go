@@ -83,6 +83,18 @@ func printunlock() {
 // write to goroutine-local buffer if diverting output,
 // or else standard error.
 func gwrite(b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	if gp := getg(); gp != nil && gp.m != nil && gp.m.printjson {
+		printjsonescaped(b)
+		return
+	}
+	gwriteraw(b)
+}
+
+// gwriteraw is gwrite without escaping for JSON.
+func gwriteraw(b []byte) {
 	if len(b) == 0 {
 		return
 	}
@@ -329,6 +329,128 @@ func forcegchelper() {
 	}
 }
 
+// start the container limits helper goroutine
+func init() {
+	if GOOS == "linux" && (debug.containermaxprocs != 0 && debug.updatemaxprocs != 0 || debug.containermemlimit != 0) {
+		go containerLimitsHelper()
+	}
+}
+
+// containerLimitsPeriod is how often sysmon checks the limits of the
+// container of the process.
+const containerLimitsPeriod = 1e9 // 1 second
+
+// containerLimitsHelper applies the changes of GOMAXPROCS and of the
+// memory limit that follow from changes of the limits of the container,
+// which sysmon cannot apply itself.
+func containerLimitsHelper() {
+	ctrlimits.g = getg()
+	for {
+		gopark(parkContainerLimitsHelper, nil, waitReasonContainerLimitsIdle, traceBlockSystemGoroutine, 1)
+		// this goroutine is explicitly resumed by sysmon
+		if procs := ctrlimits.procs; procs > 0 {
+			stopTheWorldGC(stwGOMAXPROCS)
+			if !ctrlimits.customProcs.Load() {
+				// newprocs will be processed by startTheWorld
+				newprocs = procs
+			}
+			startTheWorldGC()
+		}
+		if limit := ctrlimits.memLimit; limit >= 0 {
+			systemstack(func() {
+				lock(&mheap_.lock)
+				if !ctrlimits.customMemLimit.Load() {
+					gcController.setMemoryLimit(limit)
+					gcControllerCommit()
+				}
+				unlock(&mheap_.lock)
+			})
+		}
+	}
+}
+
+// parkContainerLimitsHelper marks the container limits helper idle once
+// it is parked, so that sysmon can wake it.
+func parkContainerLimitsHelper(gp *g, _ unsafe.Pointer) bool {
+	ctrlimits.idle.Store(true)
+	return true
+}
+
+// sysmonCheckContainerLimits wakes the container limits helper if the
+// default GOMAXPROCS or memory limit changed with the limits of the
+// container.
+func sysmonCheckContainerLimits(now int64) {
+	if now-ctrlimits.lastCheck < containerLimitsPeriod || !ctrlimits.idle.Load() {
+		return
+	}
+	ctrlimits.lastCheck = now
+	procs := int32(0)
+	if debug.updatemaxprocs != 0 && !ctrlimits.customProcs.Load() {
+		if n := defaultGOMAXPROCS(); n != gomaxprocs {
+			procs = n
+		}
+	}
+	memLimit := int64(-1)
+	if !ctrlimits.customMemLimit.Load() {
+		if n, ok := defaultMemoryLimit(); ok && n != gcController.memoryLimit.Load() {
+			memLimit = n
+		}
+	}
+	if procs == 0 && memLimit < 0 {
+		return
+	}
+	ctrlimits.idle.Store(false)
+	ctrlimits.procs = procs
+	ctrlimits.memLimit = memLimit
+	var list gList
+	list.push(ctrlimits.g)
+	injectglist(&list)
+}
+
+// defaultGOMAXPROCS returns GOMAXPROCS to use when the GOMAXPROCS
+// environment variable does not set it: the number of CPUs, capped by
+// the CPU limit of the container unless GODEBUG=containermaxprocs=0.
+func defaultGOMAXPROCS() int32 {
+	if debug.containermaxprocs == 0 {
+		return ncpu
+	}
+	quota, period, ok := osCPULimit()
+	if !ok {
+		return ncpu
+	}
+	return limitGOMAXPROCS(ncpu, quota, period)
+}
+
+// limitGOMAXPROCS returns GOMAXPROCS for a CPU limit of quota CPU time
+// per period with ncpu CPUs. The limit is rounded up to a whole number
+// of CPUs, and is at least 2, so that a goroutine that keeps a P busy
+// does not hold up all the others.
+func limitGOMAXPROCS(ncpu int32, quota, period int64) int32 {
+	n := (quota + period - 1) / period
+	if n < 2 {
+		n = 2
+	}
+	if n < int64(ncpu) {
+		return int32(n)
+	}
+	return ncpu
+}
+
+// defaultMemoryLimit returns the memory limit to use when the GOMEMLIMIT
+// environment variable does not set it, if GODEBUG=containermemlimit=1:
+// 90% of the memory limit of the container, which leaves room for the
+// memory that the Go runtime does not account for.
+func defaultMemoryLimit() (int64, bool) {
+	if debug.containermemlimit == 0 {
+		return 0, false
+	}
+	limit, ok := osMemoryLimit()
+	if !ok {
+		return 0, false
+	}
+	return limit - limit/10, true
+}
+
 // Gosched yields the processor, allowing other goroutines to run. It does not
 // suspend the current goroutine, so execution resumes automatically.
 //
@@ -396,6 +518,13 @@ func gopark(unlockf func(*g, unsafe.Pointer) bool, lock unsafe.Pointer, reason w
 	releasem(mp)
 	// can't do anything that might move the G between Ms here.
 	mcall(park_m)
+	// If a GC cycle looking for leaked goroutines hid gp.waiting
+	// while we were parked, restore it before our caller looks at
+	// it. This must not call anything that could copy the stack.
+	if gp.hiddenWaiting != 0 {
+		gp.waiting = (*sudog)(unsafe.Pointer(gp.hiddenWaiting))
+		gp.hiddenWaiting = 0
+	}
 }
 
 // Puts the current goroutine into a waiting state and unlocks the lock.
@@ -743,6 +872,9 @@ func schedinit() {
 	secure()
 	checkfds()
 	parsedebugvars()
+	if debug.containermaxprocs != 0 || debug.containermemlimit != 0 {
+		osInitContainerLimits() // must run before gcinit reads the default memory limit
+	}
 	gcinit()
 
 	// if disableMemoryProfiling is set, update MemProfileRate to 0 to turn off memprofile.
@@ -758,6 +890,9 @@ func schedinit() {
 	procs := ncpu
 	if n, ok := atoi32(gogetenv("GOMAXPROCS")); ok && n > 0 {
 		procs = n
+		ctrlimits.customProcs.Store(true)
+	} else {
+		procs = defaultGOMAXPROCS()
 	}
 	if procresize(procs) != nil {
 		throw("unknown runnable goroutine during bootstrap")
@@ -872,6 +1007,7 @@ func mcommoninit(mp *m, id int64) {
 
 func (mp *m) becomeSpinning() {
 	mp.spinning = true
+	mp.spinningSince = nanotime()
 	sched.nmspinning.Add(1)
 	sched.needspinning.Store(0)
 }
@@ -1074,6 +1210,14 @@ func casgstatus(gp *g, oldval, newval uint32) {
 		}
 	}
 
+	if usageEnabled.Load() {
+		if oldval == _Grunning {
+			gp.usage.stopRunning()
+		} else if newval == _Grunning {
+			gp.usage.startRunning()
+		}
+	}
+
 	if oldval == _Grunning {
 		// Track every gTrackingPeriod time a goroutine transitions out of running.
 		if casgstatusAlwaysTrack || gp.trackingSeq%gTrackingPeriod == 0 {
@@ -1123,19 +1267,37 @@ func casgstatus(gp *g, oldval, newval uint32) {
 		gp.trackingStamp = now
 	case _Grunnable:
 		// We just transitioned into runnable, so record what
-		// time that happened.
+		// time that happened, and why.
 		now := nanotime()
 		gp.trackingStamp = now
+		switch oldval {
+		case _Gdead:
+			gp.runnableWhy = runnableCreated
+		case _Grunning:
+			gp.runnableWhy = runnablePreempted
+		default:
+			gp.runnableWhy = runnableWoken
+		}
 	case _Grunning:
 		// We're transitioning into running, so turn off
 		// tracking and record how much time we spent in
 		// runnable.
 		gp.tracking = false
 		sched.timeToRun.record(gp.runnableTime)
+		sched.timeToRunByReason[gp.runnableWhy].record(gp.runnableTime)
 		gp.runnableTime = 0
 	}
 }
 
+// Reasons why a G became runnable, for the scheduling latencies
+// in sched.timeToRunByReason.
+const (
+	runnableWoken     = iota // the G was blocked, or in a syscall
+	runnablePreempted        // the G was running, and was preempted or yielded
+	runnableCreated          // the G was just created
+	runnableNumReasons
+)
+
 // casGToWaiting transitions gp from old to _Gwaiting, and sets the wait reason.
 //
 // Use this over casgstatus when possible to ensure that a waitreason is set.
@@ -1175,6 +1337,9 @@ func casGToPreemptScan(gp *g, old, new uint32) {
 	acquireLockRank(lockRankGscan)
 	for !gp.atomicstatus.CompareAndSwap(_Grunning, _Gscan|_Gpreempted) {
 	}
+	if usageEnabled.Load() {
+		gp.usage.stopRunning()
+	}
 }
 
 // casGFromPreempted attempts to transition gp from _Gpreempted to
@@ -2540,9 +2705,16 @@ func stopm() {
 	gp.m.nextp = 0
 }
 
+// addSpinningTime adds the time mp has spent spinning to the total.
+// It is called when mp stops spinning.
+func (mp *m) addSpinningTime() {
+	sched.totalSpinningTime.Add(nanotime() - mp.spinningSince)
+}
+
 func mspinning() {
 	// startm's caller incremented nmspinning. Set the new M's spinning.
 	getg().m.spinning = true
+	getg().m.spinningSince = nanotime()
 }
 
 // Schedules some M to run the p (creates an M if necessary).
@@ -2647,6 +2819,9 @@ func startm(pp *p, spinning, lockheld bool) {
 	}
 	// The caller incremented nmspinning, so set m.spinning in the new M.
 	nmp.spinning = spinning
+	if spinning {
+		nmp.spinningSince = nanotime()
+	}
 	nmp.nextp.set(pp)
 	notewakeup(&nmp.park)
 	// Ownership transfer of pp committed by wakeup. Preemption is now
@@ -2820,6 +2995,7 @@ func gcstopm() {
 	}
 	if gp.m.spinning {
 		gp.m.spinning = false
+		gp.m.addSpinningTime()
 		// OK to just drop nmspinning here,
 		// startTheWorld will unpark threads as necessary.
 		if sched.nmspinning.Add(-1) < 0 {
@@ -2860,6 +3036,14 @@ func execute(gp *g, inheritTime bool) {
 	// M.
 	mp.curg = gp
 	gp.m = mp
+	if gp.tracking {
+		// Sample the run queue lengths at the same rate as the
+		// scheduling latency.
+		pp := mp.p.ptr()
+		h := atomic.Load(&pp.runqhead)
+		sched.localRunqLen.record(uint64(atomic.Load(&pp.runqtail) - h))
+		sched.globalRunqLen.record(uint64(sched.runqsize))
+	}
 	casgstatus(gp, _Grunnable, _Grunning)
 	gp.waitsince = 0
 	gp.preempt = false
@@ -3123,6 +3307,7 @@ top:
 	wasSpinning := mp.spinning
 	if mp.spinning {
 		mp.spinning = false
+		mp.addSpinningTime()
 		if sched.nmspinning.Add(-1) < 0 {
 			throw("findrunnable: negative nmspinning")
 		}
@@ -3479,6 +3664,7 @@ func resetspinning() {
 		throw("resetspinning: not a spinning m")
 	}
 	gp.m.spinning = false
+	gp.m.addSpinningTime()
 	nmspinning := sched.nmspinning.Add(-1)
 	if nmspinning < 0 {
 		throw("findrunnable: negative nmspinning")
@@ -3906,7 +4092,9 @@ func goexit0(gp *g) {
 	gp.waitreason = waitReasonZero
 	gp.param = nil
 	gp.labels = nil
+	gp.usage = gUsage{}
 	gp.timer = nil
+	gp.leaked = false
 
 	if gcBlackenEnabled != 0 && gp.gcAssistBytes > 0 {
 		// Flush assist credit to the global pool. This gives
@@ -4567,6 +4755,9 @@ func newproc1(fn *funcval, callergp *g, callerpc uintptr) *g {
 		// Only user goroutines inherit pprof labels.
 		if mp.curg != nil {
 			newg.labels = mp.curg.labels
+			if l := mp.curg.usage.labels; l != nil && l.current() {
+				newg.usage.labels = l
+			}
 		}
 		if goroutineProfile.active {
 			// A concurrent goroutine profile is running. It should include
@@ -4615,9 +4806,16 @@ func newproc1(fn *funcval, callergp *g, callerpc uintptr) *g {
 // saveAncestors copies previous ancestors of the given caller g and
 // includes info for the current caller into a new set of tracebacks for
 // a g being created.
+//
+// With GODEBUG=tracebackcreators=N, only where each ancestor was created
+// is recorded, which saves unwinding the caller's stack.
 func saveAncestors(callergp *g) *[]ancestorInfo {
+	max, stacks := debug.tracebackancestors, true
+	if max <= 0 {
+		max, stacks = debug.tracebackcreators, false
+	}
 	// Copy all prior info, except for the root goroutine (goid 0).
-	if debug.tracebackancestors <= 0 || callergp.goid == 0 {
+	if max <= 0 || callergp.goid == 0 {
 		return nil
 	}
 	var callerAncestors []ancestorInfo
@@ -4625,16 +4823,19 @@ func saveAncestors(callergp *g) *[]ancestorInfo {
 		callerAncestors = *callergp.ancestors
 	}
 	n := int32(len(callerAncestors)) + 1
-	if n > debug.tracebackancestors {
-		n = debug.tracebackancestors
+	if n > max {
+		n = max
 	}
 	ancestors := make([]ancestorInfo, n)
 	copy(ancestors[1:], callerAncestors)
 
-	var pcs [tracebackInnerFrames]uintptr
-	npcs := gcallers(callergp, 0, pcs[:])
-	ipcs := make([]uintptr, npcs)
-	copy(ipcs, pcs[:])
+	var ipcs []uintptr
+	if stacks {
+		var pcs [tracebackInnerFrames]uintptr
+		npcs := gcallers(callergp, 0, pcs[:])
+		ipcs = make([]uintptr, npcs)
+		copy(ipcs, pcs[:])
+	}
 	ancestors[0] = ancestorInfo{
 		pcs:  ipcs,
 		goid: callergp.goid,
@@ -5508,6 +5709,7 @@ func checkdead() {
 			// become spinning on its own anyways.
 			sched.nmspinning.Add(1)
 			mp.spinning = true
+			mp.spinningSince = nanotime()
 			mp.nextp.set(pp)
 			notewakeup(&mp.park)
 			return
@@ -5678,6 +5880,8 @@ func sysmon() {
 			injectglist(&list)
 			unlock(&forcegc.lock)
 		}
+		// check if the limits of the container changed
+		sysmonCheckContainerLimits(now)
 		if debug.schedtrace > 0 && lasttrace+int64(debug.schedtrace)*1000000 <= now {
 			lasttrace = now
 			schedtrace(debug.scheddetail > 0)
@@ -6463,6 +6667,7 @@ func runqsteal(pp, p2 *p, stealRunNextG bool) *g {
 	if n == 0 {
 		return nil
 	}
+	sched.steals.Add(int64(n))
 	n--
 	gp := pp.runq[(t+n)%uint32(len(pp.runq))].ptr()
 	if n == 0 {
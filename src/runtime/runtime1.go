@@ -300,6 +300,7 @@ type dbgVar struct {
 	value  *int32        // for variables that can only be set at startup
 	atomic *atomic.Int32 // for variables that can be changed during execution
 	def    int32         // default value (ideally zero)
+	names  []string      // if non-nil, names that may be given for the values 0, 1, ...
 }
 
 // Holds variables parsed from GODEBUG env var,
@@ -309,6 +310,8 @@ type dbgVar struct {
 var debug struct {
 	cgocheck           int32
 	clobberfree        int32
+	containermaxprocs  int32
+	containermemlimit  int32
 	dontfreezetheworld int32
 	efence             int32
 	gccheckmark        int32
@@ -318,30 +321,42 @@ var debug struct {
 	gctrace            int32
 	invalidptr         int32
 	madvdontneed       int32 // for Linux; issue 28466
+	memproflifetimes   int32
 	scavtrace          int32
 	scheddetail        int32
 	schedtrace         int32
 	tracebackancestors int32
+	tracebackcreators  int32
+	tracebackjson      int32
+	tracebacklabels    int32
+	partialdeadlock    int32
 	asyncpreemptoff    int32
 	harddecommit       int32
 	adaptivestackstart int32
 	tracefpunwindoff   int32
+	traceadvanceperiod int32
+	updatemaxprocs     int32
 
 	// debug.malloc is used as a combined debug check
 	// in the malloc function and should be set
 	// if any of the below debug options is != 0.
 	malloc         bool
 	allocfreetrace int32
+	heapdumptypes  int32
 	inittrace      int32
 	sbrk           int32
 
-	panicnil atomic.Int32
+	panicnil       atomic.Int32
+	scavengepolicy atomic.Int32
+	scavengeretain atomic.Int32
 }
 
 var dbgvars = []*dbgVar{
 	{name: "allocfreetrace", value: &debug.allocfreetrace},
 	{name: "clobberfree", value: &debug.clobberfree},
 	{name: "cgocheck", value: &debug.cgocheck},
+	{name: "containermaxprocs", value: &debug.containermaxprocs},
+	{name: "containermemlimit", value: &debug.containermemlimit},
 	{name: "dontfreezetheworld", value: &debug.dontfreezetheworld},
 	{name: "efence", value: &debug.efence},
 	{name: "gccheckmark", value: &debug.gccheckmark},
@@ -356,19 +371,32 @@ var dbgvars = []*dbgVar{
 	{name: "scheddetail", value: &debug.scheddetail},
 	{name: "schedtrace", value: &debug.schedtrace},
 	{name: "tracebackancestors", value: &debug.tracebackancestors},
+	{name: "tracebackcreators", value: &debug.tracebackcreators},
+	{name: "tracebackjson", value: &debug.tracebackjson},
+	{name: "tracebacklabels", value: &debug.tracebacklabels},
+	{name: "partialdeadlock", value: &debug.partialdeadlock},
 	{name: "asyncpreemptoff", value: &debug.asyncpreemptoff},
 	{name: "inittrace", value: &debug.inittrace},
 	{name: "harddecommit", value: &debug.harddecommit},
+	{name: "heapdumptypes", value: &debug.heapdumptypes},
+	{name: "memproflifetimes", value: &debug.memproflifetimes},
 	{name: "adaptivestackstart", value: &debug.adaptivestackstart},
 	{name: "tracefpunwindoff", value: &debug.tracefpunwindoff},
+	{name: "traceadvanceperiod", value: &debug.traceadvanceperiod},
+	{name: "updatemaxprocs", value: &debug.updatemaxprocs},
 	{name: "panicnil", atomic: &debug.panicnil},
+	{name: "scavengepolicy", atomic: &debug.scavengepolicy, names: scavengePolicyNames},
+	{name: "scavengeretain", atomic: &debug.scavengeretain},
 }
 
 func parsedebugvars() {
 	// defaults
 	debug.cgocheck = 1
+	debug.containermaxprocs = 1
 	debug.invalidptr = 1
 	debug.adaptivestackstart = 1 // set this to 0 to turn larger initial goroutine stacks off
+	debug.traceadvanceperiod = defaultTraceAdvancePeriod
+	debug.updatemaxprocs = 1
 	if GOOS == "linux" {
 		// On Linux, MADV_FREE is faster than MADV_DONTNEED,
 		// but doesn't affect many of the statistics that
@@ -405,7 +433,7 @@ func parsedebugvars() {
 	// apply environment settings
 	parsegodebug(godebug, nil)
 
-	debug.malloc = (debug.allocfreetrace | debug.inittrace | debug.sbrk) != 0
+	debug.malloc = (debug.allocfreetrace | debug.heapdumptypes | debug.inittrace | debug.sbrk) != 0
 
 	setTraceback(gogetenv("GOTRACEBACK"))
 	traceback_env = traceback_cache
@@ -482,7 +510,13 @@ func parsegodebug(godebug string, seen map[string]bool) {
 		} else {
 			for _, v := range dbgvars {
 				if v.name == key {
-					if n, ok := atoi32(value); ok {
+					n, ok := atoi32(value)
+					for i, name := range v.names {
+						if name == value {
+							n, ok = int32(i), true
+						}
+					}
+					if ok {
 						if seen == nil && v.value != nil {
 							*v.value = n
 						} else if v.atomic != nil {
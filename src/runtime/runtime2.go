@@ -386,6 +386,10 @@ type sudog struct {
 	waitlink *sudog // g.waiting list or semaRoot
 	waittail *sudog // semaRoot
 	c        *hchan // channel
+
+	// hiddenElem holds elem of a semaRoot sudog while it is hidden
+	// from the garbage collector by goroutine leak detection.
+	hiddenElem uintptr
 }
 
 type libcall struct {
@@ -474,6 +478,7 @@ type g struct {
 	raceignore    int8  // ignore race detection events
 	tracking      bool  // whether we're tracking this G for sched latency statistics
 	trackingSeq   uint8 // used to decide whether to track this G
+	runnableWhy   uint8 // why the G became runnable, one of the runnable* constants, only used when tracking
 	trackingStamp int64 // timestamp of when the G last started being tracked
 	runnableTime  int64 // the amount of time spent runnable, cleared when running, only used when tracking
 	lockedm       muintptr
@@ -484,12 +489,14 @@ type g struct {
 	sigpc         uintptr
 	parentGoid    uint64          // goid of goroutine that created this goroutine
 	gopc          uintptr         // pc of go statement that created this goroutine
-	ancestors     *[]ancestorInfo // ancestor information goroutine(s) that created this goroutine (only used if debug.tracebackancestors)
+	ancestors     *[]ancestorInfo // ancestor information goroutine(s) that created this goroutine (only used if debug.tracebackancestors or debug.tracebackcreators)
 	startpc       uintptr         // pc of goroutine function
 	racectx       uintptr
 	waiting       *sudog         // sudog structures this g is waiting on (that have a valid elem ptr); in lock order
+	waitsema      *sudog         // sudog queued on a semaRoot while blocked in semacquire1
 	cgoCtxt       []uintptr      // cgo traceback context
 	labels        unsafe.Pointer // profiler labels
+	usage         gUsage         // resource usage, see usage.go
 	timer         *timer         // cached timer for time.Sleep
 	selectDone    atomic.Uint32  // are we participating in a select and did someone win the race?
 
@@ -510,6 +517,18 @@ type g struct {
 	// and check for debt in the malloc hot path. The assist ratio
 	// determines how this corresponds to scan work debt.
 	gcAssistBytes int64
+
+	// leakCandidate indicates that the current GC cycle is looking
+	// for goroutine leaks and has deferred scanning this G's stack
+	// until it is known whether the G can ever be woken up.
+	// leaked is set once the GC has proven that it never can.
+	// Both are only modified with the world stopped. See mgcleak.go.
+	leakCandidate bool
+	leaked        bool
+
+	// hiddenWaiting holds waiting while it is hidden from the
+	// garbage collector by goroutine leak detection.
+	hiddenWaiting uintptr
 }
 
 // gTrackingPeriod is the number of transitions out of _Grunning between
@@ -559,6 +578,7 @@ type m struct {
 	blocked       bool // m is blocked on a note
 	newSigstack   bool // minit on C thread called sigaltstack
 	printlock     int8
+	printjson     bool          // escape print output as the contents of a JSON string; see tracebackjson.go
 	incgo         bool          // m is executing a cgo call
 	isextra       bool          // m is an extra m
 	isExtraInC    bool          // m is an extra m that is not executing Go code
@@ -590,6 +610,10 @@ type m struct {
 	freelink    *m // on sched.freem
 	trace       mTraceState
 
+	spinningSince int64 // nanotime when the m started spinning
+
+	mLockProfile mLockProfile // fields relating to runtime.lock contention
+
 	// these are here because they are too large to be on the stack
 	// of low-level NOSPLIT functions.
 	libcall   libcall
@@ -860,6 +884,22 @@ type schedt struct {
 	// it transitions to _Grunning.
 	timeToRun timeHistogram
 
+	// timeToRunByReason splits timeToRun by the reason the G became
+	// runnable, indexed by the runnable* constants.
+	timeToRunByReason [runnableNumReasons]timeHistogram
+
+	// localRunqLen and globalRunqLen are distributions of the length
+	// of the local run queue of the P and of the global run queue,
+	// sampled when a G is scheduled at the same rate as timeToRun.
+	localRunqLen  lenHistogram
+	globalRunqLen lenHistogram
+
+	// steals is the number of Gs stolen from the run queues of other Ps.
+	steals atomic.Uint64
+
+	// totalSpinningTime is the sum of time Ms have spent spinning.
+	totalSpinningTime atomic.Int64
+
 	// idleTime is the total CPU time Ps have "spent" idle.
 	//
 	// Reset on each GC cycle.
@@ -969,6 +1009,22 @@ type forcegcstate struct {
 	idle atomic.Bool
 }
 
+type containerlimitsstate struct {
+	g    *g
+	idle atomic.Bool
+
+	// customProcs and customMemLimit are set once GOMAXPROCS and the
+	// memory limit are set by the environment or by the program, which
+	// stops their updates from the limits of the container.
+	customProcs    atomic.Bool
+	customMemLimit atomic.Bool
+
+	// Set by sysmon when it wakes the helper goroutine.
+	lastCheck int64 // nanotime of the last check of the limits
+	procs     int32 // GOMAXPROCS to set, or 0
+	memLimit  int64 // memory limit to set, or -1
+}
+
 // extendRandom extends the random numbers in r[:n] to the whole slice r.
 // Treats n<0 as n==0.
 func extendRandom(r []byte, n int) {
@@ -1000,17 +1056,20 @@ func extendRandom(r []byte, n int) {
 // and for heap defers, marked.
 type _defer struct {
 	// TODO(mdempsky): Remove blank fields and update cmd/compile.
-	_    bool // was started
-	heap bool
-	_    bool           // was openDefer
-	sp   uintptr        // sp at time of defer
-	pc   uintptr        // pc at time of defer
-	fn   func()         // can be nil for open-coded defers
-	_    unsafe.Pointer // was _panic
-	link *_defer        // next defer on G; can point to either heap or stack!
-	_    unsafe.Pointer // was fd
-	_    uintptr        // was varp
-	_    uintptr        // was framepc
+	_         bool // was started
+	heap      bool
+	rangefunc bool           // true for rangefunc list
+	sp        uintptr        // sp at time of defer
+	pc        uintptr        // pc at time of defer
+	fn        func()         // can be nil for open-coded defers
+	_         unsafe.Pointer // was _panic
+	link      *_defer        // next defer on G; can point to either heap or stack!
+
+	// If rangefunc is true, *head is the head of the atomic linked list
+	// during a range-over-func execution.
+	head *atomic.Pointer[_defer]
+	_    uintptr // was varp
+	_    uintptr // was framepc
 }
 
 // A _panic holds information about an active panic.
@@ -1052,7 +1111,7 @@ type _panic struct {
 
 // ancestorInfo records details of where a goroutine was started.
 type ancestorInfo struct {
-	pcs  []uintptr // pcs from the stack of this goroutine
+	pcs  []uintptr // pcs from the stack of this goroutine; nil with debug.tracebackcreators
 	goid uint64    // goroutine id of this goroutine; original goroutine possibly dead
 	gopc uintptr   // pc of go statement that created this goroutine
 }
@@ -1094,6 +1153,8 @@ const (
 	waitReasonDebugCall                               // "debug call"
 	waitReasonGCMarkTermination                       // "GC mark termination"
 	waitReasonStoppingTheWorld                        // "stopping the world"
+	waitReasonContainerLimitsIdle                     // "container limits (idle)"
+	waitReasonGCWeakToStrongWait                      // "GC weak to strong wait"
 )
 
 var waitReasonStrings = [...]string{
@@ -1129,6 +1190,8 @@ var waitReasonStrings = [...]string{
 	waitReasonDebugCall:             "debug call",
 	waitReasonGCMarkTermination:     "GC mark termination",
 	waitReasonStoppingTheWorld:      "stopping the world",
+	waitReasonContainerLimitsIdle:   "container limits (idle)",
+	waitReasonGCWeakToStrongWait:    "GC weak to strong wait",
 }
 
 func (w waitReason) String() string {
@@ -1149,6 +1212,7 @@ var (
 	gomaxprocs int32
 	ncpu       int32
 	forcegc    forcegcstate
+	ctrlimits  containerlimitsstate
 	sched      schedt
 	newprocs   int32
 
@@ -157,7 +157,9 @@ func semacquire1(addr *uint32, lifo bool, profile semaProfileFlags, skipframes i
 		// Any semrelease after the cansemacquire knows we're waiting
 		// (we set nwait above), so go to sleep.
 		root.queue(addr, s, lifo)
+		gp.waitsema = s
 		goparkunlock(&root.lock, reason, traceBlockSync, 4+skipframes)
+		gp.waitsema = nil
 		if s.ticket != 0 || cansemacquire(addr) {
 			break
 		}
@@ -252,7 +254,7 @@ func (root *semaRoot) queue(addr *uint32, s *sudog, lifo bool) {
 	var last *sudog
 	pt := &root.treap
 	for t := *pt; t != nil; t = *pt {
-		if t.elem == unsafe.Pointer(addr) {
+		if t.semaAddr() == uintptr(unsafe.Pointer(addr)) {
 			// Already have addr in list.
 			if lifo {
 				// Substitute s in t's place in treap.
@@ -291,7 +293,7 @@ func (root *semaRoot) queue(addr *uint32, s *sudog, lifo bool) {
 			return
 		}
 		last = t
-		if uintptr(unsafe.Pointer(addr)) < uintptr(t.elem) {
+		if uintptr(unsafe.Pointer(addr)) < t.semaAddr() {
 			pt = &t.prev
 		} else {
 			pt = &t.next
@@ -334,10 +336,10 @@ func (root *semaRoot) dequeue(addr *uint32) (found *sudog, now int64) {
 	ps := &root.treap
 	s := *ps
 	for ; s != nil; s = *ps {
-		if s.elem == unsafe.Pointer(addr) {
+		if s.semaAddr() == uintptr(unsafe.Pointer(addr)) {
 			goto Found
 		}
-		if uintptr(unsafe.Pointer(addr)) < uintptr(s.elem) {
+		if uintptr(unsafe.Pointer(addr)) < s.semaAddr() {
 			ps = &s.prev
 		} else {
 			ps = &s.next
@@ -393,12 +395,23 @@ Found:
 	}
 	s.parent = nil
 	s.elem = nil
+	s.hiddenElem = 0
 	s.next = nil
 	s.prev = nil
 	s.ticket = 0
 	return s, now
 }
 
+// semaAddr returns the semaphore address s is queued on.
+// Goroutine leak detection may hide s.elem from the garbage
+// collector, so always use this instead of s.elem directly.
+func (s *sudog) semaAddr() uintptr {
+	if s.hiddenElem != 0 {
+		return s.hiddenElem
+	}
+	return uintptr(s.elem)
+}
+
 // rotateLeft rotates the tree rooted at node x.
 // turning (x a (y b c)) into (y (x a b) c).
 func (root *semaRoot) rotateLeft(x *sudog) {
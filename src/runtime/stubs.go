@@ -231,6 +231,18 @@ func noEscapePtr[T any](p *T) *T {
 	return (*T)(unsafe.Pointer(x ^ 0))
 }
 
+// escape forces any pointers in x to escape to the heap. It is the
+// opposite of noescape.
+func escape[T any](x T) T {
+	if alwaysFalse {
+		escapeSink = x
+	}
+	return x
+}
+
+var alwaysFalse bool
+var escapeSink any
+
 // Not all cgocallback frames are actually cgocallback,
 // so not all have these arguments. Mark them uintptr so that the GC
 // does not misinterpret memory when the arguments are not present.
@@ -10,3 +10,18 @@ package runtime
 func sbrk0() uintptr {
 	return 0
 }
+
+// osInitContainerLimits finds the limits of the container of the process.
+func osInitContainerLimits() {}
+
+// osCPULimit returns the CPU limit of the container, as a quota of CPU
+// time per period. ok is false if the container has no CPU limit.
+func osCPULimit() (quota, period int64, ok bool) {
+	return 0, 0, false
+}
+
+// osMemoryLimit returns the memory limit of the container in bytes.
+// ok is false if the container has no memory limit.
+func osMemoryLimit() (limit int64, ok bool) {
+	return 0, false
+}
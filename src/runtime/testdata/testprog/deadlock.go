@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"runtime"
 	"runtime/debug"
+	"runtime/metrics"
+	"sync"
 	"time"
 )
 
@@ -39,6 +41,7 @@ func init() {
 	register("GoschedInPanic", GoschedInPanic)
 	register("SyscallInPanic", SyscallInPanic)
 	register("PanicLoop", PanicLoop)
+	register("PartialDeadlock", PartialDeadlock)
 }
 
 func SimpleDeadlock() {
@@ -46,6 +49,49 @@ func SimpleDeadlock() {
 	panic("not reached")
 }
 
+// lockPair is large enough to stay out of the tiny allocator, so that
+// its mutexes do not share a block with reachable objects.
+type lockPair struct {
+	a, b sync.Mutex
+	_    [16]byte
+}
+
+func partialDeadlockExchange(in <-chan int, out chan<- int) {
+	out <- <-in
+}
+
+func partialDeadlockLock(first, second *sync.Mutex, locked *sync.WaitGroup) {
+	first.Lock()
+	locked.Done()
+	locked.Wait()
+	second.Lock()
+}
+
+func startPartialDeadlocks() {
+	c1, c2 := make(chan int), make(chan int)
+	go partialDeadlockExchange(c1, c2)
+	go partialDeadlockExchange(c2, c1)
+
+	p := new(lockPair)
+	var locked sync.WaitGroup
+	locked.Add(2)
+	go partialDeadlockLock(&p.a, &p.b, &locked)
+	go partialDeadlockLock(&p.b, &p.a, &locked)
+	locked.Wait()
+}
+
+func PartialDeadlock() {
+	startPartialDeadlocks()
+	time.Sleep(10 * time.Millisecond)
+	runtime.GC()
+	// A second collection must not report the same goroutines again.
+	runtime.GC()
+
+	s := []metrics.Sample{{Name: "/sched/goroutines/deadlocked:goroutines"}}
+	metrics.Read(s)
+	fmt.Println("deadlocked goroutines:", s[0].Value.Uint64())
+}
+
 func InitDeadlock() {
 	select {}
 	panic("not reached")
@@ -26,6 +26,7 @@ func init() {
 	register("GCZombie", GCZombie)
 	register("GCMemoryLimit", GCMemoryLimit)
 	register("GCMemoryLimitNoGCPercent", GCMemoryLimitNoGCPercent)
+	register("GCScavengeRetain", GCScavengeRetain)
 }
 
 func GCSys() {
@@ -418,3 +419,36 @@ func gcMemoryLimit(gcPercent int) {
 const memLimitUnit = 8000
 
 var memLimitSink []*[memLimitUnit]byte
+
+var scavengeSink [][]byte
+
+// GCScavengeRetain checks that with GODEBUG=scavengepolicy=retain, free
+// heap memory is only returned to the OS by debug.FreeOSMemory.
+func GCScavengeRetain() {
+	m := []metrics.Sample{
+		{Name: "/gc/scavenge/released/background:bytes"},
+		{Name: "/gc/scavenge/released/eager:bytes"},
+		{Name: "/gc/scavenge/released/forced:bytes"},
+	}
+	for round := 0; round < 4; round++ {
+		for i := 0; i < 64; i++ {
+			scavengeSink = append(scavengeSink, make([]byte, 1<<20))
+		}
+		scavengeSink = nil
+		runtime.GC()
+		runtime.GC()
+	}
+	time.Sleep(100 * time.Millisecond)
+	metrics.Read(m)
+	if bg, eager := m[0].Value.Uint64(), m[1].Value.Uint64(); bg != 0 || eager != 0 {
+		fmt.Printf("released %d bytes in the background and %d bytes eagerly, want none\n", bg, eager)
+		return
+	}
+	debug.FreeOSMemory()
+	metrics.Read(m)
+	if forced := m[2].Value.Uint64(); forced == 0 {
+		fmt.Println("FreeOSMemory released no memory")
+		return
+	}
+	fmt.Println("OK")
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"runtime"
+	"runtime/pprof"
+)
+
+func init() {
+	register("TracebackJSONPanic", TracebackJSONPanic)
+	register("TracebackJSONDeadlock", TracebackJSONDeadlock)
+	register("TracebackJSONDeep", TracebackJSONDeep)
+	register("TracebackAncestry", TracebackAncestry)
+}
+
+type tracebackJSONError struct{}
+
+func (tracebackJSONError) Error() string {
+	return "a \"quoted\"\tmessage\nspanning lines \x01"
+}
+
+func TracebackJSONPanic() {
+	ready := make(chan bool)
+	block := make(chan bool)
+	pprof.Do(context.Background(), pprof.Labels("request", "a\"b"), func(context.Context) {
+		go func() {
+			ready <- true
+			<-block
+		}()
+	})
+	<-ready
+	// Make sure the goroutine is blocked, and that a GC notes
+	// when it started waiting. The first GC has no earlier one
+	// to count the wait from.
+	for i := 0; i < 100; i++ {
+		runtime.Gosched()
+	}
+	runtime.GC()
+	runtime.GC()
+
+	defer func() {
+		panic(tracebackJSONError{})
+	}()
+	tracebackJSONNilDeref(nil)
+}
+
+//go:noinline
+func tracebackJSONNilDeref(p *int) {
+	*p = 1
+}
+
+func TracebackJSONDeadlock() {
+	select {}
+}
+
+func TracebackJSONDeep() {
+	tracebackJSONRecurse(200)
+}
+
+//go:noinline
+func tracebackJSONRecurse(n int) {
+	if n == 0 {
+		panic("deep")
+	}
+	tracebackJSONRecurse(n - 1)
+}
+
+// TracebackAncestry panics in a labeled goroutine created by a chain of
+// two other goroutines.
+func TracebackAncestry() {
+	pprof.Do(context.Background(), pprof.Labels("request", "1234", "user", "gopher"), func(context.Context) {
+		go tracebackAncestryServe()
+	})
+	select {}
+}
+
+func tracebackAncestryServe() {
+	go tracebackAncestryWorker()
+	select {}
+}
+
+func tracebackAncestryWorker() {
+	panic("worker failed")
+}
@@ -91,21 +91,22 @@ type traceBlockReason uint8
 // For maximal efficiency, just map the trace block reason directly to a trace
 // event.
 const (
-	traceBlockGeneric         traceBlockReason = traceEvGoBlock
-	traceBlockForever                          = traceEvGoStop
-	traceBlockNet                              = traceEvGoBlockNet
-	traceBlockSelect                           = traceEvGoBlockSelect
-	traceBlockCondWait                         = traceEvGoBlockCond
-	traceBlockSync                             = traceEvGoBlockSync
-	traceBlockChanSend                         = traceEvGoBlockSend
-	traceBlockChanRecv                         = traceEvGoBlockRecv
-	traceBlockGCMarkAssist                     = traceEvGoBlockGC
-	traceBlockGCSweep                          = traceEvGoBlock
-	traceBlockSystemGoroutine                  = traceEvGoBlock
-	traceBlockPreempted                        = traceEvGoBlock
-	traceBlockDebugCall                        = traceEvGoBlock
-	traceBlockUntilGCEnds                      = traceEvGoBlock
-	traceBlockSleep                            = traceEvGoSleep
+	traceBlockGeneric            traceBlockReason = traceEvGoBlock
+	traceBlockForever                             = traceEvGoStop
+	traceBlockNet                                 = traceEvGoBlockNet
+	traceBlockSelect                              = traceEvGoBlockSelect
+	traceBlockCondWait                            = traceEvGoBlockCond
+	traceBlockSync                                = traceEvGoBlockSync
+	traceBlockChanSend                            = traceEvGoBlockSend
+	traceBlockChanRecv                            = traceEvGoBlockRecv
+	traceBlockGCMarkAssist                        = traceEvGoBlockGC
+	traceBlockGCWeakToStrongWait                  = traceEvGoBlockGC
+	traceBlockGCSweep                             = traceEvGoBlock
+	traceBlockSystemGoroutine                     = traceEvGoBlock
+	traceBlockPreempted                           = traceEvGoBlock
+	traceBlockDebugCall                           = traceEvGoBlock
+	traceBlockUntilGCEnds                         = traceEvGoBlock
+	traceBlockSleep                               = traceEvGoSleep
 )
 
 const (
@@ -133,25 +134,35 @@ const (
 var trace struct {
 	// trace.lock must only be acquired on the system stack where
 	// stack splits cannot happen while it is held.
-	lock          mutex       // protects the following members
-	enabled       bool        // when set runtime traces events
-	shutdown      bool        // set when we are waiting for trace reader to finish after setting enabled to false
-	headerWritten bool        // whether ReadTrace has emitted trace header
-	footerWritten bool        // whether ReadTrace has emitted trace footer
-	shutdownSema  uint32      // used to wait for ReadTrace completion
-	seqStart      uint64      // sequence number when tracing was started
-	startTicks    int64       // cputicks when tracing was started
-	endTicks      int64       // cputicks when tracing was stopped
-	startNanotime int64       // nanotime when tracing was started
-	endNanotime   int64       // nanotime when tracing was stopped
-	startTime     traceTime   // traceClockNow when tracing started
-	endTime       traceTime   // traceClockNow when tracing stopped
-	seqGC         uint64      // GC start/done sequencer
-	reading       traceBufPtr // buffer currently handed off to user
-	empty         traceBufPtr // stack of empty buffers
-	fullHead      traceBufPtr // queue of full buffers
-	fullTail      traceBufPtr
-	stackTab      traceStackTable // maps stack traces to unique ids
+	lock          mutex              // protects the following members
+	enabled       bool               // when set runtime traces events
+	shutdown      bool               // set when we are waiting for trace reader to finish after setting enabled to false
+	headerWritten bool               // whether ReadTrace has emitted the header of generation readGen
+	footerWritten bool               // whether ReadTrace has emitted the footer of the last generation
+	shutdownSema  uint32             // used to wait for ReadTrace completion
+	seqStart      uint64             // sequence number when tracing was started
+	session       uint64             // incremented each time tracing starts
+	seqGC         uint64             // GC start/done sequencer
+	readGen       uint64             // generation ReadTrace is returning the data of
+	doneGen       uint64             // last generation whose data is all in full
+	reading       traceBufPtr        // buffer currently handed off to user
+	empty         traceBufPtr        // stack of empty buffers
+	full          [2]traceBufQueue   // queues of full buffers, indexed by generation
+	stackTab      [2]traceStackTable // maps stack traces to unique ids, indexed by generation
+
+	// gen is incremented each time a trace generation starts. Trace
+	// buffers and most per-generation state are indexed by gen%2, as
+	// two generations may be written at once while one is ending; see
+	// traceAdvance. gen only changes with trace.bufLock held.
+	gen atomic.Uint64
+
+	// The following members record when generations start and end.
+	// They change with trace.bufLock held.
+	startTicks    int64        // cputicks when the current generation started
+	endTicks      int64        // cputicks when the last generation ended
+	startNanotime int64        // nanotime when the current generation started
+	endNanotime   int64        // nanotime when the last generation ended
+	genStartTime  [2]traceTime // traceClockNow when each generation started, indexed by generation
 	// cpuLogRead accepts CPU profile samples from the signal handler where
 	// they're generated. It uses a two-word header to hold the IDs of the P and
 	// G (respectively) that were active at the time of the sample. Because
@@ -180,11 +191,12 @@ var trace struct {
 	//   option: per-P cache
 	//   option: sync.Map like data structure
 	stringsLock mutex
-	strings     map[string]uint64
-	stringSeq   uint64
+	strings     [2]map[string]uint64 // indexed by generation
+	stringSeq   [2]uint64
 
-	// markWorkerLabels maps gcMarkWorkerMode to string ID.
-	markWorkerLabels [len(gcMarkWorkerModeStrings)]uint64
+	// markWorkerLabels maps gcMarkWorkerMode to string ID, in each
+	// generation.
+	markWorkerLabels [2][len(gcMarkWorkerModeStrings)]uint64
 
 	bufLock mutex       // protects buf
 	buf     traceBufPtr // global trace buffer, used when running without a p
@@ -196,18 +208,31 @@ type gTraceState struct {
 	tracedSyscallEnter bool      // syscall or cgo was entered while trace was enabled or StartTrace has emitted EvGoInSyscall about this goroutine
 	seq                uint64    // trace event sequencer
 	lastP              puintptr  // last P emitted an event for this goroutine
+	gen                uint64    // trace generation in which the status of this goroutine was written
 }
 
 // mTraceState is per-M state for the tracer.
 type mTraceState struct {
-	startingTrace  bool // this M is in TraceStart, potentially before traceEnabled is true
-	tracedSTWStart bool // this M traced a STW start, so it should trace an end
+	startingTrace  bool   // this M is in TraceStart, potentially before traceEnabled is true
+	tracedSTWStart bool   // this M traced a STW start, so it should trace an end
+	gen            uint64 // trace generation this M writes events for while it holds a trace buffer
+	acquired       int32  // number of trace buffers this M holds; see traceAcquireBuffer
 }
 
 // pTraceState is per-P state for the tracer.
 type pTraceState struct {
 	buf traceBufPtr
 
+	// gen is the trace generation in which this P was last described,
+	// as by traceProcAdvance.
+	gen uint64
+
+	// running and g are the state of this P in the trace: whether it
+	// was started, and the goroutine started on it, if any. They are
+	// used to describe the P again in each generation.
+	running bool
+	g       guintptr
+
 	// inSweep indicates the sweep events should be traced.
 	// This is used to defer the sweep start event until a span
 	// has actually been swept.
@@ -223,12 +248,15 @@ func traceLockInit() {
 	lockInit(&trace.bufLock, lockRankTraceBuf)
 	lockInit(&trace.stringsLock, lockRankTraceStrings)
 	lockInit(&trace.lock, lockRankTrace)
-	lockInit(&trace.stackTab.lock, lockRankTraceStackTab)
+	for i := range trace.stackTab {
+		lockInit(&trace.stackTab[i].lock, lockRankTraceStackTab)
+	}
 }
 
 // traceBufHeader is per-P tracing buffer.
 type traceBufHeader struct {
 	link     traceBufPtr             // in trace.empty/full
+	gen      uint64                  // trace generation of the events in the buffer
 	lastTime traceTime               // when we wrote the last event
 	pos      int                     // next write offset in arr
 	stk      [traceStackSize]uintptr // scratch buffer for traceback
@@ -256,6 +284,11 @@ func traceBufPtrOf(b *traceBuf) traceBufPtr {
 	return traceBufPtr(unsafe.Pointer(b))
 }
 
+// traceBufQueue is a queue of trace buffers.
+type traceBufQueue struct {
+	head, tail traceBufPtr
+}
+
 // traceEnabled returns true if the trace is currently enabled.
 func traceEnabled() bool {
 	return trace.enabled
@@ -306,6 +339,18 @@ func StartTrace() error {
 	mp := getg().m
 	mp.trace.startingTrace = true
 
+	// Start a new generation. All Ps are stopped, except ours, which
+	// is started below, so none of them needs to be described in it.
+	// Reset dead Ps too, as their state may be left over from an
+	// earlier trace, and they may be brought back to life.
+	gen := trace.gen.Add(1)
+	for _, pp := range allp[:cap(allp)] {
+		pp.trace.gen = gen
+		pp.trace.running = false
+		pp.trace.g = 0
+	}
+	mp.trace.gen = gen
+
 	// Obtain current stack ID to use in all traceEvGoCreate events below.
 	stkBuf := make([]uintptr, traceStackSize)
 	stackID := traceStackID(mp, stkBuf, 2)
@@ -322,14 +367,79 @@ func StartTrace() error {
 	// here.)
 	atomicstorep(unsafe.Pointer(&trace.cpuLogWrite), unsafe.Pointer(profBuf))
 
+	traceSnapshotGoroutines(stackID)
+	traceProcStart()
+	traceGoStart()
+	// Note: startTicks needs to be set after we emit traceEvGoInSyscall events.
+	// If we do it the other way around, it is possible that exitsyscall will
+	// query sysExitTime after startTicks but before traceEvGoInSyscall timestamp.
+	// It will lead to a false conclusion that cputicks is broken.
+	trace.genStartTime[gen%2] = traceClockNow()
+	trace.startTicks = cputicks()
+	trace.startNanotime = nanotime()
+	trace.readGen = gen
+	trace.doneGen = gen - 1
+	trace.headerWritten = false
+	trace.footerWritten = false
+
+	// string to id mapping
+	//  0 : reserved for an empty string
+	//  remaining: other strings registered by traceString
+	for i := range trace.strings {
+		trace.stringSeq[i] = 0
+		trace.strings[i] = make(map[string]uint64)
+	}
+
+	trace.seqGC = 0
+	mp.trace.startingTrace = false
+	trace.enabled = true
+	trace.session++
+	session := trace.session
+
+	traceRegisterLabels()
+
+	unlock(&trace.bufLock)
+
+	unlock(&sched.sysmonlock)
+
+	// Record the current state of HeapGoal to avoid information loss in trace.
+	traceHeapGoal()
+
+	startTheWorldGC()
+
+	if period := int64(debug.traceadvanceperiod); period > 0 {
+		go traceAdvancer(session, period)
+	}
+	return nil
+}
+
+// traceRegisterLabels registers the runtime goroutine labels as strings
+// of the current trace generation.
+func traceRegisterLabels() {
+	mp, pid, bufp := traceAcquireBuffer()
+	gen := mp.trace.gen
+	for i, label := range gcMarkWorkerModeStrings[:] {
+		trace.markWorkerLabels[gen%2][i], bufp = traceString(gen, bufp, pid, label)
+	}
+	traceReleaseBuffer(mp, pid)
+}
+
+// traceSnapshotGoroutines emits the events that describe all existing
+// goroutines when tracing starts. stackID is the stack to use for their
+// creation events. Later generations describe each goroutine lazily,
+// before its first event in the generation; see traceGoStatusLocked.
+//
+// The world must be stopped.
+func traceSnapshotGoroutines(stackID uint64) {
 	// World is stopped, no need to lock.
 	forEachGRace(func(gp *g) {
 		status := readgstatus(gp)
+		gp.trace.gen = trace.gen.Load()
 		if status != _Gdead {
 			gp.trace.seq = 0
 			gp.trace.lastP = getg().m.p
 			// +PCQuantum because traceFrameForPC expects return PCs and subtracts PCQuantum.
-			id := trace.stackTab.put([]uintptr{logicalStackSentinel, startPCforTrace(gp.startpc) + sys.PCQuantum})
+			id := trace.stackTab[gp.trace.gen%2].put([]uintptr{logicalStackSentinel, startPCforTrace(gp.startpc) + sys.PCQuantum})
 			traceEvent(traceEvGoCreate, -1, gp.goid, uint64(id), stackID)
 		}
 		if status == _Gwaiting {
@@ -348,7 +458,7 @@ func StartTrace() error {
 			gp.trace.seq = 0
 			gp.trace.lastP = getg().m.p
 			// +PCQuantum because traceFrameForPC expects return PCs and subtracts PCQuantum.
-			id := trace.stackTab.put([]uintptr{logicalStackSentinel, startPCforTrace(0) + sys.PCQuantum}) // no start pc
+			id := trace.stackTab[gp.trace.gen%2].put([]uintptr{logicalStackSentinel, startPCforTrace(0) + sys.PCQuantum}) // no start pc
 			traceEvent(traceEvGoCreate, -1, gp.goid, uint64(id), stackID)
 			gp.trace.seq++
 			gp.trace.tracedSyscallEnter = true
@@ -363,49 +473,14 @@ func StartTrace() error {
 			gp.trace.tracedSyscallEnter = false
 		}
 	})
-	traceProcStart()
-	traceGoStart()
-	// Note: startTicks needs to be set after we emit traceEvGoInSyscall events.
-	// If we do it the other way around, it is possible that exitsyscall will
-	// query sysExitTime after startTicks but before traceEvGoInSyscall timestamp.
-	// It will lead to a false conclusion that cputicks is broken.
-	trace.startTime = traceClockNow()
-	trace.startTicks = cputicks()
-	trace.startNanotime = nanotime()
-	trace.headerWritten = false
-	trace.footerWritten = false
-
-	// string to id mapping
-	//  0 : reserved for an empty string
-	//  remaining: other strings registered by traceString
-	trace.stringSeq = 0
-	trace.strings = make(map[string]uint64)
-
-	trace.seqGC = 0
-	mp.trace.startingTrace = false
-	trace.enabled = true
-
-	// Register runtime goroutine labels.
-	_, pid, bufp := traceAcquireBuffer()
-	for i, label := range gcMarkWorkerModeStrings[:] {
-		trace.markWorkerLabels[i], bufp = traceString(bufp, pid, label)
-	}
-	traceReleaseBuffer(mp, pid)
-
-	unlock(&trace.bufLock)
-
-	unlock(&sched.sysmonlock)
-
-	// Record the current state of HeapGoal to avoid information loss in trace.
-	traceHeapGoal()
-
-	startTheWorldGC()
-	return nil
 }
 
 // StopTrace stops tracing, if it was previously enabled.
 // StopTrace only returns after all the reads for the trace have completed.
 func StopTrace() {
+	// Wait for the generation that may be starting to be complete.
+	semacquire(&traceAdvanceSema)
+
 	// Stop the world so that we can collect the trace buffers from all p's below,
 	// and also to avoid races with traceEvent.
 	stopTheWorldGC(stwStopTrace)
@@ -420,6 +495,7 @@ func StopTrace() {
 		unlock(&trace.bufLock)
 		unlock(&sched.sysmonlock)
 		startTheWorldGC()
+		semrelease(&traceAdvanceSema)
 		return
 	}
 
@@ -429,6 +505,210 @@ func StopTrace() {
 	trace.cpuLogRead.close()
 	traceReadCPU()
 
+	traceFlushAll()
+	traceSetEndTime()
+
+	trace.enabled = false
+	trace.shutdown = true
+	unlock(&trace.bufLock)
+
+	unlock(&sched.sysmonlock)
+
+	startTheWorldGC()
+	semrelease(&traceAdvanceSema)
+
+	// The world is started but we've set trace.shutdown, so new tracing can't start.
+	// Wait for the trace reader to flush pending buffers and stop.
+	semacquire(&trace.shutdownSema)
+	if raceenabled {
+		raceacquire(unsafe.Pointer(&trace.shutdownSema))
+	}
+
+	systemstack(func() {
+		// The lock protects us from races with StartTrace/StopTrace because they do stop-the-world.
+		lock(&trace.lock)
+		for _, p := range allp[:cap(allp)] {
+			if p.trace.buf != 0 {
+				throw("trace: non-empty trace buffer in proc")
+			}
+		}
+		if trace.buf != 0 {
+			throw("trace: non-empty global trace buffer")
+		}
+		for _, q := range trace.full {
+			if q.head != 0 || q.tail != 0 {
+				throw("trace: non-empty full trace buffer")
+			}
+		}
+		if trace.reading != 0 || trace.reader.Load() != nil {
+			throw("trace: reading after shutdown")
+		}
+		for trace.empty != 0 {
+			buf := trace.empty
+			trace.empty = buf.ptr().link
+			sysFree(unsafe.Pointer(buf), unsafe.Sizeof(*buf.ptr()), &memstats.other_sys)
+		}
+		trace.strings = [2]map[string]uint64{}
+		trace.shutdown = false
+		trace.cpuLogRead = nil
+		unlock(&trace.lock)
+	})
+}
+
+// defaultTraceAdvancePeriod is the approximate period between two
+// generations of a trace, unless overridden by GODEBUG=traceadvanceperiod.
+const defaultTraceAdvancePeriod = 1e9 // 1 second.
+
+// traceHeader is the header of each generation of a trace.
+const traceHeader = "go 1.22 trace\x00\x00\x00"
+
+// traceAdvancer starts a new trace generation every period nanoseconds
+// until the trace started as session stops.
+func traceAdvancer(session uint64, period int64) {
+	for {
+		timeSleep(period)
+		if !traceAdvance(session) {
+			return
+		}
+	}
+}
+
+// traceAdvanceSema is held while a trace generation ends and the next
+// one starts, and while tracing stops, so that they do not overlap.
+var traceAdvanceSema uint32 = 1
+
+// traceAdvance ends the current generation of the trace and starts a
+// new one, if the trace started as session is still running. It
+// reports whether it is.
+//
+// A generation is a complete trace on its own: it starts with a header
+// and ends with its own stack table and the timer frequency. Strings are
+// not shared between generations either. This way, a trace can be parsed
+// one generation at a time, and a truncated trace can be read up to its
+// last complete generation.
+//
+// The world is not stopped. Each P moves to the new generation the
+// first time it writes an event in it, and describes its own state
+// there; see traceProcAdvance. Each goroutine is described again when
+// it is first involved in an event of the generation; see
+// traceGoStatusLocked. Goroutines that do nothing during a generation
+// do not appear in it. Once all Ps have gone through a safe point,
+// none of them can still be writing events of the previous generation,
+// and its footer is written.
+//
+// No new generation starts until the reader has started reading the
+// current one, as only two generations are kept at once.
+func traceAdvance(session uint64) bool {
+	semacquire(&traceAdvanceSema)
+	// A GC cycle or a stop of the world must start and end in the
+	// same generation. Holding worldsema is also needed by forEachP.
+	semacquire(&gcsema)
+	semacquire(&worldsema)
+
+	lock(&trace.bufLock)
+	if !trace.enabled || trace.session != session {
+		unlock(&trace.bufLock)
+		semrelease(&worldsema)
+		semrelease(&gcsema)
+		semrelease(&traceAdvanceSema)
+		return false
+	}
+	gen := trace.gen.Load()
+	var reading bool
+	systemstack(func() {
+		lock(&trace.lock)
+		reading = trace.readGen == gen
+		unlock(&trace.lock)
+	})
+	if !reading {
+		unlock(&trace.bufLock)
+		semrelease(&worldsema)
+		semrelease(&gcsema)
+		semrelease(&traceAdvanceSema)
+		return true
+	}
+
+	// End the current generation. Events written without a P are
+	// serialized by trace.bufLock, so only the Ps may still write
+	// events of this generation from now on.
+	traceReadCPU()
+	systemstack(func() {
+		lock(&trace.lock)
+		if buf := trace.buf; buf != 0 {
+			trace.buf = 0
+			traceFullQueue(buf)
+		}
+		if buf := trace.cpuLogBuf; buf != 0 {
+			trace.cpuLogBuf = 0
+			traceFullQueue(buf)
+		}
+		unlock(&trace.lock)
+	})
+	traceSetEndTime()
+	freq := traceFrequency()
+
+	// Start the next generation. Register the labels of the mark
+	// workers first, as Ps may need them as soon as they move to it.
+	next := gen + 1
+	trace.startTicks = trace.endTicks
+	trace.startNanotime = trace.endNanotime
+	trace.genStartTime[next%2] = traceClockNow()
+	trace.seqGC = 0
+	bufp := &trace.buf
+	for i, label := range gcMarkWorkerModeStrings[:] {
+		trace.markWorkerLabels[next%2][i], bufp = traceString(next, bufp, traceGlobProc, label)
+	}
+	trace.gen.Store(next)
+	unlock(&trace.bufLock)
+
+	// Wait for all Ps to be done with the previous generation, and
+	// queue the buffers of those that did not move to the next one.
+	// Dead Ps may still have trace buffers too; allp doesn't change
+	// while worldsema is held.
+	systemstack(func() {
+		forEachP(traceQueueStaleBuf)
+		for _, pp := range allp[len(allp):cap(allp)] {
+			traceQueueStaleBuf(pp)
+		}
+	})
+	semrelease(&worldsema)
+	semrelease(&gcsema)
+
+	traceHeapGoal()
+
+	systemstack(func() {
+		if raceenabled {
+			// g0 doesn't have a race context. Borrow the user G's,
+			// as readTrace0 does.
+			getg().racectx = getg().m.curg.racectx
+			defer func() { getg().racectx = 0 }()
+		}
+		traceWriteFooter(gen, freq)
+
+		lock(&trace.stringsLock)
+		if raceenabled {
+			// See traceString.
+			raceacquire(unsafe.Pointer(&trace.stringsLock))
+		}
+		clear(trace.strings[gen%2])
+		trace.stringSeq[gen%2] = 0
+		if raceenabled {
+			racerelease(unsafe.Pointer(&trace.stringsLock))
+		}
+		unlock(&trace.stringsLock)
+
+		lock(&trace.lock)
+		trace.doneGen = gen
+		unlock(&trace.lock)
+	})
+	semrelease(&traceAdvanceSema)
+	return true
+}
+
+// traceFlushAll queues all the trace buffers that hold events.
+//
+// The world must be stopped.
+func traceFlushAll() {
 	// Loop over all allocated Ps because dead Ps may still have
 	// trace buffers.
 	for _, p := range allp[:cap(allp)] {
@@ -452,14 +732,27 @@ func StopTrace() {
 			traceFullQueue(buf)
 		}
 	}
+}
+
+// traceQueueStaleBuf queues the trace buffer of pp if it holds events of
+// an earlier trace generation. pp must not be writing events.
+func traceQueueStaleBuf(pp *p) {
+	if buf := pp.trace.buf; buf != 0 && buf.ptr().gen != trace.gen.Load() {
+		pp.trace.buf = 0
+		lock(&trace.lock)
+		traceFullQueue(buf)
+		unlock(&trace.lock)
+	}
+}
 
+// traceSetEndTime records the end time of the current trace generation.
+func traceSetEndTime() {
 	// Wait for startNanotime != endNanotime. On Windows the default interval between
 	// system clock ticks is typically between 1 and 15 milliseconds, which may not
 	// have passed since the trace started. Without nanotime moving forward, trace
 	// tooling has no way of identifying how much real time each cputicks time deltas
 	// represent.
 	for {
-		trace.endTime = traceClockNow()
 		trace.endTicks = cputicks()
 		trace.endNanotime = nanotime()
 
@@ -468,49 +761,44 @@ func StopTrace() {
 		}
 		osyield()
 	}
+}
 
-	trace.enabled = false
-	trace.shutdown = true
-	unlock(&trace.bufLock)
-
-	unlock(&sched.sysmonlock)
+// traceFrequency returns the frequency of trace timestamps, in ticks
+// per second, over the current trace generation.
+func traceFrequency() float64 {
+	freq := (float64(trace.endTicks-trace.startTicks) / traceTimeDiv) / (float64(trace.endNanotime-trace.startNanotime) / 1e9)
+	if freq <= 0 {
+		throw("trace: got invalid frequency")
+	}
+	return freq
+}
 
-	startTheWorldGC()
+// traceWriteFooter writes and queues the footer of trace generation gen:
+// its stack table, followed by the timer frequency. The frequency comes
+// last so that a generation whose footer is cut short can be detected.
+// No more events of gen may be written.
+//
+// This must run on the system stack because it calls traceFlush.
+//
+//go:systemstack
+func traceWriteFooter(gen uint64, freq float64) {
+	// Dump stack table.
+	// This will emit a bunch of full buffers.
+	bufp := traceFlush(gen, 0, 0)
+	bufp = trace.stackTab[gen%2].dump(gen, bufp)
 
-	// The world is started but we've set trace.shutdown, so new tracing can't start.
-	// Wait for the trace reader to flush pending buffers and stop.
-	semacquire(&trace.shutdownSema)
-	if raceenabled {
-		raceacquire(unsafe.Pointer(&trace.shutdownSema))
+	// Write frequency event.
+	if buf := bufp.ptr(); len(buf.arr)-buf.pos < 1+traceBytesPerNumber {
+		bufp = traceFlush(gen, bufp, 0)
 	}
+	buf := bufp.ptr()
+	buf.byte(traceEvFrequency | 0<<traceArgCountShift)
+	buf.varint(uint64(freq))
 
-	systemstack(func() {
-		// The lock protects us from races with StartTrace/StopTrace because they do stop-the-world.
-		lock(&trace.lock)
-		for _, p := range allp[:cap(allp)] {
-			if p.trace.buf != 0 {
-				throw("trace: non-empty trace buffer in proc")
-			}
-		}
-		if trace.buf != 0 {
-			throw("trace: non-empty global trace buffer")
-		}
-		if trace.fullHead != 0 || trace.fullTail != 0 {
-			throw("trace: non-empty full trace buffer")
-		}
-		if trace.reading != 0 || trace.reader.Load() != nil {
-			throw("trace: reading after shutdown")
-		}
-		for trace.empty != 0 {
-			buf := trace.empty
-			trace.empty = buf.ptr().link
-			sysFree(unsafe.Pointer(buf), unsafe.Sizeof(*buf.ptr()), &memstats.other_sys)
-		}
-		trace.strings = nil
-		trace.shutdown = false
-		trace.cpuLogRead = nil
-		unlock(&trace.lock)
-	})
+	// Flush final buffer.
+	lock(&trace.lock)
+	traceFullQueue(bufp)
+	unlock(&trace.lock)
 }
 
 // ReadTrace returns the next chunk of binary tracing data, blocking until data
@@ -573,7 +861,9 @@ func readTrace0() (buf []byte, park bool) {
 	// trace lock not held. footerWritten and shutdown are safe to access
 	// here. They are only mutated by this goroutine or during a STW.
 	if !trace.footerWritten && !trace.shutdown {
+		lock(&trace.bufLock)
 		traceReadCPU()
+		unlock(&trace.bufLock)
 	}
 
 	// This function must not allocate while holding trace.lock:
@@ -595,14 +885,15 @@ func readTrace0() (buf []byte, park bool) {
 		trace.empty = buf
 		trace.reading = 0
 	}
+newGen:
 	// Write trace header.
 	if !trace.headerWritten {
 		trace.headerWritten = true
 		unlock(&trace.lock)
-		return []byte("go 1.21 trace\x00\x00\x00"), false
+		return []byte(traceHeader), false
 	}
 	// Wait for new data.
-	if trace.fullHead == 0 && !trace.shutdown {
+	if trace.full[trace.readGen%2].head == 0 && trace.doneGen < trace.readGen && !trace.shutdown {
 		// We don't simply use a note because the scheduler
 		// executes this goroutine directly when it wakes up
 		// (also a note would consume an M).
@@ -612,36 +903,31 @@ func readTrace0() (buf []byte, park bool) {
 newFull:
 	assertLockHeld(&trace.lock)
 	// Write a buffer.
-	if trace.fullHead != 0 {
-		buf := traceFullDequeue()
+	if trace.full[trace.readGen%2].head != 0 {
+		buf := traceFullDequeue(trace.readGen)
 		trace.reading = buf
 		unlock(&trace.lock)
 		return buf.ptr().arr[:buf.ptr().pos], false
 	}
 
-	// Write footer with timer frequency.
+	// Move on to the next generation once this one is complete.
+	if trace.doneGen >= trace.readGen {
+		trace.readGen++
+		trace.headerWritten = false
+		goto newGen
+	}
+
+	// Write footer of the last generation with timer frequency.
 	if !trace.footerWritten {
 		trace.footerWritten = true
-		freq := (float64(trace.endTicks-trace.startTicks) / traceTimeDiv) / (float64(trace.endNanotime-trace.startNanotime) / 1e9)
-		if freq <= 0 {
-			throw("trace: ReadTrace got invalid frequency")
-		}
+		freq := traceFrequency()
 		unlock(&trace.lock)
 
-		// Write frequency event.
-		bufp := traceFlush(0, 0)
-		buf := bufp.ptr()
-		buf.byte(traceEvFrequency | 0<<traceArgCountShift)
-		buf.varint(uint64(freq))
-
-		// Dump stack table.
 		// This will emit a bunch of full buffers, we will pick them up
 		// on the next iteration.
-		bufp = trace.stackTab.dump(bufp)
+		traceWriteFooter(trace.readGen, freq)
 
-		// Flush final buffer.
 		lock(&trace.lock)
-		traceFullQueue(bufp)
 		goto newFull // trace.lock should be held at newFull
 	}
 	// Done.
@@ -688,7 +974,7 @@ func traceReader() *g {
 // scheduled and should be. Callers should first check that trace.enabled
 // or trace.shutdown is set.
 func traceReaderAvailable() *g {
-	if trace.fullHead != 0 || trace.shutdown {
+	if trace.full[trace.readGen%2].head != 0 || trace.doneGen >= trace.readGen || trace.shutdown {
 		return trace.reader.Load()
 	}
 	return nil
@@ -710,26 +996,28 @@ func traceProcFree(pp *p) {
 	unlock(&trace.lock)
 }
 
-// traceFullQueue queues buf into queue of full buffers.
+// traceFullQueue queues buf into the queue of full buffers of its generation.
 func traceFullQueue(buf traceBufPtr) {
+	q := &trace.full[buf.ptr().gen%2]
 	buf.ptr().link = 0
-	if trace.fullHead == 0 {
-		trace.fullHead = buf
+	if q.head == 0 {
+		q.head = buf
 	} else {
-		trace.fullTail.ptr().link = buf
+		q.tail.ptr().link = buf
 	}
-	trace.fullTail = buf
+	q.tail = buf
 }
 
-// traceFullDequeue dequeues from queue of full buffers.
-func traceFullDequeue() traceBufPtr {
-	buf := trace.fullHead
+// traceFullDequeue dequeues from the queue of full buffers of generation gen.
+func traceFullDequeue(gen uint64) traceBufPtr {
+	q := &trace.full[gen%2]
+	buf := q.head
 	if buf == 0 {
 		return 0
 	}
-	trace.fullHead = buf.ptr().link
-	if trace.fullHead == 0 {
-		trace.fullTail = 0
+	q.head = buf.ptr().link
+	if q.head == 0 {
+		q.tail = 0
 	}
 	buf.ptr().link = 0
 	return buf
@@ -789,16 +1077,17 @@ func traceEventLocked(extraBytes int, mp *m, pid int32, bufp *traceBufPtr, ev by
 	// TODO: test on non-zero extraBytes param.
 	maxSize := 2 + 5*traceBytesPerNumber + extraBytes // event type, length, sequence, timestamp, stack id and two add params
 	if buf == nil || len(buf.arr)-buf.pos < maxSize {
+		gen := mp.trace.gen
+		if buf != nil {
+			gen = buf.gen
+		}
 		systemstack(func() {
-			buf = traceFlush(traceBufPtrOf(buf), pid).ptr()
+			buf = traceFlush(gen, traceBufPtrOf(buf), pid).ptr()
 		})
 		bufp.set(buf)
 	}
 
-	ts := traceClockNow()
-	if ts <= buf.lastTime {
-		ts = buf.lastTime + 1
-	}
+	ts := buf.eventTime()
 	tsDiff := uint64(ts - buf.lastTime)
 	buf.lastTime = ts
 	narg := byte(len(args))
@@ -839,6 +1128,24 @@ func traceEventLocked(extraBytes int, mp *m, pid int32, bufp *traceBufPtr, ev by
 	}
 }
 
+// eventTime returns the timestamp of the next event in buf, which is
+// after the last one. If the generation of buf has ended, which may
+// happen while an M that acquired buf before it ended writes its last
+// events, the timestamp is also kept before the start of the next
+// generation, so that generations do not overlap in time.
+func (buf *traceBuf) eventTime() traceTime {
+	ts := traceClockNow()
+	if ts <= buf.lastTime {
+		ts = buf.lastTime + 1
+	}
+	if buf.gen != trace.gen.Load() {
+		if end := trace.genStartTime[(buf.gen+1)%2] - 1; ts > end {
+			ts = max(end, buf.lastTime)
+		}
+	}
+	return ts
+}
+
 // traceCPUSample writes a CPU profile sample stack to the execution tracer's
 // profiling buffer. It is called from a signal handler, so is limited in what
 // it can do.
@@ -883,7 +1190,12 @@ func traceCPUSample(gp *g, pp *p, stk []uintptr) {
 	trace.signalLock.Store(0)
 }
 
+// traceReadCPU writes the CPU profile samples received so far to the
+// current trace generation.
+//
+// The caller must hold trace.bufLock.
 func traceReadCPU() {
+	gen := trace.gen.Load()
 	bufp := &trace.cpuLogBuf
 
 	for {
@@ -902,6 +1214,11 @@ func traceReadCPU() {
 				break // mismatched profile records and tags
 			}
 			timestamp := data[1]
+			if start := trace.genStartTime[gen%2]; timestamp < uint64(start) {
+				// The sample was taken before the current trace
+				// generation started.
+				timestamp = uint64(start)
+			}
 			ppid := data[2] >> 1
 			if hasP := (data[2] & 0b1) != 0; !hasP {
 				ppid = ^uint64(0)
@@ -929,7 +1246,7 @@ func traceReadCPU() {
 			buf := bufp.ptr()
 			if buf == nil {
 				systemstack(func() {
-					*bufp = traceFlush(*bufp, 0)
+					*bufp = traceFlush(gen, *bufp, 0)
 				})
 				buf = bufp.ptr()
 			}
@@ -938,7 +1255,7 @@ func traceReadCPU() {
 			for ; nstk < len(buf.stk) && nstk-1 < len(stk); nstk++ {
 				buf.stk[nstk] = uintptr(stk[nstk-1])
 			}
-			stackID := trace.stackTab.put(buf.stk[:nstk])
+			stackID := trace.stackTab[gen%2].put(buf.stk[:nstk])
 
 			traceEventLocked(0, nil, 0, bufp, traceEvCPUSample, stackID, 1, uint64(timestamp), ppid, goid)
 		}
@@ -954,7 +1271,8 @@ const logicalStackSentinel = ^uintptr(0)
 // traceStackID captures a stack trace into pcBuf, registers it in the trace
 // stack table, and returns its unique ID. pcBuf should have a length equal to
 // traceStackSize. skip controls the number of leaf frames to omit in order to
-// hide tracer internals from stack traces, see CL 5523.
+// hide tracer internals from stack traces, see CL 5523. The stack is
+// registered in the trace generation mp writes events for.
 func traceStackID(mp *m, pcBuf []uintptr, skip int) uint64 {
 	gp := getg()
 	curgp := mp.curg
@@ -993,7 +1311,7 @@ func traceStackID(mp *m, pcBuf []uintptr, skip int) uint64 {
 	if nstk > 0 && curgp.goid == 1 {
 		nstk-- // skip runtime.main
 	}
-	id := trace.stackTab.put(pcBuf[:nstk])
+	id := trace.stackTab[mp.trace.gen%2].put(pcBuf[:nstk])
 	return uint64(id)
 }
 
@@ -1019,6 +1337,11 @@ func fpTracebackPCs(fp unsafe.Pointer, pcBuf []uintptr) (i int) {
 }
 
 // traceAcquireBuffer returns trace buffer to use and, if necessary, locks it.
+// It also sets mp.trace.gen to the generation the events written to the
+// buffer belong to. If a new generation started since the P last wrote an
+// event, the P moves to it first; see traceProcAdvance. Nested calls, as
+// from an allocation made while the buffer is held, keep the generation
+// of the outermost one.
 func traceAcquireBuffer() (mp *m, pid int32, bufp *traceBufPtr) {
 	// Any time we acquire a buffer, we may end up flushing it,
 	// but flushes are rare. Record the lock edge even if it
@@ -1026,10 +1349,19 @@ func traceAcquireBuffer() (mp *m, pid int32, bufp *traceBufPtr) {
 	lockRankMayTraceFlush()
 
 	mp = acquirem()
+	mp.trace.acquired++
 	if p := mp.p.ptr(); p != nil {
+		if mp.trace.acquired == 1 {
+			mp.trace.gen = trace.gen.Load()
+			if p.trace.gen != mp.trace.gen {
+				traceProcAdvance(mp, p)
+			}
+		}
 		return mp, p.id, &p.trace.buf
 	}
 	lock(&trace.bufLock)
+	// trace.gen doesn't change while trace.bufLock is held.
+	mp.trace.gen = trace.gen.Load()
 	return mp, traceGlobProc, &trace.buf
 }
 
@@ -1038,6 +1370,7 @@ func traceReleaseBuffer(mp *m, pid int32) {
 	if pid == traceGlobProc {
 		unlock(&trace.bufLock)
 	}
+	mp.trace.acquired--
 	releasem(mp)
 }
 
@@ -1047,12 +1380,13 @@ func lockRankMayTraceFlush() {
 	lockWithRankMayAcquire(&trace.lock, getLockRank(&trace.lock))
 }
 
-// traceFlush puts buf onto stack of full buffers and returns an empty buffer.
+// traceFlush puts buf onto stack of full buffers and returns an empty buffer
+// for events of trace generation gen.
 //
 // This must run on the system stack because it acquires trace.lock.
 //
 //go:systemstack
-func traceFlush(buf traceBufPtr, pid int32) traceBufPtr {
+func traceFlush(gen uint64, buf traceBufPtr, pid int32) traceBufPtr {
 	lock(&trace.lock)
 	if buf != 0 {
 		traceFullQueue(buf)
@@ -1068,13 +1402,12 @@ func traceFlush(buf traceBufPtr, pid int32) traceBufPtr {
 	}
 	bufp := buf.ptr()
 	bufp.link.set(nil)
+	bufp.gen = gen
 	bufp.pos = 0
 
 	// initialize the buffer for a new batch
-	ts := traceClockNow()
-	if ts <= bufp.lastTime {
-		ts = bufp.lastTime + 1
-	}
+	bufp.lastTime = 0
+	ts := bufp.eventTime()
 	bufp.lastTime = ts
 	bufp.byte(traceEvBatch | 1<<traceArgCountShift)
 	bufp.varint(uint64(pid))
@@ -1084,8 +1417,9 @@ func traceFlush(buf traceBufPtr, pid int32) traceBufPtr {
 	return buf
 }
 
-// traceString adds a string to the trace.strings and returns the id.
-func traceString(bufp *traceBufPtr, pid int32, s string) (uint64, *traceBufPtr) {
+// traceString adds a string to the trace.strings of generation gen and
+// returns the id.
+func traceString(gen uint64, bufp *traceBufPtr, pid int32, s string) (uint64, *traceBufPtr) {
 	if s == "" {
 		return 0, bufp
 	}
@@ -1097,7 +1431,8 @@ func traceString(bufp *traceBufPtr, pid int32, s string) (uint64, *traceBufPtr)
 		raceacquire(unsafe.Pointer(&trace.stringsLock))
 	}
 
-	if id, ok := trace.strings[s]; ok {
+	strings := trace.strings[gen%2]
+	if id, ok := strings[s]; ok {
 		if raceenabled {
 			racerelease(unsafe.Pointer(&trace.stringsLock))
 		}
@@ -1106,9 +1441,9 @@ func traceString(bufp *traceBufPtr, pid int32, s string) (uint64, *traceBufPtr)
 		return id, bufp
 	}
 
-	trace.stringSeq++
-	id := trace.stringSeq
-	trace.strings[s] = id
+	trace.stringSeq[gen%2]++
+	id := trace.stringSeq[gen%2]
+	strings[s] = id
 
 	if raceenabled {
 		racerelease(unsafe.Pointer(&trace.stringsLock))
@@ -1124,7 +1459,7 @@ func traceString(bufp *traceBufPtr, pid int32, s string) (uint64, *traceBufPtr)
 	size := 1 + 2*traceBytesPerNumber + len(s)
 	if buf == nil || len(buf.arr)-buf.pos < size {
 		systemstack(func() {
-			buf = traceFlush(traceBufPtrOf(buf), pid).ptr()
+			buf = traceFlush(gen, traceBufPtrOf(buf), pid).ptr()
 			bufp.set(buf)
 		})
 	}
@@ -1267,13 +1602,13 @@ func (tab *traceStackTable) newStack(n int) *traceStack {
 
 // traceFrames returns the frames corresponding to pcs. It may
 // allocate and may emit trace events.
-func traceFrames(bufp traceBufPtr, pcs []uintptr) ([]traceFrame, traceBufPtr) {
+func traceFrames(gen uint64, bufp traceBufPtr, pcs []uintptr) ([]traceFrame, traceBufPtr) {
 	frames := make([]traceFrame, 0, len(pcs))
 	ci := CallersFrames(pcs)
 	for {
 		var frame traceFrame
 		f, more := ci.Next()
-		frame, bufp = traceFrameForPC(bufp, 0, f)
+		frame, bufp = traceFrameForPC(gen, bufp, 0, f)
 		frames = append(frames, frame)
 		if !more {
 			return frames, bufp
@@ -1281,18 +1616,18 @@ func traceFrames(bufp traceBufPtr, pcs []uintptr) ([]traceFrame, traceBufPtr) {
 	}
 }
 
-// dump writes all previously cached stacks to trace buffers,
-// releases all memory and resets state.
+// dump writes all previously cached stacks to trace buffers of
+// generation gen, releases all memory and resets state.
 //
 // This must run on the system stack because it calls traceFlush.
 //
 //go:systemstack
-func (tab *traceStackTable) dump(bufp traceBufPtr) traceBufPtr {
+func (tab *traceStackTable) dump(gen uint64, bufp traceBufPtr) traceBufPtr {
 	for i := range tab.tab {
 		stk := tab.tab[i].ptr()
 		for ; stk != nil; stk = stk.link.ptr() {
 			var frames []traceFrame
-			frames, bufp = traceFrames(bufp, fpunwindExpand(stk.stack()))
+			frames, bufp = traceFrames(gen, bufp, fpunwindExpand(stk.stack()))
 
 			// Estimate the size of this record. This
 			// bound is pretty loose, but avoids counting
@@ -1300,7 +1635,7 @@ func (tab *traceStackTable) dump(bufp traceBufPtr) traceBufPtr {
 			maxSize := 1 + traceBytesPerNumber + (2+4*len(frames))*traceBytesPerNumber
 			// Make sure we have enough buffer space.
 			if buf := bufp.ptr(); len(buf.arr)-buf.pos < maxSize {
-				bufp = traceFlush(bufp, 0)
+				bufp = traceFlush(gen, bufp, 0)
 			}
 
 			// Emit header, with space reserved for length.
@@ -1397,7 +1732,7 @@ type traceFrame struct {
 
 // traceFrameForPC records the frame information.
 // It may allocate memory.
-func traceFrameForPC(buf traceBufPtr, pid int32, f Frame) (traceFrame, traceBufPtr) {
+func traceFrameForPC(gen uint64, buf traceBufPtr, pid int32, f Frame) (traceFrame, traceBufPtr) {
 	bufp := &buf
 	var frame traceFrame
 	frame.PC = f.PC
@@ -1407,13 +1742,13 @@ func traceFrameForPC(buf traceBufPtr, pid int32, f Frame) (traceFrame, traceBufP
 	if len(fn) > maxLen {
 		fn = fn[len(fn)-maxLen:]
 	}
-	frame.funcID, bufp = traceString(bufp, pid, fn)
+	frame.funcID, bufp = traceString(gen, bufp, pid, fn)
 	frame.line = uint64(f.Line)
 	file := f.File
 	if len(file) > maxLen {
 		file = file[len(file)-maxLen:]
 	}
-	frame.fileID, bufp = traceString(bufp, pid, file)
+	frame.fileID, bufp = traceString(gen, bufp, pid, file)
 	return frame, (*bufp)
 }
 
@@ -1478,6 +1813,7 @@ func traceGomaxprocs(procs int32) {
 
 func traceProcStart() {
 	traceEvent(traceEvProcStart, -1, uint64(getg().m.id))
+	getg().m.p.ptr().trace.running = true
 }
 
 func traceProcStop(pp *p) {
@@ -1487,10 +1823,47 @@ func traceProcStop(pp *p) {
 	oldp := mp.p
 	mp.p.set(pp)
 	traceEvent(traceEvProcStop, -1)
+	pp.trace.running = false
 	mp.p = oldp
 	releasem(mp)
 }
 
+// traceProcAdvance moves pp, on which mp is about to write an event, to
+// the trace generation mp.trace.gen. It queues the buffer of pp, which
+// holds events of an earlier generation, and describes the state of pp
+// in the new generation: an EvProcStart event if pp is running, an
+// EvGoStart event, preceded by the status of the goroutine, for the
+// goroutine that runs on pp, if any, and an EvGCSweepStart event if pp
+// is sweeping.
+//
+// This is called by traceAcquireBuffer, and is subject to the same
+// restrictions as traceEventLocked.
+func traceProcAdvance(mp *m, pp *p) {
+	if buf := pp.trace.buf; buf != 0 {
+		pp.trace.buf = 0
+		systemstack(func() {
+			lock(&trace.lock)
+			traceFullQueue(buf)
+			unlock(&trace.lock)
+		})
+	}
+	pp.trace.gen = mp.trace.gen
+	if !trace.enabled && !mp.trace.startingTrace {
+		return
+	}
+	bufp := &pp.trace.buf
+	if pp.trace.running {
+		traceEventLocked(0, mp, pp.id, bufp, traceEvProcStart, 0, -1, uint64(mp.id))
+	}
+	if gp := pp.trace.g.ptr(); gp != nil {
+		traceGoStatusLocked(mp, pp.id, bufp, gp, _Grunnable)
+		traceGoStartLocked(mp, pp.id, bufp, pp, gp)
+	}
+	if pp.trace.inSweep && pp.trace.swept != 0 {
+		traceEventLocked(0, mp, pp.id, bufp, traceEvGCSweepStart, 0, 0)
+	}
+}
+
 func traceGCStart() {
 	traceEvent(traceEvGCStart, 3, trace.seqGC)
 	trace.seqGC++
@@ -1568,58 +1941,146 @@ func traceGCMarkAssistDone() {
 }
 
 func traceGoCreate(newg *g, pc uintptr) {
+	mp, pid, bufp, ok := traceAcquireGoBuffer()
+	if !ok {
+		return
+	}
 	newg.trace.seq = 0
-	newg.trace.lastP = getg().m.p
+	newg.trace.lastP = mp.p
+	newg.trace.gen = mp.trace.gen
 	// +PCQuantum because traceFrameForPC expects return PCs and subtracts PCQuantum.
-	id := trace.stackTab.put([]uintptr{logicalStackSentinel, startPCforTrace(pc) + sys.PCQuantum})
-	traceEvent(traceEvGoCreate, 2, newg.goid, uint64(id))
+	id := trace.stackTab[mp.trace.gen%2].put([]uintptr{logicalStackSentinel, startPCforTrace(pc) + sys.PCQuantum})
+	// Unlike traceEvent, don't add a frame to skip: traceEventLocked
+	// is called directly here.
+	traceEventLocked(0, mp, pid, bufp, traceEvGoCreate, 0, 2, newg.goid, uint64(id))
+	traceReleaseBuffer(mp, pid)
+}
+
+// traceGoStatusLocked writes the status of gp if it was not written yet
+// in the current trace generation: an EvGoCreate event, followed by
+// EvGoWaiting or EvGoInSyscall if status, the status gp has had since the
+// generation started, is _Gwaiting or _Gsyscall. It reports whether it
+// wrote anything.
+//
+// The caller holds the trace buffer, as for traceEventLocked, and writes
+// the event about gp that needs the status right after, so that no new
+// generation can start in between.
+func traceGoStatusLocked(mp *m, pid int32, bufp *traceBufPtr, gp *g, status uint32) bool {
+	if gp.trace.gen == mp.trace.gen {
+		return false
+	}
+	gp.trace.gen = mp.trace.gen
+	gp.trace.seq = 0
+	gp.trace.lastP = mp.p
+	// This may run without write barriers, so use the buffer's scratch
+	// space for the stack rather than allocating it.
+	if bufp.ptr() == nil {
+		systemstack(func() {
+			*bufp = traceFlush(mp.trace.gen, *bufp, pid)
+		})
+	}
+	buf := bufp.ptr()
+	// +PCQuantum because traceFrameForPC expects return PCs and subtracts PCQuantum.
+	buf.stk[0] = logicalStackSentinel
+	buf.stk[1] = startPCforTrace(gp.startpc) + sys.PCQuantum
+	id := trace.stackTab[mp.trace.gen%2].put(buf.stk[:2])
+	traceEventLocked(0, mp, pid, bufp, traceEvGoCreate, 0, 0, gp.goid, uint64(id))
+	switch status {
+	case _Gwaiting:
+		// traceEvGoWaiting is implied to have seq=1.
+		gp.trace.seq++
+		traceEventLocked(0, mp, pid, bufp, traceEvGoWaiting, 0, -1, gp.goid)
+	case _Gsyscall:
+		gp.trace.seq++
+		traceEventLocked(0, mp, pid, bufp, traceEvGoInSyscall, 0, -1, gp.goid)
+	}
+	return true
+}
+
+// traceAcquireGoBuffer is traceAcquireBuffer for events about
+// goroutines, which must be consistent with their status. It reports
+// false, with the buffer released, if tracing is disabled.
+func traceAcquireGoBuffer() (mp *m, pid int32, bufp *traceBufPtr, ok bool) {
+	mp, pid, bufp = traceAcquireBuffer()
+	// See the comment in traceEvent.
+	if !trace.enabled && !mp.trace.startingTrace {
+		traceReleaseBuffer(mp, pid)
+		return nil, 0, nil, false
+	}
+	return mp, pid, bufp, true
 }
 
 func traceGoStart() {
-	gp := getg().m.curg
-	pp := gp.m.p
+	mp, pid, bufp, ok := traceAcquireGoBuffer()
+	if !ok {
+		return
+	}
+	gp := mp.curg
+	pp := mp.p.ptr()
+	traceGoStatusLocked(mp, pid, bufp, gp, _Grunnable)
+	traceGoStartLocked(mp, pid, bufp, pp, gp)
+	traceReleaseBuffer(mp, pid)
+}
+
+// traceGoStartLocked writes the event that starts gp on pp, and records
+// it as the goroutine that runs on pp. The caller holds the trace buffer
+// of pp, as for traceEventLocked.
+func traceGoStartLocked(mp *m, pid int32, bufp *traceBufPtr, pp *p, gp *g) {
 	gp.trace.seq++
-	if pp.ptr().gcMarkWorkerMode != gcMarkWorkerNotWorker {
-		traceEvent(traceEvGoStartLabel, -1, gp.goid, gp.trace.seq, trace.markWorkerLabels[pp.ptr().gcMarkWorkerMode])
-	} else if gp.trace.lastP == pp {
-		traceEvent(traceEvGoStartLocal, -1, gp.goid)
+	if pp.gcMarkWorkerMode != gcMarkWorkerNotWorker {
+		traceEventLocked(0, mp, pid, bufp, traceEvGoStartLabel, 0, -1, gp.goid, gp.trace.seq, trace.markWorkerLabels[mp.trace.gen%2][pp.gcMarkWorkerMode])
+	} else if gp.trace.lastP.ptr() == pp {
+		traceEventLocked(0, mp, pid, bufp, traceEvGoStartLocal, 0, -1, gp.goid)
 	} else {
-		gp.trace.lastP = pp
-		traceEvent(traceEvGoStart, -1, gp.goid, gp.trace.seq)
+		gp.trace.lastP.set(pp)
+		traceEventLocked(0, mp, pid, bufp, traceEvGoStart, 0, -1, gp.goid, gp.trace.seq)
 	}
+	pp.trace.g.set(gp)
 }
 
 func traceGoEnd() {
 	traceEvent(traceEvGoEnd, -1)
+	getg().m.p.ptr().trace.g = 0
 }
 
 func traceGoSched() {
 	gp := getg()
 	gp.trace.lastP = gp.m.p
 	traceEvent(traceEvGoSched, 1)
+	gp.m.p.ptr().trace.g = 0
 }
 
 func traceGoPreempt() {
 	gp := getg()
 	gp.trace.lastP = gp.m.p
 	traceEvent(traceEvGoPreempt, 1)
+	gp.m.p.ptr().trace.g = 0
 }
 
 func traceGoPark(reason traceBlockReason, skip int) {
 	// Convert the block reason directly to a trace event type.
 	// See traceBlockReason for more information.
 	traceEvent(byte(reason), skip)
+	getg().m.p.ptr().trace.g = 0
 }
 
 func traceGoUnpark(gp *g, skip int) {
-	pp := getg().m.p
+	mp, pid, bufp, ok := traceAcquireGoBuffer()
+	if !ok {
+		return
+	}
+	pp := mp.p
+	traceGoStatusLocked(mp, pid, bufp, gp, _Gwaiting)
+	// Unlike traceEvent, don't add a frame to skip: traceEventLocked
+	// is called directly here.
 	gp.trace.seq++
 	if gp.trace.lastP == pp {
-		traceEvent(traceEvGoUnblockLocal, skip, gp.goid)
+		traceEventLocked(0, mp, pid, bufp, traceEvGoUnblockLocal, 0, skip, gp.goid)
 	} else {
 		gp.trace.lastP = pp
-		traceEvent(traceEvGoUnblock, skip, gp.goid, gp.trace.seq)
+		traceEventLocked(0, mp, pid, bufp, traceEvGoUnblock, 0, skip, gp.goid, gp.trace.seq)
 	}
+	traceReleaseBuffer(mp, pid)
 }
 
 func traceGoSysCall() {
@@ -1652,7 +2113,12 @@ func traceGoSysExit() {
 	}
 	gp.trace.tracedSyscallEnter = false
 	ts := gp.trace.sysExitTime
-	if ts != 0 && ts < trace.startTime {
+	gp.trace.sysExitTime = 0
+	mp, pid, bufp, ok := traceAcquireGoBuffer()
+	if !ok {
+		return
+	}
+	if ts != 0 && ts < trace.genStartTime[mp.trace.gen%2] {
 		// There is a race between the code that initializes sysExitTimes
 		// (in exitsyscall, which runs without a P, and therefore is not
 		// stopped with the rest of the world) and the code that initializes
@@ -1664,10 +2130,15 @@ func traceGoSysExit() {
 		// aka right now), and assign a fresh time stamp to keep the log consistent.
 		ts = 0
 	}
-	gp.trace.sysExitTime = 0
+	if traceGoStatusLocked(mp, pid, bufp, gp, _Gsyscall) && ts != 0 {
+		// The syscall may have returned before EvGoInSyscall,
+		// which was just written.
+		ts = 0
+	}
 	gp.trace.seq++
-	gp.trace.lastP = gp.m.p
-	traceEvent(traceEvGoSysExit, -1, gp.goid, gp.trace.seq, uint64(ts))
+	gp.trace.lastP = mp.p
+	traceEventLocked(0, mp, pid, bufp, traceEvGoSysExit, 0, -1, gp.goid, gp.trace.seq, uint64(ts))
+	traceReleaseBuffer(mp, pid)
 }
 
 func traceGoSysBlock(pp *p) {
@@ -1677,6 +2148,7 @@ func traceGoSysBlock(pp *p) {
 	oldp := mp.p
 	mp.p.set(pp)
 	traceEvent(traceEvGoSysBlock, -1)
+	pp.trace.g = 0
 	mp.p = oldp
 	releasem(mp)
 }
@@ -1711,7 +2183,7 @@ func trace_userTaskCreate(id, parentID uint64, taskType string) {
 		return
 	}
 
-	typeStringID, bufp := traceString(bufp, pid, taskType)
+	typeStringID, bufp := traceString(mp.trace.gen, bufp, pid, taskType)
 	traceEventLocked(0, mp, pid, bufp, traceEvUserTaskCreate, 0, 3, id, parentID, typeStringID)
 	traceReleaseBuffer(mp, pid)
 }
@@ -1733,7 +2205,7 @@ func trace_userRegion(id, mode uint64, name string) {
 		return
 	}
 
-	nameStringID, bufp := traceString(bufp, pid, name)
+	nameStringID, bufp := traceString(mp.trace.gen, bufp, pid, name)
 	traceEventLocked(0, mp, pid, bufp, traceEvUserRegion, 0, 3, id, mode, nameStringID)
 	traceReleaseBuffer(mp, pid)
 }
@@ -1750,7 +2222,7 @@ func trace_userLog(id uint64, category, message string) {
 		return
 	}
 
-	categoryID, bufp := traceString(bufp, pid, category)
+	categoryID, bufp := traceString(mp.trace.gen, bufp, pid, category)
 
 	// The log message is recorded after all of the normal trace event
 	// arguments, including the task, category, and stack IDs. We must ask
@@ -1772,6 +2244,41 @@ func trace_userLog(id uint64, category, message string) {
 	traceReleaseBuffer(mp, pid)
 }
 
+// trace_advanceGeneration ends the current generation of the trace, so
+// that everything traced so far can be read. It returns the generation
+// that ended, or 0 if tracing is disabled.
+//
+// Unlike traceAdvance, it doesn't give up if the reader is still reading
+// the previous generation, but waits for it.
+//
+//go:linkname trace_advanceGeneration runtime/trace.advanceGeneration
+func trace_advanceGeneration() uint64 {
+	lock(&trace.bufLock)
+	enabled, session, gen := trace.enabled, trace.session, trace.gen.Load()
+	unlock(&trace.bufLock)
+	if !enabled {
+		return 0
+	}
+	for trace.gen.Load() == gen {
+		if !traceAdvance(session) {
+			return 0
+		}
+		if trace.gen.Load() == gen {
+			timeSleep(1e6)
+		}
+	}
+	return gen
+}
+
+// trace_readingGeneration returns the generation of the trace that the
+// data returned by ReadTrace belongs to. It must be called by the reader.
+//
+//go:linkname trace_readingGeneration runtime/trace.readingGeneration
+func trace_readingGeneration() uint64 {
+	// Only the reader changes trace.readGen.
+	return trace.readGen
+}
+
 // the start PC of a goroutine for tracing purposes. If pc is a wrapper,
 // it returns the PC of the wrapped function. Otherwise it returns pc.
 func startPCforTrace(pc uintptr) uintptr {
@@ -0,0 +1,351 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package trace
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// FlightRecorderConfig is the configuration of a [FlightRecorder].
+type FlightRecorderConfig struct {
+	// MinAge is the minimum amount of recent history that the flight
+	// recorder tries to keep. It defaults to 10 seconds.
+	//
+	// The flight recorder keeps somewhat more than MinAge of trace
+	// data, to ensure that a snapshot taken at any time covers at
+	// least MinAge, unless that would exceed MaxBytes.
+	MinAge time.Duration
+
+	// MaxBytes is the maximum amount of trace data that the flight
+	// recorder keeps in memory. It takes precedence over MinAge.
+	// It defaults to 10 MiB.
+	MaxBytes uint64
+}
+
+// A FlightRecorder continuously records the execution trace of the
+// program into an in-memory ring buffer that holds the most recent
+// part of the trace, and writes that part out on request.
+//
+// This makes it possible to trace a program all the time and only
+// keep the trace around rare events of interest, such as a request
+// that takes longer than expected. For example:
+//
+//	fr := trace.NewFlightRecorder(trace.FlightRecorderConfig{MinAge: 5 * time.Second})
+//	fr.Start()
+//	...
+//	if elapsed > slo {
+//		fr.WriteTo(f)
+//	}
+//
+// The flight recorder keeps a single trace running, and retains its
+// most recent generations. The runtime splits a trace into generations
+// that can each be read on their own, and the flight recorder starts a
+// new one as often as needed to drop old trace data in small steps.
+// A snapshot written by WriteTo is the retained generations written
+// one after another, which `go tool trace` reads as a single trace.
+//
+// While a flight recorder is running, tracing is enabled, and [Start]
+// fails. At most one flight recorder can run at a time. If tracing is
+// stopped by a direct call to [runtime.StopTrace], the flight recorder
+// stops, and [FlightRecorder.WriteTo] and [FlightRecorder.Stop] report
+// the error.
+type FlightRecorder struct {
+	minAge   time.Duration
+	maxBytes uint64
+
+	// full is signaled by the reader when the current generation
+	// holds enough data that a new one should start.
+	full chan struct{}
+
+	// mu protects the fields below. If both are needed, tracing
+	// must be locked before mu. cond is signaled when a generation
+	// completes and when the reader exits.
+	mu      sync.Mutex
+	cond    sync.Cond
+	running bool
+	reading bool          // the reader has not seen the end of the trace yet
+	stop    chan struct{} // closed to stop the rotator
+	read    chan struct{} // closed when the reader exits
+	cur     *generation   // generation being read
+	done    []*generation // completed generations, oldest first
+	doneGen uint64        // last completed generation
+	err     error         // error that stopped the flight recorder, if any
+}
+
+// generation is one generation of the trace recorded by a flight
+// recorder.
+type generation struct {
+	gen        uint64
+	start, end time.Time
+	data       []byte
+}
+
+// NewFlightRecorder creates a new flight recorder with the given
+// configuration. The flight recorder does not record anything until
+// it is started.
+func NewFlightRecorder(cfg FlightRecorderConfig) *FlightRecorder {
+	fr := &FlightRecorder{
+		minAge:   cfg.MinAge,
+		maxBytes: cfg.MaxBytes,
+		full:     make(chan struct{}, 1),
+	}
+	fr.cond.L = &fr.mu
+	if fr.minAge <= 0 {
+		fr.minAge = 10 * time.Second
+	}
+	if fr.maxBytes == 0 {
+		fr.maxBytes = 10 << 20
+	}
+	return fr
+}
+
+// Start starts the flight recorder. It returns an error if tracing is
+// already enabled, either by [Start] or by another flight recorder.
+func (fr *FlightRecorder) Start() error {
+	tracing.Lock()
+	defer tracing.Unlock()
+	fr.mu.Lock()
+	running, read := fr.running, fr.read
+	fr.mu.Unlock()
+
+	if running {
+		return errors.New("flight recorder is already running")
+	}
+	// If the flight recorder stopped on its own, its reader may not
+	// have exited yet.
+	if read != nil {
+		<-read
+	}
+	if err := runtime.StartTrace(); err != nil {
+		return err
+	}
+
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	fr.running = true
+	fr.reading = true
+	fr.stop = make(chan struct{})
+	fr.read = make(chan struct{})
+	fr.cur = nil
+	fr.done = nil
+	fr.doneGen = 0
+	fr.err = nil
+	// Drop any request for a new generation left from an earlier run.
+	select {
+	case <-fr.full:
+	default:
+	}
+	go fr.reader(fr.read)
+	go fr.rotator(fr.stop, fr.read)
+	tracing.recorder = fr
+	tracing.enabled.Store(true)
+	return nil
+}
+
+// Stop stops the flight recorder and discards the recorded trace.
+// It does nothing if the flight recorder is not running. If the flight
+// recorder stopped on its own because of an error, Stop returns that
+// error.
+func (fr *FlightRecorder) Stop() error {
+	tracing.Lock()
+	defer tracing.Unlock()
+	fr.mu.Lock()
+	running, read := fr.running, fr.read
+	if running {
+		fr.running = false
+		close(fr.stop)
+	}
+	err := fr.err
+	fr.err = nil
+	fr.mu.Unlock()
+	if !running {
+		return err
+	}
+	tracing.recorder = nil
+	tracing.enabled.Store(false)
+
+	runtime.StopTrace()
+	<-read
+	fr.mu.Lock()
+	fr.cur = nil
+	fr.done = nil
+	fr.mu.Unlock()
+	return nil
+}
+
+// Enabled reports whether the flight recorder is running.
+func (fr *FlightRecorder) Enabled() bool {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	return fr.running
+}
+
+// WriteTo writes a snapshot of the recent execution trace to w. The
+// snapshot covers at least the last MinAge of execution, unless that
+// needs more than MaxBytes, or the flight recorder was started more
+// recently. It returns an error if the flight recorder is not running,
+// or the error that stopped it.
+func (fr *FlightRecorder) WriteTo(w io.Writer) (n int64, err error) {
+	tracing.Lock()
+	fr.mu.Lock()
+	running, err := fr.running, fr.err
+	fr.mu.Unlock()
+	if !running {
+		tracing.Unlock()
+		if err != nil {
+			return 0, err
+		}
+		return 0, errors.New("flight recorder is not running")
+	}
+	// Complete the current generation, so that the snapshot includes
+	// everything up to now, and wait for the reader to get all of it.
+	gen := advanceGeneration()
+	fr.mu.Lock()
+	for gen != 0 && fr.doneGen < gen && fr.reading {
+		fr.cond.Wait()
+	}
+	if gen == 0 || fr.doneGen < gen {
+		err := fr.fail()
+		fr.mu.Unlock()
+		tracing.Unlock()
+		return 0, err
+	}
+	gens := append([]*generation(nil), fr.done...)
+	fr.mu.Unlock()
+	tracing.Unlock()
+
+	// Completed generations are never modified, so they can be
+	// written out without holding any locks.
+	for _, g := range gens {
+		m, err := w.Write(g.data)
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// rotator periodically starts a new generation of the trace, until
+// stop is closed. If the trace ends before that, which is when read is
+// closed, it stops the flight recorder.
+func (fr *FlightRecorder) rotator(stop, read chan struct{}) {
+	// Starting a new generation twice per MinAge keeps the amount of
+	// trace data beyond MinAge that has to be retained low, without
+	// doing it too often.
+	period := fr.minAge / 2
+	if period < time.Millisecond {
+		period = time.Millisecond
+	}
+	t := time.NewTicker(period)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-read:
+			tracing.Lock()
+			fr.mu.Lock()
+			if fr.running && fr.read == read {
+				fr.fail()
+			}
+			fr.mu.Unlock()
+			tracing.Unlock()
+			return
+		case <-t.C:
+		case <-fr.full:
+		}
+		tracing.Lock()
+		if fr.Enabled() {
+			advanceGeneration()
+		}
+		tracing.Unlock()
+	}
+}
+
+// fail stops the flight recorder after its trace was stopped by a call
+// to runtime.StopTrace that bypassed it, and keeps the error for WriteTo
+// and Stop. tracing and fr.mu must be locked, and the flight recorder
+// must be running.
+func (fr *FlightRecorder) fail() error {
+	fr.err = errors.New("flight recorder stopped: tracing was stopped by runtime.StopTrace")
+	fr.running = false
+	fr.done = nil
+	close(fr.stop)
+	tracing.recorder = nil
+	tracing.enabled.Store(false)
+	return fr.err
+}
+
+// reader reads the trace into generations until the trace ends, and
+// then closes read.
+func (fr *FlightRecorder) reader(read chan struct{}) {
+	defer close(read)
+	for {
+		data := runtime.ReadTrace()
+		fr.mu.Lock()
+		if data == nil {
+			fr.reading = false
+			fr.cond.Broadcast()
+			fr.mu.Unlock()
+			return
+		}
+		// The data of a generation is complete when the reader moves
+		// on to the next one.
+		if gen := readingGeneration(); fr.cur == nil || fr.cur.gen != gen {
+			if fr.cur != nil {
+				fr.complete(fr.cur)
+			}
+			fr.cur = &generation{gen: gen, start: time.Now()}
+		}
+		fr.cur.data = append(fr.cur.data, data...)
+		if uint64(len(fr.cur.data)) >= fr.maxBytes/2 {
+			select {
+			case fr.full <- struct{}{}:
+			default:
+			}
+		}
+		fr.mu.Unlock()
+	}
+}
+
+// complete adds g to the completed generations. fr.mu must be locked.
+func (fr *FlightRecorder) complete(g *generation) {
+	g.end = time.Now()
+	fr.doneGen = g.gen
+	fr.cond.Broadcast()
+	if !fr.running {
+		return
+	}
+	fr.done = append(fr.done, g)
+
+	// Drop the oldest generations that are not needed to cover MinAge,
+	// or that do not fit in MaxBytes. The newest generation is always
+	// kept.
+	var size uint64
+	i := len(fr.done) - 1
+	for ; i >= 0; i-- {
+		d := fr.done[i]
+		if i < len(fr.done)-1 && (g.end.Sub(fr.done[i+1].start) >= fr.minAge || size+uint64(len(d.data)) > fr.maxBytes) {
+			break
+		}
+		size += uint64(len(d.data))
+	}
+	fr.done = fr.done[i+1:]
+}
+
+// advanceGeneration and readingGeneration are defined in runtime/trace.go.
+
+// advanceGeneration ends the current generation of the trace, and
+// returns it, or 0 if tracing is disabled.
+func advanceGeneration() uint64
+
+// readingGeneration returns the generation of the trace that the data
+// returned by runtime.ReadTrace belongs to.
+func readingGeneration() uint64
@@ -0,0 +1,243 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package trace_test
+
+import (
+	"bytes"
+	"context"
+	"internal/trace"
+	"runtime"
+	. "runtime/trace"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlightRecorder(t *testing.T) {
+	if IsEnabled() {
+		t.Skip("skipping because -test.trace is set")
+	}
+	fr := NewFlightRecorder(FlightRecorderConfig{MinAge: time.Second})
+	if err := fr.Start(); err != nil {
+		t.Fatalf("failed to start flight recorder: %v", err)
+	}
+	defer fr.Stop()
+	if err := fr.Start(); err == nil {
+		t.Fatalf("succeeded to start flight recorder second time")
+	}
+	if err := Start(new(bytes.Buffer)); err == nil {
+		t.Fatalf("succeeded to start tracing while flight recorder is running")
+	}
+	Stop() // Must not stop the flight recorder.
+	if !IsEnabled() || !fr.Enabled() {
+		t.Fatalf("flight recorder stopped by Stop")
+	}
+
+	Log(context.Background(), "flightrecorder", "before")
+	buf := new(bytes.Buffer)
+	if _, err := fr.WriteTo(buf); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+	Log(context.Background(), "flightrecorder", "after")
+	saveTrace(t, buf, "TestFlightRecorder")
+	events, _ := parseTrace(t, buf)
+	var before, after bool
+	for _, ev := range events {
+		if ev.Type == trace.EvUserLog && ev.SArgs[0] == "flightrecorder" {
+			before = before || ev.SArgs[1] == "before"
+			after = after || ev.SArgs[1] == "after"
+		}
+	}
+	if !before {
+		t.Errorf("snapshot is missing event logged before it was taken")
+	}
+	if after {
+		t.Errorf("snapshot contains event logged after it was taken")
+	}
+
+	fr.Stop()
+	if IsEnabled() || fr.Enabled() {
+		t.Fatalf("tracing still enabled after flight recorder was stopped")
+	}
+	if _, err := fr.WriteTo(new(bytes.Buffer)); err == nil {
+		t.Fatalf("succeeded to write snapshot of stopped flight recorder")
+	}
+}
+
+func TestFlightRecorderStopTrace(t *testing.T) {
+	if IsEnabled() {
+		t.Skip("skipping because -test.trace is set")
+	}
+	fr := NewFlightRecorder(FlightRecorderConfig{MinAge: time.Hour})
+	if err := fr.Start(); err != nil {
+		t.Fatalf("failed to start flight recorder: %v", err)
+	}
+	defer fr.Stop()
+
+	// Stop tracing behind the flight recorder's back.
+	runtime.StopTrace()
+
+	if _, err := fr.WriteTo(new(bytes.Buffer)); err == nil {
+		t.Fatalf("succeeded to write snapshot after tracing was stopped")
+	}
+	if IsEnabled() || fr.Enabled() {
+		t.Fatalf("flight recorder still enabled after tracing was stopped")
+	}
+	if _, err := fr.WriteTo(new(bytes.Buffer)); err == nil {
+		t.Fatalf("second WriteTo succeeded after tracing was stopped")
+	}
+	if err := fr.Stop(); err == nil {
+		t.Fatalf("Stop succeeded after tracing was stopped")
+	}
+	if err := fr.Stop(); err != nil {
+		t.Fatalf("second Stop returned %v, want nil", err)
+	}
+
+	if err := fr.Start(); err != nil {
+		t.Fatalf("failed to restart flight recorder: %v", err)
+	}
+	if err := fr.Stop(); err != nil {
+		t.Fatalf("Stop returned %v", err)
+	}
+}
+
+func TestFlightRecorderMinAge(t *testing.T) {
+	if IsEnabled() {
+		t.Skip("skipping because -test.trace is set")
+	}
+	if testing.Short() {
+		t.Skip("skipping in -short mode")
+	}
+	const minAge = 100 * time.Millisecond
+	fr := NewFlightRecorder(FlightRecorderConfig{MinAge: minAge})
+	if err := fr.Start(); err != nil {
+		t.Fatalf("failed to start flight recorder: %v", err)
+	}
+	defer fr.Stop()
+
+	// Keep some goroutines busy across many generations.
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := make(chan int)
+			go func() {
+				for range c {
+				}
+			}()
+			for ctx.Err() == nil {
+				c <- 1
+				time.Sleep(time.Millisecond)
+			}
+			close(c)
+		}()
+	}
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	Log(ctx, "flightrecorder", "old")
+	time.Sleep(10 * minAge)
+	Log(ctx, "flightrecorder", "new")
+	time.Sleep(minAge / 2)
+
+	buf := new(bytes.Buffer)
+	if _, err := fr.WriteTo(buf); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+	saveTrace(t, buf, "TestFlightRecorderMinAge")
+	events, _ := parseTrace(t, buf)
+	if d := time.Duration(events[len(events)-1].Ts - events[0].Ts); d < minAge*9/10 {
+		t.Errorf("snapshot covers %v, want at least %v", d, minAge)
+	}
+	var old, new bool
+	for _, ev := range events {
+		if ev.Type == trace.EvUserLog && ev.SArgs[0] == "flightrecorder" {
+			old = old || ev.SArgs[1] == "old"
+			new = new || ev.SArgs[1] == "new"
+		}
+	}
+	if old {
+		t.Errorf("snapshot contains event older than its age")
+	}
+	if !new {
+		t.Errorf("snapshot is missing recent event")
+	}
+}
+
+func TestFlightRecorderSegmentState(t *testing.T) {
+	if IsEnabled() {
+		t.Skip("skipping because -test.trace is set")
+	}
+	// A goroutine that blocks in one segment and is unblocked before
+	// the next one starts must not appear to start running again
+	// without being unblocked.
+	for i := 0; ; i++ {
+		buf := new(bytes.Buffer)
+		if err := Start(buf); err != nil {
+			t.Fatalf("failed to start tracing: %v", err)
+		}
+		ready := make(chan bool)
+		unblock := make(chan bool)
+		done := make(chan bool)
+		var stop atomic.Bool
+		go func() {
+			ready <- true
+			Log(context.Background(), "flightrecorder", "blocking")
+			<-unblock
+			for !stop.Load() {
+			}
+			close(done)
+		}()
+		<-ready
+		time.Sleep(10 * time.Millisecond)
+		Stop()
+
+		unblock <- true
+		if err := Start(buf); err != nil {
+			t.Fatalf("failed to start tracing: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+		stop.Store(true)
+		<-done
+		Stop()
+
+		saveTrace(t, buf, "TestFlightRecorderSegmentState")
+		events, _ := parseTrace(t, buf)
+		var g uint64
+		for _, ev := range events {
+			if ev.Type == trace.EvUserLog && ev.SArgs[0] == "flightrecorder" {
+				g = ev.G
+			}
+		}
+		blocked, sawBlock := false, false
+		for _, ev := range events {
+			switch ev.Type {
+			case trace.EvGoBlockRecv:
+				if ev.G == g {
+					blocked, sawBlock = true, true
+				}
+			case trace.EvGoUnblock:
+				if ev.Args[0] == g {
+					blocked = false
+				}
+			case trace.EvGoStart, trace.EvGoStartLabel:
+				if ev.G == g && blocked {
+					t.Fatalf("goroutine %d started at offset 0x%x while blocked", g, ev.Off)
+				}
+			}
+		}
+		if sawBlock {
+			break
+		}
+		if i == 10 {
+			t.Skip("goroutine did not block while tracing")
+		}
+	}
+}
@@ -140,9 +140,13 @@ func Start(w io.Writer) error {
 
 // Stop stops the current tracing, if any.
 // Stop only returns after all the writes for the trace have completed.
+// Stop does not stop a running [FlightRecorder].
 func Stop() {
 	tracing.Lock()
 	defer tracing.Unlock()
+	if tracing.recorder != nil {
+		return
+	}
 	tracing.enabled.Store(false)
 
 	runtime.StopTrace()
@@ -151,4 +155,5 @@ func Stop() {
 var tracing struct {
 	sync.Mutex // gate mutators (Start, Stop)
 	enabled    atomic.Bool
+	recorder   *FlightRecorder // running flight recorder, if any
 }
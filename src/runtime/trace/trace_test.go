@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"internal/profile"
 	"internal/race"
+	"internal/testenv"
 	"internal/trace"
 	"io"
 	"net"
@@ -142,6 +143,55 @@ func TestTrace(t *testing.T) {
 	}
 }
 
+func TestTraceGenerations(t *testing.T) {
+	if IsEnabled() {
+		t.Skip("skipping because -test.trace is set")
+	}
+	if os.Getenv("GO_TEST_TRACE_GENERATIONS") == "" {
+		// Run the test in a subprocess that starts a new generation
+		// of the trace every 10ms.
+		testenv.MustHaveExec(t)
+		cmd := testenv.CleanCmdEnv(testenv.Command(t, os.Args[0], "-test.run=^TestTraceGenerations$"))
+		cmd.Env = append(cmd.Env, "GO_TEST_TRACE_GENERATIONS=1", "GODEBUG=traceadvanceperiod=10000000")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("subprocess failed: %v\n%s", err, out)
+		}
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	if err := Start(buf); err != nil {
+		t.Fatalf("failed to start tracing: %v", err)
+	}
+	c := make(chan int)
+	go func() {
+		for range c {
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		c <- i
+		time.Sleep(time.Millisecond)
+	}
+	close(c)
+	Stop()
+	saveTrace(t, buf, "TestTraceGenerations")
+
+	data := buf.Bytes()
+	header := []byte(" trace\x00\x00\x00")
+	if n := bytes.Count(data, header); n < 3 {
+		t.Fatalf("trace has %d generations, want at least 3", n)
+	}
+	events, _ := parseTrace(t, bytes.NewReader(data))
+
+	// A trace that is cut short is readable up to its last complete
+	// generation.
+	last := bytes.LastIndex(data, header)
+	truncated, _ := parseTrace(t, bytes.NewReader(data[:last+(len(data)-last)/2]))
+	if len(truncated) == 0 || len(truncated) >= len(events) {
+		t.Fatalf("truncated trace has %d events, want between 1 and %d", len(truncated), len(events)-1)
+	}
+}
+
 func parseTrace(t *testing.T, r io.Reader) ([]*trace.Event, map[uint64]*trace.GDesc) {
 	res, err := trace.Parse(r, "")
 	if err == trace.ErrTimeOrder {
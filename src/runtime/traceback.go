@@ -1207,6 +1207,58 @@ func goroutineheader(gp *g) {
 		print(", locked to thread")
 	}
 	print("]:\n")
+	printlabels(gp)
+}
+
+// printlabels prints the profiler labels of gp, sorted by key, on a line
+// of their own, if there are any and GODEBUG=tracebacklabels=1:
+//
+//	labels: {"request": "1234", "user": "gopher"}
+//
+// Keys and values are quoted like JSON strings.
+func printlabels(gp *g) {
+	if debug.tracebacklabels == 0 {
+		return
+	}
+	k, v, ok := nextLabel(gp, "", true)
+	if !ok {
+		return
+	}
+	print("labels: {")
+	for n := 0; ok; n++ {
+		if n > 0 {
+			print(", ")
+		}
+		printjsonstring(k)
+		print(": ")
+		printjsonstring(v)
+		k, v, ok = nextLabel(gp, k, false)
+	}
+	print("}\n")
+}
+
+// nextLabel returns the profiler label of gp with the smallest key
+// greater than after, or with the smallest key if first is set. ok is
+// false if there is no such label. Goroutines have few labels, so the
+// quadratic cost of sorting them this way does not matter, and unlike
+// sorting a copy, it does not allocate, so it can be used while crashing.
+func nextLabel(gp *g, after string, first bool) (key, value string, ok bool) {
+	// gp.labels is a *map[string]string set by runtime/pprof. Read the
+	// map directly, because mapiterinit and mapiternext have write
+	// barriers.
+	if gp.labels == nil {
+		return "", "", false
+	}
+	var labels map[string]string
+	t := (*maptype)(unsafe.Pointer(abi.TypeOf(labels)))
+	mapRangeNoWB(t, *(**hmap)(gp.labels), func(kp, vp unsafe.Pointer) {
+		k := *(*string)(kp)
+		if !first && k <= after || ok && k >= key {
+			return
+		}
+		key, value, ok = k, *(*string)(vp), true
+	})
+	return key, value, ok
 }
 
 func tracebackothers(me *g) {
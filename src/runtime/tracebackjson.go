@@ -0,0 +1,444 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"internal/abi"
+	"runtime/internal/sys"
+)
+
+// This file implements GODEBUG=tracebackjson=1, which makes the runtime
+// report an unrecovered panic or fatal error as a single line of JSON
+// instead of text. The format is documented in the package docs (see
+// extern.go) and by the types of internal/traceback, which can also
+// parse the text format into the same structure.
+//
+// Like the text traceback, everything here runs while crashing, so it
+// must not allocate. Strings are written with print while m.printjson
+// is set, which makes gwrite escape them.
+
+// dopanicJSON_m is like dopanic_m, but prints the whole crash report as
+// JSON. msgs is the chain of panics, if any, and fatalmsg is the fatal
+// error message, if any.
+func dopanicJSON_m(gp *g, pc, sp uintptr, msgs *_panic, fatalmsg string) bool {
+	level, all, docrash := gotraceback()
+
+	print("{")
+	comma := false
+	if fatalmsg != "" {
+		print(`"fatalError":`)
+		printjsonstring(fatalmsg)
+		comma = true
+	}
+	if msgs != nil {
+		if comma {
+			print(",")
+		}
+		print(`"panics":[`)
+		printpanicsJSON(msgs)
+		print("]")
+		comma = true
+	}
+	if gp.sig != 0 {
+		if comma {
+			print(",")
+		}
+		print(`"signal":{"name":`)
+		printjsonstring(signame(gp.sig))
+		print(`,"number":`, gp.sig, `,"code":`, gp.sigcode0, `,"addr":`, gp.sigcode1, `,"pc":`, gp.sigpc, "}")
+		comma = true
+	}
+	if level > 0 {
+		if gp != gp.m.curg {
+			all = true
+		}
+		if gp == gp.m.g0 && (level >= 2 || gp.m.throwing >= throwTypeRuntime) {
+			if comma {
+				print(",")
+			}
+			print(`"runtimeStack":{`)
+			tracebackJSON(pc, sp, 0, gp)
+			print("}")
+			comma = true
+		}
+		if comma {
+			print(",")
+		}
+		print(`"goroutines":[`)
+		n := 0
+		if gp != gp.m.g0 {
+			goroutineJSON(gp, pc, sp)
+			n++
+		}
+		if !didothers && all {
+			didothers = true
+			tracebackothersJSON(gp, n)
+		}
+		print("]")
+	}
+	print("}\n")
+
+	finishpanic_m()
+	return docrash
+}
+
+// printpanicsJSON prints the panics in the chain p as the elements of a
+// JSON array, oldest first. It reports whether it printed any.
+func printpanicsJSON(p *_panic) (printed bool) {
+	if p.link != nil {
+		printed = printpanicsJSON(p.link)
+	}
+	if p.goexit {
+		return printed
+	}
+	if printed {
+		print(",")
+	}
+	print(`{"value":`)
+	printjsonbegin()
+	printany(p.arg)
+	printjsonend()
+	if p.recovered {
+		print(`,"recovered":true`)
+	}
+	print("}")
+	return true
+}
+
+// tracebackothersJSON is like tracebackothers, but prints the goroutines
+// as the elements of a JSON array, n of which have already been printed.
+func tracebackothersJSON(me *g, n int) {
+	level, _, _ := gotraceback()
+
+	curgp := getg().m.curg
+	if curgp != nil && curgp != me {
+		if n > 0 {
+			print(",")
+		}
+		goroutineJSON(curgp, ^uintptr(0), ^uintptr(0))
+		n++
+	}
+
+	forEachGRace(func(gp *g) {
+		if gp == me || gp == curgp || readgstatus(gp) == _Gdead || isSystemGoroutine(gp, false) && level < 2 {
+			return
+		}
+		if n > 0 {
+			print(",")
+		}
+		goroutineJSON(gp, ^uintptr(0), ^uintptr(0))
+		n++
+	})
+}
+
+// goroutineJSON prints gp and its stack as a JSON object. It reports
+// the same information as goroutineheader and traceback.
+func goroutineJSON(gp *g, pc, sp uintptr) {
+	gpstatus := readgstatus(gp) &^ _Gscan
+	status := "???"
+	if gpstatus < uint32(len(gStatusStrings)) && gStatusStrings[gpstatus] != "" {
+		status = gStatusStrings[gpstatus]
+	}
+
+	print(`{"id":`, gp.goid, `,"status":`)
+	printjsonstring(status)
+	if gpstatus == _Gwaiting && gp.waitreason != waitReasonZero {
+		print(`,"waitReason":`)
+		printjsonstring(gp.waitreason.String())
+	}
+	if (gpstatus == _Gwaiting || gpstatus == _Gsyscall) && gp.waitsince != 0 {
+		print(`,"waitTime":`, nanotime()-gp.waitsince)
+	}
+	if gp.lockedm != 0 {
+		print(`,"lockedToThread":true`)
+	}
+	printlabelsJSON(gp)
+	print(",")
+	if gp.m != getg().m && gpstatus == _Grunning {
+		print(`"frames":[],"stackUnavailable":true`)
+	} else {
+		tracebackJSON(pc, sp, 0, gp)
+	}
+	printcreatedbyJSON(gp)
+	printancestorsJSON(gp)
+	print("}")
+}
+
+// printlabelsJSON prints the profiler labels of gp, if any, as a JSON
+// object member. Like printlabels, it prints them sorted by key.
+func printlabelsJSON(gp *g) {
+	k, v, ok := nextLabel(gp, "", true)
+	if !ok {
+		return
+	}
+	print(`,"labels":{`)
+	for n := 0; ok; n++ {
+		if n > 0 {
+			print(",")
+		}
+		printjsonstring(k)
+		print(":")
+		printjsonstring(v)
+		k, v, ok = nextLabel(gp, k, false)
+	}
+	print("}")
+}
+
+// printcreatedbyJSON prints the frame that created gp as a JSON object
+// member, if printcreatedby would print it.
+func printcreatedbyJSON(gp *g) {
+	pc := gp.gopc
+	f := findfunc(pc)
+	if !f.valid() || !showframe(f.srcFunc(), gp, false, abi.FuncIDNormal) || gp.goid == 1 {
+		return
+	}
+	tracepc := pc // back up to CALL instruction for funcline.
+	if pc > f.entry() {
+		tracepc -= sys.PCQuantum
+	}
+	file, line := funcline(f, tracepc)
+	print(`,"createdBy":`)
+	printframeJSON(funcname(f), file, int(line), pc, pc-f.entry(), false)
+	if gp.parentGoid != 0 {
+		print(`,"creatorID":`, gp.parentGoid)
+	}
+}
+
+// printancestorsJSON prints the ancestors of gp recorded with
+// GODEBUG=tracebackancestors=N or tracebackcreators=N, if any, as a JSON
+// object member. It reports the same information as printAncestorTraceback.
+func printancestorsJSON(gp *g) {
+	if gp.ancestors == nil || len(*gp.ancestors) == 0 {
+		return
+	}
+	print(`,"ancestors":[`)
+	for i, ancestor := range *gp.ancestors {
+		if i > 0 {
+			print(",")
+		}
+		print(`{"id":`, ancestor.goid, `,"frames":[`)
+		n := 0
+		for fidx, pc := range ancestor.pcs {
+			f := findfunc(pc) // f previously validated
+			if !showfuncinfo(f.srcFunc(), fidx == 0, abi.FuncIDNormal) {
+				continue
+			}
+			if n > 0 {
+				print(",")
+			}
+			n++
+			u, uf := newInlineUnwinder(f, pc, nil)
+			file, line := u.fileLine(uf)
+			printframeJSON(u.srcFunc(uf).name(), file, int(line), pc, pc-f.entry(), false)
+		}
+		print("]")
+		if len(ancestor.pcs) == tracebackInnerFrames {
+			print(`,"framesTruncated":true`)
+		}
+		f := findfunc(ancestor.gopc)
+		if f.valid() && showfuncinfo(f.srcFunc(), false, abi.FuncIDNormal) && ancestor.goid != 1 {
+			pc := ancestor.gopc
+			tracepc := pc // back up to CALL instruction for funcline.
+			if pc > f.entry() {
+				tracepc -= sys.PCQuantum
+			}
+			file, line := funcline(f, tracepc)
+			print(`,"createdBy":`)
+			printframeJSON(funcname(f), file, int(line), pc, pc-f.entry(), false)
+		}
+		print("}")
+	}
+	print("]")
+}
+
+// printframeJSON prints a stack frame as a JSON object.
+func printframeJSON(name, file string, line int, pc, offset uintptr, inlined bool) {
+	print(`{"func":`)
+	printjsonbegin()
+	printFuncName(name)
+	printjsonend()
+	print(`,"file":`)
+	printjsonstring(file)
+	print(`,"line":`, line, `,"pc":`, pc)
+	if inlined {
+		print(`,"inlined":true`)
+	} else {
+		print(`,"offset":`, offset)
+	}
+	print("}")
+}
+
+// tracebackJSON prints the stack of gp as the "frames" and
+// "elidedFrames" members of a JSON object. Like traceback1, it prints
+// only the innermost and outermost frames of very deep stacks, and
+// omits runtime frames unless that would leave nothing to print.
+func tracebackJSON(pc, sp, lr uintptr, gp *g) {
+	if readgstatus(gp)&^_Gscan == _Gsyscall {
+		// Override registers if blocked in system call.
+		pc = gp.syscallpc
+		sp = gp.syscallsp
+	}
+	if gp.m != nil && gp.m.vdsoSP != 0 {
+		// Override registers if running in VDSO. This comes after the
+		// _Gsyscall check to cover VDSO calls after entersyscall.
+		pc = gp.m.vdsoPC
+		sp = gp.m.vdsoSP
+	}
+
+	// Unlike traceback1, we walk the stack more than once: first to
+	// count the frames, then to print them, so that we don't have to
+	// reserve space for the elided frames in the middle. Unwinding
+	// errors are silent so that they don't corrupt the JSON.
+	const maxInt int = 0x7fffffff
+	var u unwinder
+	walk := func(showRuntime bool, skip, max int, printed *int) int {
+		u.initAt(pc, sp, lr, gp, unwindSilentErrors)
+		return tracebackJSON1(&u, showRuntime, skip, max, printed)
+	}
+	showRuntime := false
+	n := walk(showRuntime, 0, maxInt, nil)
+	if n == 0 {
+		showRuntime = true
+		n = walk(showRuntime, 0, maxInt, nil)
+	}
+
+	print(`"frames":[`)
+	printed := 0
+	elide := n - tracebackInnerFrames - tracebackOuterFrames
+	if elide <= 0 {
+		walk(showRuntime, 0, maxInt, &printed)
+	} else {
+		walk(showRuntime, 0, tracebackInnerFrames, &printed)
+		walk(showRuntime, tracebackInnerFrames+elide, tracebackOuterFrames, &printed)
+	}
+	print("]")
+	if elide > 0 {
+		print(`,"elidedFrames":`, elide)
+	}
+}
+
+// tracebackJSON1 is like traceback2: it skips the first "skip" logical
+// frames starting at u and then prints at most "max" of them as the
+// elements of a JSON array. It returns the number of frames skipped and
+// printed. If printed is nil, it only counts the frames; otherwise
+// *printed is the number of array elements already printed.
+func tracebackJSON1(u *unwinder, showRuntime bool, skip, max int, printed *int) (n int) {
+	gp := u.g.ptr()
+	var cgoBuf [32]uintptr
+	for ; u.valid() && max > 0; u.next() {
+		f := u.frame.fn
+		for iu, uf := newInlineUnwinder(f, u.symPC(), noEscapePtr(&u.cache)); uf.valid() && max > 0; uf = iu.next(uf) {
+			sf := iu.srcFunc(uf)
+			callee := u.calleeFuncID
+			u.calleeFuncID = sf.funcID
+			if !(showRuntime || showframe(sf, gp, n == 0, callee)) {
+				continue
+			}
+			n++
+			if skip > 0 {
+				skip--
+				continue
+			}
+			max--
+			if printed == nil {
+				continue
+			}
+			if *printed > 0 {
+				print(",")
+			}
+			*printed++
+			file, line := iu.fileLine(uf)
+			printframeJSON(sf.name(), file, line, u.frame.pc, u.frame.pc-f.entry(), iu.isInlined(uf))
+		}
+
+		cgoN := u.cgoCallers(cgoBuf[:])
+		for _, pc := range cgoBuf[:cgoN] {
+			if max == 0 {
+				break
+			}
+			n++
+			if skip > 0 {
+				skip--
+				continue
+			}
+			max--
+			if printed == nil {
+				continue
+			}
+			if *printed > 0 {
+				print(",")
+			}
+			*printed++
+			print(`{"func":"","file":"","line":0,"pc":`, pc, `,"cgo":true}`)
+		}
+	}
+	return n
+}
+
+// printjsonstring prints s as a JSON string.
+func printjsonstring(s string) {
+	printjsonbegin()
+	print(s)
+	printjsonend()
+}
+
+// printjsonbegin starts a JSON string. Until the matching printjsonend,
+// everything printed by this M is escaped as the contents of the string.
+func printjsonbegin() {
+	print(`"`)
+	getg().m.printjson = true
+}
+
+// printjsonend ends a JSON string started by printjsonbegin.
+func printjsonend() {
+	getg().m.printjson = false
+	print(`"`)
+}
+
+// printjsonescaped prints b escaped as the contents of a JSON string.
+// Invalid UTF-8 is replaced by U+FFFD.
+func printjsonescaped(b []byte) {
+	s := slicebytetostringtmp(&b[0], len(b))
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		var esc string
+		switch {
+		case c == '"':
+			esc = `\"`
+		case c == '\\':
+			esc = `\\`
+		case c == '\n':
+			esc = `\n`
+		case c == '\r':
+			esc = `\r`
+		case c == '\t':
+			esc = `\t`
+		case c < 0x20:
+			esc = `\u00`
+		case c >= runeSelf:
+			r, next := decoderune(s, i)
+			if r == runeError && next == i+1 {
+				esc = `\ufffd`
+				break
+			}
+			i = next
+			continue
+		default:
+			i++
+			continue
+		}
+		gwriteraw(b[start:i])
+		gwriteraw(bytes(esc))
+		if c < 0x20 && esc == `\u00` {
+			const hex = "0123456789abcdef"
+			gwriteraw(bytes(hex[c>>4 : c>>4+1]))
+			gwriteraw(bytes(hex[c&0xf : c&0xf+1]))
+		}
+		i++
+		start = i
+	}
+	gwriteraw(b[start:])
+}
@@ -0,0 +1,169 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime_test
+
+import (
+	"encoding/json"
+	tb "internal/traceback"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTracebackJSON checks that the JSON crash report printed with
+// GODEBUG=tracebackjson=1 has the same contents as the text report.
+func TestTracebackJSON(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		gotraceback string
+		godebug     string
+		check       func(t *testing.T, r *tb.Traceback)
+	}{
+		{"TracebackJSONPanic", "all", "tracebacklabels=1", func(t *testing.T, r *tb.Traceback) {
+			want := []tb.Panic{
+				{Value: "runtime error: invalid memory address or nil pointer dereference"},
+				{Value: "a \"quoted\"\tmessage\nspanning lines \x01"},
+			}
+			if !reflect.DeepEqual(r.Panics, want) {
+				t.Errorf("got panics %+v, want %+v", r.Panics, want)
+			}
+			if r.Signal == nil || !strings.HasPrefix(r.Signal.Name, "SIG") {
+				t.Errorf("got signal %+v, want a named signal", r.Signal)
+			}
+			var labeled bool
+			for _, g := range r.Goroutines {
+				if g.Labels["request"] == "a\"b" {
+					labeled = g.WaitReason == "chan receive" && g.CreatedBy != nil
+				}
+			}
+			if !labeled {
+				t.Errorf("no goroutine blocked in chan receive with profiler labels")
+			}
+		}},
+		{"TracebackJSONDeadlock", "single", "", func(t *testing.T, r *tb.Traceback) {
+			if r.FatalError != "all goroutines are asleep - deadlock!" {
+				t.Errorf("got fatal error %q", r.FatalError)
+			}
+			if len(r.Goroutines) != 1 || r.Goroutines[0].WaitReason != "select (no cases)" {
+				t.Errorf("got goroutines %+v, want one blocked in select", r.Goroutines)
+			}
+		}},
+		{"TracebackJSONDeep", "single", "", func(t *testing.T, r *tb.Traceback) {
+			if len(r.Goroutines) != 1 || r.Goroutines[0].ElidedFrames == 0 {
+				t.Errorf("got goroutines %+v, want one with elided frames", r.Goroutines)
+			}
+		}},
+		{"TracebackAncestry", "single", "tracebacklabels=1,tracebackcreators=3", checkTracebackAncestry},
+		{"TracebackAncestry", "single", "tracebacklabels=1,tracebackancestors=3", checkTracebackAncestry},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			env := []string{"GOTRACEBACK=" + test.gotraceback, "GODEBUG=" + test.godebug}
+			text := runTestProg(t, "testprog", test.name, env...)
+			fromText, err := tb.Parse([]byte(text))
+			if err != nil {
+				t.Fatalf("parsing text report: %v\n%s", err, text)
+			}
+
+			env[1] += ",tracebackjson=1"
+			out := runTestProg(t, "testprog", test.name, env...)
+			var line string
+			for _, l := range strings.Split(out, "\n") {
+				if strings.HasPrefix(l, "{") {
+					if line != "" {
+						t.Fatalf("more than one line of JSON:\n%s", out)
+					}
+					line = l
+				}
+			}
+			var fromJSON tb.Traceback
+			if err := json.Unmarshal([]byte(line), &fromJSON); err != nil {
+				t.Fatalf("decoding JSON report: %v\n%s", err, out)
+			}
+			test.check(t, &fromJSON)
+			if test.name == "TracebackJSONPanic" {
+				// Only the JSON form reports waits shorter than a minute.
+				for _, g := range fromJSON.Goroutines {
+					if g.WaitReason == "chan receive" && g.WaitTime <= 0 {
+						t.Errorf("goroutine %d blocked across two GCs has wait time %v", g.ID, g.WaitTime)
+					}
+				}
+			}
+
+			test.check(t, fromText)
+
+			labels := strings.Contains(test.godebug, "tracebacklabels=1")
+			normalizeTraceback(fromText, labels)
+			normalizeTraceback(&fromJSON, labels)
+			if !reflect.DeepEqual(fromText, &fromJSON) {
+				t.Errorf("text and JSON reports differ\ntext:\n%s\nJSON:\n%s", text, out)
+			}
+		})
+	}
+}
+
+func checkTracebackAncestry(t *testing.T, r *tb.Traceback) {
+	if len(r.Goroutines) != 1 {
+		t.Fatalf("got goroutines %+v, want one", r.Goroutines)
+	}
+	g := r.Goroutines[0]
+	if want := map[string]string{"request": "1234", "user": "gopher"}; !reflect.DeepEqual(g.Labels, want) {
+		t.Errorf("got labels %v, want %v", g.Labels, want)
+	}
+	if g.CreatedBy == nil || g.CreatedBy.Func != "main.tracebackAncestryServe" {
+		t.Errorf("got created by %+v, want main.tracebackAncestryServe", g.CreatedBy)
+	}
+	if len(g.Ancestors) != 2 {
+		t.Fatalf("got ancestors %+v, want two", g.Ancestors)
+	}
+	if a := g.Ancestors[0]; a.ID != g.CreatorID || a.CreatedBy == nil || !strings.HasPrefix(a.CreatedBy.Func, "main.TracebackAncestry") {
+		t.Errorf("got first ancestor %+v, want goroutine %d created by main.TracebackAncestry", a, g.CreatorID)
+	}
+	if a := g.Ancestors[1]; a.ID != 1 || a.CreatedBy != nil {
+		t.Errorf("got second ancestor %+v, want the main goroutine", a)
+	}
+}
+
+// normalizeTraceback clears the information that the text and JSON
+// reports don't both include, and sorts the goroutines by ID.
+func normalizeTraceback(r *tb.Traceback, labels bool) {
+	if r.Signal != nil && r.Signal.Name != "" {
+		r.Signal.Number = 0
+	}
+	stack := func(s *tb.Stack) {
+		for i := range s.Frames {
+			s.Frames[i].PC = 0
+		}
+		if len(s.Frames) == 0 {
+			s.Frames = nil
+		}
+	}
+	if r.RuntimeStack != nil {
+		stack(r.RuntimeStack)
+	}
+	for i := range r.Goroutines {
+		g := &r.Goroutines[i]
+		if !labels {
+			g.Labels = nil
+		}
+		// The text form only has whole minutes.
+		g.WaitTime = g.WaitTime.Truncate(time.Minute)
+		stack(&g.Stack)
+		if g.CreatedBy != nil {
+			g.CreatedBy.PC = 0
+		}
+		for j := range g.Ancestors {
+			a := &g.Ancestors[j]
+			stack(&tb.Stack{Frames: a.Frames})
+			if a.CreatedBy != nil {
+				a.CreatedBy.PC = 0
+			}
+		}
+	}
+	sort.Slice(r.Goroutines, func(i, j int) bool {
+		return r.Goroutines[i].ID < r.Goroutines[j].ID
+	})
+}
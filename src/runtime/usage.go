@@ -0,0 +1,218 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Per-goroutine resource usage accounting.
+//
+// Each goroutine counts the time it spends running and the heap memory
+// it allocates. When runtime/pprof label usage accounting is enabled,
+// a goroutine may also have a labelUsage, shared by all goroutines with
+// the same set of profiler labels. The goroutine adds its usage to the
+// labelUsage each time it stops running, and when it changes labels.
+// When label usage accounting stops, goroutines are not reset: each
+// labelUsage belongs to an epoch, and goroutines stop adding to those of
+// earlier epochs.
+//
+// Accounting costs a clock read on each transition into and out of
+// _Grunning, so it is off until the program first asks for usage, with
+// ReadGoroutineUsage or runtime/pprof label usage. It then stays on.
+// Usage before that is not counted.
+
+package runtime
+
+import (
+	"runtime/internal/atomic"
+	"unsafe"
+)
+
+// GoroutineUsage describes the resources used by a goroutine.
+type GoroutineUsage struct {
+	// RunningTime is the time, in nanoseconds, the goroutine spent
+	// running Go code. It does not include time spent in system
+	// calls, or waiting to be scheduled. It is not CPU time: it is
+	// measured with the runtime's monotonic clock when the goroutine
+	// starts and stops running, so it includes time the thread
+	// running the goroutine was descheduled by the operating system.
+	RunningTime int64
+
+	// AllocBytes is the cumulative number of bytes of heap objects
+	// allocated by the goroutine, as requested by each allocation.
+	AllocBytes uint64
+
+	// AllocObjects is the cumulative number of heap objects
+	// allocated by the goroutine.
+	AllocObjects uint64
+}
+
+// ReadGoroutineUsage populates u with the resources used so far by the
+// calling goroutine.
+//
+// Unlike ReadMemStats, it does not stop the world, and is cheap enough
+// to be called at the start and end of each request of a server, to
+// account for the resources used by the request.
+//
+// Goroutine usage is only accounted once the program first calls
+// ReadGoroutineUsage, or enables label usage in runtime/pprof, so that
+// programs that do not use it do not pay for it. Usage before that is
+// not included, so only differences between two calls are meaningful.
+func ReadGoroutineUsage(u *GoroutineUsage) {
+	gp := getg().m.curg
+	enableUsage(gp)
+	*u = gp.usage.read(true)
+}
+
+// usageEnabled is set once goroutine usage accounting is enabled.
+// Until then, the scheduler and the allocator don't account usage.
+var usageEnabled atomic.Bool
+
+// enableUsage enables goroutine usage accounting, if it isn't already.
+// gp is the calling goroutine, whose current run is then accounted
+// from now on.
+func enableUsage(gp *g) {
+	if !usageEnabled.Load() {
+		usageEnabled.Store(true)
+	}
+	if gp.usage.runningSince == 0 {
+		gp.usage.runningSince = nanotime()
+	}
+}
+
+// gUsage is the resource usage state of a goroutine. It is only
+// modified by the M running the goroutine, or with the goroutine
+// stopped.
+type gUsage struct {
+	runningSince int64 // nanotime when the goroutine last started running, or 0 if unknown
+	runningTime  int64 // not including the time since runningSince
+	allocBytes   uint64
+	allocObjects uint64
+
+	// labels is where the usage is accounted by label set, or nil.
+	// flushed is the usage already added to labels.
+	labels  *labelUsage
+	flushed GoroutineUsage
+}
+
+// labelUsage is the resource usage accounted to a label set.
+type labelUsage struct {
+	epoch        uint64 // labelUsageEpoch the label set was created in
+	runningTime  atomic.Int64
+	allocBytes   atomic.Uint64
+	allocObjects atomic.Uint64
+}
+
+// labelUsageEpoch is incremented each time runtime/pprof stops label
+// usage accounting.
+var labelUsageEpoch atomic.Uint64
+
+// current reports whether usage is still accounted to l.
+//
+//go:nosplit
+func (l *labelUsage) current() bool {
+	return l.epoch == labelUsageEpoch.Load()
+}
+
+// read returns the usage of the goroutine. running must be true if
+// the goroutine is running, to include the current run.
+//
+//go:nosplit
+func (u *gUsage) read(running bool) GoroutineUsage {
+	r := GoroutineUsage{
+		RunningTime:  u.runningTime,
+		AllocBytes:   u.allocBytes,
+		AllocObjects: u.allocObjects,
+	}
+	if running && u.runningSince != 0 {
+		r.RunningTime += nanotime() - u.runningSince
+	}
+	return r
+}
+
+// startRunning is called when the goroutine transitions to _Grunning,
+// if usage accounting is enabled.
+//
+//go:nosplit
+func (u *gUsage) startRunning() {
+	u.runningSince = nanotime()
+}
+
+// stopRunning is called when the goroutine transitions out of
+// _Grunning, if usage accounting is enabled. It adds the current run
+// to the running time of the goroutine, unless the run started before
+// accounting was enabled, and flushes the usage to its label set.
+//
+// This runs on the scheduler's paths, including entersyscall,
+// so it must not split the stack.
+//
+//go:nosplit
+func (u *gUsage) stopRunning() {
+	if u.runningSince != 0 {
+		u.runningTime += nanotime() - u.runningSince
+		u.runningSince = 0
+	}
+	if u.labels != nil {
+		u.flush(u.read(false))
+	}
+}
+
+// flush adds the usage cur not yet added to u.labels, unless label
+// usage accounting stopped since the goroutine set its labels. It
+// doesn't clear u.labels then, as it may run where write barriers are
+// not allowed.
+//
+//go:nosplit
+func (u *gUsage) flush(cur GoroutineUsage) {
+	if l := u.labels; l != nil && l.current() {
+		l.runningTime.Add(cur.RunningTime - u.flushed.RunningTime)
+		l.allocBytes.Add(int64(cur.AllocBytes - u.flushed.AllocBytes))
+		l.allocObjects.Add(int64(cur.AllocObjects - u.flushed.AllocObjects))
+	}
+	u.flushed = cur
+}
+
+// runtime_newLabelUsage returns a new label set for the label usage
+// accounting of epoch, as returned by runtime_stopLabelUsage.
+//
+//go:linkname runtime_newLabelUsage runtime/pprof.runtime_newLabelUsage
+func runtime_newLabelUsage(epoch uint64) unsafe.Pointer {
+	return unsafe.Pointer(&labelUsage{epoch: epoch})
+}
+
+// runtime_stopLabelUsage stops the accounting of usage to the current
+// label sets, and returns the epoch of the next ones.
+//
+//go:linkname runtime_stopLabelUsage runtime/pprof.runtime_stopLabelUsage
+func runtime_stopLabelUsage() uint64 {
+	return labelUsageEpoch.Add(1)
+}
+
+// runtime_setLabelUsage sets the label set where the usage of the
+// calling goroutine, and of the goroutines it creates, is accounted.
+//
+//go:linkname runtime_setLabelUsage runtime/pprof.runtime_setLabelUsage
+func runtime_setLabelUsage(p unsafe.Pointer) {
+	gp := getg().m.curg
+	u := &gp.usage
+	if u.labels == nil && p == nil {
+		return
+	}
+	enableUsage(gp)
+	u.flush(u.read(true))
+	u.labels = (*labelUsage)(p)
+}
+
+// runtime_readLabelUsage returns the usage accounted to a label set.
+// It includes the usage of the calling goroutine so far, but not the
+// usage of other goroutines since they last stopped running.
+//
+//go:linkname runtime_readLabelUsage runtime/pprof.runtime_readLabelUsage
+func runtime_readLabelUsage(p unsafe.Pointer) GoroutineUsage {
+	if u := &getg().m.curg.usage; u.labels != nil {
+		u.flush(u.read(true))
+	}
+	l := (*labelUsage)(p)
+	return GoroutineUsage{
+		RunningTime:  l.runningTime.Load(),
+		AllocBytes:   l.allocBytes.Load(),
+		AllocObjects: l.allocObjects.Load(),
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime_test
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+var usageSink []byte
+
+// usageEnabledAtInit is whether goroutine usage accounting was enabled
+// before any test ran.
+var usageEnabledAtInit = runtime.UsageEnabled()
+
+func TestGoroutineUsageOptIn(t *testing.T) {
+	if usageEnabledAtInit {
+		t.Errorf("goroutine usage accounting enabled before the first ReadGoroutineUsage")
+	}
+	var u runtime.GoroutineUsage
+	runtime.ReadGoroutineUsage(&u)
+	if !runtime.UsageEnabled() {
+		t.Errorf("goroutine usage accounting not enabled by ReadGoroutineUsage")
+	}
+}
+
+func TestReadGoroutineUsage(t *testing.T) {
+	var before, after runtime.GoroutineUsage
+	runtime.ReadGoroutineUsage(&before)
+
+	// Allocate.
+	const n, size = 1000, 1024
+	for i := 0; i < n; i++ {
+		usageSink = make([]byte, size)
+	}
+	// Run for a while.
+	start := time.Now()
+	for time.Since(start) < 20*time.Millisecond {
+	}
+	// Wait for a while, which should not count as running time.
+	time.Sleep(100 * time.Millisecond)
+
+	runtime.ReadGoroutineUsage(&after)
+	if d := after.AllocObjects - before.AllocObjects; d < n {
+		t.Errorf("got %d allocated objects, want at least %d", d, n)
+	}
+	if d := after.AllocBytes - before.AllocBytes; d < n*size {
+		t.Errorf("got %d allocated bytes, want at least %d", d, n*size)
+	}
+	if d := time.Duration(after.RunningTime - before.RunningTime); d < 10*time.Millisecond || d >= 100*time.Millisecond {
+		t.Errorf("got running time %v, want at least 10ms and less than the 100ms sleep", d)
+	}
+
+	// Other goroutines do not count.
+	runtime.ReadGoroutineUsage(&before)
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < n; i++ {
+			usageSink = make([]byte, size)
+		}
+		done <- true
+	}()
+	<-done
+	runtime.ReadGoroutineUsage(&after)
+	if d := after.AllocBytes - before.AllocBytes; d >= n*size {
+		t.Errorf("got %d allocated bytes, want fewer than the %d allocated by another goroutine", d, n*size)
+	}
+}
@@ -0,0 +1,17 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+The unique package provides facilities for canonicalizing ("interning")
+comparable values.
+
+Interning deduplicates equal values so that they share a single canonical
+copy. This can reduce memory use when many equal values are live at once,
+and lets callers compare values by comparing small handles instead of the
+values themselves.
+
+Canonical values are reclaimed by the garbage collector once no handle
+refers to them, so the intern table does not grow without bound.
+*/
+package unique
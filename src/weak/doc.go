@@ -0,0 +1,42 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package weak provides weak pointers with the goal of memory efficiency.
+The primary use-cases for weak pointers are for implementing caches,
+canonicalization maps, and for tying together
+the lifetimes of separate values (for example, through a map with weak
+keys).
+
+# Guarantees
+
+Weak pointers are cleared as soon as the garbage collector determines
+that the object they point to is unreachable, before any finalizer
+attached to that object runs. If the finalizer makes the object
+reachable again, weak pointers created before the object became
+unreachable remain nil, and new weak pointers to it are not equal to
+the old ones.
+
+Weak pointers to the same memory compare equal, and weak pointers made
+from distinct memory compare unequal, so long as the memory has not been
+freed. This makes weak pointers suitable for use as map keys.
+
+Weak pointers to different offsets within the same object, for example
+a pointer to a struct and a pointer to one of its fields, are distinct
+and compare unequal, but are cleared at the same time since they
+reference the same object.
+
+# Caveats
+
+Small objects that contain no pointers may be combined by the memory
+allocator into a single allocation, in which case they are not freed
+until all of them are unreachable. A weak pointer to such an object may
+therefore remain non-nil for longer than expected.
+
+Weak pointers do not keep the objects they reference alive, but if the
+object referenced by a weak pointer is itself referenced from a
+finalizer closure or a value reachable from it, the object will never
+be collected.
+*/
+package weak
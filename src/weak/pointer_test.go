@@ -0,0 +1,175 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package weak_test
+
+import (
+	"runtime"
+	"testing"
+	"weak"
+)
+
+type T struct {
+	// N.B. This must contain a pointer, otherwise the weak handle might get placed
+	// in a tiny block making the tests in this package flaky.
+	t *T
+	a int
+}
+
+func TestPointer(t *testing.T) {
+	bt := new(T)
+	wt := weak.Make(bt)
+	if st := wt.Value(); st != bt {
+		t.Fatalf("weak pointer is not the same as strong pointer: %p vs. %p", st, bt)
+	}
+	// bt is still referenced.
+	runtime.GC()
+
+	if st := wt.Value(); st != bt {
+		t.Fatalf("weak pointer is not the same as strong pointer after GC: %p vs. %p", st, bt)
+	}
+	// bt is no longer referenced.
+	runtime.GC()
+
+	if st := wt.Value(); st != nil {
+		t.Fatalf("expected weak pointer to be nil, got %p", st)
+	}
+}
+
+func TestPointerEquality(t *testing.T) {
+	bt := make([]*T, 10)
+	wt := make([]weak.Pointer[T], 10)
+	for i := range bt {
+		bt[i] = new(T)
+		wt[i] = weak.Make(bt[i])
+	}
+	for i := range bt {
+		st := wt[i].Value()
+		if st != bt[i] {
+			t.Fatalf("weak pointer is not the same as strong pointer: %p vs. %p", st, bt[i])
+		}
+		if wp := weak.Make(st); wp != wt[i] {
+			t.Fatalf("new weak pointer not equal to existing weak pointer: %v vs. %v", wp, wt[i])
+		}
+		if i == 0 {
+			continue
+		}
+		if wt[i] == wt[i-1] {
+			t.Fatalf("expected weak pointers to not be equal to each other, but got %v", wt[i])
+		}
+	}
+	// bt is still referenced.
+	runtime.GC()
+	for i := range bt {
+		st := wt[i].Value()
+		if st != bt[i] {
+			t.Fatalf("weak pointer is not the same as strong pointer: %p vs. %p", st, bt[i])
+		}
+		if wp := weak.Make(st); wp != wt[i] {
+			t.Fatalf("new weak pointer not equal to existing weak pointer: %v vs. %v", wp, wt[i])
+		}
+		if i == 0 {
+			continue
+		}
+		if wt[i] == wt[i-1] {
+			t.Fatalf("expected weak pointers to not be equal to each other, but got %v", wt[i])
+		}
+	}
+	bt = nil
+	// bt is no longer referenced.
+	runtime.GC()
+	for i := range wt {
+		st := wt[i].Value()
+		if st != nil {
+			t.Fatalf("expected weak pointer to be nil, got %p", st)
+		}
+		if i == 0 {
+			continue
+		}
+		if wt[i] == wt[i-1] {
+			t.Fatalf("expected weak pointers to not be equal to each other, but got %v", wt[i])
+		}
+	}
+}
+
+func TestPointerInteriorField(t *testing.T) {
+	bt := new(T)
+	wt := weak.Make(bt)
+	wa := weak.Make(&bt.a)
+	if wa.Value() != &bt.a {
+		t.Fatalf("interior weak pointer does not match strong pointer")
+	}
+	if weak.Make(&bt.a) != wa {
+		t.Fatalf("interior weak pointers to the same field are not equal")
+	}
+	runtime.KeepAlive(bt)
+	bt = nil
+	runtime.GC()
+	if wt.Value() != nil || wa.Value() != nil {
+		t.Fatalf("expected weak pointers to be nil after object became unreachable")
+	}
+}
+
+func TestPointerNil(t *testing.T) {
+	var zero weak.Pointer[T]
+	if p := zero.Value(); p != nil {
+		t.Fatalf("expected zero weak pointer to return nil, got %p", p)
+	}
+	if w := weak.Make[T](nil); w != zero {
+		t.Fatalf("expected weak pointer made from nil to equal the zero value")
+	}
+}
+
+var global T
+
+func TestPointerGlobal(t *testing.T) {
+	wt := weak.Make(&global)
+	runtime.GC()
+	if p := wt.Value(); p != &global {
+		t.Fatalf("weak pointer to global is not the same as strong pointer: %p vs. %p", p, &global)
+	}
+	if weak.Make(&global) != wt {
+		t.Fatalf("weak pointers to the same global are not equal")
+	}
+}
+
+func TestPointerFinalizer(t *testing.T) {
+	bt := new(T)
+	wt := weak.Make(bt)
+	done := make(chan struct{}, 1)
+	runtime.SetFinalizer(bt, func(bt *T) {
+		if wt.Value() != nil {
+			t.Errorf("weak pointer did not go nil before finalizer ran")
+		}
+		done <- struct{}{}
+	})
+
+	// Make sure the weak->strong conversion works while we're holding
+	// on to bt.
+	if st := wt.Value(); st != bt {
+		t.Fatalf("weak pointer is not the same as strong pointer: %p vs. %p", st, bt)
+	}
+	// bt is still referenced.
+	runtime.GC()
+	if st := wt.Value(); st != bt {
+		t.Fatalf("weak pointer is not the same as strong pointer after GC: %p vs. %p", st, bt)
+	}
+
+	// bt is no longer referenced.
+	//
+	// Run one cycle to queue the finalizer.
+	runtime.GC()
+	if st := wt.Value(); st != nil {
+		t.Fatalf("expected weak pointer to be nil after finalizer was queued, got %p", st)
+	}
+
+	// Wait for the finalizer to run.
+	<-done
+
+	// The weak pointer should still be nil after the finalizer runs.
+	runtime.GC()
+	if st := wt.Value(); st != nil {
+		t.Fatalf("expected weak pointer to be nil after finalizer ran, got %p", st)
+	}
+}
@@ -0,0 +1,143 @@
+// errorcheck -0 -m -goexperiment newinliner
+
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Test, using compiler diagnostic flags, that the heuristics of
+// GOEXPERIMENT=newinliner drive inlining decisions at call sites.
+// Compiles but does not run.
+
+package foo
+
+// mode's body is over the default budget, but calls that pass a
+// constant mode reduce it to a single case.
+func mode(m int, x int) int { // ERROR "can inline mode"
+	switch m {
+	case 0:
+		x = x*3 + 1
+		x ^= x >> 7
+		x = x*5 + 2
+		x ^= x >> 3
+		x = x*7 + 3
+		x ^= x >> 11
+	case 1:
+		x = x*11 + 4
+		x ^= x >> 5
+		x = x*13 + 5
+		x ^= x >> 9
+		x = x*17 + 6
+		x ^= x >> 2
+	case 2:
+		x = x*19 + 7
+		x ^= x >> 13
+		x = x*23 + 8
+		x ^= x >> 6
+		x = x*29 + 9
+		x ^= x >> 4
+	default:
+		x = x*31 + 10
+		x ^= x >> 8
+		x = x*37 + 11
+		x ^= x >> 12
+		x = x*41 + 12
+		x ^= x >> 1
+	}
+	return x
+}
+
+// Passing a constant mode folds away most of mode's body.
+func constMode(x int) int { // ERROR "can inline constMode"
+	return mode(1, x) // ERROR "inlining call to mode"
+}
+
+// Without a constant mode, mode is too large to inline.
+func varMode(m, x int) int { // ERROR "can inline varMode"
+	return mode(m, x)
+}
+
+type shape interface {
+	area() int
+}
+
+type square int
+
+func (s square) area() int { return int(s) * int(s) } // ERROR "can inline square\.area"
+
+// sum calls a method on s unconditionally, so callers that pass a
+// concrete value are credited with the call becoming direct.
+func sum(s shape, n int) int { // ERROR "can inline sum" "leaking param: s"
+	t := s.area()
+	for i := 0; i < n; i++ {
+		t ^= t >> 3
+		t += i * 7
+		t ^= t << 5
+		t += i * 11
+		t ^= t >> 2
+	}
+	return t
+}
+
+func sumSquares(n int) int { // ERROR "can inline sumSquares"
+	return sum(square(3), n) // ERROR "inlining call to sum" "devirtualizing s\.area to square" "square\(3\) does not escape"
+}
+
+func report(msg string, a, b, c int) string { // ERROR "can inline report" "leaking param: msg to result ~r0 level=0"
+	s := msg
+	if a > 0 {
+		s += " a"
+	}
+	if b > 0 {
+		s += " b"
+	}
+	if c > 0 {
+		s += " c"
+	}
+	if a+b+c > 10 {
+		s += " big"
+	}
+	if a*b*c > 100 {
+		s += " huge"
+	}
+	return s
+}
+
+// report is small enough to inline normally, but not on a path that
+// ends in a panic.
+func check(ok bool, a, b, c int) { // ERROR "can inline check"
+	if !ok {
+		panic(report("check failed", a, b, c)) // ERROR "report\(.*\) escapes to heap"
+	}
+}
+
+var c0, c1, c2, c3 int
+
+// tick always returns false, so the condition testing its result in
+// ticker folds away once it is inlined.
+func tick(i int) bool { // ERROR "can inline tick"
+	c0 += i
+	c1 += c0 * 2
+	c2 += c1 * 3
+	c3 += c2 * 4
+	c0 ^= c1 >> 1
+	c1 ^= c2 >> 2
+	c2 ^= c3 >> 3
+	c3 ^= c0 >> 4
+	c0 += c3 * 5
+	c1 += c0 * 6
+	c2 += c1 * 7
+	c3 += c2 * 8
+	c0 ^= c1 >> 5
+	c1 ^= c2 >> 6
+	c2 ^= c3 >> 7
+	c3 ^= c0 >> 8
+	c0 += c3 * 9
+	return false
+}
+
+func ticker(i int) int { // ERROR "can inline ticker"
+	if tick(i) { // ERROR "inlining call to tick"
+		return 1
+	}
+	return 0
+}